@@ -0,0 +1,233 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/getsentry/sentry-go"
+	"github.com/rs/zerolog/log"
+)
+
+// AcknowledgementSource is where an acknowledgement was made.
+type AcknowledgementSource string
+
+const (
+	AcknowledgementSourceAPI      AcknowledgementSource = "api"
+	AcknowledgementSourceSlack    AcknowledgementSource = "slack"
+	AcknowledgementSourceDiscord  AcknowledgementSource = "discord"
+	AcknowledgementSourceTelegram AcknowledgementSource = "telegram"
+)
+
+// ErrNotDown is returned when acknowledging a monitor that has no ongoing outage.
+var ErrNotDown = errors.New("monitor has no ongoing outage")
+
+// Acknowledgement records that someone is looking into an outage. An outage can be acknowledged more than once,
+// for example by everyone who joins the investigation.
+type Acknowledgement struct {
+	MonitorID string `json:"monitor_id"`
+	// OutageStartedAt identifies the acknowledged outage, along with the monitor ID.
+	OutageStartedAt time.Time `json:"outage_started_at"`
+	// AcknowledgedBy is the name given to the API, or the user name on the chat platform.
+	AcknowledgedBy string                `json:"acknowledged_by"`
+	Source         AcknowledgementSource `json:"source"`
+	Comment        string                `json:"comment"`
+	AcknowledgedAt time.Time             `json:"acknowledged_at"`
+}
+
+// AcknowledgementStore persists the acknowledgements.
+type AcknowledgementStore struct {
+	db *sql.DB
+}
+
+func NewAcknowledgementStore(db *sql.DB) *AcknowledgementStore {
+	return &AcknowledgementStore{db: db}
+}
+
+// Save writes the acknowledgement.
+func (s *AcknowledgementStore) Save(ctx context.Context, acknowledgement Acknowledgement) error {
+	span := sentry.StartSpan(ctx, "function", sentry.WithDescription("AcknowledgementStore.Save"))
+	span.SetData("semyi.monitor.id", acknowledgement.MonitorID)
+	ctx = span.Context()
+	defer span.Finish()
+
+	conn, err := s.db.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get connection: %w", err)
+	}
+	defer func() {
+		err := conn.Close()
+		if err != nil {
+			log.Warn().Err(err).Msg("failed to close connection")
+		}
+	}()
+
+	comment := sql.NullString{String: acknowledgement.Comment, Valid: acknowledgement.Comment != ""}
+	_, err = conn.ExecContext(
+		ctx,
+		`INSERT INTO alert_acknowledgements
+			(monitor_id, outage_started_at, acknowledged_by, source, comment, acknowledged_at)
+		VALUES
+			(?, ?, ?, ?, ?, ?)`,
+		acknowledgement.MonitorID,
+		EnsureUTC(acknowledgement.OutageStartedAt),
+		acknowledgement.AcknowledgedBy,
+		string(acknowledgement.Source),
+		comment,
+		EnsureUTC(acknowledgement.AcknowledgedAt),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to insert acknowledgement: %w", err)
+	}
+
+	return nil
+}
+
+// Read returns the acknowledgements of a monitor, from the newest to the oldest. The limit defaults to 100.
+func (s *AcknowledgementStore) Read(ctx context.Context, monitorId string, limit int) ([]Acknowledgement, error) {
+	span := sentry.StartSpan(ctx, "function", sentry.WithDescription("AcknowledgementStore.Read"))
+	span.SetData("semyi.monitor.id", monitorId)
+	ctx = span.Context()
+	defer span.Finish()
+
+	if limit <= 0 {
+		limit = 100
+	}
+
+	conn, err := s.db.Conn(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get connection: %w", err)
+	}
+	defer func() {
+		err := conn.Close()
+		if err != nil {
+			log.Warn().Err(err).Msg("failed to close connection")
+		}
+	}()
+
+	rows, err := conn.QueryContext(
+		ctx,
+		fmt.Sprintf(
+			`SELECT monitor_id, outage_started_at, acknowledged_by, source, comment, acknowledged_at
+			FROM alert_acknowledgements WHERE monitor_id = ? ORDER BY acknowledged_at DESC LIMIT %d`,
+			limit,
+		),
+		monitorId,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read acknowledgements: %w", err)
+	}
+	defer func() {
+		if err := rows.Close(); err != nil {
+			log.Warn().Err(err).Msg("failed to close rows")
+		}
+	}()
+
+	var acknowledgements []Acknowledgement
+	for rows.Next() {
+		var acknowledgement Acknowledgement
+		var source string
+		var comment sql.NullString
+		err := rows.Scan(&acknowledgement.MonitorID, &acknowledgement.OutageStartedAt, &acknowledgement.AcknowledgedBy, &source, &comment, &acknowledgement.AcknowledgedAt)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+
+		acknowledgement.OutageStartedAt = acknowledgement.OutageStartedAt.UTC()
+		acknowledgement.AcknowledgedAt = acknowledgement.AcknowledgedAt.UTC()
+		acknowledgement.Source = AcknowledgementSource(source)
+		acknowledgement.Comment = comment.String
+		acknowledgements = append(acknowledgements, acknowledgement)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate rows: %w", err)
+	}
+
+	return acknowledgements, nil
+}
+
+// Acknowledger acknowledges the ongoing outage of a monitor, which stops its escalations and reminders until
+// the monitor recovers.
+type Acknowledger struct {
+	store   *AcknowledgementStore
+	outages *OutageStore
+	// escalator is optional.
+	escalator *Escalator
+}
+
+func NewAcknowledger(store *AcknowledgementStore, outages *OutageStore, escalator *Escalator) *Acknowledger {
+	return &Acknowledger{store: store, outages: outages, escalator: escalator}
+}
+
+// Acknowledge records the acknowledgement of the ongoing outage of a monitor, and stops its escalation.
+// ErrNotDown is returned if the monitor has no ongoing outage.
+func (a *Acknowledger) Acknowledge(ctx context.Context, monitorId string, acknowledgedBy string, source AcknowledgementSource, comment string) (Acknowledgement, error) {
+	span := sentry.StartSpan(ctx, "function", sentry.WithDescription("Acknowledger.Acknowledge"))
+	span.SetData("semyi.monitor.id", monitorId)
+	ctx = span.Context()
+	defer span.Finish()
+
+	outages, err := a.outages.Read(ctx, OutageFilter{MonitorID: monitorId, Ongoing: true, Limit: 1})
+	if err != nil {
+		return Acknowledgement{}, fmt.Errorf("failed to read ongoing outage: %w", err)
+	}
+
+	if len(outages) == 0 {
+		return Acknowledgement{}, ErrNotDown
+	}
+
+	acknowledgement := Acknowledgement{
+		MonitorID:       monitorId,
+		OutageStartedAt: outages[0].StartedAt,
+		AcknowledgedBy:  acknowledgedBy,
+		Source:          source,
+		Comment:         comment,
+		AcknowledgedAt:  time.Now().UTC(),
+	}
+
+	err = a.store.Save(ctx, acknowledgement)
+	if err != nil {
+		return Acknowledgement{}, fmt.Errorf("failed to save acknowledgement: %w", err)
+	}
+
+	if a.escalator != nil {
+		a.escalator.Acknowledge(monitorId)
+	}
+
+	log.Info().Str("monitor_id", monitorId).Str("acknowledged_by", acknowledgedBy).Str("source", string(source)).Msg("outage acknowledged")
+
+	return acknowledgement, nil
+}
+
+// Read returns the acknowledgements of a monitor, see AcknowledgementStore.Read.
+func (a *Acknowledger) Read(ctx context.Context, monitorId string, limit int) ([]Acknowledgement, error) {
+	return a.store.Read(ctx, monitorId, limit)
+}
+
+// Hydrate stops the escalation of the ongoing outages that were acknowledged before a restart. It is called
+// after Escalator.Hydrate.
+func (a *Acknowledger) Hydrate(ctx context.Context, outages []Outage) error {
+	if a.escalator == nil {
+		return nil
+	}
+
+	for _, outage := range outages {
+		if !outage.Ongoing() {
+			continue
+		}
+
+		acknowledgements, err := a.store.Read(ctx, outage.MonitorID, 1)
+		if err != nil {
+			return fmt.Errorf("failed to read acknowledgements of %s: %w", outage.MonitorID, err)
+		}
+
+		if len(acknowledgements) > 0 && acknowledgements[0].OutageStartedAt.Equal(outage.StartedAt) {
+			a.escalator.Acknowledge(outage.MonitorID)
+		}
+	}
+
+	return nil
+}
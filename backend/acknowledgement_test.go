@@ -0,0 +1,158 @@
+package main_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	main "semyi"
+	"semyi/testutils"
+
+	"github.com/getsentry/sentry-go"
+)
+
+// startOutage stores an ongoing outage of the monitor, and deletes its outages and acknowledgements once the
+// test is done.
+func startOutage(t *testing.T, ctx context.Context, monitorId string, startedAt time.Time) {
+	t.Helper()
+
+	t.Cleanup(func() {
+		for _, table := range []string{"alert_acknowledgements", "outages"} {
+			_, err := database.Exec("DELETE FROM "+table+" WHERE monitor_id = ?", monitorId)
+			if err != nil {
+				t.Logf("Warning: failed to clean up test data: %v", err)
+			}
+		}
+	})
+
+	err := main.NewOutageStore(database).Save(ctx, main.Outage{MonitorID: monitorId, StartedAt: startedAt, FirstFailureMessage: "timeout", FailedChecks: 2})
+	testutils.AssertNoError(t, err, "Failed to save outage")
+}
+
+func TestAcknowledger_Acknowledge(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	ctx = sentry.SetHubOnContext(ctx, sentry.CurrentHub())
+
+	escalator, alerters := newEscalationFixture(t, nil)
+	acknowledger := main.NewAcknowledger(main.NewAcknowledgementStore(database), main.NewOutageStore(database), escalator)
+
+	_, err := acknowledger.Acknowledge(ctx, "escalated", "alice", main.AcknowledgementSourceAPI, "")
+	testutils.AssertTrue(t, errors.Is(err, main.ErrNotDown), "A monitor that is up can not be acknowledged")
+
+	start := time.Now().UTC().Add(-time.Hour).Truncate(time.Second)
+	startOutage(t, ctx, "escalated", start)
+	escalator.Observe(ctx, main.AlertMessage{MonitorID: "escalated", Status: main.MonitorStatusFailure, Timestamp: start}, start)
+
+	acknowledgement, err := acknowledger.Acknowledge(ctx, "escalated", "alice", main.AcknowledgementSourceSlack, "on it")
+	testutils.AssertNoError(t, err, "Failed to acknowledge outage")
+	testutils.AssertTrue(t, acknowledgement.OutageStartedAt.Equal(start), "Expected the ongoing outage to be acknowledged")
+
+	escalator.Evaluate(ctx, start.Add(2*time.Hour))
+	for name, alerter := range alerters {
+		testutils.AssertEqual(t, 0, len(alerter.alertsSent), "Nothing should be escalated to "+name+" once acknowledged")
+	}
+
+	acknowledgements, err := acknowledger.Read(ctx, "escalated", 0)
+	testutils.AssertNoError(t, err, "Failed to read acknowledgements")
+	testutils.AssertEqual(t, 1, len(acknowledgements), "Expected the acknowledgement to be recorded")
+	testutils.AssertEqual(t, "alice", acknowledgements[0].AcknowledgedBy, "Unexpected acknowledged by")
+	testutils.AssertEqual(t, main.AcknowledgementSourceSlack, acknowledgements[0].Source, "Unexpected source")
+	testutils.AssertEqual(t, "on it", acknowledgements[0].Comment, "Unexpected comment")
+
+	// The acknowledgement survives a restart
+	escalator, alerters = newEscalationFixture(t, nil)
+	err = escalator.Hydrate(ctx, []main.Outage{{MonitorID: "escalated", StartedAt: start}}, nil, start.Add(time.Minute))
+	testutils.AssertNoError(t, err, "Failed to hydrate escalations")
+	err = main.NewAcknowledger(main.NewAcknowledgementStore(database), main.NewOutageStore(database), escalator).Hydrate(ctx, []main.Outage{{MonitorID: "escalated", StartedAt: start}})
+	testutils.AssertNoError(t, err, "Failed to hydrate acknowledgements")
+
+	escalator.Evaluate(ctx, start.Add(2*time.Hour))
+	testutils.AssertEqual(t, 0, len(alerters["team-b"].alertsSent), "The escalation should stay acknowledged after a restart")
+}
+
+func TestAlertRouter_Acknowledgeable(t *testing.T) {
+	var bodies []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		bodies = append(bodies, string(body))
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	router := newMockAlertRouter(t, main.AlertRouterConfig{
+		Defaults: []string{"slack", "discord", "telegram"},
+		ChatOps:  main.ChatOpsConfig{SlackSigningSecret: "secret", TelegramSecretToken: "token"},
+	}, map[string]main.Alerter{
+		"slack":    main.NewSlackAlertProvider(main.SlackProviderConfig{WebhookURL: server.URL, HttpClient: server.Client()}),
+		"discord":  main.NewDiscordAlertProvider(main.DiscordProviderConfig{WebhookURL: server.URL, HttpClient: server.Client()}),
+		"telegram": main.NewTelegramAlertProvider(main.TelegramProviderConfig{Url: server.URL, ChatID: "42", HttpClient: server.Client()}),
+	})
+
+	err := router.Send(context.Background(), main.AlertMessage{MonitorID: "api", Status: main.MonitorStatusFailure, PreviousStatus: main.MonitorStatusSuccess})
+	testutils.AssertNoError(t, err, "Failed to send alert")
+	testutils.AssertEqual(t, 3, len(bodies), "Expected an alert per provider")
+	testutils.AssertContains(t, bodies[0], `"action_id": "acknowledge"`, "Expected an acknowledge button on Slack")
+	testutils.AssertFalse(t, strings.Contains(bodies[1], "components"), "Discord has no chat-ops configured, so it should not get a button")
+	testutils.AssertContains(t, bodies[2], `"callback_data":"ack:api"`, "Expected an acknowledge button on Telegram")
+
+	err = router.SendTo(context.Background(), []string{"slack"}, main.AlertMessage{MonitorID: "api", Success: true, Status: main.MonitorStatusSuccess, PreviousStatus: main.MonitorStatusFailure})
+	testutils.AssertNoError(t, err, "Failed to send alert")
+	testutils.AssertFalse(t, strings.Contains(bodies[3], "acknowledge"), "Recovery alerts should not be acknowledgeable")
+}
+
+func TestServer_AcknowledgeOutage(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	ctx = sentry.SetHubOnContext(ctx, sentry.CurrentHub())
+
+	outages := main.NewOutageStore(database)
+	server := main.NewServer(main.ServerConfig{
+		MonitorList:  []main.Monitor{{UniqueID: "ack-api"}},
+		Acknowledger: main.NewAcknowledger(main.NewAcknowledgementStore(database), outages, nil),
+		ApiKey:       "secret",
+	})
+
+	serve := func(method string, path string, body string, apiKey string) *httptest.ResponseRecorder {
+		request := httptest.NewRequest(method, path, strings.NewReader(body))
+		if apiKey != "" {
+			request.Header.Set("X-API-Key", apiKey)
+		}
+		recorder := httptest.NewRecorder()
+		server.Handler.ServeHTTP(recorder, request)
+		return recorder
+	}
+
+	recorder := serve(http.MethodPost, "/api/v1/monitors/ack-api/acknowledge", `{"acknowledged_by": "alice"}`, "")
+	testutils.AssertEqual(t, http.StatusUnauthorized, recorder.Code, "Expected the API key to be required")
+
+	recorder = serve(http.MethodPost, "/api/v1/monitors/unknown/acknowledge", `{"acknowledged_by": "alice"}`, "secret")
+	testutils.AssertEqual(t, http.StatusNotFound, recorder.Code, "Expected an unknown monitor to be rejected")
+
+	recorder = serve(http.MethodPost, "/api/v1/monitors/ack-api/acknowledge", `{}`, "secret")
+	testutils.AssertEqual(t, http.StatusBadRequest, recorder.Code, "Expected acknowledged_by to be required")
+
+	recorder = serve(http.MethodPost, "/api/v1/monitors/ack-api/acknowledge", `{"acknowledged_by": "alice"}`, "secret")
+	testutils.AssertEqual(t, http.StatusConflict, recorder.Code, "A monitor that is up can not be acknowledged")
+
+	startOutage(t, ctx, "ack-api", time.Now().UTC().Add(-10*time.Minute))
+
+	recorder = serve(http.MethodPost, "/api/v1/monitors/ack-api/acknowledge", `{"acknowledged_by": "alice", "comment": "rolling back"}`, "secret")
+	testutils.AssertEqual(t, http.StatusCreated, recorder.Code, "Expected the outage to be acknowledged")
+
+	recorder = serve(http.MethodGet, "/api/v1/monitors/ack-api/acknowledgements", "", "secret")
+	testutils.AssertEqual(t, http.StatusOK, recorder.Code, "Expected the acknowledgements to be returned")
+
+	var acknowledgements []main.Acknowledgement
+	err := json.NewDecoder(recorder.Body).Decode(&acknowledgements)
+	testutils.AssertNoError(t, err, "Failed to decode acknowledgements")
+	testutils.AssertEqual(t, 1, len(acknowledgements), "Expected a single acknowledgement")
+	testutils.AssertEqual(t, main.AcknowledgementSourceAPI, acknowledgements[0].Source, "Unexpected source")
+	testutils.AssertEqual(t, "rolling back", acknowledgements[0].Comment, "Unexpected comment")
+}
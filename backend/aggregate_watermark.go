@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/getsentry/sentry-go"
+	"github.com/rs/zerolog/log"
+)
+
+// AggregateWatermarkStore keeps track of how far the aggregates of each monitor have been finalized.
+// The watermark is the end of the latest closed bucket that has been aggregated, per monitor and per interval.
+type AggregateWatermarkStore struct {
+	db *sql.DB
+}
+
+func NewAggregateWatermarkStore(db *sql.DB) *AggregateWatermarkStore {
+	return &AggregateWatermarkStore{db: db}
+}
+
+// Get returns the watermark of a monitor. It returns false if the monitor has never been aggregated.
+func (s *AggregateWatermarkStore) Get(ctx context.Context, monitorId string, interval AggregateInterval) (time.Time, bool, error) {
+	span := sentry.StartSpan(ctx, "function", sentry.WithDescription("AggregateWatermarkStore.Get"))
+	span.SetData("semyi.monitor.id", monitorId)
+	ctx = span.Context()
+	defer span.Finish()
+
+	conn, err := s.db.Conn(ctx)
+	if err != nil {
+		return time.Time{}, false, fmt.Errorf("failed to get connection: %w", err)
+	}
+	defer func() {
+		err := conn.Close()
+		if err != nil {
+			log.Warn().Err(err).Msg("failed to close connection")
+		}
+	}()
+
+	var watermark time.Time
+	err = conn.QueryRowContext(ctx, "SELECT watermark FROM aggregate_watermark WHERE monitor_id = ? AND tier = ?", monitorId, string(interval)).Scan(&watermark)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return time.Time{}, false, nil
+		}
+
+		return time.Time{}, false, fmt.Errorf("failed to read aggregate watermark: %w", err)
+	}
+
+	return watermark.UTC(), true, nil
+}
+
+// Set stores the watermark of a monitor.
+func (s *AggregateWatermarkStore) Set(ctx context.Context, monitorId string, interval AggregateInterval, watermark time.Time) error {
+	span := sentry.StartSpan(ctx, "function", sentry.WithDescription("AggregateWatermarkStore.Set"))
+	span.SetData("semyi.monitor.id", monitorId)
+	ctx = span.Context()
+	defer span.Finish()
+
+	conn, err := s.db.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get connection: %w", err)
+	}
+	defer func() {
+		err := conn.Close()
+		if err != nil {
+			log.Warn().Err(err).Msg("failed to close connection")
+		}
+	}()
+
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+
+	_, err = tx.ExecContext(ctx, "DELETE FROM aggregate_watermark WHERE monitor_id = ? AND tier = ?", monitorId, string(interval))
+	if err != nil {
+		if rollbackErr := tx.Rollback(); rollbackErr != nil {
+			log.Warn().Err(rollbackErr).Msg("failed to rollback transaction")
+		}
+
+		return fmt.Errorf("failed to delete aggregate watermark: %w", err)
+	}
+
+	_, err = tx.ExecContext(
+		ctx,
+		"INSERT INTO aggregate_watermark (monitor_id, tier, watermark, updated_at) VALUES (?, ?, ?, ?)",
+		monitorId,
+		string(interval),
+		EnsureUTC(watermark),
+		time.Now().UTC(),
+	)
+	if err != nil {
+		if rollbackErr := tx.Rollback(); rollbackErr != nil {
+			log.Warn().Err(rollbackErr).Msg("failed to rollback transaction")
+		}
+
+		return fmt.Errorf("failed to insert aggregate watermark: %w", err)
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return nil
+}
+
+// Rewind moves the watermark of a monitor back to the given bucket, so every bucket from there on is finalized
+// again. A watermark that is already before the bucket is kept, and a monitor without a watermark is backfilled
+// anyway.
+func (s *AggregateWatermarkStore) Rewind(ctx context.Context, monitorId string, interval AggregateInterval, bucket time.Time) error {
+	watermark, ok, err := s.Get(ctx, monitorId, interval)
+	if err != nil {
+		return err
+	}
+
+	if !ok || !watermark.After(bucket) {
+		return nil
+	}
+
+	return s.Set(ctx, monitorId, interval, bucket)
+}
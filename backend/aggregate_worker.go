@@ -2,25 +2,114 @@ package main
 
 import (
 	"context"
+	"errors"
 	"time"
 
 	"github.com/getsentry/sentry-go"
 	"github.com/rs/zerolog/log"
 )
 
+// aggregateBackfillChunk bounds the time range that is aggregated in a single query while backfilling.
+const aggregateBackfillChunk = 31 * 24 * time.Hour
+
+// ErrPastRawRetention is returned when aggregates are rebuilt for a time range whose raw historical data
+// has already been deleted.
+var ErrPastRawRetention = errors.New("time range is past the raw retention")
+
 type AggregateWorker struct {
 	monitorIds []string
 	reader     *MonitorHistoricalReader
 	writer     *MonitorHistoricalWriter
+	watermarks *AggregateWatermarkStore
+	retention  RetentionPolicy
+	// overrides holds the retention policy of every monitor that overrides at least one tier.
+	overrides map[string]RetentionPolicy
+}
+
+// NewAggregateWorker creates a new aggregate worker. The retention policy tells which buckets still have their
+// raw historical data, only those can be aggregated again.
+func NewAggregateWorker(monitors []Monitor, reader *MonitorHistoricalReader, writer *MonitorHistoricalWriter, watermarks *AggregateWatermarkStore, retention RetentionPolicy) *AggregateWorker {
+	monitorIds := make([]string, 0, len(monitors))
+	for _, monitor := range monitors {
+		monitorIds = append(monitorIds, monitor.UniqueID)
+	}
+
+	return &AggregateWorker{
+		monitorIds: monitorIds,
+		reader:     reader,
+		writer:     writer,
+		watermarks: watermarks,
+		retention:  retention,
+		overrides:  retentionOverrides(retention, monitors),
+	}
+}
+
+// RawRetentionStart returns the start of the first bucket of the interval that still has all of its raw
+// historical data at the given time. It returns the zero time if the raw data is kept forever.
+func (w *AggregateWorker) RawRetentionStart(monitorId string, interval AggregateInterval, now time.Time) time.Time {
+	policy, ok := w.overrides[monitorId]
+	if !ok {
+		policy = w.retention
+	}
+
+	if policy.Raw <= 0 {
+		return time.Time{}
+	}
+
+	cutoff := now.UTC().AddDate(0, 0, -policy.Raw)
+	start := interval.Truncate(cutoff)
+	if start.Before(cutoff) {
+		start = interval.Next(start)
+	}
+
+	return start
 }
 
-func NewAggregateWorker(monitorIds []string, reader *MonitorHistoricalReader, writer *MonitorHistoricalWriter) *AggregateWorker {
-	return &AggregateWorker{monitorIds, reader, writer}
+// Invalidate tells the worker that raw historical data of the monitor has been written late, at the given time
+// or after it, e.g. by a spool replay or an import. The buckets from there on are aggregated again on the next
+// run, except for the buckets that are past the raw retention.
+func (w *AggregateWorker) Invalidate(ctx context.Context, monitorId string, at time.Time) error {
+	span := sentry.StartSpan(ctx, "function", sentry.WithDescription("AggregateWorker.Invalidate"))
+	span.SetData("semyi.monitor.id", monitorId)
+	ctx = span.Context()
+	defer span.Finish()
+
+	materialized, err := w.writer.MaterializedAggregates(ctx)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	for _, interval := range []AggregateInterval{AggregateIntervalHour, AggregateIntervalDay} {
+		from := at
+		if start := w.RawRetentionStart(monitorId, interval, now); from.Before(start) {
+			from = start
+		}
+
+		if !from.Before(now) {
+			continue
+		}
+
+		// Materialized aggregates have no watermark, and the database only refreshes the recent buckets by itself
+		if materialized {
+			err = w.Rebuild(ctx, monitorId, interval, from, now)
+		} else {
+			err = w.watermarks.Rewind(ctx, monitorId, interval, interval.Truncate(from))
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
 }
 
 func (w *AggregateWorker) RunHourlyAggregate(ctx context.Context) {
 	ctx = sentry.SetHubOnContext(ctx, sentry.CurrentHub().Clone())
 
+	// Catch up on the buckets that were missed while we were not running
+	w.hourlyAggregate(ctx)
+
 	// Run worker every 10 minutes
 	ticker := time.NewTicker(10 * time.Minute)
 	defer ticker.Stop()
@@ -42,91 +131,10 @@ func (w *AggregateWorker) hourlyAggregate(ctx context.Context) {
 	defer span.Finish()
 
 	for _, monitorId := range w.monitorIds {
-		historicalData, err := w.reader.ReadRawHistorical(ctx, monitorId, false)
-		if err != nil {
-			log.Error().Err(err).Msgf("failed to read raw historical data for monitor %s", monitorId)
-			sentry.GetHubFromContext(ctx).CaptureException(err)
-			continue
-		}
-
-		// Filter out from the last hour
-		// If right now is 08:29, we should filter out data from 08:00 - 09:00
-		// If right now is 08:01, we should filter out data from 08:00 - 09:00
-		// If right now is 09:00, we should filter out data from 09:00 - 10:00
-		var now = time.Now()
-		var fromTime = time.Date(now.Year(), now.Month(), now.Day(), now.Hour(), 0, 0, 0, now.Location())
-		var toTime = fromTime.Add(1 * time.Hour)
-		var lastHourData []MonitorHistorical
-		for _, data := range historicalData {
-			if data.Timestamp.Equal(fromTime) || (data.Timestamp.After(fromTime) && data.Timestamp.Before(toTime)) {
-				lastHourData = append(lastHourData, data)
-			}
-		}
-
-		if len(lastHourData) == 0 {
-			continue
-		}
-
-		// Calculate the average latency and status
-		var totalLatency int64
-		var totalStatus int64
-		for _, data := range lastHourData {
-			totalLatency += data.Latency
-			totalStatus += int64(data.Status)
-		}
-
-		var averageLatency = totalLatency / int64(len(lastHourData))
-		var averageStatus = MonitorStatus(totalStatus / int64(len(lastHourData)))
-		var additionalMessage, httpProtocol, tlsVersion, tlsCipherName string
-		var tlsExpiryDate time.Time
-		// Additional Semyi-specific information should be acquired from
-		// the latest available entry in the hourly aggregate table
-		for i := len(lastHourData) - 1; i >= 0; i-- {
-			data := lastHourData[i]
-			// Additional message should only be set if the status is not success
-			if averageStatus != MonitorStatusSuccess && additionalMessage == "" && data.AdditionalMessage != "" {
-				additionalMessage = data.AdditionalMessage
-			}
-
-			if httpProtocol == "" && data.HttpProtocol != "" {
-				httpProtocol = data.HttpProtocol
-			}
-
-			if tlsVersion == "" && data.TLSVersion != "" {
-				tlsVersion = data.TLSVersion
-			}
-
-			if tlsCipherName == "" && data.TLSCipherName != "" {
-				tlsCipherName = data.TLSCipherName
-			}
-
-			if tlsExpiryDate.IsZero() && !data.TLSExpiryDate.IsZero() {
-				tlsExpiryDate = data.TLSExpiryDate
-			}
-
-			// If everything has been set, we can break the loop
-			if additionalMessage != "" && httpProtocol != "" &&
-				tlsVersion != "" && tlsCipherName != "" &&
-				!tlsExpiryDate.IsZero() {
-				break
-			}
-		}
-
-		err = w.writer.WriteHourly(ctx, MonitorHistorical{
-			MonitorID:         monitorId,
-			Status:            averageStatus,
-			Latency:           averageLatency,
-			Timestamp:         fromTime,
-			AdditionalMessage: additionalMessage,
-			HttpProtocol:      httpProtocol,
-			TLSVersion:        tlsVersion,
-			TLSCipherName:     tlsCipherName,
-			TLSExpiryDate:     tlsExpiryDate,
-		})
+		err := w.Aggregate(ctx, monitorId, AggregateIntervalHour, time.Now())
 		if err != nil {
-			log.Error().Err(err).Msg("failed to write hourly aggregate data")
+			log.Error().Err(err).Msgf("failed to aggregate hourly historical data for monitor %s", monitorId)
 			sentry.GetHubFromContext(ctx).CaptureException(err)
-			continue
 		}
 	}
 }
@@ -134,6 +142,9 @@ func (w *AggregateWorker) hourlyAggregate(ctx context.Context) {
 func (w *AggregateWorker) RunDailyAggregate(ctx context.Context) {
 	ctx = sentry.SetHubOnContext(ctx, sentry.CurrentHub().Clone())
 
+	// Catch up on the buckets that were missed while we were not running
+	w.dailyAggregate(ctx)
+
 	// Run worker every 1 hour
 	ticker := time.NewTicker(1 * time.Hour)
 	defer ticker.Stop()
@@ -155,88 +166,130 @@ func (w *AggregateWorker) dailyAggregate(ctx context.Context) {
 	defer span.Finish()
 
 	for _, monitorId := range w.monitorIds {
-		historicalData, err := w.reader.ReadRawHistorical(ctx, monitorId, false)
+		err := w.Aggregate(ctx, monitorId, AggregateIntervalDay, time.Now())
 		if err != nil {
-			log.Error().Err(err).Msgf("failed to read raw historical data for monitor %s", monitorId)
+			log.Error().Err(err).Msgf("failed to aggregate daily historical data for monitor %s", monitorId)
 			sentry.GetHubFromContext(ctx).CaptureException(err)
-			continue
 		}
+	}
+}
+
+// Aggregate finalizes every closed bucket since the monitor's watermark, then aggregates the bucket that is
+// still in progress at the given time. The in-progress bucket is recomputed on every run until it is closed.
+// Monitors without a watermark are backfilled from their oldest raw historical data.
+func (w *AggregateWorker) Aggregate(ctx context.Context, monitorId string, interval AggregateInterval, now time.Time) error {
+	// ClickHouse keeps materialized aggregates up to date by itself
+	materialized, err := w.writer.MaterializedAggregates(ctx)
+	if err != nil {
+		return err
+	}
+
+	if materialized {
+		return nil
+	}
 
-		// Filter out for today's data
-		var now = time.Now()
-		var fromTime = time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
-		var toTime = fromTime.Add(24 * time.Hour)
-		var lastHourData []MonitorHistorical
-		for _, data := range historicalData {
-			if data.Timestamp.Equal(fromTime) || (data.Timestamp.After(fromTime) && data.Timestamp.Before(toTime)) {
-				lastHourData = append(lastHourData, data)
-			}
+	current := interval.Truncate(now)
+
+	watermark, ok, err := w.watermarks.Get(ctx, monitorId, interval)
+	if err != nil {
+		return err
+	}
+
+	if !ok {
+		oldest, found, err := w.reader.ReadRawOldestTimestamp(ctx, monitorId)
+		if err != nil {
+			return err
 		}
 
-		if len(lastHourData) == 0 {
-			continue
+		if !found {
+			return nil
+		}
+
+		watermark = interval.Truncate(oldest)
+	}
+
+	for watermark.Before(current) {
+		chunkEnd := watermark.Add(aggregateBackfillChunk)
+		if chunkEnd.After(current) {
+			chunkEnd = current
 		}
 
-		// Calculate the average latency and status
-		var totalLatency int64
-		var totalStatus int64
-		for _, data := range lastHourData {
-			totalLatency += data.Latency
-			totalStatus += int64(data.Status)
+		err = w.Rebuild(ctx, monitorId, interval, watermark, chunkEnd)
+		if err != nil {
+			return err
 		}
 
-		var averageLatency = totalLatency / int64(len(lastHourData))
-		var averageStatus = MonitorStatus(totalStatus / int64(len(lastHourData)))
-		var additionalMessage, httpProtocol, tlsVersion, tlsCipherName string
-		var tlsExpiryDate time.Time
-		// Additional Semyi-specific information should be acquired from
-		// the latest available entry in the hourly aggregate table
-		for i := len(lastHourData) - 1; i >= 0; i-- {
-			data := lastHourData[i]
-			// Additional message should only be set if the status is not success
-			if averageStatus != MonitorStatusSuccess && additionalMessage == "" && data.AdditionalMessage != "" {
-				additionalMessage = data.AdditionalMessage
-			}
-
-			if httpProtocol == "" && data.HttpProtocol != "" {
-				httpProtocol = data.HttpProtocol
-			}
-
-			if tlsVersion == "" && data.TLSVersion != "" {
-				tlsVersion = data.TLSVersion
-			}
-
-			if tlsCipherName == "" && data.TLSCipherName != "" {
-				tlsCipherName = data.TLSCipherName
-			}
-
-			if tlsExpiryDate.IsZero() && !data.TLSExpiryDate.IsZero() {
-				tlsExpiryDate = data.TLSExpiryDate
-			}
-
-			// If everything has been set, we can break the loop
-			if additionalMessage != "" && httpProtocol != "" &&
-				tlsVersion != "" && tlsCipherName != "" &&
-				!tlsExpiryDate.IsZero() {
-				break
-			}
+		err = w.watermarks.Set(ctx, monitorId, interval, chunkEnd)
+		if err != nil {
+			return err
 		}
 
-		err = w.writer.WriteDaily(ctx, MonitorHistorical{
-			MonitorID:         monitorId,
-			Status:            averageStatus,
-			Latency:           averageLatency,
-			Timestamp:         fromTime,
-			AdditionalMessage: additionalMessage,
-			HttpProtocol:      httpProtocol,
-			TLSVersion:        tlsVersion,
-			TLSCipherName:     tlsCipherName,
-			TLSExpiryDate:     tlsExpiryDate,
-		})
+		log.Debug().Str("monitor_id", monitorId).Str("interval", string(interval)).Time("watermark", chunkEnd).Msg("finalized aggregates")
+		watermark = chunkEnd
+	}
+
+	aggregates, err := w.reader.ReadAggregate(ctx, monitorId, interval, current, interval.Next(current))
+	if err != nil {
+		return err
+	}
+
+	for _, aggregate := range aggregates {
+		err = w.write(ctx, interval, aggregate)
 		if err != nil {
-			log.Error().Err(err).Msg("failed to write daily aggregate data")
-			sentry.GetHubFromContext(ctx).CaptureException(err)
-			continue
+			return err
 		}
 	}
+
+	return nil
+}
+
+// Rebuild recomputes the aggregates of a monitor within [from, to), rounded outward to whole buckets.
+// Existing aggregates within the range are replaced, including buckets that no longer have any raw data.
+func (w *AggregateWorker) Rebuild(ctx context.Context, monitorId string, interval AggregateInterval, from time.Time, to time.Time) error {
+	span := sentry.StartSpan(ctx, "function", sentry.WithDescription("AggregateWorker.Rebuild"))
+	span.SetData("semyi.monitor.id", monitorId)
+	span.SetData("semyi.aggregate.interval", string(interval))
+	ctx = span.Context()
+	defer span.Finish()
+
+	from = interval.Truncate(from)
+	if truncated := interval.Truncate(to); truncated.Before(to) {
+		to = interval.Next(truncated)
+	}
+
+	materialized, err := w.writer.MaterializedAggregates(ctx)
+	if err != nil {
+		return err
+	}
+
+	if materialized {
+		return w.writer.RebuildMaterializedAggregates(ctx, monitorId, interval, from, to)
+	}
+
+	err = w.writer.DeleteAggregates(ctx, monitorId, interval, from, to)
+	if err != nil {
+		return err
+	}
+
+	aggregates, err := w.reader.ReadAggregate(ctx, monitorId, interval, from, to)
+	if err != nil {
+		return err
+	}
+
+	for _, aggregate := range aggregates {
+		err = w.write(ctx, interval, aggregate)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (w *AggregateWorker) write(ctx context.Context, interval AggregateInterval, aggregate MonitorHistorical) error {
+	if interval == AggregateIntervalDay {
+		return w.writer.WriteDaily(ctx, aggregate)
+	}
+
+	return w.writer.WriteHourly(ctx, aggregate)
 }
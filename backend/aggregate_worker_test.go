@@ -0,0 +1,139 @@
+package main_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	main "semyi"
+	"semyi/testutils"
+
+	"github.com/getsentry/sentry-go"
+)
+
+func TestAggregateWorker_Aggregate(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	ctx = sentry.SetHubOnContext(ctx, sentry.CurrentHub())
+
+	reader := main.NewMonitorHistoricalReader(database)
+	writer := main.NewMonitorHistoricalWriter(database)
+	watermarks := main.NewAggregateWatermarkStore(database)
+	worker := main.NewAggregateWorker([]main.Monitor{{UniqueID: "backfill-monitor"}}, reader, writer, watermarks, main.RetentionPolicy{})
+
+	// Raw data for three hours, the last one is still in progress
+	start := time.Date(2025, 3, 10, 5, 0, 0, 0, time.UTC)
+	for i := 0; i < 3; i++ {
+		err := writer.Write(ctx, main.MonitorHistorical{
+			MonitorID: "backfill-monitor",
+			Status:    main.MonitorStatusSuccess,
+			Latency:   100,
+			Timestamp: start.Add(time.Duration(i)*time.Hour + 15*time.Minute),
+		})
+		testutils.AssertNoError(t, err, "Failed to write test data")
+	}
+
+	now := start.Add(2*time.Hour + 30*time.Minute)
+	err := worker.Aggregate(ctx, "backfill-monitor", main.AggregateIntervalHour, now)
+	testutils.AssertNoError(t, err, "Failed to aggregate")
+
+	hourly, err := reader.ReadHourlyHistorical(ctx, "backfill-monitor", false)
+	testutils.AssertNoError(t, err, "Failed to read hourly historical data")
+	testutils.AssertEqual(t, 3, len(hourly), "Expected every missed bucket and the current bucket to be aggregated")
+
+	// Aggregates that the database maintains by itself do not need a watermark
+	if !materializedAggregates(t) {
+		watermark, ok, err := watermarks.Get(ctx, "backfill-monitor", main.AggregateIntervalHour)
+		testutils.AssertNoError(t, err, "Failed to read watermark")
+		testutils.AssertTrue(t, ok, "Expected a watermark")
+		testutils.AssertTrue(t, watermark.Equal(start.Add(2*time.Hour)), "Watermark should stop at the bucket in progress")
+	}
+
+	// A failure is added to the first hour after it has been finalized, e.g. a data repair
+	err = writer.Write(ctx, main.MonitorHistorical{
+		MonitorID: "backfill-monitor",
+		Status:    main.MonitorStatusFailure,
+		Latency:   100,
+		Timestamp: start.Add(30 * time.Minute),
+	})
+	testutils.AssertNoError(t, err, "Failed to write test data")
+
+	err = worker.Rebuild(ctx, "backfill-monitor", main.AggregateIntervalHour, start.Add(10*time.Minute), start.Add(20*time.Minute))
+	testutils.AssertNoError(t, err, "Failed to rebuild aggregates")
+
+	hourly, err = reader.ReadHourlyHistorical(ctx, "backfill-monitor", false)
+	testutils.AssertNoError(t, err, "Failed to read hourly historical data")
+	testutils.AssertEqual(t, 3, len(hourly), "Rebuild should not duplicate aggregates")
+
+	// Ordered from the newest to the oldest
+	oldest := hourly[len(hourly)-1]
+	testutils.AssertNotNil(t, oldest.Aggregate, "Expected aggregate statistics")
+	testutils.AssertEqual(t, int64(2), oldest.Aggregate.CheckCount, "Rebuild should include the repaired data")
+	testutils.AssertEqual(t, int64(1), oldest.Aggregate.FailureCount, "Rebuild should include the repaired data")
+}
+
+func TestAggregateWorker_Invalidate(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	ctx = sentry.SetHubOnContext(ctx, sentry.CurrentHub())
+
+	reader := main.NewMonitorHistoricalReader(database)
+	writer := main.NewMonitorHistoricalWriter(database)
+	watermarks := main.NewAggregateWatermarkStore(database)
+	worker := main.NewAggregateWorker([]main.Monitor{{UniqueID: "late-monitor"}}, reader, writer, watermarks, main.RetentionPolicy{})
+
+	now := time.Now().UTC()
+	start := main.AggregateIntervalHour.Truncate(now).Add(-3 * time.Hour)
+	for i := 0; i < 3; i++ {
+		err := writer.Write(ctx, main.MonitorHistorical{MonitorID: "late-monitor", Status: main.MonitorStatusSuccess, Latency: 100, Timestamp: start.Add(time.Duration(i)*time.Hour + 15*time.Minute)})
+		testutils.AssertNoError(t, err, "Failed to write test data")
+	}
+
+	err := worker.Aggregate(ctx, "late-monitor", main.AggregateIntervalHour, now)
+	testutils.AssertNoError(t, err, "Failed to aggregate")
+
+	// A spooled failure of the first hour is replayed after the hour has been finalized
+	late := start.Add(30 * time.Minute)
+	err = writer.Write(ctx, main.MonitorHistorical{MonitorID: "late-monitor", Status: main.MonitorStatusFailure, Latency: 100, Timestamp: late})
+	testutils.AssertNoError(t, err, "Failed to write test data")
+
+	err = worker.Invalidate(ctx, "late-monitor", late)
+	testutils.AssertNoError(t, err, "Failed to invalidate aggregates")
+
+	if !materializedAggregates(t) {
+		watermark, ok, err := watermarks.Get(ctx, "late-monitor", main.AggregateIntervalHour)
+		testutils.AssertNoError(t, err, "Failed to read watermark")
+		testutils.AssertTrue(t, ok, "Expected a watermark")
+		testutils.AssertTrue(t, watermark.Equal(start), "Expected the watermark to be rewound to the bucket of the late row")
+	}
+
+	err = worker.Aggregate(ctx, "late-monitor", main.AggregateIntervalHour, now)
+	testutils.AssertNoError(t, err, "Failed to aggregate")
+
+	hourly, err := reader.ReadHourlyHistorical(ctx, "late-monitor", false)
+	testutils.AssertNoError(t, err, "Failed to read hourly historical data")
+
+	oldest := hourly[len(hourly)-1]
+	testutils.AssertNotNil(t, oldest.Aggregate, "Expected aggregate statistics")
+	testutils.AssertEqual(t, int64(1), oldest.Aggregate.FailureCount, "Expected the late row to be aggregated")
+}
+
+func TestAggregateWorker_RawRetentionStart(t *testing.T) {
+	worker := main.NewAggregateWorker(
+		[]main.Monitor{{UniqueID: "short"}, {UniqueID: "short-raw", Retention: main.RetentionPolicy{Raw: 1}}},
+		nil, nil, nil,
+		main.RetentionPolicy{Raw: 7, Hourly: 30, Daily: 365},
+	)
+
+	now := time.Date(2025, 9, 10, 12, 30, 0, 0, time.UTC)
+	testutils.AssertEqual(t, time.Date(2025, 9, 3, 13, 0, 0, 0, time.UTC), worker.RawRetentionStart("short", main.AggregateIntervalHour, now), "Expected the first whole hour within the raw retention")
+	testutils.AssertEqual(t, time.Date(2025, 9, 4, 0, 0, 0, 0, time.UTC), worker.RawRetentionStart("short", main.AggregateIntervalDay, now), "Expected the first whole day within the raw retention")
+	testutils.AssertEqual(t, time.Date(2025, 9, 10, 0, 0, 0, 0, time.UTC), worker.RawRetentionStart("short-raw", main.AggregateIntervalDay, now), "Expected the override of the monitor")
+
+	err := main.RunCommand(context.Background(), []string{"rebuild-aggregates", "-from", time.Now().AddDate(0, 0, -30).Format(time.RFC3339)}, main.CommandDependencies{
+		Monitors:        []main.Monitor{{UniqueID: "short"}},
+		AggregateWorker: worker,
+	})
+	testutils.AssertTrue(t, errors.Is(err, main.ErrPastRawRetention), "Expected a rebuild past the raw retention to be refused")
+}
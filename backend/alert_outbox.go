@@ -0,0 +1,488 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/getsentry/sentry-go"
+	"github.com/google/uuid"
+	"github.com/rs/zerolog/log"
+)
+
+// AlertDeliveryState is the state of the delivery of an alert through one alert provider.
+type AlertDeliveryState string
+
+const (
+	// AlertDeliveryStatePending deliveries are waiting for their next attempt.
+	AlertDeliveryStatePending   AlertDeliveryState = "pending"
+	AlertDeliveryStateDelivered AlertDeliveryState = "delivered"
+	// AlertDeliveryStateFailed deliveries ran out of attempts, or their provider is no longer configured.
+	AlertDeliveryStateFailed AlertDeliveryState = "failed"
+)
+
+// AlertDelivery is an alert message waiting in, or delivered from, the alert outbox. Every alert provider
+// of an alert gets its own delivery, so a failing provider is retried without paging the others again.
+type AlertDelivery struct {
+	ID        string `json:"id"`
+	MonitorID string `json:"monitor_id"`
+	// Provider is the name of the alert provider, see NewAlertProviders.
+	Provider string             `json:"provider"`
+	Message  AlertMessage       `json:"-"`
+	State    AlertDeliveryState `json:"state"`
+	// AttemptCount is the number of attempts so far. The attempts themselves are only read by AlertOutbox.Read.
+	AttemptCount  int       `json:"attempt_count"`
+	NextAttemptAt time.Time `json:"next_attempt_at"`
+	// LastStatusCode is the status code of the provider's response to the latest attempt. It is zero if no
+	// attempt was made, or if no response was received.
+	LastStatusCode int       `json:"last_status_code"`
+	LastError      string    `json:"last_error"`
+	CreatedAt      time.Time `json:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at"`
+
+	Attempts []AlertDeliveryAttempt `json:"attempts"`
+}
+
+// AlertDeliveryAttempt is a single attempt to deliver an alert.
+type AlertDeliveryAttempt struct {
+	// Attempt counts the attempts of a delivery, starting at 1.
+	Attempt     int       `json:"attempt"`
+	AttemptedAt time.Time `json:"attempted_at"`
+	// StatusCode is zero if no response was received.
+	StatusCode int    `json:"status_code"`
+	Error      string `json:"error"`
+	Success    bool   `json:"success"`
+}
+
+// AlertDeliveryFilter narrows down the deliveries returned by AlertOutbox.Read.
+type AlertDeliveryFilter struct {
+	// MonitorID and Provider return the deliveries of every monitor or provider if empty.
+	MonitorID string
+	Provider  string
+	// State returns the deliveries of every state if empty.
+	State AlertDeliveryState
+	// From and To return the deliveries created within [From, To). Both are optional.
+	From time.Time
+	To   time.Time
+	// Limit defaults to 100.
+	Limit int
+}
+
+// AlertOutbox persists the alerts before they are delivered, along with the history of every delivery.
+// The deliveries are made by the AlertOutboxWorker.
+type AlertOutbox struct {
+	db *sql.DB
+}
+
+func NewAlertOutbox(db *sql.DB) *AlertOutbox {
+	return &AlertOutbox{db: db}
+}
+
+// Enqueue writes a pending delivery of the alert message for every provider.
+func (o *AlertOutbox) Enqueue(ctx context.Context, msg AlertMessage, providers []string) error {
+	span := sentry.StartSpan(ctx, "function", sentry.WithDescription("AlertOutbox.Enqueue"))
+	span.SetData("semyi.monitor.id", msg.MonitorID)
+	ctx = span.Context()
+	defer span.Finish()
+
+	if len(providers) == 0 {
+		return nil
+	}
+
+	// The configuration of the monitor is restored by the AlertRouter on delivery, it is not persisted.
+	msg.Monitor = Monitor{}
+
+	message, err := json.Marshal(msg)
+	if err != nil {
+		return fmt.Errorf("failed to marshal alert message: %w", err)
+	}
+
+	conn, err := o.db.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get connection: %w", err)
+	}
+	defer func() {
+		err := conn.Close()
+		if err != nil {
+			log.Warn().Err(err).Msg("failed to close connection")
+		}
+	}()
+
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+
+	now := time.Now().UTC()
+	for _, provider := range providers {
+		_, err = tx.ExecContext(
+			ctx,
+			`INSERT INTO alert_outbox
+				(id, monitor_id, provider, message, state, attempt_count, next_attempt_at, last_status_code, last_error, created_at, updated_at)
+			VALUES
+				(?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			uuid.New().String(),
+			msg.MonitorID,
+			provider,
+			string(message),
+			string(AlertDeliveryStatePending),
+			0,
+			now,
+			sql.NullInt32{},
+			sql.NullString{},
+			now,
+			now,
+		)
+		if err != nil {
+			if rollbackErr := tx.Rollback(); rollbackErr != nil {
+				log.Warn().Err(rollbackErr).Msg("failed to rollback transaction")
+			}
+
+			return fmt.Errorf("failed to insert alert delivery: %w", err)
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return nil
+}
+
+// DeleteExpired deletes the deliveries created before the given time, along with their attempts. Pending
+// deliveries are kept until they are delivered or fail.
+func (o *AlertOutbox) DeleteExpired(ctx context.Context, before time.Time) error {
+	span := sentry.StartSpan(ctx, "function", sentry.WithDescription("AlertOutbox.DeleteExpired"))
+	ctx = span.Context()
+	defer span.Finish()
+
+	conn, err := o.db.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get connection: %w", err)
+	}
+	defer func() {
+		err := conn.Close()
+		if err != nil {
+			log.Warn().Err(err).Msg("failed to close connection")
+		}
+	}()
+
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+
+	rollback := func() {
+		if rollbackErr := tx.Rollback(); rollbackErr != nil {
+			log.Warn().Err(rollbackErr).Msg("failed to rollback transaction")
+		}
+	}
+
+	// The attempts go first, ClickHouse has no transactions and would keep them if the deliveries went first.
+	_, err = tx.ExecContext(
+		ctx,
+		"DELETE FROM alert_delivery_attempts WHERE delivery_id IN (SELECT id FROM alert_outbox WHERE state <> ? AND created_at < ?)",
+		string(AlertDeliveryStatePending),
+		EnsureUTC(before),
+	)
+	if err != nil {
+		rollback()
+		return fmt.Errorf("failed to delete expired alert delivery attempts: %w", err)
+	}
+
+	_, err = tx.ExecContext(
+		ctx,
+		"DELETE FROM alert_outbox WHERE state <> ? AND created_at < ?",
+		string(AlertDeliveryStatePending),
+		EnsureUTC(before),
+	)
+	if err != nil {
+		rollback()
+		return fmt.Errorf("failed to delete expired alert deliveries: %w", err)
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return nil
+}
+
+// ReadDue returns the pending deliveries whose next attempt is due at the given time, the most overdue first.
+func (o *AlertOutbox) ReadDue(ctx context.Context, now time.Time, limit int) ([]AlertDelivery, error) {
+	span := sentry.StartSpan(ctx, "function", sentry.WithDescription("AlertOutbox.ReadDue"))
+	ctx = span.Context()
+	defer span.Finish()
+
+	return o.read(
+		ctx,
+		"WHERE state = ? AND next_attempt_at <= ? ORDER BY next_attempt_at ASC",
+		[]any{string(AlertDeliveryStatePending), EnsureUTC(now)},
+		limit,
+	)
+}
+
+// Read returns the deliveries that match the filter along with their attempts, ordered from the newest to the oldest.
+func (o *AlertOutbox) Read(ctx context.Context, filter AlertDeliveryFilter) ([]AlertDelivery, error) {
+	span := sentry.StartSpan(ctx, "function", sentry.WithDescription("AlertOutbox.Read"))
+	span.SetData("semyi.monitor.id", filter.MonitorID)
+	ctx = span.Context()
+	defer span.Finish()
+
+	var conditions []string
+	var args []any
+	if filter.MonitorID != "" {
+		conditions = append(conditions, "monitor_id = ?")
+		args = append(args, filter.MonitorID)
+	}
+	if filter.Provider != "" {
+		conditions = append(conditions, "provider = ?")
+		args = append(args, filter.Provider)
+	}
+	if filter.State != "" {
+		conditions = append(conditions, "state = ?")
+		args = append(args, string(filter.State))
+	}
+	if !filter.From.IsZero() {
+		conditions = append(conditions, "created_at >= ?")
+		args = append(args, EnsureUTC(filter.From))
+	}
+	if !filter.To.IsZero() {
+		conditions = append(conditions, "created_at < ?")
+		args = append(args, EnsureUTC(filter.To))
+	}
+
+	var clause string
+	if len(conditions) > 0 {
+		clause = "WHERE " + strings.Join(conditions, " AND ") + " "
+	}
+	clause += "ORDER BY created_at DESC, provider ASC"
+
+	deliveries, err := o.read(ctx, clause, args, filter.Limit)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range deliveries {
+		deliveries[i].Attempts, err = o.readAttempts(ctx, deliveries[i].ID)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return deliveries, nil
+}
+
+func (o *AlertOutbox) read(ctx context.Context, clause string, args []any, limit int) ([]AlertDelivery, error) {
+	if limit <= 0 {
+		limit = 100
+	}
+
+	conn, err := o.db.Conn(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get connection: %w", err)
+	}
+	defer func() {
+		err := conn.Close()
+		if err != nil {
+			log.Warn().Err(err).Msg("failed to close connection")
+		}
+	}()
+
+	query := fmt.Sprintf(
+		`SELECT id, monitor_id, provider, message, state, attempt_count, next_attempt_at, last_status_code, last_error, created_at, updated_at
+		FROM alert_outbox %s LIMIT %d`,
+		clause,
+		limit,
+	)
+	rows, err := conn.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read alert deliveries: %w", err)
+	}
+	defer func() {
+		if err := rows.Close(); err != nil {
+			log.Warn().Err(err).Msg("failed to close rows")
+		}
+	}()
+
+	var deliveries []AlertDelivery
+	for rows.Next() {
+		var delivery AlertDelivery
+		var message, state string
+		var lastStatusCode sql.NullInt32
+		var lastError sql.NullString
+		err := rows.Scan(&delivery.ID, &delivery.MonitorID, &delivery.Provider, &message, &state, &delivery.AttemptCount, &delivery.NextAttemptAt, &lastStatusCode, &lastError, &delivery.CreatedAt, &delivery.UpdatedAt)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+
+		err = json.Unmarshal([]byte(message), &delivery.Message)
+		if err != nil {
+			return nil, fmt.Errorf("failed to unmarshal alert message of delivery %s: %w", delivery.ID, err)
+		}
+
+		delivery.State = AlertDeliveryState(state)
+		delivery.LastStatusCode = int(lastStatusCode.Int32)
+		delivery.LastError = lastError.String
+		delivery.NextAttemptAt = delivery.NextAttemptAt.UTC()
+		delivery.CreatedAt = delivery.CreatedAt.UTC()
+		delivery.UpdatedAt = delivery.UpdatedAt.UTC()
+		deliveries = append(deliveries, delivery)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate rows: %w", err)
+	}
+
+	return deliveries, nil
+}
+
+func (o *AlertOutbox) readAttempts(ctx context.Context, deliveryId string) ([]AlertDeliveryAttempt, error) {
+	conn, err := o.db.Conn(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get connection: %w", err)
+	}
+	defer func() {
+		err := conn.Close()
+		if err != nil {
+			log.Warn().Err(err).Msg("failed to close connection")
+		}
+	}()
+
+	rows, err := conn.QueryContext(
+		ctx,
+		"SELECT attempt, attempted_at, status_code, error, success FROM alert_delivery_attempts WHERE delivery_id = ? ORDER BY attempt ASC",
+		deliveryId,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read alert delivery attempts: %w", err)
+	}
+	defer func() {
+		if err := rows.Close(); err != nil {
+			log.Warn().Err(err).Msg("failed to close rows")
+		}
+	}()
+
+	attempts := []AlertDeliveryAttempt{}
+	for rows.Next() {
+		var attempt AlertDeliveryAttempt
+		var statusCode sql.NullInt32
+		var attemptError sql.NullString
+		err := rows.Scan(&attempt.Attempt, &attempt.AttemptedAt, &statusCode, &attemptError, &attempt.Success)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+
+		attempt.AttemptedAt = attempt.AttemptedAt.UTC()
+		attempt.StatusCode = int(statusCode.Int32)
+		attempt.Error = attemptError.String
+		attempts = append(attempts, attempt)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate rows: %w", err)
+	}
+
+	return attempts, nil
+}
+
+// RecordAttempt writes an attempt, and the delivery as it is after the attempt.
+func (o *AlertOutbox) RecordAttempt(ctx context.Context, delivery AlertDelivery, attempt AlertDeliveryAttempt) error {
+	span := sentry.StartSpan(ctx, "function", sentry.WithDescription("AlertOutbox.RecordAttempt"))
+	span.SetData("semyi.monitor.id", delivery.MonitorID)
+	ctx = span.Context()
+	defer span.Finish()
+
+	message, err := json.Marshal(delivery.Message)
+	if err != nil {
+		return fmt.Errorf("failed to marshal alert message: %w", err)
+	}
+
+	conn, err := o.db.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get connection: %w", err)
+	}
+	defer func() {
+		err := conn.Close()
+		if err != nil {
+			log.Warn().Err(err).Msg("failed to close connection")
+		}
+	}()
+
+	var statusCode sql.NullInt32
+	var attemptError sql.NullString
+	if attempt.StatusCode != 0 {
+		statusCode = sql.NullInt32{Int32: int32(attempt.StatusCode), Valid: true}
+	}
+	if attempt.Error != "" {
+		attemptError = sql.NullString{String: attempt.Error, Valid: true}
+	}
+
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+
+	rollback := func() {
+		if rollbackErr := tx.Rollback(); rollbackErr != nil {
+			log.Warn().Err(rollbackErr).Msg("failed to rollback transaction")
+		}
+	}
+
+	_, err = tx.ExecContext(
+		ctx,
+		"INSERT INTO alert_delivery_attempts (delivery_id, attempt, attempted_at, status_code, error, success) VALUES (?, ?, ?, ?, ?, ?)",
+		delivery.ID,
+		attempt.Attempt,
+		EnsureUTC(attempt.AttemptedAt),
+		statusCode,
+		attemptError,
+		attempt.Success,
+	)
+	if err != nil {
+		rollback()
+		return fmt.Errorf("failed to insert alert delivery attempt: %w", err)
+	}
+
+	// ClickHouse does not support UPDATE statements, the delivery is replaced instead.
+	_, err = tx.ExecContext(ctx, "DELETE FROM alert_outbox WHERE id = ?", delivery.ID)
+	if err != nil {
+		rollback()
+		return fmt.Errorf("failed to delete alert delivery: %w", err)
+	}
+
+	_, err = tx.ExecContext(
+		ctx,
+		`INSERT INTO alert_outbox
+			(id, monitor_id, provider, message, state, attempt_count, next_attempt_at, last_status_code, last_error, created_at, updated_at)
+		VALUES
+			(?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		delivery.ID,
+		delivery.MonitorID,
+		delivery.Provider,
+		string(message),
+		string(delivery.State),
+		delivery.AttemptCount,
+		EnsureUTC(delivery.NextAttemptAt),
+		statusCode,
+		attemptError,
+		EnsureUTC(delivery.CreatedAt),
+		time.Now().UTC(),
+	)
+	if err != nil {
+		rollback()
+		return fmt.Errorf("failed to insert alert delivery: %w", err)
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,242 @@
+package main_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	main "semyi"
+	"semyi/testutils"
+
+	"github.com/getsentry/sentry-go"
+)
+
+func newOutboxRouter(t *testing.T, outbox *main.AlertOutbox, providers map[string]main.Alerter, monitorId string) *main.AlertRouter {
+	t.Helper()
+	cleanupAlertOutbox(t, monitorId)
+
+	return newMockAlertRouter(t, main.AlertRouterConfig{
+		Monitors: []main.Monitor{{UniqueID: monitorId, Name: "Outbox Monitor"}},
+		Outbox:   outbox,
+	}, providers)
+}
+
+// cleanupAlertOutbox deletes the deliveries of the monitor once the test is done, so they are not picked up by
+// the workers of other tests.
+func cleanupAlertOutbox(t *testing.T, monitorId string) {
+	t.Cleanup(func() {
+		_, err := database.Exec("DELETE FROM alert_delivery_attempts WHERE delivery_id IN (SELECT id FROM alert_outbox WHERE monitor_id = ?)", monitorId)
+		if err != nil {
+			t.Logf("Warning: failed to clean up test data: %v", err)
+		}
+
+		_, err = database.Exec("DELETE FROM alert_outbox WHERE monitor_id = ?", monitorId)
+		if err != nil {
+			t.Logf("Warning: failed to clean up test data: %v", err)
+		}
+	})
+}
+
+func TestAlertOutboxWorker_Retry(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	ctx = sentry.SetHubOnContext(ctx, sentry.CurrentHub())
+
+	// The webhook fails the first request, and accepts the next ones
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if requests == 1 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	working := &MockAlerter{}
+	outbox := main.NewAlertOutbox(database)
+	router := newOutboxRouter(t, outbox, map[string]main.Alerter{
+		"webhook": main.NewHTTPAlertProvider(main.HTTPProviderConfig{WebhookURL: server.URL, HttpClient: server.Client()}),
+		"working": working,
+	}, "outbox-retry")
+	worker, err := main.NewAlertOutboxWorker(outbox, router, main.AlertDeliveryConfig{InitialBackoff: "1m"})
+	testutils.AssertNoError(t, err, "Failed to create alert outbox worker")
+
+	err = router.Send(ctx, main.AlertMessage{MonitorID: "outbox-retry", MonitorName: "Outbox Monitor", Timestamp: time.Now()})
+	testutils.AssertNoError(t, err, "Failed to enqueue alert")
+	testutils.AssertEqual(t, 0, requests, "Alerts should not be sent before the worker runs")
+
+	now := time.Now().UTC()
+	err = worker.Process(ctx, now)
+	testutils.AssertNoError(t, err, "Failed to process outbox")
+	testutils.AssertEqual(t, 1, requests, "Expected a single webhook request")
+	testutils.AssertEqual(t, 1, len(working.alertsSent), "Expected the working provider to be delivered once")
+	testutils.AssertEqual(t, "Outbox Monitor", working.alertsSent[0].Monitor.Name, "Expected the monitor configuration to be restored")
+
+	// The failed delivery waits for its backoff, and the delivered one is not sent again
+	err = worker.Process(ctx, now.Add(30*time.Second))
+	testutils.AssertNoError(t, err, "Failed to process outbox")
+	testutils.AssertEqual(t, 1, requests, "The failed delivery should wait for its backoff")
+	testutils.AssertEqual(t, 1, len(working.alertsSent), "The delivered alert should not be sent again")
+
+	err = worker.Process(ctx, now.Add(time.Minute))
+	testutils.AssertNoError(t, err, "Failed to process outbox")
+	testutils.AssertEqual(t, 2, requests, "The failed delivery should be retried after its backoff")
+
+	deliveries, err := outbox.Read(ctx, main.AlertDeliveryFilter{MonitorID: "outbox-retry", Provider: "webhook"})
+	testutils.AssertNoError(t, err, "Failed to read deliveries")
+	testutils.AssertEqual(t, 1, len(deliveries), "Expected a delivery of the webhook provider")
+	delivery := deliveries[0]
+	testutils.AssertEqual(t, main.AlertDeliveryStateDelivered, delivery.State, "Expected the delivery to succeed")
+	testutils.AssertEqual(t, 2, delivery.AttemptCount, "Unexpected attempt count")
+	testutils.AssertEqual(t, http.StatusNoContent, delivery.LastStatusCode, "Unexpected last status code")
+	testutils.AssertEqual(t, 2, len(delivery.Attempts), "Expected both attempts in the history")
+	testutils.AssertEqual(t, http.StatusBadGateway, delivery.Attempts[0].StatusCode, "Unexpected status code of the first attempt")
+	testutils.AssertEqual(t, false, delivery.Attempts[0].Success, "The first attempt should have failed")
+	testutils.AssertContains(t, delivery.Attempts[0].Error, "502", "Expected the error of the first attempt")
+	testutils.AssertEqual(t, true, delivery.Attempts[1].Success, "The second attempt should have succeeded")
+}
+
+func TestAlertOutboxWorker_GivesUp(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	ctx = sentry.SetHubOnContext(ctx, sentry.CurrentHub())
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	outbox := main.NewAlertOutbox(database)
+	router := newOutboxRouter(t, outbox, map[string]main.Alerter{
+		"webhook": main.NewHTTPAlertProvider(main.HTTPProviderConfig{WebhookURL: server.URL, HttpClient: server.Client()}),
+	}, "outbox-give-up")
+	worker, err := main.NewAlertOutboxWorker(outbox, router, main.AlertDeliveryConfig{MaxAttempts: 3, InitialBackoff: "1s"})
+	testutils.AssertNoError(t, err, "Failed to create alert outbox worker")
+
+	err = router.Send(ctx, main.AlertMessage{MonitorID: "outbox-give-up", Timestamp: time.Now()})
+	testutils.AssertNoError(t, err, "Failed to enqueue alert")
+
+	now := time.Now().UTC()
+	for i := range 5 {
+		err = worker.Process(ctx, now.Add(time.Duration(i)*time.Hour))
+		testutils.AssertNoError(t, err, "Failed to process outbox")
+	}
+
+	deliveries, err := outbox.Read(ctx, main.AlertDeliveryFilter{MonitorID: "outbox-give-up"})
+	testutils.AssertNoError(t, err, "Failed to read deliveries")
+	testutils.AssertEqual(t, 1, len(deliveries), "Expected a single delivery")
+	testutils.AssertEqual(t, main.AlertDeliveryStateFailed, deliveries[0].State, "Expected the delivery to be given up")
+	testutils.AssertEqual(t, 3, len(deliveries[0].Attempts), "Expected no more attempts than configured")
+
+	failed, err := outbox.Read(ctx, main.AlertDeliveryFilter{MonitorID: "outbox-give-up", State: main.AlertDeliveryStatePending})
+	testutils.AssertNoError(t, err, "Failed to read deliveries")
+	testutils.AssertEqual(t, 0, len(failed), "Expected no pending delivery")
+}
+
+func TestAlertOutbox_DeleteExpired(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	ctx = sentry.SetHubOnContext(ctx, sentry.CurrentHub())
+
+	working := &MockAlerter{}
+	outbox := main.NewAlertOutbox(database)
+	router := newOutboxRouter(t, outbox, map[string]main.Alerter{"working": working}, "outbox-expired")
+	worker, err := main.NewAlertOutboxWorker(outbox, router, main.AlertDeliveryConfig{})
+	testutils.AssertNoError(t, err, "Failed to create alert outbox worker")
+
+	err = router.Send(ctx, main.AlertMessage{MonitorID: "outbox-expired", Monitor: main.Monitor{UniqueID: "outbox-expired", Name: "Outbox Monitor"}, Timestamp: time.Now()})
+	testutils.AssertNoError(t, err, "Failed to enqueue alert")
+
+	now := time.Now().UTC()
+	err = worker.Process(ctx, now)
+	testutils.AssertNoError(t, err, "Failed to process outbox")
+	testutils.AssertEqual(t, 1, len(working.alertsSent), "Expected the alert to be delivered")
+
+	// The second alert stays pending, as the worker does not run again
+	err = router.Send(ctx, main.AlertMessage{MonitorID: "outbox-expired", Timestamp: time.Now()})
+	testutils.AssertNoError(t, err, "Failed to enqueue alert")
+
+	deliveries, err := outbox.Read(ctx, main.AlertDeliveryFilter{MonitorID: "outbox-expired"})
+	testutils.AssertNoError(t, err, "Failed to read deliveries")
+	testutils.AssertEqual(t, 2, len(deliveries), "Expected both deliveries")
+	for _, delivery := range deliveries {
+		testutils.AssertEqual(t, "", delivery.Message.Monitor.Name, "The monitor configuration should not be persisted")
+	}
+
+	err = outbox.DeleteExpired(ctx, now.Add(time.Hour))
+	testutils.AssertNoError(t, err, "Failed to delete expired deliveries")
+
+	deliveries, err = outbox.Read(ctx, main.AlertDeliveryFilter{MonitorID: "outbox-expired"})
+	testutils.AssertNoError(t, err, "Failed to read deliveries")
+	testutils.AssertEqual(t, 1, len(deliveries), "Expected only the pending delivery to be kept")
+	testutils.AssertEqual(t, main.AlertDeliveryStatePending, deliveries[0].State, "Expected the pending delivery to be kept")
+
+	var attempts int
+	err = database.QueryRow("SELECT COUNT(*) FROM alert_delivery_attempts WHERE delivery_id NOT IN (SELECT id FROM alert_outbox)").Scan(&attempts)
+	testutils.AssertNoError(t, err, "Failed to count attempts")
+	testutils.AssertEqual(t, 0, attempts, "Expected the attempts of the deleted delivery to be deleted")
+}
+
+func TestAlertOutboxWorker_Backoff(t *testing.T) {
+	worker, err := main.NewAlertOutboxWorker(nil, nil, main.AlertDeliveryConfig{InitialBackoff: "10s", MaxBackoff: "1m"})
+	testutils.AssertNoError(t, err, "Failed to create alert outbox worker")
+
+	testutils.AssertEqual(t, 10*time.Second, worker.Backoff(1), "Unexpected backoff after the first attempt")
+	testutils.AssertEqual(t, 20*time.Second, worker.Backoff(2), "Unexpected backoff after the second attempt")
+	testutils.AssertEqual(t, 40*time.Second, worker.Backoff(3), "Unexpected backoff after the third attempt")
+	testutils.AssertEqual(t, time.Minute, worker.Backoff(10), "The backoff should not exceed the maximum")
+
+	_, err = main.NewAlertOutboxWorker(nil, nil, main.AlertDeliveryConfig{InitialBackoff: "soon"})
+	testutils.AssertError(t, err, "Expected an invalid backoff to be rejected")
+}
+
+func TestServer_AlertDeliveryHistory(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	ctx = sentry.SetHubOnContext(ctx, sentry.CurrentHub())
+
+	cleanupAlertOutbox(t, "outbox-api")
+	outbox := main.NewAlertOutbox(database)
+	err := outbox.Enqueue(ctx, main.AlertMessage{MonitorID: "outbox-api", Timestamp: time.Now()}, []string{"slack", "telegram"})
+	testutils.AssertNoError(t, err, "Failed to enqueue alert")
+
+	server := main.NewServer(main.ServerConfig{
+		MonitorList: []main.Monitor{{UniqueID: "outbox-api"}},
+		AlertOutbox: outbox,
+		ApiKey:      "secret",
+	})
+
+	serve := func(path string, apiKey string) *httptest.ResponseRecorder {
+		request := httptest.NewRequest(http.MethodGet, path, nil)
+		if apiKey != "" {
+			request.Header.Set("X-API-Key", apiKey)
+		}
+		recorder := httptest.NewRecorder()
+		server.Handler.ServeHTTP(recorder, request)
+		return recorder
+	}
+
+	recorder := serve("/api/v1/monitors/outbox-api/alerts/deliveries", "")
+	testutils.AssertEqual(t, http.StatusUnauthorized, recorder.Code, "Expected the API key to be required")
+
+	recorder = serve("/api/v1/monitors/outbox-api/alerts/deliveries?state=lost", "secret")
+	testutils.AssertEqual(t, http.StatusBadRequest, recorder.Code, "Expected an invalid state to be rejected")
+
+	recorder = serve("/api/v1/monitors/unknown/alerts/deliveries", "secret")
+	testutils.AssertEqual(t, http.StatusNotFound, recorder.Code, "Expected an unknown monitor to be rejected")
+
+	recorder = serve("/api/v1/monitors/outbox-api/alerts/deliveries?provider=slack&state=pending", "secret")
+	testutils.AssertEqual(t, http.StatusOK, recorder.Code, "Expected the history to be returned")
+
+	var deliveries []main.AlertDelivery
+	err = json.NewDecoder(recorder.Body).Decode(&deliveries)
+	testutils.AssertNoError(t, err, "Failed to decode deliveries")
+	testutils.AssertEqual(t, 1, len(deliveries), "Expected the delivery of the Slack provider")
+	testutils.AssertEqual(t, "slack", deliveries[0].Provider, "Unexpected provider")
+	testutils.AssertEqual(t, []main.AlertDeliveryAttempt{}, deliveries[0].Attempts, "Expected no attempts yet")
+}
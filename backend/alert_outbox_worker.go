@@ -0,0 +1,158 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/getsentry/sentry-go"
+	"github.com/rs/zerolog/log"
+)
+
+// alertOutboxBatchSize bounds the number of deliveries attempted in a single run of the AlertOutboxWorker.
+const alertOutboxBatchSize = 100
+
+// AlertOutboxWorker delivers the alerts of the AlertOutbox. Failed deliveries are retried with an exponential
+// backoff, each provider on its own, until they succeed or run out of attempts.
+type AlertOutboxWorker struct {
+	outbox         *AlertOutbox
+	router         *AlertRouter
+	maxAttempts    int
+	initialBackoff time.Duration
+	maxBackoff     time.Duration
+}
+
+// NewAlertOutboxWorker creates a new AlertOutboxWorker. An error is returned if the backoff durations are invalid.
+func NewAlertOutboxWorker(outbox *AlertOutbox, router *AlertRouter, config AlertDeliveryConfig) (*AlertOutboxWorker, error) {
+	worker := &AlertOutboxWorker{
+		outbox:         outbox,
+		router:         router,
+		maxAttempts:    config.MaxAttempts,
+		initialBackoff: 30 * time.Second,
+		maxBackoff:     30 * time.Minute,
+	}
+
+	if worker.maxAttempts <= 0 {
+		worker.maxAttempts = 8
+	}
+
+	if config.InitialBackoff != "" {
+		backoff, err := time.ParseDuration(config.InitialBackoff)
+		if err != nil || backoff <= 0 {
+			return nil, fmt.Errorf("initial_backoff must be a valid positive duration")
+		}
+
+		worker.initialBackoff = backoff
+	}
+
+	if config.MaxBackoff != "" {
+		backoff, err := time.ParseDuration(config.MaxBackoff)
+		if err != nil || backoff <= 0 {
+			return nil, fmt.Errorf("max_backoff must be a valid positive duration")
+		}
+
+		worker.maxBackoff = backoff
+	}
+
+	worker.maxBackoff = max(worker.maxBackoff, worker.initialBackoff)
+
+	return worker, nil
+}
+
+// Run delivers the due alerts every few seconds, starting with the alerts left pending before a restart.
+func (w *AlertOutboxWorker) Run(ctx context.Context) {
+	ctx = sentry.SetHubOnContext(ctx, sentry.CurrentHub().Clone())
+
+	ticker := time.NewTicker(5 * time.Second)
+	defer ticker.Stop()
+
+	for {
+		err := w.Process(ctx, time.Now().UTC())
+		if err != nil {
+			log.Error().Err(err).Msg("failed to process alert outbox")
+			sentry.GetHubFromContext(ctx).CaptureException(err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Process attempts every delivery that is due at the given time. The deliveries are attempted concurrently,
+// so a slow provider does not hold back the others.
+func (w *AlertOutboxWorker) Process(ctx context.Context, now time.Time) error {
+	span := sentry.StartSpan(ctx, "function", sentry.WithDescription("AlertOutboxWorker.Process"))
+	ctx = span.Context()
+	defer span.Finish()
+
+	deliveries, err := w.outbox.ReadDue(ctx, now, alertOutboxBatchSize)
+	if err != nil {
+		return fmt.Errorf("failed to read due alert deliveries: %w", err)
+	}
+
+	var wg sync.WaitGroup
+	for _, delivery := range deliveries {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			err := w.attempt(ctx, delivery, now)
+			if err != nil {
+				log.Error().Err(err).Str("delivery_id", delivery.ID).Msg("failed to record alert delivery attempt")
+				sentry.GetHubFromContext(ctx).CaptureException(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	return nil
+}
+
+func (w *AlertOutboxWorker) attempt(ctx context.Context, delivery AlertDelivery, now time.Time) error {
+	ctx, cancel := context.WithTimeout(ctx, time.Minute)
+	defer cancel()
+
+	statusCode, err := w.router.Deliver(ctx, delivery.Provider, delivery.Message)
+
+	delivery.AttemptCount++
+	delivery.LastStatusCode = statusCode
+	attempt := AlertDeliveryAttempt{
+		Attempt:     delivery.AttemptCount,
+		AttemptedAt: now,
+		StatusCode:  statusCode,
+		Success:     err == nil,
+	}
+
+	switch {
+	case err == nil:
+		delivery.State = AlertDeliveryStateDelivered
+		delivery.LastError = ""
+	case delivery.AttemptCount >= w.maxAttempts:
+		delivery.State = AlertDeliveryStateFailed
+		delivery.LastError = err.Error()
+		attempt.Error = err.Error()
+		log.Error().Err(err).Str("delivery_id", delivery.ID).Str("provider", delivery.Provider).Str("monitor_id", delivery.MonitorID).Msg("giving up on alert delivery")
+	default:
+		delivery.NextAttemptAt = now.Add(w.Backoff(delivery.AttemptCount))
+		delivery.LastError = err.Error()
+		attempt.Error = err.Error()
+		log.Warn().Err(err).Str("delivery_id", delivery.ID).Str("provider", delivery.Provider).Time("next_attempt_at", delivery.NextAttemptAt).Msg("failed to deliver alert, retrying")
+	}
+
+	// The attempt is recorded even if the context timed out during the delivery.
+	return w.outbox.RecordAttempt(context.WithoutCancel(ctx), delivery, attempt)
+}
+
+// Backoff returns the delay before the next attempt, after the given number of failed attempts.
+func (w *AlertOutboxWorker) Backoff(attempts int) time.Duration {
+	backoff := w.initialBackoff
+	for i := 1; i < attempts && backoff < w.maxBackoff; i++ {
+		backoff *= 2
+	}
+
+	return min(backoff, w.maxBackoff)
+}
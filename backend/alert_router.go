@@ -0,0 +1,349 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"text/template"
+
+	"github.com/getsentry/sentry-go"
+	"github.com/rs/zerolog/log"
+)
+
+// NewAlertProviders creates every enabled alert provider, by name. The single providers of each type are named
+// after their type, the named providers after their name.
+func NewAlertProviders(config AlertingConfig, httpClient *http.Client) (map[string]Alerter, error) {
+	// The single providers are named providers of their type, named after the type
+	var named []AlertProviderConfig
+	if config.Telegram.Enabled && config.Telegram.URL != "" && config.Telegram.ChatID != "" {
+		named = append(named, AlertProviderConfig{Type: AlertProviderTypeTelegram, URL: config.Telegram.URL, ChatID: config.Telegram.ChatID, Template: config.Telegram.Template})
+	}
+
+	if config.Discord.Enabled && config.Discord.WebhookURL != "" {
+		named = append(named, AlertProviderConfig{Type: AlertProviderTypeDiscord, WebhookURL: config.Discord.WebhookURL, Template: config.Discord.Template})
+	}
+
+	if config.HTTP.Enabled && config.HTTP.WebhookURL != "" {
+		named = append(named, AlertProviderConfig{Type: AlertProviderTypeHTTP, WebhookURL: config.HTTP.WebhookURL, Template: config.HTTP.Template})
+	}
+
+	if config.Slack.Enabled && config.Slack.WebhookURL != "" {
+		named = append(named, AlertProviderConfig{Type: AlertProviderTypeSlack, WebhookURL: config.Slack.WebhookURL, Template: config.Slack.Template})
+	}
+
+	for i := range named {
+		named[i].Name = string(named[i].Type)
+	}
+
+	providers := make(map[string]Alerter)
+	for _, provider := range append(named, config.Providers...) {
+		if provider.Name == "" {
+			return nil, fmt.Errorf("alert provider name is required")
+		}
+
+		if _, ok := providers[provider.Name]; ok {
+			return nil, fmt.Errorf("duplicate alert provider %q", provider.Name)
+		}
+
+		alerter, err := newAlertProvider(provider, httpClient)
+		if err != nil {
+			return nil, fmt.Errorf("alert provider %q: %w", provider.Name, err)
+		}
+
+		providers[provider.Name] = alerter
+	}
+
+	return providers, nil
+}
+
+func newAlertProvider(provider AlertProviderConfig, httpClient *http.Client) (Alerter, error) {
+	var tmpl *template.Template
+	if provider.Template != "" {
+		var err error
+		tmpl, err = NewAlertTemplate(provider.Name, provider.Template)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	switch provider.Type {
+	case AlertProviderTypeTelegram:
+		if provider.URL == "" || provider.ChatID == "" {
+			return nil, fmt.Errorf("url and chat_id are required")
+		}
+
+		return NewTelegramAlertProvider(TelegramProviderConfig{Url: provider.URL, ChatID: provider.ChatID, Template: tmpl, HttpClient: httpClient}), nil
+	case AlertProviderTypeDiscord, AlertProviderTypeHTTP, AlertProviderTypeSlack:
+		if provider.WebhookURL == "" {
+			return nil, fmt.Errorf("webhook_url is required")
+		}
+
+		switch provider.Type {
+		case AlertProviderTypeDiscord:
+			return NewDiscordAlertProvider(DiscordProviderConfig{WebhookURL: provider.WebhookURL, Template: tmpl, HttpClient: httpClient}), nil
+		case AlertProviderTypeHTTP:
+			return NewHTTPAlertProvider(HTTPProviderConfig{WebhookURL: provider.WebhookURL, Template: tmpl, HttpClient: httpClient}), nil
+		default:
+			return NewSlackAlertProvider(SlackProviderConfig{WebhookURL: provider.WebhookURL, Template: tmpl, HttpClient: httpClient}), nil
+		}
+	default:
+		return nil, fmt.Errorf("unknown type %q", provider.Type)
+	}
+}
+
+// AlertRouter sends the alerts of each monitor to the alert providers the monitor references. Alerts of
+// monitors that do not reference any provider, or that are not about a monitor, go to the default providers.
+type AlertRouter struct {
+	providers map[string]Alerter
+	defaults  []string
+	// routes holds the provider names of every monitor that references at least one provider.
+	routes map[string][]string
+	// monitors holds the configuration of every monitor, to describe the monitor in alerts that lack it.
+	monitors map[string]Monitor
+	// templates holds the parsed alert templates of every monitor that has any, by provider type.
+	templates     map[string]map[AlertProviderType]*template.Template
+	statusPageURL string
+	// outbox receives the alerts instead of the providers if not nil, see AlertOutboxWorker.
+	outbox *AlertOutbox
+	// acknowledgeable holds the provider types whose platform has chat-ops enabled.
+	acknowledgeable map[AlertProviderType]bool
+}
+
+type AlertRouterConfig struct {
+	// Providers holds every alert provider by name, see NewAlertProviders.
+	Providers map[string]Alerter
+	// Defaults holds the names of the default providers. Every provider is a default provider if empty.
+	Defaults []string
+	Monitors []Monitor
+	// StatusPageURL is the public URL of the status page, see AlertingConfig.StatusPageURL.
+	StatusPageURL string
+	// Outbox persists the alerts, which are then delivered by an AlertOutboxWorker. Alerts are sent right away
+	// if nil.
+	Outbox *AlertOutbox
+	// ChatOps enables the acknowledge button of the down alerts sent to the configured platforms.
+	ChatOps ChatOpsConfig
+}
+
+// NewAlertRouter creates a new AlertRouter. An error is returned if the alert_providers of a monitor or the
+// defaults reference a provider that does not exist, or if the alert templates of a monitor are invalid. A
+// monitor whose legacy alert_provider does not exist is routed to the defaults instead.
+func NewAlertRouter(config AlertRouterConfig) (*AlertRouter, error) {
+	router := &AlertRouter{
+		providers:     config.Providers,
+		defaults:      config.Defaults,
+		routes:        make(map[string][]string),
+		monitors:      make(map[string]Monitor),
+		templates:     make(map[string]map[AlertProviderType]*template.Template),
+		statusPageURL: strings.TrimRight(config.StatusPageURL, "/"),
+		outbox:        config.Outbox,
+		acknowledgeable: map[AlertProviderType]bool{
+			AlertProviderTypeSlack:    config.ChatOps.SlackSigningSecret != "",
+			AlertProviderTypeDiscord:  config.ChatOps.DiscordPublicKey != "",
+			AlertProviderTypeTelegram: config.ChatOps.TelegramSecretToken != "",
+		},
+	}
+
+	if router.providers == nil {
+		router.providers = make(map[string]Alerter)
+	}
+
+	if len(router.defaults) == 0 {
+		router.defaults = slices.Sorted(maps.Keys(router.providers))
+	}
+
+	for _, name := range router.defaults {
+		if _, ok := router.providers[name]; !ok {
+			return nil, fmt.Errorf("default alert provider %q is not configured", name)
+		}
+	}
+
+	for _, monitor := range config.Monitors {
+		router.monitors[monitor.UniqueID] = monitor
+
+		for providerType, text := range monitor.AlertTemplates {
+			if text == "" {
+				continue
+			}
+
+			tmpl, err := NewAlertTemplate(string(providerType), text)
+			if err != nil {
+				return nil, fmt.Errorf("monitor %q: %w", monitor.UniqueID, err)
+			}
+
+			if router.templates[monitor.UniqueID] == nil {
+				router.templates[monitor.UniqueID] = make(map[AlertProviderType]*template.Template)
+			}
+			router.templates[monitor.UniqueID][providerType] = tmpl
+		}
+
+		names := slices.Clone(monitor.AlertProviders)
+		if monitor.AlertProvider != AlertProviderTypeUnspecified && !slices.Contains(names, string(monitor.AlertProvider)) {
+			// Configurations written before the named providers kept alert_provider set to a provider that
+			// was disabled, so the legacy field falls back to the defaults instead of failing the startup
+			if _, ok := router.providers[string(monitor.AlertProvider)]; ok {
+				names = append(names, string(monitor.AlertProvider))
+			} else {
+				log.Warn().
+					Str("monitor_id", monitor.UniqueID).
+					Str("alert_provider", string(monitor.AlertProvider)).
+					Msg("alert provider is not configured, falling back to the default providers")
+			}
+		}
+
+		if len(names) == 0 {
+			continue
+		}
+
+		for _, name := range names {
+			if _, ok := router.providers[name]; !ok {
+				return nil, fmt.Errorf("monitor %q: alert provider %q is not configured", monitor.UniqueID, name)
+			}
+		}
+
+		router.routes[monitor.UniqueID] = names
+	}
+
+	return router, nil
+}
+
+// Ensure AlertRouter implements Alerter interface
+var _ Alerter = (*AlertRouter)(nil)
+
+// Route returns the names of the alert providers that receive the alerts of a monitor.
+func (r *AlertRouter) Route(monitorId string) []string {
+	if names, ok := r.routes[monitorId]; ok {
+		return names
+	}
+
+	return r.defaults
+}
+
+// Send sends the alert message through every alert provider of its monitor, see SendTo.
+func (r *AlertRouter) Send(ctx context.Context, msg AlertMessage) error {
+	span := sentry.StartSpan(ctx, "function", sentry.WithDescription("AlertRouter.Send"))
+	span.SetData("semyi.monitor.id", msg.MonitorID)
+	ctx = span.Context()
+	defer span.Finish()
+
+	return r.SendTo(ctx, r.Route(msg.MonitorID), msg)
+}
+
+// SendTo sends the alert message through the given alert providers. An error is returned for every provider
+// that failed, after the message has been sent through the other providers. With an outbox, the message is
+// written to the outbox instead, and an error is only returned if that fails.
+func (r *AlertRouter) SendTo(ctx context.Context, providers []string, msg AlertMessage) error {
+	msg = r.describe(msg)
+
+	if r.outbox != nil {
+		err := r.outbox.Enqueue(ctx, msg, providers)
+		if err != nil {
+			return fmt.Errorf("failed to enqueue alert: %w", err)
+		}
+
+		return nil
+	}
+
+	var errs []error
+	for _, name := range providers {
+		alerter, ok := r.providers[name]
+		if !ok {
+			errs = append(errs, fmt.Errorf("alert provider %q is not configured", name))
+			continue
+		}
+
+		err := alerter.Send(ctx, r.acknowledge(alerter, msg))
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to send %s alert: %w", name, err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// TelegramChatIDs returns the chat IDs of the Telegram providers, which are the chats the alerts are sent to.
+func (r *AlertRouter) TelegramChatIDs() []string {
+	var chatIds []string
+	for _, name := range slices.Sorted(maps.Keys(r.providers)) {
+		if telegram, ok := r.providers[name].(*TelegramProvider); ok && !slices.Contains(chatIds, telegram.chatID) {
+			chatIds = append(chatIds, telegram.chatID)
+		}
+	}
+
+	return chatIds
+}
+
+// HasProvider returns true if an alert provider with the given name is configured.
+func (r *AlertRouter) HasProvider(name string) bool {
+	_, ok := r.providers[name]
+	return ok
+}
+
+// Deliver sends the alert message through a single alert provider, and returns the status code of the
+// provider's response if the provider reports it, see AlertDeliverer.
+func (r *AlertRouter) Deliver(ctx context.Context, provider string, msg AlertMessage) (int, error) {
+	alerter, ok := r.providers[provider]
+	if !ok {
+		return 0, fmt.Errorf("alert provider %q is not configured", provider)
+	}
+
+	// The outbox does not keep the configuration of the monitor, which holds the alert templates.
+	if monitor, ok := r.monitors[msg.MonitorID]; ok {
+		msg.Monitor = monitor
+	}
+	msg.templates = r.templates[msg.MonitorID]
+
+	msg = r.acknowledge(alerter, msg)
+
+	if deliverer, ok := alerter.(AlertDeliverer); ok {
+		return deliverer.Deliver(ctx, msg)
+	}
+
+	return 0, alerter.Send(ctx, msg)
+}
+
+// describe fills in the public URL, the description and the status page link of the monitor of an alert message,
+// unless the message already has them, and attaches the parsed alert templates of the monitor.
+func (r *AlertRouter) describe(msg AlertMessage) AlertMessage {
+	if msg.MonitorID == "" {
+		return msg
+	}
+
+	msg.templates = r.templates[msg.MonitorID]
+
+	if monitor, ok := r.monitors[msg.MonitorID]; ok {
+		if msg.PublicURL == "" {
+			msg.PublicURL = monitor.PublicUrl
+		}
+
+		if msg.Description == "" {
+			msg.Description = monitor.Description
+		}
+	}
+
+	if msg.StatusPageURL == "" && r.statusPageURL != "" {
+		msg.StatusPageURL = r.statusPageURL + "/by?id=" + url.QueryEscape(msg.MonitorID)
+	}
+
+	return msg
+}
+
+// acknowledge offers the acknowledge action in the down alerts of a provider whose platform has chat-ops enabled.
+func (r *AlertRouter) acknowledge(alerter Alerter, msg AlertMessage) AlertMessage {
+	var providerType AlertProviderType
+	switch alerter.(type) {
+	case *SlackProvider:
+		providerType = AlertProviderTypeSlack
+	case *DiscordProvider:
+		providerType = AlertProviderTypeDiscord
+	case *TelegramProvider:
+		providerType = AlertProviderTypeTelegram
+	}
+
+	msg.Acknowledgeable = msg.MonitorID != "" && msg.Status == MonitorStatusFailure && r.acknowledgeable[providerType]
+	return msg
+}
@@ -0,0 +1,125 @@
+package main_test
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	main "semyi"
+	"semyi/testutils"
+)
+
+func TestNewAlertProviders(t *testing.T) {
+	providers, err := main.NewAlertProviders(main.AlertingConfig{
+		Slack: main.SlackConfig{Enabled: true, WebhookURL: "https://hooks.slack.com/services/default"},
+		// Disabled providers are not created
+		Discord: main.DiscordConfig{Enabled: false, WebhookURL: "https://discord.com/api/webhooks/default"},
+		Providers: []main.AlertProviderConfig{
+			{Name: "team-a-slack", Type: main.AlertProviderTypeSlack, WebhookURL: "https://hooks.slack.com/services/team-a"},
+			{Name: "team-b-telegram", Type: main.AlertProviderTypeTelegram, URL: "https://api.telegram.org", ChatID: "123"},
+		},
+	}, http.DefaultClient)
+	testutils.AssertNoError(t, err, "Failed to create alert providers")
+	testutils.AssertEqual(t, 3, len(providers), "Unexpected number of providers")
+	testutils.AssertNotNil(t, providers["slack"], "Expected the single Slack provider to be named after its type")
+	testutils.AssertNotNil(t, providers["team-a-slack"], "Expected the named Slack provider")
+	testutils.AssertNotNil(t, providers["team-b-telegram"], "Expected the named Telegram provider")
+
+	tests := []struct {
+		name      string
+		providers []main.AlertProviderConfig
+	}{
+		{name: "missing name", providers: []main.AlertProviderConfig{{Type: main.AlertProviderTypeSlack, WebhookURL: "https://example.com"}}},
+		{name: "duplicate name", providers: []main.AlertProviderConfig{
+			{Name: "ops", Type: main.AlertProviderTypeSlack, WebhookURL: "https://example.com"},
+			{Name: "ops", Type: main.AlertProviderTypeDiscord, WebhookURL: "https://example.com"},
+		}},
+		{name: "unknown type", providers: []main.AlertProviderConfig{{Name: "ops", Type: "pager", WebhookURL: "https://example.com"}}},
+		{name: "missing webhook", providers: []main.AlertProviderConfig{{Name: "ops", Type: main.AlertProviderTypeHTTP}}},
+		{name: "missing chat", providers: []main.AlertProviderConfig{{Name: "ops", Type: main.AlertProviderTypeTelegram, URL: "https://api.telegram.org"}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := main.NewAlertProviders(main.AlertingConfig{Providers: tt.providers}, http.DefaultClient)
+			testutils.AssertError(t, err, "Expected an invalid provider to be rejected")
+		})
+	}
+}
+
+func TestAlertRouter(t *testing.T) {
+	teamA := &MockAlerter{}
+	teamB := &MockAlerter{}
+	legacy := &MockAlerter{}
+	providers := map[string]main.Alerter{"team-a": teamA, "team-b": teamB, "telegram": legacy}
+
+	router, err := main.NewAlertRouter(main.AlertRouterConfig{
+		Providers: providers,
+		Defaults:  []string{"team-b"},
+		Monitors: []main.Monitor{
+			{UniqueID: "staging", AlertProviders: []string{"team-a"}},
+			{UniqueID: "legacy", AlertProvider: main.AlertProviderTypeTelegram},
+			{UniqueID: "both", AlertProviders: []string{"team-a"}, AlertProvider: main.AlertProviderTypeTelegram},
+			{UniqueID: "production"},
+		},
+	})
+	testutils.AssertNoError(t, err, "Failed to create alert router")
+
+	for _, monitorId := range []string{"staging", "legacy", "both", "production", ""} {
+		err := router.Send(context.Background(), main.AlertMessage{MonitorID: monitorId})
+		testutils.AssertNoError(t, err, "Failed to send alert")
+	}
+
+	testutils.AssertEqual(t, 2, len(teamA.alertsSent), "Expected the alerts of the monitors that reference team-a")
+	testutils.AssertEqual(t, "staging", teamA.alertsSent[0].MonitorID, "Unexpected team-a alert")
+	testutils.AssertEqual(t, 2, len(legacy.alertsSent), "Expected the alerts of the monitors that set alert_provider")
+	// Alerts that are not about a configured monitor go to the default providers
+	testutils.AssertEqual(t, 2, len(teamB.alertsSent), "Expected the alerts of the other monitors")
+	testutils.AssertEqual(t, "production", teamB.alertsSent[0].MonitorID, "Unexpected team-b alert")
+
+	router, err = main.NewAlertRouter(main.AlertRouterConfig{Providers: providers})
+	testutils.AssertNoError(t, err, "Failed to create alert router")
+	testutils.AssertEqual(t, []string{"team-a", "team-b", "telegram"}, router.Route("production"), "Expected every provider to be a default provider")
+
+	_, err = main.NewAlertRouter(main.AlertRouterConfig{
+		Providers: providers,
+		Monitors:  []main.Monitor{{UniqueID: "staging", AlertProviders: []string{"team-c"}}},
+	})
+	testutils.AssertError(t, err, "Expected an unknown provider to be rejected")
+
+	router, err = main.NewAlertRouter(main.AlertRouterConfig{
+		Providers: providers,
+		Defaults:  []string{"team-b"},
+		Monitors: []main.Monitor{
+			{UniqueID: "legacy", AlertProvider: main.AlertProviderTypeDiscord},
+			{UniqueID: "both", AlertProviders: []string{"team-a"}, AlertProvider: main.AlertProviderTypeDiscord},
+		},
+	})
+	testutils.AssertNoError(t, err, "Expected an unknown legacy provider to be ignored")
+	testutils.AssertEqual(t, []string{"team-b"}, router.Route("legacy"), "Expected the default providers")
+	testutils.AssertEqual(t, []string{"team-a"}, router.Route("both"), "Expected the named providers")
+
+	_, err = main.NewAlertRouter(main.AlertRouterConfig{Providers: providers, Defaults: []string{"team-c"}})
+	testutils.AssertError(t, err, "Expected an unknown default provider to be rejected")
+}
+
+func TestAlertRouter_DescribesMonitor(t *testing.T) {
+	alerter := &MockAlerter{}
+	router, err := main.NewAlertRouter(main.AlertRouterConfig{
+		Providers: map[string]main.Alerter{"mock": alerter},
+		Monitors: []main.Monitor{
+			{UniqueID: "checkout api", Description: "Checkout backend", PublicUrl: "https://shop.example.com"},
+		},
+		StatusPageURL: "https://status.example.com/",
+	})
+	testutils.AssertNoError(t, err, "Failed to create alert router")
+
+	err = router.Send(context.Background(), main.AlertMessage{MonitorID: "checkout api", Title: "SLO burn rate"})
+	testutils.AssertNoError(t, err, "Failed to send alert")
+
+	testutils.AssertEqual(t, 1, len(alerter.alertsSent), "Expected one alert")
+	msg := alerter.alertsSent[0]
+	testutils.AssertEqual(t, "Checkout backend", msg.Description, "Expected the description of the monitor")
+	testutils.AssertEqual(t, "https://shop.example.com", msg.PublicURL, "Expected the public URL of the monitor")
+	testutils.AssertEqual(t, "https://status.example.com/by?id=checkout+api", msg.StatusPageURL, "Expected a link to the monitor page")
+}
@@ -0,0 +1,816 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/getsentry/sentry-go"
+	"github.com/google/uuid"
+	"github.com/rs/zerolog/log"
+)
+
+// AlertType classifies the alert of a status transition.
+type AlertType string
+
+const (
+	AlertTypeDown     AlertType = "down"
+	AlertTypeDegraded AlertType = "degraded"
+	// AlertTypeTLS is a down alert caused by a TLS certificate or handshake error.
+	AlertTypeTLS      AlertType = "tls"
+	AlertTypeRecovery AlertType = "recovery"
+)
+
+// AlertRule filters the alerts of the monitors it matches. Rules apply to the alerts sent by the Processor,
+// before they are routed to the alert providers. The escalation of a down alert only starts once the alert
+// passes the rules, so dropped alerts are not escalated, see EscalationPolicy.
+type AlertRule struct {
+	// Name identifies the rule in the logs.
+	Name string `json:"name" yaml:"name" toml:"name"`
+	// Tags matches the monitors that have at least one of the tags, see Monitor.Tags. Every monitor is
+	// matched if empty.
+	Tags []string `json:"tags" yaml:"tags" toml:"tags"`
+	// Types matches the alerts of the given types: "down", "degraded", "tls" or "recovery". Every alert is
+	// matched if empty, including the alerts that are not about a status transition, such as SLO alerts.
+	Types []AlertType `json:"types" yaml:"types" toml:"types"`
+	// Drop drops every matched alert.
+	Drop bool `json:"drop" yaml:"drop" toml:"drop"`
+	// MinOutageDuration holds the matched alerts for the given duration, in Go's duration format (e.g., "5m").
+	// If the monitor recovers in the meantime, both the held alert and the recovery alert are dropped.
+	MinOutageDuration string `json:"min_outage_duration" yaml:"min_outage_duration" toml:"min_outage_duration"`
+	// QuietHours drops the matched alerts within any of the given time windows.
+	QuietHours []AlertQuietHours `json:"quiet_hours" yaml:"quiet_hours" toml:"quiet_hours"`
+}
+
+// AlertQuietHours is a daily time window, such as from "22:00" to "07:00". A window that ends before it starts
+// ends on the next day.
+type AlertQuietHours struct {
+	// Start and End specify the time of day in the "15:04" format.
+	Start string `json:"start" yaml:"start" toml:"start"`
+	End   string `json:"end" yaml:"end" toml:"end"`
+	// Days specifies the days the window starts on, such as "sat" and "sun". Defaults to every day.
+	Days []string `json:"days" yaml:"days" toml:"days"`
+	// Timezone specifies the IANA time zone of the window (e.g., "Asia/Jakarta"). Defaults to UTC.
+	Timezone string `json:"timezone" yaml:"timezone" toml:"timezone"`
+}
+
+// AlertGroupingConfig groups the alerts that happen at about the same time, such as when a network outage takes
+// down many monitors at once.
+type AlertGroupingConfig struct {
+	// Window specifies how long alerts are collected after the first one, in Go's duration format (e.g., "30s").
+	// Grouping is disabled if empty.
+	Window string `json:"window" yaml:"window" toml:"window"`
+	// MinAlerts specifies how many alerts of the same alert providers are summarized into one notification.
+	// Fewer alerts are sent one by one. Defaults to 3.
+	MinAlerts int `json:"min_alerts" yaml:"min_alerts" toml:"min_alerts"`
+}
+
+// alertSummaryMaxLines bounds the number of monitors listed in a summarized notification.
+const alertSummaryMaxLines = 20
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday,
+	"thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+}
+
+type quietHours struct {
+	// start and end are in minutes since midnight.
+	start, end int
+	// days is empty for every day.
+	days     []time.Weekday
+	location *time.Location
+}
+
+type alertRule struct {
+	name       string
+	tags       []string
+	types      []AlertType
+	drop       bool
+	hold       time.Duration
+	quietHours []quietHours
+}
+
+// PendingAlertKind is the reason the alert rules have not sent an alert yet.
+type PendingAlertKind string
+
+const (
+	// PendingAlertKindHeld alerts are held by MinOutageDuration until due.
+	PendingAlertKindHeld PendingAlertKind = "held"
+	// PendingAlertKindGrouped alerts are collected into the group until its window has passed.
+	PendingAlertKindGrouped PendingAlertKind = "grouped"
+)
+
+// PendingAlert is an alert that the alert rules hold or collect into a group.
+type PendingAlert struct {
+	ID      string
+	Kind    PendingAlertKind
+	Message AlertMessage
+	// Due is the time a held alert is released, or the time the window of the group passes.
+	Due time.Time
+	// OutageStartedAt is the start of the outage, which the escalation of the alert is based on.
+	OutageStartedAt time.Time
+	CreatedAt       time.Time
+}
+
+// PendingAlertStore persists the pending alerts of the alert rules, so they are not lost on a restart.
+type PendingAlertStore struct {
+	db *sql.DB
+}
+
+func NewPendingAlertStore(db *sql.DB) *PendingAlertStore {
+	return &PendingAlertStore{db: db}
+}
+
+// Save writes a pending alert.
+func (s *PendingAlertStore) Save(ctx context.Context, alert PendingAlert) error {
+	span := sentry.StartSpan(ctx, "function", sentry.WithDescription("PendingAlertStore.Save"))
+	span.SetData("semyi.monitor.id", alert.Message.MonitorID)
+	ctx = span.Context()
+	defer span.Finish()
+
+	// The configuration of the monitor is restored by AlertRules.Hydrate, it is not persisted.
+	msg := alert.Message
+	msg.Monitor = Monitor{}
+	message, err := json.Marshal(msg)
+	if err != nil {
+		return fmt.Errorf("failed to marshal alert message: %w", err)
+	}
+
+	conn, err := s.db.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get connection: %w", err)
+	}
+	defer func() {
+		err := conn.Close()
+		if err != nil {
+			log.Warn().Err(err).Msg("failed to close connection")
+		}
+	}()
+
+	_, err = conn.ExecContext(
+		ctx,
+		`INSERT INTO alert_pending
+			(id, monitor_id, kind, message, due, outage_started_at, created_at)
+		VALUES
+			(?, ?, ?, ?, ?, ?, ?)`,
+		alert.ID,
+		msg.MonitorID,
+		string(alert.Kind),
+		string(message),
+		EnsureUTC(alert.Due),
+		EnsureUTC(alert.OutageStartedAt),
+		EnsureUTC(alert.CreatedAt),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to insert pending alert: %w", err)
+	}
+
+	return nil
+}
+
+// Delete removes the pending alerts with the given IDs, once they are sent or dropped.
+func (s *PendingAlertStore) Delete(ctx context.Context, ids []string) error {
+	span := sentry.StartSpan(ctx, "function", sentry.WithDescription("PendingAlertStore.Delete"))
+	ctx = span.Context()
+	defer span.Finish()
+
+	if len(ids) == 0 {
+		return nil
+	}
+
+	conn, err := s.db.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get connection: %w", err)
+	}
+	defer func() {
+		err := conn.Close()
+		if err != nil {
+			log.Warn().Err(err).Msg("failed to close connection")
+		}
+	}()
+
+	args := make([]any, len(ids))
+	for i, id := range ids {
+		args[i] = id
+	}
+
+	_, err = conn.ExecContext(
+		ctx,
+		fmt.Sprintf("DELETE FROM alert_pending WHERE id IN (%s)", strings.TrimSuffix(strings.Repeat("?, ", len(ids)), ", ")),
+		args...,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to delete pending alerts: %w", err)
+	}
+
+	return nil
+}
+
+// Read returns every pending alert, from the oldest to the newest.
+func (s *PendingAlertStore) Read(ctx context.Context) ([]PendingAlert, error) {
+	span := sentry.StartSpan(ctx, "function", sentry.WithDescription("PendingAlertStore.Read"))
+	ctx = span.Context()
+	defer span.Finish()
+
+	conn, err := s.db.Conn(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get connection: %w", err)
+	}
+	defer func() {
+		err := conn.Close()
+		if err != nil {
+			log.Warn().Err(err).Msg("failed to close connection")
+		}
+	}()
+
+	rows, err := conn.QueryContext(ctx, "SELECT id, kind, message, due, outage_started_at, created_at FROM alert_pending ORDER BY created_at ASC")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read pending alerts: %w", err)
+	}
+	defer func() {
+		if err := rows.Close(); err != nil {
+			log.Warn().Err(err).Msg("failed to close rows")
+		}
+	}()
+
+	var alerts []PendingAlert
+	for rows.Next() {
+		var alert PendingAlert
+		var kind, message string
+		err := rows.Scan(&alert.ID, &kind, &message, &alert.Due, &alert.OutageStartedAt, &alert.CreatedAt)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+
+		err = json.Unmarshal([]byte(message), &alert.Message)
+		if err != nil {
+			return nil, fmt.Errorf("failed to unmarshal alert message of pending alert %s: %w", alert.ID, err)
+		}
+
+		alert.Kind = PendingAlertKind(kind)
+		alert.Due = alert.Due.UTC()
+		alert.OutageStartedAt = alert.OutageStartedAt.UTC()
+		alert.CreatedAt = alert.CreatedAt.UTC()
+		alerts = append(alerts, alert)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate rows: %w", err)
+	}
+
+	return alerts, nil
+}
+
+// AlertRules filters, holds and groups the alerts of the Processor before they reach the AlertRouter.
+type AlertRules struct {
+	router   *AlertRouter
+	rules    []alertRule
+	monitors map[string]Monitor
+	// groupWindow is zero if grouping is disabled.
+	groupWindow time.Duration
+	groupMin    int
+	// store and escalations are optional.
+	store       *PendingAlertStore
+	escalations *Escalator
+
+	mutex sync.Mutex
+	held  map[string]PendingAlert
+	// group holds the alerts collected since groupStart.
+	group      []PendingAlert
+	groupStart time.Time
+}
+
+type AlertRulesConfig struct {
+	Rules    []AlertRule
+	Grouping AlertGroupingConfig
+	Monitors []Monitor
+	// Router sends the alerts that pass the rules.
+	Router *AlertRouter
+	// Store persists the held and grouped alerts, see AlertRules.Hydrate. It is optional.
+	Store *PendingAlertStore
+	// Escalations is started by the down alerts that pass the rules, and stopped by the recoveries even if the
+	// rules drop them. It is optional.
+	Escalations *Escalator
+}
+
+// NewAlertRules creates a new AlertRules. An error is returned if a rule or the grouping is invalid.
+func NewAlertRules(config AlertRulesConfig) (*AlertRules, error) {
+	rules := &AlertRules{
+		router:      config.Router,
+		monitors:    make(map[string]Monitor),
+		groupMin:    config.Grouping.MinAlerts,
+		store:       config.Store,
+		escalations: config.Escalations,
+		held:        make(map[string]PendingAlert),
+	}
+
+	for i, rule := range config.Rules {
+		name := rule.Name
+		if name == "" {
+			name = fmt.Sprintf("#%d", i+1)
+		}
+
+		parsed := alertRule{name: name, tags: rule.Tags, types: rule.Types, drop: rule.Drop}
+		for _, alertType := range rule.Types {
+			switch alertType {
+			case AlertTypeDown, AlertTypeDegraded, AlertTypeTLS, AlertTypeRecovery:
+			default:
+				return nil, fmt.Errorf("alert rule %s: unknown type %q", name, alertType)
+			}
+		}
+
+		if rule.MinOutageDuration != "" {
+			hold, err := time.ParseDuration(rule.MinOutageDuration)
+			if err != nil || hold <= 0 {
+				return nil, fmt.Errorf("alert rule %s: min_outage_duration must be a valid positive duration", name)
+			}
+
+			parsed.hold = hold
+		}
+
+		for _, window := range rule.QuietHours {
+			quiet, err := parseQuietHours(window)
+			if err != nil {
+				return nil, fmt.Errorf("alert rule %s: %w", name, err)
+			}
+
+			parsed.quietHours = append(parsed.quietHours, quiet)
+		}
+
+		if !parsed.drop && parsed.hold == 0 && len(parsed.quietHours) == 0 {
+			return nil, fmt.Errorf("alert rule %s: one of drop, min_outage_duration or quiet_hours is required", name)
+		}
+
+		rules.rules = append(rules.rules, parsed)
+	}
+
+	if config.Grouping.Window != "" {
+		window, err := time.ParseDuration(config.Grouping.Window)
+		if err != nil || window <= 0 {
+			return nil, fmt.Errorf("grouping window must be a valid positive duration")
+		}
+
+		rules.groupWindow = window
+	}
+
+	if rules.groupMin <= 0 {
+		rules.groupMin = 3
+	}
+
+	for _, monitor := range config.Monitors {
+		rules.monitors[monitor.UniqueID] = monitor
+	}
+
+	return rules, nil
+}
+
+func parseQuietHours(window AlertQuietHours) (quietHours, error) {
+	quiet := quietHours{location: time.UTC}
+
+	start, err := time.Parse("15:04", window.Start)
+	if err != nil {
+		return quietHours{}, fmt.Errorf("quiet hours start must be in the 15:04 format")
+	}
+
+	end, err := time.Parse("15:04", window.End)
+	if err != nil {
+		return quietHours{}, fmt.Errorf("quiet hours end must be in the 15:04 format")
+	}
+
+	quiet.start = start.Hour()*60 + start.Minute()
+	quiet.end = end.Hour()*60 + end.Minute()
+
+	for _, day := range window.Days {
+		weekday, ok := weekdays[strings.ToLower(day)]
+		if !ok {
+			return quietHours{}, fmt.Errorf("unknown day %q", day)
+		}
+
+		quiet.days = append(quiet.days, weekday)
+	}
+
+	if window.Timezone != "" {
+		quiet.location, err = time.LoadLocation(window.Timezone)
+		if err != nil {
+			return quietHours{}, fmt.Errorf("failed to load timezone %q: %w", window.Timezone, err)
+		}
+	}
+
+	return quiet, nil
+}
+
+// contains returns true if the time is within the quiet hours. A window with the same start and end lasts
+// the whole day.
+func (q quietHours) contains(t time.Time) bool {
+	t = t.In(q.location)
+	minute := t.Hour()*60 + t.Minute()
+
+	startsOn := func(day time.Weekday) bool {
+		return len(q.days) == 0 || slices.Contains(q.days, day)
+	}
+
+	if q.start < q.end {
+		return startsOn(t.Weekday()) && minute >= q.start && minute < q.end
+	}
+
+	if q.start == q.end {
+		return startsOn(t.Weekday())
+	}
+
+	// The window ends on the next day
+	return (startsOn(t.Weekday()) && minute >= q.start) || (startsOn(t.AddDate(0, 0, -1).Weekday()) && minute < q.end)
+}
+
+// Classify returns the type of an alert, which is empty if the alert is not about a status transition.
+func (a *AlertRules) Classify(msg AlertMessage) AlertType {
+	if msg.Status == msg.PreviousStatus {
+		return ""
+	}
+
+	switch msg.Status {
+	case MonitorStatusSuccess:
+		return AlertTypeRecovery
+	case MonitorStatusFailure:
+		reason := strings.ToLower(msg.AdditionalMessage)
+		if strings.Contains(reason, "tls") || strings.Contains(reason, "x509") {
+			return AlertTypeTLS
+		}
+
+		return AlertTypeDown
+	case MonitorStatusDegradedPerformance, MonitorStatusLimitedAvailability:
+		return AlertTypeDegraded
+	default:
+		return ""
+	}
+}
+
+// Hydrate restores the alerts that were held or grouped before a restart. Held alerts that came due while the
+// process was down, and groups whose window has passed, are sent by the next Evaluate.
+func (a *AlertRules) Hydrate(ctx context.Context) error {
+	if a.store == nil {
+		return nil
+	}
+
+	alerts, err := a.store.Read(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to read pending alerts: %w", err)
+	}
+
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	for _, alert := range alerts {
+		if monitor, ok := a.monitors[alert.Message.MonitorID]; ok {
+			alert.Message.Monitor = monitor
+		}
+
+		switch alert.Kind {
+		case PendingAlertKindHeld:
+			a.held[alert.Message.MonitorID] = alert
+		case PendingAlertKindGrouped:
+			// The group starts with its oldest alert, even if the window changed since
+			if start := alert.Due.Add(-a.groupWindow); len(a.group) == 0 || start.Before(a.groupStart) {
+				a.groupStart = start
+			}
+			a.group = append(a.group, alert)
+		}
+	}
+
+	return nil
+}
+
+// Ensure AlertRules implements Alerter interface
+var _ Alerter = (*AlertRules)(nil)
+
+// Send applies the rules to the alert message, see Apply. The outage is assumed to start with the alert.
+func (a *AlertRules) Send(ctx context.Context, msg AlertMessage) error {
+	return a.Apply(ctx, msg, msg.Timestamp)
+}
+
+// Apply applies the rules to the alert message. The alert is dropped, held, collected into a group, or routed
+// right away. The time of the alert is its timestamp, and startedAt is the start of the outage, which the
+// escalation of a down alert is based on.
+func (a *AlertRules) Apply(ctx context.Context, msg AlertMessage, startedAt time.Time) error {
+	span := sentry.StartSpan(ctx, "function", sentry.WithDescription("AlertRules.Apply"))
+	span.SetData("semyi.monitor.id", msg.MonitorID)
+	ctx = span.Context()
+	defer span.Finish()
+
+	now := msg.Timestamp
+	if now.IsZero() {
+		now = time.Now().UTC()
+	}
+
+	if startedAt.IsZero() {
+		startedAt = now
+	}
+
+	alertType := a.Classify(msg)
+
+	a.mutex.Lock()
+	held, isHeld := a.held[msg.MonitorID]
+	if isHeld && alertType != "" {
+		delete(a.held, msg.MonitorID)
+	}
+	a.mutex.Unlock()
+
+	if isHeld && alertType != "" {
+		// The monitor changed status again before the held alert was due
+		a.deletePending(ctx, held.ID)
+		if alertType == AlertTypeRecovery {
+			log.Debug().Str("monitor_id", msg.MonitorID).Msg("monitor recovered before the held alert was due, dropping both alerts")
+			return nil
+		}
+	}
+
+	var hold time.Duration
+	for _, rule := range a.rules {
+		if !a.matches(rule, msg, alertType) {
+			continue
+		}
+
+		if rule.drop {
+			log.Debug().Str("monitor_id", msg.MonitorID).Str("rule", rule.name).Msg("alert dropped by rule")
+			a.stopEscalation(ctx, msg, alertType)
+			return nil
+		}
+
+		for _, quiet := range rule.quietHours {
+			if quiet.contains(now) {
+				log.Debug().Str("monitor_id", msg.MonitorID).Str("rule", rule.name).Msg("alert dropped by quiet hours")
+				a.stopEscalation(ctx, msg, alertType)
+				return nil
+			}
+		}
+
+		hold = max(hold, rule.hold)
+	}
+
+	// Only the alerts that a recovery can cancel are held
+	if hold > 0 && alertType != "" && alertType != AlertTypeRecovery {
+		pending := PendingAlert{
+			ID:              uuid.New().String(),
+			Kind:            PendingAlertKindHeld,
+			Message:         msg,
+			Due:             now.Add(hold),
+			OutageStartedAt: startedAt,
+			CreatedAt:       now,
+		}
+		a.savePending(ctx, pending)
+
+		a.mutex.Lock()
+		a.held[msg.MonitorID] = pending
+		a.mutex.Unlock()
+		return nil
+	}
+
+	return a.dispatch(ctx, msg, alertType, startedAt, now)
+}
+
+// stopEscalation stops the escalation of a monitor that left the failure status, whose alert was dropped.
+func (a *AlertRules) stopEscalation(ctx context.Context, msg AlertMessage, alertType AlertType) {
+	if a.escalations != nil && alertType != "" && msg.Status != MonitorStatusFailure {
+		a.escalations.Stop(ctx, msg.MonitorID)
+	}
+}
+
+// savePending persists a pending alert. A failure is only logged, the alert is still pending in memory.
+func (a *AlertRules) savePending(ctx context.Context, alert PendingAlert) {
+	if a.store == nil {
+		return
+	}
+
+	err := a.store.Save(ctx, alert)
+	if err != nil {
+		log.Error().Err(err).Str("monitor_id", alert.Message.MonitorID).Msg("failed to save pending alert")
+		sentry.GetHubFromContext(ctx).CaptureException(err)
+	}
+}
+
+// deletePending removes the pending alerts that were sent or dropped.
+func (a *AlertRules) deletePending(ctx context.Context, ids ...string) {
+	if a.store == nil {
+		return
+	}
+
+	err := a.store.Delete(ctx, ids)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to delete pending alerts")
+		sentry.GetHubFromContext(ctx).CaptureException(err)
+	}
+}
+
+func (a *AlertRules) matches(rule alertRule, msg AlertMessage, alertType AlertType) bool {
+	if len(rule.types) > 0 && !slices.Contains(rule.types, alertType) {
+		return false
+	}
+
+	if len(rule.tags) == 0 {
+		return true
+	}
+
+	tags := msg.Monitor.Tags
+	if monitor, ok := a.monitors[msg.MonitorID]; ok {
+		tags = monitor.Tags
+	}
+
+	for _, tag := range tags {
+		if slices.Contains(rule.tags, tag) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// dispatch starts or stops the escalation of the alerts of status transitions, then collects them into the
+// group if grouping is enabled. The other alerts are routed right away.
+func (a *AlertRules) dispatch(ctx context.Context, msg AlertMessage, alertType AlertType, startedAt time.Time, now time.Time) error {
+	if a.escalations != nil && alertType != "" {
+		a.escalations.Observe(ctx, msg, startedAt)
+	}
+
+	if len(a.router.Route(msg.MonitorID)) == 0 {
+		log.Warn().Str("monitor_id", msg.MonitorID).Msg("no alert providers are set, skipping alert")
+		return nil
+	}
+
+	if a.groupWindow == 0 || alertType == "" {
+		return a.router.Send(ctx, msg)
+	}
+
+	pending := PendingAlert{
+		ID:              uuid.New().String(),
+		Kind:            PendingAlertKindGrouped,
+		Message:         msg,
+		OutageStartedAt: startedAt,
+		CreatedAt:       now,
+	}
+
+	a.mutex.Lock()
+	pending.Due = now.Add(a.groupWindow)
+	if len(a.group) > 0 {
+		pending.Due = a.groupStart.Add(a.groupWindow)
+	}
+	a.mutex.Unlock()
+
+	a.savePending(ctx, pending)
+
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	if len(a.group) == 0 {
+		a.groupStart = now
+	}
+	a.group = append(a.group, pending)
+
+	return nil
+}
+
+// Run releases the held alerts and sends the groups every second.
+func (a *AlertRules) Run(ctx context.Context) {
+	ctx = sentry.SetHubOnContext(ctx, sentry.CurrentHub().Clone())
+
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			err := a.Evaluate(ctx, now.UTC())
+			if err != nil {
+				log.Error().Err(err).Msg("failed to send alerts")
+				sentry.GetHubFromContext(ctx).CaptureException(err)
+			}
+		}
+	}
+}
+
+// Evaluate releases the held alerts that are due at the given time, and sends the group once its window has
+// passed. The alerts of a group that share the same alert providers are summarized into one notification if
+// there are at least MinAlerts of them.
+func (a *AlertRules) Evaluate(ctx context.Context, now time.Time) error {
+	span := sentry.StartSpan(ctx, "function", sentry.WithDescription("AlertRules.Evaluate"))
+	ctx = span.Context()
+	defer span.Finish()
+
+	var errs []error
+
+	var released []PendingAlert
+	a.mutex.Lock()
+	for monitorId, held := range a.held {
+		if !held.Due.After(now) {
+			released = append(released, held)
+			delete(a.held, monitorId)
+		}
+	}
+	a.mutex.Unlock()
+
+	slices.SortFunc(released, func(x, y PendingAlert) int {
+		return x.Due.Compare(y.Due)
+	})
+	for _, held := range released {
+		a.deletePending(ctx, held.ID)
+
+		err := a.dispatch(ctx, held.Message, a.Classify(held.Message), held.OutageStartedAt, held.Due)
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	a.mutex.Lock()
+	var group []PendingAlert
+	if len(a.group) > 0 && !a.groupStart.Add(a.groupWindow).After(now) {
+		group = a.group
+		a.group = nil
+	}
+	a.mutex.Unlock()
+
+	// The alerts are grouped by their providers, so every provider only gets the alerts it would get anyway
+	var routes [][]string
+	var ids []string
+	byRoute := make(map[string][]AlertMessage)
+	for _, pending := range group {
+		ids = append(ids, pending.ID)
+		route := a.router.Route(pending.Message.MonitorID)
+		key := strings.Join(route, "\x00")
+		if _, ok := byRoute[key]; !ok {
+			routes = append(routes, route)
+		}
+		byRoute[key] = append(byRoute[key], pending.Message)
+	}
+
+	for _, route := range routes {
+		messages := byRoute[strings.Join(route, "\x00")]
+		if len(messages) < a.groupMin {
+			for _, msg := range messages {
+				err := a.router.SendTo(ctx, route, msg)
+				if err != nil {
+					errs = append(errs, err)
+				}
+			}
+			continue
+		}
+
+		err := a.router.SendTo(ctx, route, summarizeAlerts(messages, now))
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	// The group is not sent again after a failure, like the alerts that are routed right away
+	a.deletePending(ctx, ids...)
+
+	return errors.Join(errs...)
+}
+
+// summarizeAlerts summarizes the alerts of many monitors into one alert message.
+func summarizeAlerts(messages []AlertMessage, now time.Time) AlertMessage {
+	var down, recovered int
+	lines := make([]string, 0, min(len(messages), alertSummaryMaxLines)+1)
+	for i, msg := range messages {
+		switch msg.Status {
+		case MonitorStatusFailure:
+			down++
+		case MonitorStatusSuccess:
+			recovered++
+		}
+
+		if i >= alertSummaryMaxLines {
+			continue
+		}
+
+		line := fmt.Sprintf("• %s: %s → %s", msg.MonitorName, msg.PreviousStatus, msg.Status)
+		if msg.AdditionalMessage != "" {
+			line += fmt.Sprintf(" (%s)", msg.AdditionalMessage)
+		}
+		lines = append(lines, line)
+	}
+
+	if len(messages) > alertSummaryMaxLines {
+		lines = append(lines, fmt.Sprintf("…and %d more", len(messages)-alertSummaryMaxLines))
+	}
+
+	title := fmt.Sprintf("⚠️ %d monitors changed status", len(messages))
+	switch len(messages) {
+	case down:
+		title = fmt.Sprintf("🔴 %d monitors are down", down)
+	case recovered:
+		title = fmt.Sprintf("✅ %d monitors recovered", recovered)
+	}
+
+	return AlertMessage{
+		Success:   recovered == len(messages),
+		Timestamp: now,
+		Title:     title,
+		Message:   strings.Join(lines, "\n"),
+	}
+}
@@ -0,0 +1,268 @@
+package main_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	main "semyi"
+	"semyi/testutils"
+)
+
+func newAlertRulesFixture(t *testing.T, config main.AlertRulesConfig) (*main.AlertRules, map[string]*MockAlerter) {
+	t.Helper()
+
+	alerters := map[string]*MockAlerter{"ops": {}, "network": {}}
+	config.Router = newMockAlertRouter(t, main.AlertRouterConfig{Defaults: []string{"ops"}, Monitors: config.Monitors}, alerters)
+	rules, err := main.NewAlertRules(config)
+	testutils.AssertNoError(t, err, "Failed to create alert rules")
+
+	return rules, alerters
+}
+
+func down(monitorId string, at time.Time) main.AlertMessage {
+	return main.AlertMessage{MonitorID: monitorId, MonitorName: monitorId, Timestamp: at, Status: main.MonitorStatusFailure, PreviousStatus: main.MonitorStatusSuccess}
+}
+
+func recovered(monitorId string, at time.Time) main.AlertMessage {
+	return main.AlertMessage{MonitorID: monitorId, MonitorName: monitorId, Timestamp: at, Success: true, Status: main.MonitorStatusSuccess, PreviousStatus: main.MonitorStatusFailure}
+}
+
+func TestAlertRules_Filter(t *testing.T) {
+	ctx := context.Background()
+	rules, alerters := newAlertRulesFixture(t, main.AlertRulesConfig{
+		Rules: []main.AlertRule{
+			{Name: "staging", Tags: []string{"staging"}, Types: []main.AlertType{main.AlertTypeDegraded, main.AlertTypeRecovery}, Drop: true},
+			{Name: "weekend nights", Tags: []string{"internal"}, QuietHours: []main.AlertQuietHours{{Start: "22:00", End: "07:00", Days: []string{"sat"}}}},
+		},
+		Monitors: []main.Monitor{
+			{UniqueID: "staging-api", Tags: []string{"staging"}},
+			{UniqueID: "wiki", Tags: []string{"internal"}},
+		},
+	})
+
+	saturday := time.Date(2025, 9, 6, 12, 0, 0, 0, time.UTC)
+
+	err := rules.Send(ctx, recovered("staging-api", saturday))
+	testutils.AssertNoError(t, err, "Failed to send alert")
+	err = rules.Send(ctx, main.AlertMessage{MonitorID: "staging-api", Timestamp: saturday, Status: main.MonitorStatusDegradedPerformance})
+	testutils.AssertNoError(t, err, "Failed to send alert")
+	testutils.AssertEqual(t, 0, len(alerters["ops"].alertsSent), "Expected the recovery and degraded alerts of staging to be dropped")
+
+	err = rules.Send(ctx, down("staging-api", saturday))
+	testutils.AssertNoError(t, err, "Failed to send alert")
+	testutils.AssertEqual(t, 1, len(alerters["ops"].alertsSent), "Expected the down alert of staging to pass")
+
+	// The quiet hours start on Saturday night and end on Sunday morning
+	err = rules.Send(ctx, down("wiki", saturday.Add(11*time.Hour)))
+	testutils.AssertNoError(t, err, "Failed to send alert")
+	err = rules.Send(ctx, down("wiki", saturday.Add(18*time.Hour)))
+	testutils.AssertNoError(t, err, "Failed to send alert")
+	testutils.AssertEqual(t, 1, len(alerters["ops"].alertsSent), "Expected the alerts within the quiet hours to be dropped")
+
+	err = rules.Send(ctx, down("wiki", saturday.Add(20*time.Hour)))
+	testutils.AssertNoError(t, err, "Failed to send alert")
+	err = rules.Send(ctx, down("wiki", saturday.Add(-6*time.Hour)))
+	testutils.AssertNoError(t, err, "Failed to send alert")
+	testutils.AssertEqual(t, 3, len(alerters["ops"].alertsSent), "Expected the alerts outside the quiet hours to pass")
+}
+
+func TestAlertRules_Classify(t *testing.T) {
+	rules, _ := newAlertRulesFixture(t, main.AlertRulesConfig{})
+
+	tls := down("api", time.Now())
+	tls.AdditionalMessage = "Get \"https://api.example.com\": tls: failed to verify certificate: x509: certificate has expired"
+
+	testutils.AssertEqual(t, main.AlertTypeDown, rules.Classify(down("api", time.Now())), "Unexpected type of a down alert")
+	testutils.AssertEqual(t, main.AlertTypeTLS, rules.Classify(tls), "Unexpected type of a TLS alert")
+	testutils.AssertEqual(t, main.AlertTypeRecovery, rules.Classify(recovered("api", time.Now())), "Unexpected type of a recovery alert")
+	testutils.AssertEqual(t, main.AlertType(""), rules.Classify(main.AlertMessage{Title: "SLO burn rate"}), "Alerts without a transition have no type")
+}
+
+func TestAlertRules_MinOutageDuration(t *testing.T) {
+	ctx := context.Background()
+	rules, alerters := newAlertRulesFixture(t, main.AlertRulesConfig{
+		Rules: []main.AlertRule{{Name: "blips", Types: []main.AlertType{main.AlertTypeDown}, MinOutageDuration: "5m"}},
+	})
+
+	start := time.Date(2025, 9, 1, 8, 0, 0, 0, time.UTC)
+
+	// A blip is dropped along with its recovery
+	err := rules.Send(ctx, down("blip", start))
+	testutils.AssertNoError(t, err, "Failed to send alert")
+	err = rules.Send(ctx, recovered("blip", start.Add(2*time.Minute)))
+	testutils.AssertNoError(t, err, "Failed to send alert")
+
+	// An outage that lasts is alerted once the duration has passed
+	err = rules.Send(ctx, down("outage", start))
+	testutils.AssertNoError(t, err, "Failed to send alert")
+
+	err = rules.Evaluate(ctx, start.Add(4*time.Minute))
+	testutils.AssertNoError(t, err, "Failed to evaluate alert rules")
+	testutils.AssertEqual(t, 0, len(alerters["ops"].alertsSent), "Nothing should be sent before the duration has passed")
+
+	err = rules.Evaluate(ctx, start.Add(5*time.Minute))
+	testutils.AssertNoError(t, err, "Failed to evaluate alert rules")
+	testutils.AssertEqual(t, 1, len(alerters["ops"].alertsSent), "Expected the held alert to be released")
+	testutils.AssertEqual(t, "outage", alerters["ops"].alertsSent[0].MonitorID, "Expected the alert of the outage that lasted")
+
+	err = rules.Send(ctx, recovered("outage", start.Add(10*time.Minute)))
+	testutils.AssertNoError(t, err, "Failed to send alert")
+	testutils.AssertEqual(t, 2, len(alerters["ops"].alertsSent), "Expected the recovery of a released alert to pass")
+}
+
+func TestAlertRules_Grouping(t *testing.T) {
+	ctx := context.Background()
+
+	monitors := []main.Monitor{{UniqueID: "dns", AlertProviders: []string{"network"}}}
+	for i := range 5 {
+		monitors = append(monitors, main.Monitor{UniqueID: fmt.Sprintf("service-%d", i)})
+	}
+
+	rules, alerters := newAlertRulesFixture(t, main.AlertRulesConfig{
+		Grouping: main.AlertGroupingConfig{Window: "30s"},
+		Monitors: monitors,
+	})
+
+	start := time.Date(2025, 9, 1, 8, 0, 0, 0, time.UTC)
+	for i, monitor := range monitors {
+		err := rules.Send(ctx, down(monitor.UniqueID, start.Add(time.Duration(i)*time.Second)))
+		testutils.AssertNoError(t, err, "Failed to send alert")
+	}
+
+	err := rules.Evaluate(ctx, start.Add(20*time.Second))
+	testutils.AssertNoError(t, err, "Failed to evaluate alert rules")
+	testutils.AssertEqual(t, 0, len(alerters["ops"].alertsSent), "Nothing should be sent before the window has passed")
+
+	err = rules.Evaluate(ctx, start.Add(30*time.Second))
+	testutils.AssertNoError(t, err, "Failed to evaluate alert rules")
+	testutils.AssertEqual(t, 1, len(alerters["ops"].alertsSent), "Expected a single summary")
+	testutils.AssertEqual(t, "🔴 5 monitors are down", alerters["ops"].alertsSent[0].Title, "Unexpected summary title")
+	testutils.AssertContains(t, alerters["ops"].alertsSent[0].Message, "• service-4: Success → Failure", "Expected every monitor in the summary")
+
+	// Fewer alerts than the minimum are sent one by one
+	testutils.AssertEqual(t, 1, len(alerters["network"].alertsSent), "Expected the alert of the other providers on its own")
+	testutils.AssertEqual(t, "dns", alerters["network"].alertsSent[0].MonitorID, "Unexpected alert")
+
+	// Alerts that are not about a transition are not grouped
+	err = rules.Send(ctx, main.AlertMessage{MonitorID: "service-0", Title: "SLO burn rate", Timestamp: start.Add(time.Minute)})
+	testutils.AssertNoError(t, err, "Failed to send alert")
+	testutils.AssertEqual(t, 2, len(alerters["ops"].alertsSent), "Expected the SLO alert to be sent right away")
+}
+
+func TestAlertRules_Hydrate(t *testing.T) {
+	ctx := context.Background()
+	store := main.NewPendingAlertStore(database)
+	t.Cleanup(func() {
+		_, err := database.Exec("DELETE FROM alert_pending WHERE monitor_id IN (?, ?, ?)", "held", "grouped-0", "grouped-1")
+		if err != nil {
+			t.Logf("Warning: failed to clean up test data: %v", err)
+		}
+	})
+
+	config := main.AlertRulesConfig{
+		Rules:    []main.AlertRule{{Name: "blips", Tags: []string{"flaky"}, Types: []main.AlertType{main.AlertTypeDown}, MinOutageDuration: "5m"}},
+		Grouping: main.AlertGroupingConfig{Window: "30s", MinAlerts: 2},
+		Monitors: []main.Monitor{{UniqueID: "held", Name: "Held", Tags: []string{"flaky"}}, {UniqueID: "grouped-0"}, {UniqueID: "grouped-1"}},
+		Store:    store,
+	}
+	rules, _ := newAlertRulesFixture(t, config)
+
+	start := time.Date(2025, 9, 3, 8, 0, 0, 0, time.UTC)
+	for _, monitorId := range []string{"held", "grouped-0", "grouped-1"} {
+		err := rules.Send(ctx, down(monitorId, start))
+		testutils.AssertNoError(t, err, "Failed to send alert")
+	}
+
+	// The process restarts before the alerts are sent
+	rules, alerters := newAlertRulesFixture(t, config)
+	err := rules.Hydrate(ctx)
+	testutils.AssertNoError(t, err, "Failed to hydrate alert rules")
+
+	err = rules.Evaluate(ctx, start.Add(30*time.Second))
+	testutils.AssertNoError(t, err, "Failed to evaluate alert rules")
+	testutils.AssertEqual(t, 1, len(alerters["ops"].alertsSent), "Expected the restored group to be sent once its window has passed")
+	testutils.AssertEqual(t, "🔴 2 monitors are down", alerters["ops"].alertsSent[0].Title, "Unexpected summary title")
+
+	err = rules.Evaluate(ctx, start.Add(5*time.Minute))
+	testutils.AssertNoError(t, err, "Failed to evaluate alert rules")
+	err = rules.Evaluate(ctx, start.Add(6*time.Minute))
+	testutils.AssertNoError(t, err, "Failed to evaluate alert rules")
+	testutils.AssertEqual(t, 2, len(alerters["ops"].alertsSent), "Expected the restored held alert to be released")
+	testutils.AssertEqual(t, "Held", alerters["ops"].alertsSent[1].Monitor.Name, "Expected the configuration of the monitor to be restored")
+
+	pending, err := store.Read(ctx)
+	testutils.AssertNoError(t, err, "Failed to read pending alerts")
+	for _, alert := range pending {
+		testutils.AssertFalse(t, alert.Message.MonitorID == "held" || alert.Message.MonitorID == "grouped-0", "Expected the sent alerts to be deleted")
+	}
+}
+
+func TestAlertRules_Escalations(t *testing.T) {
+	ctx := context.Background()
+
+	alerters := map[string]*MockAlerter{"ops": {}, "on-call": {}}
+	monitors := []main.Monitor{
+		{UniqueID: "staging-api", Tags: []string{"staging"}, EscalationPolicy: "page"},
+		{UniqueID: "wiki", Tags: []string{"internal"}, EscalationPolicy: "page"},
+		{UniqueID: "database", Tags: []string{"flaky"}, EscalationPolicy: "page"},
+	}
+	router := newMockAlertRouter(t, main.AlertRouterConfig{Defaults: []string{"ops"}, Monitors: monitors}, alerters)
+
+	escalator, err := main.NewEscalator(main.EscalatorConfig{
+		Policies: []main.EscalationPolicy{{Name: "page", Steps: []main.EscalationStep{{After: "15m", Providers: []string{"on-call"}}}}},
+		Monitors: monitors,
+		Router:   router,
+	})
+	testutils.AssertNoError(t, err, "Failed to create escalator")
+
+	rules, err := main.NewAlertRules(main.AlertRulesConfig{
+		Rules: []main.AlertRule{
+			{Name: "staging", Tags: []string{"staging"}, Drop: true},
+			{Name: "nights", Tags: []string{"internal"}, QuietHours: []main.AlertQuietHours{{Start: "22:00", End: "07:00"}}},
+			{Name: "blips", Tags: []string{"flaky"}, MinOutageDuration: "5m"},
+		},
+		Monitors:    monitors,
+		Router:      router,
+		Escalations: escalator,
+	})
+	testutils.AssertNoError(t, err, "Failed to create alert rules")
+
+	night := time.Date(2025, 9, 1, 23, 0, 0, 0, time.UTC)
+	for _, monitorId := range []string{"staging-api", "wiki", "database"} {
+		err := rules.Apply(ctx, down(monitorId, night), night.Add(-time.Minute))
+		testutils.AssertNoError(t, err, "Failed to send alert")
+	}
+
+	escalator.Evaluate(ctx, night.Add(20*time.Minute))
+	testutils.AssertEqual(t, 0, len(alerters["on-call"].alertsSent), "Dropped and held alerts should not be escalated")
+
+	// The held alert is escalated from the start of the outage once it is released
+	err = rules.Evaluate(ctx, night.Add(5*time.Minute))
+	testutils.AssertNoError(t, err, "Failed to evaluate alert rules")
+	escalator.Evaluate(ctx, night.Add(20*time.Minute))
+	testutils.AssertEqual(t, 1, len(alerters["on-call"].alertsSent), "Expected the released alert to be escalated")
+	testutils.AssertEqual(t, "database", alerters["on-call"].alertsSent[0].MonitorID, "Unexpected escalated alert")
+}
+
+func TestNewAlertRules_Invalid(t *testing.T) {
+	tests := []struct {
+		name   string
+		config main.AlertRulesConfig
+	}{
+		{name: "no action", config: main.AlertRulesConfig{Rules: []main.AlertRule{{Tags: []string{"staging"}}}}},
+		{name: "unknown type", config: main.AlertRulesConfig{Rules: []main.AlertRule{{Types: []main.AlertType{"flap"}, Drop: true}}}},
+		{name: "invalid duration", config: main.AlertRulesConfig{Rules: []main.AlertRule{{MinOutageDuration: "soon"}}}},
+		{name: "invalid quiet hours", config: main.AlertRulesConfig{Rules: []main.AlertRule{{QuietHours: []main.AlertQuietHours{{Start: "10pm", End: "07:00"}}}}}},
+		{name: "unknown day", config: main.AlertRulesConfig{Rules: []main.AlertRule{{QuietHours: []main.AlertQuietHours{{Start: "22:00", End: "07:00", Days: []string{"someday"}}}}}}},
+		{name: "invalid window", config: main.AlertRulesConfig{Grouping: main.AlertGroupingConfig{Window: "-1s"}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := main.NewAlertRules(tt.config)
+			testutils.AssertError(t, err, "Expected an invalid configuration to be rejected")
+		})
+	}
+}
@@ -0,0 +1,220 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// The default templates of each provider. Besides the check result, they show the status transition, the reason
+// of the failure, the downtime on recovery, the links of the monitor and the acknowledge button, when the alert
+// has them. Telegram templates render the text of the message, the other templates render the JSON body of the
+// webhook request. The acknowledge button of Telegram is added by TelegramProvider, as it is not part of the text.
+const (
+	defaultTelegramTemplate = `{{ if .Title }}{{ .Title }}{{ else if .Success }}✅ Up{{ else }}🔴 Down{{ end }}
+{{- if .Description }}
+_{{ .Description }}_{{ end }}
+
+	**MonitorID:** {{ .MonitorID }}
+	**MonitorName:** {{ .MonitorName }}
+	{{- if ne .Status .PreviousStatus }}
+	**Status:** {{ .PreviousStatus }} → {{ .Status }}{{ end }}
+	**StatusCode:** {{ .StatusCode }}
+	**Latency:** {{ .Latency }}
+	**Timestamp:** {{ rfc3339 .Timestamp }}
+	{{- if .AdditionalMessage }}
+	**Reason:** {{ .AdditionalMessage }}{{ end }}
+	{{- if .OutageDuration }}
+	**Downtime:** {{ duration .OutageDuration }}{{ end }}
+	{{- if .PublicURL }}
+	**URL:** {{ .PublicURL }}{{ end }}
+	{{- if .StatusPageURL }}
+	**Status Page:** {{ .StatusPageURL }}{{ end }}{{ if .Message }}
+
+	{{ .Message }}{{ end }}`
+
+	defaultDiscordTemplate = `{{ $title := "🔴 Service Down" }}{{ if .Success }}{{ $title = "✅ Service Up" }}{{ end }}{{ if .Title }}{{ $title = .Title }}{{ end -}}
+{{ $description := .Message }}{{ if and .Description (not .Message) }}{{ $description = .Description }}{{ end -}}
+{
+  "embeds": [
+    {
+      "title": {{ json $title }},
+      {{- if .StatusPageURL }}
+      "url": {{ json .StatusPageURL }},
+      {{- end }}
+      "color": {{ if .Success }}65280{{ else }}16711680{{ end }},
+      {{- if $description }}
+      "description": {{ json $description }},
+      {{- end }}
+      "fields": [
+        {"name": "Monitor ID", "value": {{ json .MonitorID }}, "inline": "true"},
+        {"name": "Monitor Name", "value": {{ json .MonitorName }}, "inline": "true"},
+        {{- if ne .Status .PreviousStatus }}
+        {"name": "Status", "value": {{ json (printf "%s → %s" .PreviousStatus .Status) }}, "inline": "true"},
+        {{- end }}
+        {"name": "Status Code", "value": "{{ .StatusCode }}", "inline": "true"},
+        {"name": "Latency", "value": "{{ .Latency }} ms", "inline": "true"},
+        {{- if .OutageDuration }}
+        {"name": "Downtime", "value": "{{ duration .OutageDuration }}", "inline": "true"},
+        {{- end }}
+        {{- if .AdditionalMessage }}
+        {"name": "Reason", "value": {{ json .AdditionalMessage }}, "inline": "false"},
+        {{- end }}
+        {{- if .PublicURL }}
+        {"name": "URL", "value": {{ json .PublicURL }}, "inline": "false"},
+        {{- end }}
+        {"name": "Timestamp", "value": "{{ rfc3339 .Timestamp }}", "inline": "true"}
+      ]
+    }
+  ]
+  {{- /* The custom ID of a Discord button is limited to 100 characters */}}
+  {{- if and .Acknowledgeable (le (len .MonitorID) 96) }},
+  "components": [
+    {"type": 1, "components": [{"type": 2, "style": 1, "label": "Acknowledge", "custom_id": {{ json (printf "ack:%s" .MonitorID) }}}]}
+  ]
+  {{- end }}
+}`
+
+	defaultSlackTemplate = `{{ $title := "🔴 Service Down" }}{{ if .Success }}{{ $title = "✅ Service Up" }}{{ end }}{{ if .Title }}{{ $title = .Title }}{{ end -}}
+{{ $links := "" }}{{ if .PublicURL }}{{ $links = printf "<%s|Service>" .PublicURL }}{{ end -}}
+{{ if .StatusPageURL }}{{ if $links }}{{ $links = printf "%s · " $links }}{{ end }}{{ $links = printf "%s<%s|Status page>" $links .StatusPageURL }}{{ end -}}
+{
+  "text": {{ json (printf "%s: %s (%s)" $title .MonitorName .MonitorID) }},
+  "blocks": [
+    {"type": "header", "text": {"type": "plain_text", "text": {{ json $title }}}},
+    {{- if .Message }}
+    {"type": "section", "text": {"type": "mrkdwn", "text": {{ json .Message }}}},
+    {{- end }}
+    {{- if .Description }}
+    {"type": "section", "text": {"type": "plain_text", "text": {{ json .Description }}}},
+    {{- end }}
+    {
+      "type": "section",
+      "fields": [
+        {"type": "mrkdwn", "text": {{ json (printf "*Monitor ID*\n%s" .MonitorID) }}},
+        {"type": "mrkdwn", "text": {{ json (printf "*Monitor Name*\n%s" .MonitorName) }}},
+        {{- if ne .Status .PreviousStatus }}
+        {"type": "mrkdwn", "text": {{ json (printf "*Status*\n%s → %s" .PreviousStatus .Status) }}},
+        {{- end }}
+        {"type": "mrkdwn", "text": "*Status Code*\n{{ .StatusCode }}"},
+        {"type": "mrkdwn", "text": "*Latency*\n{{ .Latency }} ms"}
+        {{- if .OutageDuration }},
+        {"type": "mrkdwn", "text": "*Downtime*\n{{ duration .OutageDuration }}"}
+        {{- end }}
+      ]
+    },
+    {{- if .AdditionalMessage }}
+    {"type": "section", "text": {"type": "mrkdwn", "text": {{ json (printf "*Reason*\n%s" .AdditionalMessage) }}}},
+    {{- end }}
+    {{- if or .PublicURL .StatusPageURL }}
+    {"type": "section", "text": {"type": "mrkdwn", "text": {{ json $links }}}},
+    {{- end }}
+    {{- if .Acknowledgeable }}
+    {"type": "actions", "elements": [{"type": "button", "text": {"type": "plain_text", "text": "Acknowledge"}, "action_id": "acknowledge", "value": {{ json .MonitorID }}}]},
+    {{- end }}
+    {"type": "context", "elements": [{"type": "mrkdwn", "text": "Timestamp: {{ rfc3339 .Timestamp }}"}]}
+  ]
+}`
+
+	defaultHTTPTemplate = `{
+  "success": {{ .Success }},
+  "monitor_id": {{ json .MonitorID }},
+  "monitor_name": {{ json .MonitorName }},
+  "status": {{ json (print .Status) }},
+  "previous_status": {{ json (print .PreviousStatus) }},
+  "status_code": {{ .StatusCode }},
+  "latency": {{ .Latency }},
+  {{- if .Title }}
+  "title": {{ json .Title }},
+  {{- end }}
+  {{- if .Message }}
+  "message": {{ json .Message }},
+  {{- end }}
+  "reason": {{ json .AdditionalMessage }},
+  "outage_duration_seconds": {{ printf "%.0f" .OutageDuration.Seconds }},
+  "description": {{ json .Description }},
+  "public_url": {{ json .PublicURL }},
+  "status_page_url": {{ json .StatusPageURL }},
+  "timestamp": "{{ rfc3339 .Timestamp }}"
+}`
+)
+
+// The default templates of each provider, parsed once.
+var (
+	defaultTelegramAlertTemplate = template.Must(NewAlertTemplate(string(AlertProviderTypeTelegram), defaultTelegramTemplate))
+	defaultDiscordAlertTemplate  = template.Must(NewAlertTemplate(string(AlertProviderTypeDiscord), defaultDiscordTemplate))
+	defaultSlackAlertTemplate    = template.Must(NewAlertTemplate(string(AlertProviderTypeSlack), defaultSlackTemplate))
+	defaultHTTPAlertTemplate     = template.Must(NewAlertTemplate(string(AlertProviderTypeHTTP), defaultHTTPTemplate))
+)
+
+// alertTemplateFuncs are the functions available to alert templates, on top of the text/template builtins.
+var alertTemplateFuncs = template.FuncMap{
+	// json encodes a value as JSON, which quotes and escapes strings.
+	"json": func(value any) (string, error) {
+		encoded, err := json.Marshal(value)
+		return string(encoded), err
+	},
+	"rfc3339": func(t time.Time) string {
+		return t.Format(time.RFC3339)
+	},
+	// duration formats a duration rounded to the second, such as "1h2m3s".
+	"duration": func(d time.Duration) string {
+		return d.Round(time.Second).String()
+	},
+	"upper": strings.ToUpper,
+	"lower": strings.ToLower,
+}
+
+// NewAlertTemplate parses an alert template. The template is executed with the AlertMessage.
+func NewAlertTemplate(name string, text string) (*template.Template, error) {
+	tmpl, err := template.New(name).Funcs(alertTemplateFuncs).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s template: %w", name, err)
+	}
+
+	return tmpl, nil
+}
+
+// alertTemplate returns the template of a provider for a message: the template of the message's monitor for the
+// provider type if there is one, the template of the provider otherwise, or the default template. The templates
+// of the monitors are parsed by the AlertRouter, they are only parsed here for messages that did not go through
+// one.
+func alertTemplate(providerType AlertProviderType, providerTemplate *template.Template, defaultTemplate *template.Template, msg AlertMessage) (*template.Template, error) {
+	if tmpl, ok := msg.templates[providerType]; ok {
+		return tmpl, nil
+	}
+
+	if text, ok := msg.Monitor.AlertTemplates[providerType]; ok && text != "" {
+		return NewAlertTemplate(string(providerType), text)
+	}
+
+	if providerTemplate != nil {
+		return providerTemplate, nil
+	}
+
+	return defaultTemplate, nil
+}
+
+// renderAlertTemplate executes the template of a provider for a message, see alertTemplate. If asJSON is true,
+// the result must be valid JSON, since it is used as the body of a webhook request.
+func renderAlertTemplate(providerType AlertProviderType, providerTemplate *template.Template, defaultTemplate *template.Template, msg AlertMessage, asJSON bool) ([]byte, error) {
+	tmpl, err := alertTemplate(providerType, providerTemplate, defaultTemplate, msg)
+	if err != nil {
+		return nil, err
+	}
+
+	var buffer bytes.Buffer
+	err = tmpl.Execute(&buffer, msg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute %s template: %w", providerType, err)
+	}
+
+	if asJSON && !json.Valid(buffer.Bytes()) {
+		return nil, fmt.Errorf("%s template did not produce valid JSON", providerType)
+	}
+
+	return buffer.Bytes(), nil
+}
@@ -0,0 +1,202 @@
+package main_test
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	main "semyi"
+	"semyi/testutils"
+)
+
+func TestNewAlertTemplate(t *testing.T) {
+	_, err := main.NewAlertTemplate("valid", `{{ .MonitorName }} is {{ .Status }} after {{ duration .OutageDuration }}`)
+	testutils.AssertNoError(t, err, "Expected a valid template to parse")
+
+	_, err = main.NewAlertTemplate("invalid", `{{ .MonitorName `)
+	testutils.AssertError(t, err, "Expected an invalid template to fail")
+}
+
+func TestAlertTemplate_DefaultsRenderDetails(t *testing.T) {
+	var body string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		raw, err := io.ReadAll(r.Body)
+		testutils.AssertNoError(t, err, "Failed to read request body")
+		testutils.AssertTrue(t, json.Valid(raw), "Expected a JSON body")
+		body = string(raw)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	details := []string{"Failure → Success", "connection refused", "5m0s", "https://api.example.com", "Public API", "https://status.example.com/by?id=api"}
+	tests := []struct {
+		name     string
+		provider main.Alerter
+		expected []string
+	}{
+		{name: "telegram", provider: main.NewTelegramAlertProvider(main.TelegramProviderConfig{Url: server.URL, ChatID: "123", HttpClient: server.Client()}), expected: details},
+		{name: "discord", provider: main.NewDiscordAlertProvider(main.DiscordProviderConfig{WebhookURL: server.URL, HttpClient: server.Client()}), expected: details},
+		{name: "slack", provider: main.NewSlackAlertProvider(main.SlackProviderConfig{WebhookURL: server.URL, HttpClient: server.Client()}), expected: details},
+		{
+			name:     "http",
+			provider: main.NewHTTPAlertProvider(main.HTTPProviderConfig{WebhookURL: server.URL, HttpClient: server.Client()}),
+			expected: []string{`"status": "Success"`, `"previous_status": "Failure"`, `"reason": "connection refused"`, `"outage_duration_seconds": 300`, `"public_url": "https://api.example.com"`, `"description": "Public API"`, `"status_page_url": "https://status.example.com/by?id=api"`},
+		},
+	}
+
+	msg := main.AlertMessage{
+		Success:           true,
+		MonitorID:         "api",
+		MonitorName:       "API",
+		StatusCode:        200,
+		Timestamp:         time.Now(),
+		Status:            main.MonitorStatusSuccess,
+		PreviousStatus:    main.MonitorStatusFailure,
+		AdditionalMessage: "connection refused",
+		OutageDuration:    5 * time.Minute,
+		PublicURL:         "https://api.example.com",
+		Description:       "Public API",
+		StatusPageURL:     "https://status.example.com/by?id=api",
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.provider.Send(context.Background(), msg)
+			testutils.AssertNoError(t, err, "Failed to send alert")
+
+			for _, expected := range tt.expected {
+				testutils.AssertContains(t, body, expected, "Expected the alert to render "+expected)
+			}
+		})
+	}
+}
+
+func TestAlertTemplate_ProviderTemplate(t *testing.T) {
+	var body []byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var err error
+		body, err = io.ReadAll(r.Body)
+		testutils.AssertNoError(t, err, "Failed to read request body")
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	tmpl, err := main.NewAlertTemplate("http", `{"text": {{ json (printf "%s is %s (was %s) after %s: %s" .MonitorName .Status .PreviousStatus (duration .OutageDuration) .AdditionalMessage) }}, "tls": {{ json .TLSVersion }}, "group": {{ json .Monitor.Group }}}`)
+	testutils.AssertNoError(t, err, "Failed to parse template")
+
+	provider := main.NewHTTPAlertProvider(main.HTTPProviderConfig{
+		WebhookURL: server.URL,
+		Template:   tmpl,
+		HttpClient: server.Client(),
+	})
+
+	err = provider.Send(context.Background(), main.AlertMessage{
+		Success:           true,
+		MonitorID:         "api",
+		MonitorName:       "API",
+		Timestamp:         time.Now(),
+		Monitor:           main.Monitor{UniqueID: "api", Name: "API", Group: "backend"},
+		Status:            main.MonitorStatusSuccess,
+		PreviousStatus:    main.MonitorStatusFailure,
+		AdditionalMessage: "recovered",
+		OutageDuration:    90*time.Second + 400*time.Millisecond,
+		TLSVersion:        "TLS 1.3",
+	})
+	testutils.AssertNoError(t, err, "Failed to send alert")
+
+	var payload map[string]string
+	err = json.Unmarshal(body, &payload)
+	testutils.AssertNoError(t, err, "Expected a JSON body")
+	testutils.AssertEqual(t, map[string]string{
+		"text":  "API is Success (was Failure) after 1m30s: recovered",
+		"tls":   "TLS 1.3",
+		"group": "backend",
+	}, payload, "Expected the body rendered from the provider template")
+}
+
+func TestAlertTemplate_MonitorTemplate(t *testing.T) {
+	var text string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload map[string]string
+		err := json.NewDecoder(r.Body).Decode(&payload)
+		testutils.AssertNoError(t, err, "Failed to decode request body")
+		text = payload["text"]
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte(`{"ok":true}`))
+	}))
+	defer server.Close()
+
+	providerTemplate, err := main.NewAlertTemplate("telegram", `provider template`)
+	testutils.AssertNoError(t, err, "Failed to parse template")
+
+	provider := main.NewTelegramAlertProvider(main.TelegramProviderConfig{
+		Url:        server.URL,
+		ChatID:     "123",
+		Template:   providerTemplate,
+		HttpClient: server.Client(),
+	})
+
+	msg := main.AlertMessage{
+		MonitorID:   "api",
+		MonitorName: "API",
+		Timestamp:   time.Now(),
+		Monitor: main.Monitor{
+			UniqueID: "api",
+			AlertTemplates: map[main.AlertProviderType]string{
+				main.AlertProviderTypeTelegram: `{{ upper .MonitorName }} down: {{ .AdditionalMessage }}`,
+			},
+		},
+		AdditionalMessage: "connection refused",
+	}
+
+	err = provider.Send(context.Background(), msg)
+	testutils.AssertNoError(t, err, "Failed to send alert")
+	testutils.AssertEqual(t, "API down: connection refused", text, "Expected the monitor template to take precedence")
+
+	msg.Monitor.AlertTemplates = nil
+	err = provider.Send(context.Background(), msg)
+	testutils.AssertNoError(t, err, "Failed to send alert")
+	testutils.AssertEqual(t, "provider template", text, "Expected the provider template without a monitor template")
+}
+
+func TestAlertTemplate_InvalidJSON(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	tmpl, err := main.NewAlertTemplate("slack", `{"text": {{ .MonitorName }}}`)
+	testutils.AssertNoError(t, err, "Failed to parse template")
+
+	provider := main.NewSlackAlertProvider(main.SlackProviderConfig{
+		WebhookURL: server.URL,
+		Template:   tmpl,
+		HttpClient: server.Client(),
+	})
+
+	err = provider.Send(context.Background(), main.AlertMessage{MonitorID: "api", MonitorName: "API", Timestamp: time.Now()})
+	testutils.AssertError(t, err, "Expected a template producing invalid JSON to fail")
+	testutils.AssertEqual(t, 0, requests, "Expected no request to be sent")
+}
+
+func TestNewAlertProviders_InvalidTemplate(t *testing.T) {
+	_, err := main.NewAlertProviders(main.AlertingConfig{
+		Providers: []main.AlertProviderConfig{
+			{Name: "ops", Type: main.AlertProviderTypeHTTP, WebhookURL: "http://localhost", Template: `{{ .Missing`},
+		},
+	}, http.DefaultClient)
+	testutils.AssertError(t, err, "Expected an invalid provider template to fail")
+
+	_, err = main.NewAlertRouter(main.AlertRouterConfig{
+		Monitors: []main.Monitor{
+			{UniqueID: "api", AlertTemplates: map[main.AlertProviderType]string{main.AlertProviderTypeSlack: `{{ end }}`}},
+		},
+	})
+	testutils.AssertError(t, err, "Expected an invalid monitor template to fail")
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"text/template"
 	"time"
 )
 
@@ -16,4 +17,41 @@ type AlertMessage struct {
 	MonitorID   string
 	MonitorName string
 	Latency     int64
+	// Title overrides the default "Up" or "Down" title, for alerts that are not about a single check.
+	Title string
+	// Message explains the alert, for alerts that are not about a single check (e.g. an SLO burn rate alert).
+	Message string
+	// Monitor is the configuration of the monitor, for its metadata such as the description, the group and
+	// the public URL. It is empty for alerts that are not about a single check.
+	Monitor Monitor
+	// Status is the confirmed status of the monitor, and PreviousStatus the confirmed status before this alert.
+	Status         MonitorStatus
+	PreviousStatus MonitorStatus
+	// AdditionalMessage is the additional message of the check, which explains why a check failed.
+	AdditionalMessage string
+	// OutageDuration is the duration of the outage that ended with this alert. It is zero unless the monitor recovered.
+	OutageDuration time.Duration
+	HttpProtocol   string
+	TLSVersion     string
+	TLSCipherName  string
+	TLSExpiryDate  time.Time
+	// PublicURL and Description are the public URL and the description of the monitor.
+	PublicURL   string
+	Description string
+	// StatusPageURL links to the page of the monitor on the status page. It is empty unless the public URL of the
+	// status page is configured, see AlertingConfig.StatusPageURL.
+	StatusPageURL string
+	// Acknowledgeable is true if the alert offers an action to acknowledge the outage, see ChatOpsConfig. It is
+	// set for each provider, as only the platforms with chat-ops configured can handle the action.
+	Acknowledgeable bool
+
+	// templates holds the parsed alert templates of the monitor by provider type, see AlertRouter.
+	templates map[AlertProviderType]*template.Template
+}
+
+// AlertDeliverer is an Alerter that reports the status code of the provider's response, which is recorded in
+// the delivery history of the alert outbox.
+type AlertDeliverer interface {
+	Alerter
+	Deliver(ctx context.Context, msg AlertMessage) (statusCode int, err error)
 }
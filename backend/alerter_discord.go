@@ -3,9 +3,9 @@ package main
 import (
 	"bytes"
 	"context"
-	"encoding/json"
 	"fmt"
 	"net/http"
+	"text/template"
 	"time"
 
 	"github.com/getsentry/sentry-go"
@@ -13,11 +13,14 @@ import (
 
 type DiscordProvider struct {
 	webhookURL string
+	template   *template.Template
 	httpClient *http.Client
 }
 
 type DiscordProviderConfig struct {
 	WebhookURL string
+	// Template renders the JSON body of the webhook request, see NewAlertTemplate. The built-in format is used if nil.
+	Template   *template.Template
 	HttpClient *http.Client
 }
 
@@ -27,81 +30,40 @@ func NewDiscordAlertProvider(config DiscordProviderConfig) *DiscordProvider {
 	}
 	return &DiscordProvider{
 		webhookURL: config.WebhookURL,
+		template:   config.Template,
 		httpClient: config.HttpClient,
 	}
 }
 
-// Ensure DiscordProvider implements Alerter interface
-var _ Alerter = (*DiscordProvider)(nil)
+// Ensure DiscordProvider implements AlertDeliverer interface
+var _ AlertDeliverer = (*DiscordProvider)(nil)
 
 func (d *DiscordProvider) Send(ctx context.Context, msg AlertMessage) error {
+	_, err := d.Deliver(ctx, msg)
+	return err
+}
+
+// Deliver sends the alert message, and returns the status code of the response. The status code is zero if
+// no response was received.
+func (d *DiscordProvider) Deliver(ctx context.Context, msg AlertMessage) (int, error) {
 	if d.webhookURL == "" {
-		return fmt.Errorf("can't make a discord alert request: webhook URL is not set")
+		return 0, fmt.Errorf("can't make a discord alert request: webhook URL is not set")
 	}
 
-	span := sentry.StartSpan(ctx, "function", sentry.WithDescription("DiscordProvider.Send"))
+	span := sentry.StartSpan(ctx, "function", sentry.WithDescription("DiscordProvider.Deliver"))
 	span.SetData("semyi.alert.provider", "discord")
 	span.SetData("semyi.monitor.id", msg.MonitorID)
 	ctx = span.Context()
 	defer span.Finish()
 
-	// Create a Discord embed message
-	title := "🔴 Service Down"
-	if msg.Success {
-		title = "✅ Service Up"
-	}
-
-	// Discord embed color (red for down, green for up)
-	color := 0xFF0000 // Red
-	if msg.Success {
-		color = 0x00FF00 // Green
-	}
-
-	// Format the message as a Discord embed
-	embed := map[string]interface{}{
-		"title": title,
-		"color": color,
-		"fields": []map[string]string{
-			{
-				"name":   "Monitor ID",
-				"value":  msg.MonitorID,
-				"inline": "true",
-			},
-			{
-				"name":   "Monitor Name",
-				"value":  msg.MonitorName,
-				"inline": "true",
-			},
-			{
-				"name":   "Status Code",
-				"value":  fmt.Sprintf("%d", msg.StatusCode),
-				"inline": "true",
-			},
-			{
-				"name":   "Latency",
-				"value":  fmt.Sprintf("%d ms", msg.Latency),
-				"inline": "true",
-			},
-			{
-				"name":   "Timestamp",
-				"value":  msg.Timestamp.Format(time.RFC3339),
-				"inline": "true",
-			},
-		},
-	}
-
-	payload := map[string]interface{}{
-		"embeds": []map[string]interface{}{embed},
-	}
-
-	payloadBytes, err := json.Marshal(payload)
+	payloadBytes, err := renderAlertTemplate(AlertProviderTypeDiscord, d.template, defaultDiscordAlertTemplate, msg, true)
 	if err != nil {
-		return fmt.Errorf("failed to marshal discord payload: %w", err)
+		return 0, err
 	}
 
 	req, err := http.NewRequestWithContext(ctx, http.MethodPost, d.webhookURL, bytes.NewReader(payloadBytes))
 	if err != nil {
-		return fmt.Errorf("failed to create discord request: %w", err)
+		return 0, fmt.Errorf("failed to create discord request: %w", err)
 	}
 	defer req.Body.Close()
 
@@ -109,13 +71,13 @@ func (d *DiscordProvider) Send(ctx context.Context, msg AlertMessage) error {
 
 	resp, err := d.httpClient.Do(req)
 	if err != nil {
-		return fmt.Errorf("failed to make discord request: %w", err)
+		return 0, fmt.Errorf("failed to make discord request: %w", err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("discord webhook returned non-200 status code: %d", resp.StatusCode)
+		return resp.StatusCode, fmt.Errorf("discord webhook returned non-200 status code: %d", resp.StatusCode)
 	}
 
-	return nil
+	return resp.StatusCode, nil
 }
@@ -3,9 +3,9 @@ package main
 import (
 	"bytes"
 	"context"
-	"encoding/json"
 	"fmt"
 	"net/http"
+	"text/template"
 	"time"
 
 	"github.com/getsentry/sentry-go"
@@ -13,11 +13,14 @@ import (
 
 type HTTPProvider struct {
 	webhookURL string
+	template   *template.Template
 	httpClient *http.Client
 }
 
 type HTTPProviderConfig struct {
 	WebhookURL string
+	// Template renders the JSON body of the webhook request, see NewAlertTemplate. The built-in format is used if nil.
+	Template   *template.Template
 	HttpClient *http.Client
 }
 
@@ -28,42 +31,40 @@ func NewHTTPAlertProvider(config HTTPProviderConfig) *HTTPProvider {
 
 	return &HTTPProvider{
 		webhookURL: config.WebhookURL,
+		template:   config.Template,
 		httpClient: config.HttpClient,
 	}
 }
 
-// Ensure HTTPProvider implements Alerter interface
-var _ Alerter = (*HTTPProvider)(nil)
+// Ensure HTTPProvider implements AlertDeliverer interface
+var _ AlertDeliverer = (*HTTPProvider)(nil)
 
 func (h *HTTPProvider) Send(ctx context.Context, msg AlertMessage) error {
+	_, err := h.Deliver(ctx, msg)
+	return err
+}
+
+// Deliver sends the alert message, and returns the status code of the response. The status code is zero if
+// no response was received.
+func (h *HTTPProvider) Deliver(ctx context.Context, msg AlertMessage) (int, error) {
 	if h.webhookURL == "" {
-		return fmt.Errorf("can't make a HTTP webhook request: webhook URL is not set")
+		return 0, fmt.Errorf("can't make a HTTP webhook request: webhook URL is not set")
 	}
 
-	span := sentry.StartSpan(ctx, "function", sentry.WithDescription("HTTPProvider.Send"))
+	span := sentry.StartSpan(ctx, "function", sentry.WithDescription("HTTPProvider.Deliver"))
 	span.SetData("semyi.alert.provider", "http")
 	span.SetData("semyi.monitor.id", msg.MonitorID)
 	ctx = span.Context()
 	defer span.Finish()
 
-	// Format the message as a JSON payload
-	payload := map[string]interface{}{
-		"success":      msg.Success,
-		"monitor_id":   msg.MonitorID,
-		"monitor_name": msg.MonitorName,
-		"status_code":  msg.StatusCode,
-		"latency":      msg.Latency,
-		"timestamp":    msg.Timestamp.Format(time.RFC3339),
-	}
-
-	payloadBytes, err := json.Marshal(payload)
+	payloadBytes, err := renderAlertTemplate(AlertProviderTypeHTTP, h.template, defaultHTTPAlertTemplate, msg, true)
 	if err != nil {
-		return fmt.Errorf("failed to marshal HTTP webhook payload: %w", err)
+		return 0, err
 	}
 
 	req, err := http.NewRequestWithContext(ctx, http.MethodPost, h.webhookURL, bytes.NewReader(payloadBytes))
 	if err != nil {
-		return fmt.Errorf("failed to create HTTP webhook request: %w", err)
+		return 0, fmt.Errorf("failed to create HTTP webhook request: %w", err)
 	}
 	defer req.Body.Close()
 
@@ -71,13 +72,13 @@ func (h *HTTPProvider) Send(ctx context.Context, msg AlertMessage) error {
 
 	resp, err := h.httpClient.Do(req)
 	if err != nil {
-		return fmt.Errorf("failed to make HTTP webhook request: %w", err)
+		return 0, fmt.Errorf("failed to make HTTP webhook request: %w", err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNoContent {
-		return fmt.Errorf("HTTP webhook returned non-200 status code: %d", resp.StatusCode)
+		return resp.StatusCode, fmt.Errorf("HTTP webhook returned non-200 status code: %d", resp.StatusCode)
 	}
 
-	return nil
+	return resp.StatusCode, nil
 }
@@ -3,9 +3,9 @@ package main
 import (
 	"bytes"
 	"context"
-	"encoding/json"
 	"fmt"
 	"net/http"
+	"text/template"
 	"time"
 
 	"github.com/getsentry/sentry-go"
@@ -13,11 +13,14 @@ import (
 
 type SlackProvider struct {
 	webhookURL string
+	template   *template.Template
 	httpClient *http.Client
 }
 
 type SlackProviderConfig struct {
 	WebhookURL string
+	// Template renders the JSON body of the webhook request, see NewAlertTemplate. The built-in format is used if nil.
+	Template   *template.Template
 	HttpClient *http.Client
 }
 
@@ -28,85 +31,40 @@ func NewSlackAlertProvider(config SlackProviderConfig) *SlackProvider {
 
 	return &SlackProvider{
 		webhookURL: config.WebhookURL,
+		template:   config.Template,
 		httpClient: config.HttpClient,
 	}
 }
 
-// Ensure SlackProvider implements Alerter interface
-var _ Alerter = (*SlackProvider)(nil)
+// Ensure SlackProvider implements AlertDeliverer interface
+var _ AlertDeliverer = (*SlackProvider)(nil)
 
 func (s *SlackProvider) Send(ctx context.Context, msg AlertMessage) error {
+	_, err := s.Deliver(ctx, msg)
+	return err
+}
+
+// Deliver sends the alert message, and returns the status code of the response. The status code is zero if
+// no response was received.
+func (s *SlackProvider) Deliver(ctx context.Context, msg AlertMessage) (int, error) {
 	if s.webhookURL == "" {
-		return fmt.Errorf("can't make a Slack webhook request: webhook URL is not set")
+		return 0, fmt.Errorf("can't make a Slack webhook request: webhook URL is not set")
 	}
 
-	span := sentry.StartSpan(ctx, "function", sentry.WithDescription("SlackProvider.Send"))
+	span := sentry.StartSpan(ctx, "function", sentry.WithDescription("SlackProvider.Deliver"))
 	span.SetData("semyi.alert.provider", "slack")
 	span.SetData("semyi.monitor.id", msg.MonitorID)
 	ctx = span.Context()
 	defer span.Finish()
 
-	// Create a Slack message using Block Kit format
-	title := "🔴 Service Down"
-	if msg.Success {
-		title = "✅ Service Up"
-	}
-
-	// Create blocks for the Slack message
-	blocks := []map[string]interface{}{
-		{
-			"type": "header",
-			"text": map[string]string{
-				"type": "plain_text",
-				"text": title,
-			},
-		},
-		{
-			"type": "section",
-			"fields": []map[string]string{
-				{
-					"type": "mrkdwn",
-					"text": fmt.Sprintf("*Monitor ID*\n%s", msg.MonitorID),
-				},
-				{
-					"type": "mrkdwn",
-					"text": fmt.Sprintf("*Monitor Name*\n%s", msg.MonitorName),
-				},
-				{
-					"type": "mrkdwn",
-					"text": fmt.Sprintf("*Status Code*\n%d", msg.StatusCode),
-				},
-				{
-					"type": "mrkdwn",
-					"text": fmt.Sprintf("*Latency*\n%d ms", msg.Latency),
-				},
-			},
-		},
-		{
-			"type": "context",
-			"elements": []map[string]string{
-				{
-					"type": "mrkdwn",
-					"text": fmt.Sprintf("Timestamp: %s", msg.Timestamp.Format(time.RFC3339)),
-				},
-			},
-		},
-	}
-
-	// Create the payload
-	payload := map[string]interface{}{
-		"text":   fmt.Sprintf("%s: %s (%s)", title, msg.MonitorName, msg.MonitorID),
-		"blocks": blocks,
-	}
-
-	payloadBytes, err := json.Marshal(payload)
+	payloadBytes, err := renderAlertTemplate(AlertProviderTypeSlack, s.template, defaultSlackAlertTemplate, msg, true)
 	if err != nil {
-		return fmt.Errorf("failed to marshal Slack payload: %w", err)
+		return 0, err
 	}
 
 	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.webhookURL, bytes.NewReader(payloadBytes))
 	if err != nil {
-		return fmt.Errorf("failed to create Slack webhook request: %w", err)
+		return 0, fmt.Errorf("failed to create Slack webhook request: %w", err)
 	}
 	defer req.Body.Close()
 
@@ -114,13 +72,13 @@ func (s *SlackProvider) Send(ctx context.Context, msg AlertMessage) error {
 
 	resp, err := s.httpClient.Do(req)
 	if err != nil {
-		return fmt.Errorf("failed to make Slack webhook request: %w", err)
+		return 0, fmt.Errorf("failed to make Slack webhook request: %w", err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNoContent {
-		return fmt.Errorf("Slack webhook returned non-200 status code: %d", resp.StatusCode)
+		return resp.StatusCode, fmt.Errorf("Slack webhook returned non-200 status code: %d", resp.StatusCode)
 	}
 
-	return nil
+	return resp.StatusCode, nil
 }
@@ -6,6 +6,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"text/template"
 	"time"
 
 	"github.com/getsentry/sentry-go"
@@ -14,12 +15,15 @@ import (
 type TelegramProvider struct {
 	url        string
 	chatID     string
+	template   *template.Template
 	httpClient *http.Client
 }
 
 type TelegramProviderConfig struct {
-	Url        string
-	ChatID     string
+	Url    string
+	ChatID string
+	// Template renders the message text, see NewAlertTemplate. The built-in format is used if nil.
+	Template   *template.Template
 	HttpClient *http.Client
 }
 
@@ -31,52 +35,53 @@ func NewTelegramAlertProvider(config TelegramProviderConfig) *TelegramProvider {
 	return &TelegramProvider{
 		url:        config.Url,
 		chatID:     config.ChatID,
+		template:   config.Template,
 		httpClient: config.HttpClient,
 	}
 }
 
-// Ensure TelegramProvider implements Alerter interface
-var _ Alerter = (*TelegramProvider)(nil)
+// Ensure TelegramProvider implements AlertDeliverer interface
+var _ AlertDeliverer = (*TelegramProvider)(nil)
 
 func (t *TelegramProvider) Send(ctx context.Context, msg AlertMessage) error {
+	_, err := t.Deliver(ctx, msg)
+	return err
+}
+
+// Deliver sends the alert message, and returns the status code of the response. The status code is zero if
+// no response was received.
+func (t *TelegramProvider) Deliver(ctx context.Context, msg AlertMessage) (int, error) {
 	if t.url == "" || t.chatID == "" {
-		return fmt.Errorf("can't make a telegram alert request: some config is not set")
+		return 0, fmt.Errorf("can't make a telegram alert request: some config is not set")
 	}
 
-	span := sentry.StartSpan(ctx, "function", sentry.WithDescription("TelegramProvider.Send"))
+	span := sentry.StartSpan(ctx, "function", sentry.WithDescription("TelegramProvider.Deliver"))
 	span.SetData("semyi.alert.provider", "telegram")
 	span.SetData("semyi.monitor.id", msg.MonitorID)
 	ctx = span.Context()
 	defer span.Finish()
 
-	// Perhaps we can use a template file instead.
-	title := "🔴 Down"
-	if msg.Success {
-		title = "✅ Up"
+	text, err := renderAlertTemplate(AlertProviderTypeTelegram, t.template, defaultTelegramAlertTemplate, msg, false)
+	if err != nil {
+		return 0, err
 	}
-	text := fmt.Sprintf(title+`
-
-	**MonitorID:** %s
-	**MonitorName:** %s
-	**StatusCode:** %d
-	**Latency:** %d
-	**Timestamp:** %s`,
-		msg.MonitorID,
-		msg.MonitorName,
-		msg.StatusCode,
-		msg.Latency,
-		msg.Timestamp.Format(time.RFC3339),
-	)
+
 	payload := map[string]any{
 		"chat_id":    t.chatID,
-		"text":       text,
+		"text":       string(text),
 		"parse_mode": "Markdown",
 	}
+	// The callback data of an inline button is limited to 64 bytes, so long monitor IDs get no button.
+	if data := acknowledgeActionPrefix + msg.MonitorID; msg.Acknowledgeable && len(data) <= 64 {
+		payload["reply_markup"] = map[string]any{
+			"inline_keyboard": [][]map[string]string{{{"text": "Acknowledge", "callback_data": data}}},
+		}
+	}
 	payloadByte, _ := json.Marshal(payload)
 
 	req, err := http.NewRequestWithContext(ctx, http.MethodPost, t.url, bytes.NewReader(payloadByte))
 	if err != nil {
-		return fmt.Errorf("failed to send telegram alert: %w", err)
+		return 0, fmt.Errorf("failed to send telegram alert: %w", err)
 	}
 	defer req.Body.Close()
 
@@ -84,13 +89,13 @@ func (t *TelegramProvider) Send(ctx context.Context, msg AlertMessage) error {
 
 	resp, err := t.httpClient.Do(req)
 	if err != nil {
-		return fmt.Errorf("failed to make request: %w", err)
+		return 0, fmt.Errorf("failed to make request: %w", err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("telegram API returned non-200 status code: %d", resp.StatusCode)
+		return resp.StatusCode, fmt.Errorf("telegram API returned non-200 status code: %d", resp.StatusCode)
 	}
 
-	return nil
+	return resp.StatusCode, nil
 }
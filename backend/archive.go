@@ -0,0 +1,260 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/getsentry/sentry-go"
+	"github.com/rs/zerolog/log"
+)
+
+// archiveColumns are the columns of the raw historical data that are kept in the archive.
+const archiveColumns = "monitor_id, status, latency, timestamp, additional_message, http_protocol, tls_version, tls_cipher, tls_expiry"
+
+// Archive keeps the raw historical data in Parquet files after it expires from the database. The files are
+// partitioned by monitor, year, and month (in UTC), following the Hive layout:
+// <directory>/monitor_id=<id>/year=<year>/month=<month>/archive_<uuid>.parquet.
+// Archiving relies on DuckDB's COPY statement and read_parquet function, so it is only available on DuckDB.
+type Archive struct {
+	db        *sql.DB
+	directory string
+}
+
+// NewArchive creates an archive that stores the Parquet files in the given directory.
+func NewArchive(db *sql.DB, directory string) (*Archive, error) {
+	absolute, err := filepath.Abs(directory)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve archive directory: %w", err)
+	}
+
+	err = os.MkdirAll(absolute, 0o755)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create archive directory: %w", err)
+	}
+
+	return &Archive{db: db, directory: absolute}, nil
+}
+
+// Directory returns the absolute path of the archive directory.
+func (a *Archive) Directory() string {
+	return a.directory
+}
+
+// Export copies the raw historical data that matches the condition into new Parquet files. It is called with the
+// same condition right before the rows are deleted, so the rows are only deleted if they were archived.
+func (a *Archive) Export(ctx context.Context, tx *sql.Tx, condition string, args ...any) error {
+	span := sentry.StartSpan(ctx, "function", sentry.WithDescription("Archive.Export"))
+	ctx = span.Context()
+	defer span.Finish()
+
+	query := fmt.Sprintf(
+		`COPY (
+			SELECT %s, year(timestamp) AS year, month(timestamp) AS month
+			FROM monitor_historical
+			WHERE %s
+		) TO %s (FORMAT PARQUET, PARTITION_BY (monitor_id, year, month), OVERWRITE_OR_IGNORE, FILENAME_PATTERN 'archive_{uuid}')`,
+		archiveColumns,
+		condition,
+		quoteDuckDBString(a.directory),
+	)
+
+	_, err := tx.ExecContext(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("failed to copy raw historical data to the archive: %w", err)
+	}
+
+	return nil
+}
+
+// empty returns true if the archive does not contain any Parquet file yet, since read_parquet fails
+// when the glob does not match any file.
+func (a *Archive) empty() (bool, error) {
+	empty := true
+	err := filepath.WalkDir(a.directory, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if !entry.IsDir() && strings.HasSuffix(entry.Name(), ".parquet") {
+			empty = false
+			return fs.SkipAll
+		}
+
+		return nil
+	})
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return false, fmt.Errorf("failed to list archive directory: %w", err)
+	}
+
+	return empty, nil
+}
+
+// source returns the read_parquet call that reads every file of the archive. Rows can be archived twice when
+// they were re-imported and expired again, the duplicates are removed by the callers.
+func (a *Archive) source() string {
+	return fmt.Sprintf("read_parquet(%s, hive_partitioning = true)", quoteDuckDBString(filepath.Join(a.directory, "**", "*.parquet")))
+}
+
+// Read returns the archived raw historical data of a monitor within [from, to), ordered by timestamp,
+// with at most limit rows.
+func (a *Archive) Read(ctx context.Context, monitorId string, from, to time.Time, limit int) ([]MonitorHistorical, error) {
+	span := sentry.StartSpan(ctx, "function", sentry.WithDescription("Archive.Read"))
+	span.SetData("semyi.monitor.id", monitorId)
+	ctx = span.Context()
+	defer span.Finish()
+
+	empty, err := a.empty()
+	if err != nil {
+		return nil, err
+	}
+
+	if empty {
+		return nil, nil
+	}
+
+	conn, err := a.db.Conn(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get connection: %w", err)
+	}
+	defer func() {
+		err := conn.Close()
+		if err != nil {
+			log.Warn().Err(err).Msg("failed to close connection")
+		}
+	}()
+
+	// The year filter lets DuckDB skip the partitions outside the range without opening them.
+	rows, err := conn.QueryContext(
+		ctx,
+		fmt.Sprintf(
+			`SELECT DISTINCT %s
+			FROM %s
+			WHERE monitor_id = ? AND year BETWEEN ? AND ? AND timestamp >= ? AND timestamp < ?
+			ORDER BY timestamp
+			LIMIT %d`,
+			archiveColumns,
+			a.source(),
+			limit,
+		),
+		monitorId,
+		EnsureUTC(from).Year(),
+		EnsureUTC(to).Year(),
+		EnsureUTC(from),
+		EnsureUTC(to),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read archive: %w", err)
+	}
+	defer func() {
+		if err := rows.Close(); err != nil {
+			log.Warn().Err(err).Msg("failed to close rows")
+		}
+	}()
+
+	var historicals []MonitorHistorical
+	for rows.Next() {
+		var historical MonitorHistorical
+		var additionalMessage, httpProtocol, tlsVersion, tlsCipher sql.NullString
+		var tlsExpiry sql.NullTime
+		err := rows.Scan(
+			&historical.MonitorID,
+			&historical.Status,
+			&historical.Latency,
+			&historical.Timestamp,
+			&additionalMessage,
+			&httpProtocol,
+			&tlsVersion,
+			&tlsCipher,
+			&tlsExpiry,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+
+		historical.Timestamp = historical.Timestamp.UTC()
+		historical.AdditionalMessage = additionalMessage.String
+		historical.HttpProtocol = httpProtocol.String
+		historical.TLSVersion = tlsVersion.String
+		historical.TLSCipherName = tlsCipher.String
+		if tlsExpiry.Valid {
+			historical.TLSExpiryDate = tlsExpiry.Time.UTC()
+		}
+
+		historicals = append(historicals, historical)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate rows: %w", err)
+	}
+
+	return historicals, nil
+}
+
+// Import copies the archived raw historical data of a monitor within [from, to) back into the database,
+// skipping the rows that are already there. It returns the number of imported rows.
+func (a *Archive) Import(ctx context.Context, monitorId string, from, to time.Time) (int64, error) {
+	span := sentry.StartSpan(ctx, "function", sentry.WithDescription("Archive.Import"))
+	span.SetData("semyi.monitor.id", monitorId)
+	ctx = span.Context()
+	defer span.Finish()
+
+	empty, err := a.empty()
+	if err != nil {
+		return 0, err
+	}
+
+	if empty {
+		return 0, nil
+	}
+
+	conn, err := a.db.Conn(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get connection: %w", err)
+	}
+	defer func() {
+		err := conn.Close()
+		if err != nil {
+			log.Warn().Err(err).Msg("failed to close connection")
+		}
+	}()
+
+	result, err := conn.ExecContext(
+		ctx,
+		fmt.Sprintf(
+			`INSERT OR IGNORE INTO monitor_historical (%s)
+			SELECT DISTINCT ON (monitor_id, timestamp) %s
+			FROM %s
+			WHERE monitor_id = ? AND year BETWEEN ? AND ? AND timestamp >= ? AND timestamp < ?`,
+			archiveColumns,
+			archiveColumns,
+			a.source(),
+		),
+		monitorId,
+		EnsureUTC(from).Year(),
+		EnsureUTC(to).Year(),
+		EnsureUTC(from),
+		EnsureUTC(to),
+	)
+	if err != nil {
+		return 0, fmt.Errorf("failed to import archive: %w", err)
+	}
+
+	imported, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get imported rows: %w", err)
+	}
+
+	return imported, nil
+}
+
+// quoteDuckDBString quotes a string literal for DuckDB, for the places that do not accept parameters.
+func quoteDuckDBString(value string) string {
+	return "'" + strings.ReplaceAll(value, "'", "''") + "'"
+}
@@ -0,0 +1,127 @@
+package main_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	main "semyi"
+	"semyi/testutils"
+
+	"github.com/getsentry/sentry-go"
+)
+
+func TestArchive(t *testing.T) {
+	skipUnlessDuckDB(t)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	ctx = sentry.SetHubOnContext(ctx, sentry.CurrentHub())
+
+	monitorId := "archive-monitor"
+	timestamps := []time.Time{
+		time.Date(2024, 2, 10, 8, 0, 0, 0, time.UTC),
+		time.Date(2024, 3, 10, 8, 0, 0, 0, time.UTC),
+	}
+	for _, timestamp := range timestamps {
+		_, err := database.ExecContext(ctx, "INSERT INTO monitor_historical (timestamp, monitor_id, status, latency, additional_message) VALUES (?, ?, 1, 150, 'timeout')", timestamp, monitorId)
+		testutils.AssertNoError(t, err, "Failed to insert test data")
+	}
+	t.Cleanup(func() {
+		_, err := database.Exec("DELETE FROM monitor_historical WHERE monitor_id = ?", monitorId)
+		if err != nil {
+			t.Logf("Warning: failed to clean up test data: %v", err)
+		}
+	})
+
+	archive, err := main.NewArchive(database, t.TempDir())
+	testutils.AssertNoError(t, err, "Failed to create archive")
+
+	// Nothing has been archived yet
+	historicals, err := archive.Read(ctx, monitorId, timestamps[0], timestamps[1].Add(time.Hour), 100)
+	testutils.AssertNoError(t, err, "Failed to read empty archive")
+	testutils.AssertEqual(t, 0, len(historicals), "Expected an empty archive")
+
+	// Only the test monitor expires, so the data of the other tests is left alone
+	worker := main.NewCleanupWorker(main.NewSQLStorage(database, archive), main.RetentionPolicy{Raw: 100000, Hourly: 100000, Daily: 100000}, []main.Monitor{
+		{UniqueID: monitorId, Retention: main.RetentionPolicy{Raw: 30}},
+	}, nil)
+	err = worker.Cleanup(ctx)
+	testutils.AssertNoError(t, err, "Cleanup failed")
+
+	var count int
+	err = database.QueryRowContext(ctx, "SELECT COUNT(*) FROM monitor_historical WHERE monitor_id = ?", monitorId).Scan(&count)
+	testutils.AssertNoError(t, err, "Failed to count raw data")
+	testutils.AssertEqual(t, 0, count, "Expected the raw data to be deleted")
+
+	for _, month := range []string{"2", "3"} {
+		files, err := filepath.Glob(filepath.Join(archive.Directory(), "monitor_id="+monitorId, "year=2024", "month="+month, "*.parquet"))
+		testutils.AssertNoError(t, err, "Failed to list archive")
+		testutils.AssertEqual(t, 1, len(files), "Expected a Parquet file for month "+month)
+	}
+
+	historicals, err = archive.Read(ctx, monitorId, timestamps[0], timestamps[1].Add(time.Hour), 100)
+	testutils.AssertNoError(t, err, "Failed to read archive")
+	testutils.AssertEqual(t, 2, len(historicals), "Expected every archived check")
+	testutils.AssertTrue(t, historicals[0].Timestamp.Equal(timestamps[0]), "Expected the checks in order")
+	testutils.AssertEqual(t, main.MonitorStatusFailure, historicals[0].Status, "Unexpected status")
+	testutils.AssertEqual(t, "timeout", historicals[0].AdditionalMessage, "Unexpected additional message")
+
+	historicals, err = archive.Read(ctx, monitorId, timestamps[1], timestamps[1].Add(time.Hour), 100)
+	testutils.AssertNoError(t, err, "Failed to read archive")
+	testutils.AssertEqual(t, 1, len(historicals), "Expected the checks within the range only")
+
+	imported, err := archive.Import(ctx, monitorId, timestamps[0], timestamps[1].Add(time.Hour))
+	testutils.AssertNoError(t, err, "Failed to import archive")
+	testutils.AssertEqual(t, int64(2), imported, "Expected every archived check to be imported")
+
+	// Importing again does not duplicate the rows
+	imported, err = archive.Import(ctx, monitorId, timestamps[0], timestamps[1].Add(time.Hour))
+	testutils.AssertNoError(t, err, "Failed to import archive")
+	testutils.AssertEqual(t, int64(0), imported, "Expected the imported checks to be skipped")
+
+	err = database.QueryRowContext(ctx, "SELECT COUNT(*) FROM monitor_historical WHERE monitor_id = ?", monitorId).Scan(&count)
+	testutils.AssertNoError(t, err, "Failed to count raw data")
+	testutils.AssertEqual(t, 2, count, "Expected the raw data to be restored")
+}
+
+func TestServer_MonitorArchive(t *testing.T) {
+	archive, err := main.NewArchive(database, t.TempDir())
+	testutils.AssertNoError(t, err, "Failed to create archive")
+
+	monitors := []main.Monitor{{UniqueID: "archive-api-monitor", Name: "Archive API Monitor"}}
+
+	tests := []struct {
+		name       string
+		archive    *main.Archive
+		path       string
+		wantStatus int
+	}{
+		{name: "empty archive", archive: archive, path: "/api/v1/monitors/archive-api-monitor/archive", wantStatus: http.StatusOK},
+		{name: "archive disabled", archive: nil, path: "/api/v1/monitors/archive-api-monitor/archive", wantStatus: http.StatusNotFound},
+		{name: "unknown monitor", archive: archive, path: "/api/v1/monitors/unknown/archive", wantStatus: http.StatusNotFound},
+		{name: "invalid range", archive: archive, path: "/api/v1/monitors/archive-api-monitor/archive?from=2025-02-01T00:00:00Z&to=2025-01-01T00:00:00Z", wantStatus: http.StatusBadRequest},
+		{name: "invalid limit", archive: archive, path: "/api/v1/monitors/archive-api-monitor/archive?limit=0", wantStatus: http.StatusBadRequest},
+		{name: "range too long", archive: archive, path: "/api/v1/monitors/archive-api-monitor/archive?from=2024-01-01T00:00:00Z&to=2025-01-01T00:00:00Z", wantStatus: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := main.NewServer(main.ServerConfig{
+				MonitorList: monitors,
+				Archive:     tt.archive,
+				ApiKey:      "secret",
+			})
+
+			request := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			request.Header.Set("X-API-Key", "secret")
+			recorder := httptest.NewRecorder()
+			server.Handler.ServeHTTP(recorder, request)
+
+			testutils.AssertEqual(t, tt.wantStatus, recorder.Code, "Unexpected status code")
+		})
+	}
+}
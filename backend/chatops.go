@@ -0,0 +1,469 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/getsentry/sentry-go"
+	"github.com/rs/zerolog/log"
+)
+
+// acknowledgeActionPrefix prefixes the monitor ID in the acknowledge buttons of Discord and Telegram.
+const acknowledgeActionPrefix = "ack:"
+
+// slackRequestMaxAge bounds the age of a signed Slack request, to prevent replays.
+const slackRequestMaxAge = 5 * time.Minute
+
+// ChatOps acknowledges outages from the acknowledge buttons of the alerts, and from the "ack" slash command of
+// each chat platform. Every request is verified with the secret of its platform, see ChatOpsConfig.
+type ChatOps struct {
+	acknowledger       *Acknowledger
+	monitors           map[string]Monitor
+	slackSigningSecret []byte
+	discordPublicKey   ed25519.PublicKey
+	telegramToken      string
+	// telegramChats holds the chat IDs of the Telegram providers. Updates from other chats are rejected, as
+	// anyone can add the bot to a chat.
+	telegramChats []string
+	httpClient    *http.Client
+}
+
+// NewChatOps creates a new ChatOps. The router provides the Telegram chats that may acknowledge outages, and may
+// be nil if Telegram is not used. An error is returned if the Discord public key is invalid.
+func NewChatOps(config ChatOpsConfig, acknowledger *Acknowledger, monitors []Monitor, router *AlertRouter, httpClient *http.Client) (*ChatOps, error) {
+	chatOps := &ChatOps{
+		acknowledger:       acknowledger,
+		monitors:           make(map[string]Monitor),
+		slackSigningSecret: []byte(config.SlackSigningSecret),
+		telegramToken:      config.TelegramSecretToken,
+		httpClient:         httpClient,
+	}
+
+	if router != nil {
+		chatOps.telegramChats = router.TelegramChatIDs()
+	}
+
+	if chatOps.telegramToken != "" && len(chatOps.telegramChats) == 0 {
+		log.Warn().Msg("telegram chat-ops is enabled without a telegram alert provider, every update will be rejected")
+	}
+
+	if chatOps.httpClient == nil {
+		chatOps.httpClient = http.DefaultClient
+	}
+
+	if config.DiscordPublicKey != "" {
+		key, err := hex.DecodeString(config.DiscordPublicKey)
+		if err != nil || len(key) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("discord_public_key must be a hex encoded ed25519 public key")
+		}
+
+		chatOps.discordPublicKey = key
+	}
+
+	for _, monitor := range monitors {
+		chatOps.monitors[monitor.UniqueID] = monitor
+	}
+
+	return chatOps, nil
+}
+
+// Slack handles the interactions and slash commands of a Slack app. The slash command takes the monitor ID and
+// an optional comment, such as "/semyi ack api-gateway looking into it".
+func (c *ChatOps) Slack(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	body, ok := c.readBody(w, r, len(c.slackSigningSecret) > 0)
+	if !ok {
+		return
+	}
+
+	if !c.verifySlack(r.Header, body, time.Now()) {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	form, err := url.ParseQuery(string(body))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	if payload := form.Get("payload"); payload != "" {
+		var interaction struct {
+			Type string `json:"type"`
+			User struct {
+				Username string `json:"username"`
+				Name     string `json:"name"`
+			} `json:"user"`
+			Actions []struct {
+				ActionID string `json:"action_id"`
+				Value    string `json:"value"`
+			} `json:"actions"`
+			ResponseURL string `json:"response_url"`
+		}
+		err := json.Unmarshal([]byte(payload), &interaction)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		user := interaction.User.Username
+		if user == "" {
+			user = interaction.User.Name
+		}
+
+		for _, action := range interaction.Actions {
+			if interaction.Type != "block_actions" || action.ActionID != "acknowledge" {
+				continue
+			}
+
+			reply := c.acknowledge(ctx, action.Value, user, AcknowledgementSourceSlack, "")
+			if interaction.ResponseURL != "" {
+				c.respondSlack(ctx, interaction.ResponseURL, reply)
+			}
+		}
+
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	reply := acknowledgeUsage
+	if monitorId, comment, ok := parseAcknowledgeCommand(form.Get("text"), true); ok {
+		reply = c.acknowledge(ctx, monitorId, form.Get("user_name"), AcknowledgementSourceSlack, comment)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(map[string]string{"response_type": "in_channel", "text": reply})
+}
+
+// Discord handles the interactions of a Discord application: the acknowledge buttons, and an "ack" command
+// with a "monitor" option and an optional "comment" option.
+func (c *ChatOps) Discord(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	body, ok := c.readBody(w, r, c.discordPublicKey != nil)
+	if !ok {
+		return
+	}
+
+	signature, err := hex.DecodeString(r.Header.Get("X-Signature-Ed25519"))
+	if err != nil || !ed25519.Verify(c.discordPublicKey, append([]byte(r.Header.Get("X-Signature-Timestamp")), body...), signature) {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	type discordUser struct {
+		Username string `json:"username"`
+	}
+	var interaction struct {
+		Type int `json:"type"`
+		Data struct {
+			Name     string `json:"name"`
+			CustomID string `json:"custom_id"`
+			Options  []struct {
+				Name  string `json:"name"`
+				Value any    `json:"value"`
+			} `json:"options"`
+		} `json:"data"`
+		// Member is set for interactions in a server, and User for interactions in a direct message.
+		Member *struct {
+			User discordUser `json:"user"`
+		} `json:"member"`
+		User *discordUser `json:"user"`
+	}
+	err = json.Unmarshal(body, &interaction)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	var user string
+	if interaction.Member != nil {
+		user = interaction.Member.User.Username
+	} else if interaction.User != nil {
+		user = interaction.User.Username
+	}
+
+	var reply string
+	switch interaction.Type {
+	case 1: // PING
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]int{"type": 1})
+		return
+	case 2: // APPLICATION_COMMAND
+		var monitorId, comment string
+		for _, option := range interaction.Data.Options {
+			switch option.Name {
+			case "monitor":
+				monitorId = fmt.Sprint(option.Value)
+			case "comment":
+				comment = fmt.Sprint(option.Value)
+			}
+		}
+
+		reply = acknowledgeUsage
+		if monitorId != "" {
+			reply = c.acknowledge(ctx, monitorId, user, AcknowledgementSourceDiscord, comment)
+		}
+	case 3: // MESSAGE_COMPONENT
+		monitorId, ok := strings.CutPrefix(interaction.Data.CustomID, acknowledgeActionPrefix)
+		if !ok {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		reply = c.acknowledge(ctx, monitorId, user, AcknowledgementSourceDiscord, "")
+	default:
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	// CHANNEL_MESSAGE_WITH_SOURCE
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]any{"type": 4, "data": map[string]string{"content": reply}})
+}
+
+// Telegram handles the updates of the Telegram bot: the acknowledge buttons, and the "/ack" command with the
+// monitor ID and an optional comment. The replies are sent as the response of the webhook. Only the chats of the
+// Telegram providers may acknowledge outages, the updates of other chats are answered with a rejection.
+func (c *ChatOps) Telegram(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	body, ok := c.readBody(w, r, c.telegramToken != "")
+	if !ok {
+		return
+	}
+
+	if subtle.ConstantTimeCompare([]byte(r.Header.Get("X-Telegram-Bot-Api-Secret-Token")), []byte(c.telegramToken)) != 1 {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	type telegramUser struct {
+		Username  string `json:"username"`
+		FirstName string `json:"first_name"`
+	}
+	name := func(user telegramUser) string {
+		if user.Username != "" {
+			return user.Username
+		}
+		return user.FirstName
+	}
+	type telegramChat struct {
+		ID       int64  `json:"id"`
+		Username string `json:"username"`
+	}
+	// allowed accepts the chats of the providers, which are configured by ID or by "@username".
+	allowed := func(chat *telegramChat) bool {
+		if chat == nil {
+			return false
+		}
+
+		for _, chatId := range c.telegramChats {
+			if chatId == strconv.FormatInt(chat.ID, 10) || (chat.Username != "" && chatId == "@"+chat.Username) {
+				return true
+			}
+		}
+		return false
+	}
+	var update struct {
+		Message *struct {
+			Chat telegramChat `json:"chat"`
+			From telegramUser `json:"from"`
+			Text string       `json:"text"`
+		} `json:"message"`
+		CallbackQuery *struct {
+			ID      string       `json:"id"`
+			From    telegramUser `json:"from"`
+			Data    string       `json:"data"`
+			Message *struct {
+				Chat telegramChat `json:"chat"`
+			} `json:"message"`
+		} `json:"callback_query"`
+	}
+	err := json.Unmarshal(body, &update)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	var response map[string]any
+	switch {
+	case update.CallbackQuery != nil:
+		monitorId, ok := strings.CutPrefix(update.CallbackQuery.Data, acknowledgeActionPrefix)
+		if !ok {
+			break
+		}
+
+		var chat *telegramChat
+		if update.CallbackQuery.Message != nil {
+			chat = &update.CallbackQuery.Message.Chat
+		}
+
+		reply := telegramChatRejected
+		if allowed(chat) {
+			reply = c.acknowledge(ctx, monitorId, name(update.CallbackQuery.From), AcknowledgementSourceTelegram, "")
+		}
+
+		response = map[string]any{
+			"method":            "answerCallbackQuery",
+			"callback_query_id": update.CallbackQuery.ID,
+			"text":              reply,
+			"show_alert":        true,
+		}
+	case update.Message != nil:
+		command, text, _ := strings.Cut(update.Message.Text, " ")
+		command, _, _ = strings.Cut(command, "@")
+		if command != "/ack" && command != "/acknowledge" {
+			break
+		}
+
+		reply := acknowledgeUsage
+		if !allowed(&update.Message.Chat) {
+			reply = telegramChatRejected
+		} else if monitorId, comment, ok := parseAcknowledgeCommand(text, false); ok {
+			reply = c.acknowledge(ctx, monitorId, name(update.Message.From), AcknowledgementSourceTelegram, comment)
+		}
+
+		response = map[string]any{"method": "sendMessage", "chat_id": update.Message.Chat.ID, "text": reply}
+	}
+
+	if response == nil {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(response)
+}
+
+// readBody reads the body of a chat-ops request, which is needed as is to verify the signature. A not found
+// response is written if the platform is not enabled.
+func (c *ChatOps) readBody(w http.ResponseWriter, r *http.Request, enabled bool) ([]byte, bool) {
+	if !enabled {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusNotFound)
+		_ = json.NewEncoder(w).Encode(HttpCommonError{Error: "chat-ops is not configured for this platform"})
+		return nil, false
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, 1<<20))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return nil, false
+	}
+
+	return body, true
+}
+
+// verifySlack verifies the signature of a Slack request, see
+// https://api.slack.com/authentication/verifying-requests-from-slack.
+func (c *ChatOps) verifySlack(header http.Header, body []byte, now time.Time) bool {
+	timestamp := header.Get("X-Slack-Request-Timestamp")
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return false
+	}
+
+	age := now.Sub(time.Unix(seconds, 0))
+	if age > slackRequestMaxAge || age < -slackRequestMaxAge {
+		return false
+	}
+
+	mac := hmac.New(sha256.New, c.slackSigningSecret)
+	mac.Write([]byte("v0:" + timestamp + ":"))
+	mac.Write(body)
+	expected := "v0=" + hex.EncodeToString(mac.Sum(nil))
+
+	return hmac.Equal([]byte(expected), []byte(header.Get("X-Slack-Signature")))
+}
+
+// respondSlack posts the reply of an interaction to its response URL, as Slack ignores the response body of
+// interactions.
+func (c *ChatOps) respondSlack(ctx context.Context, responseURL string, reply string) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	payload, _ := json.Marshal(map[string]any{"response_type": "in_channel", "replace_original": false, "text": reply})
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, responseURL, bytes.NewReader(payload))
+	if err != nil {
+		log.Warn().Err(err).Msg("failed to create slack response request")
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		log.Warn().Err(err).Msg("failed to send slack response")
+		return
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		log.Warn().Int("status_code", resp.StatusCode).Msg("slack returned non-200 status code for response")
+	}
+}
+
+// acknowledgeUsage is the reply to an acknowledge command without a monitor ID.
+const acknowledgeUsage = "Usage: ack <monitor id> [comment]"
+
+// telegramChatRejected is the reply to a Telegram update from a chat that no Telegram provider sends alerts to.
+const telegramChatRejected = "This chat is not allowed to acknowledge outages."
+
+// acknowledge acknowledges the outage of a monitor, and returns the reply to the chat.
+func (c *ChatOps) acknowledge(ctx context.Context, monitorId string, user string, source AcknowledgementSource, comment string) string {
+	monitor, ok := c.monitors[monitorId]
+	if !ok {
+		return fmt.Sprintf("Unknown monitor %q.", monitorId)
+	}
+
+	if user == "" {
+		user = "unknown " + string(source) + " user"
+	}
+
+	acknowledgement, err := c.acknowledger.Acknowledge(ctx, monitorId, user, source, comment)
+	if err != nil {
+		if errors.Is(err, ErrNotDown) {
+			return fmt.Sprintf("%s is not down.", monitor.Name)
+		}
+
+		log.Error().Err(err).Str("monitor_id", monitorId).Msg("failed to acknowledge outage")
+		sentry.GetHubFromContext(ctx).CaptureException(err)
+		return fmt.Sprintf("Failed to acknowledge %s, please try again.", monitor.Name)
+	}
+
+	return fmt.Sprintf("%s acknowledged the outage of %s, down since %s.", user, monitor.Name, acknowledgement.OutageStartedAt.Format(time.RFC3339))
+}
+
+// parseAcknowledgeCommand parses the text of an acknowledge command into the monitor ID and the comment. With
+// subcommand, the text starts with "ack" or "acknowledge", as in "/semyi ack api-gateway".
+func parseAcknowledgeCommand(text string, subcommand bool) (monitorId string, comment string, ok bool) {
+	fields := strings.Fields(text)
+	if subcommand {
+		if len(fields) == 0 || (fields[0] != "ack" && fields[0] != "acknowledge") {
+			return "", "", false
+		}
+		fields = fields[1:]
+	}
+
+	if len(fields) == 0 {
+		return "", "", false
+	}
+
+	return fields[0], strings.Join(fields[1:], " "), true
+}
@@ -0,0 +1,172 @@
+package main_test
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	main "semyi"
+	"semyi/testutils"
+
+	"github.com/getsentry/sentry-go"
+)
+
+func newChatOpsServer(t *testing.T, config main.ChatOpsConfig, monitorId string) *http.Server {
+	t.Helper()
+
+	ctx := sentry.SetHubOnContext(context.Background(), sentry.CurrentHub())
+	startOutage(t, ctx, monitorId, time.Now().UTC().Add(-5*time.Minute))
+
+	// The Telegram provider sends the alerts to chat 42, which may acknowledge them
+	monitors := []main.Monitor{{UniqueID: monitorId, Name: "Chat Monitor"}}
+	router := newMockAlertRouter(t, main.AlertRouterConfig{Monitors: monitors, ChatOps: config}, map[string]main.Alerter{
+		"telegram": main.NewTelegramAlertProvider(main.TelegramProviderConfig{Url: "http://telegram.invalid", ChatID: "42"}),
+	})
+	acknowledger := main.NewAcknowledger(main.NewAcknowledgementStore(database), main.NewOutageStore(database), nil)
+	chatOps, err := main.NewChatOps(config, acknowledger, monitors, router, nil)
+	testutils.AssertNoError(t, err, "Failed to create chat-ops")
+
+	return main.NewServer(main.ServerConfig{MonitorList: monitors, Acknowledger: acknowledger, ChatOps: chatOps})
+}
+
+func readAcknowledgements(t *testing.T, monitorId string) []main.Acknowledgement {
+	t.Helper()
+
+	acknowledgements, err := main.NewAcknowledgementStore(database).Read(context.Background(), monitorId, 0)
+	testutils.AssertNoError(t, err, "Failed to read acknowledgements")
+	return acknowledgements
+}
+
+func TestChatOps_Slack(t *testing.T) {
+	server := newChatOpsServer(t, main.ChatOpsConfig{SlackSigningSecret: "signing-secret"}, "chatops-slack")
+
+	serve := func(body string, secret string) *httptest.ResponseRecorder {
+		timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+		mac := hmac.New(sha256.New, []byte(secret))
+		mac.Write([]byte("v0:" + timestamp + ":" + body))
+
+		request := httptest.NewRequest(http.MethodPost, "/api/v1/chatops/slack", strings.NewReader(body))
+		request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		request.Header.Set("X-Slack-Request-Timestamp", timestamp)
+		request.Header.Set("X-Slack-Signature", "v0="+hex.EncodeToString(mac.Sum(nil)))
+		recorder := httptest.NewRecorder()
+		server.Handler.ServeHTTP(recorder, request)
+		return recorder
+	}
+
+	command := url.Values{"command": {"/semyi"}, "text": {"ack chatops-slack looking into it"}, "user_name": {"alice"}}.Encode()
+	recorder := serve(command, "wrong-secret")
+	testutils.AssertEqual(t, http.StatusUnauthorized, recorder.Code, "Expected an invalid signature to be rejected")
+
+	recorder = serve(command, "signing-secret")
+	testutils.AssertEqual(t, http.StatusOK, recorder.Code, "Expected the slash command to succeed")
+	testutils.AssertContains(t, recorder.Body.String(), "alice acknowledged the outage of Chat Monitor", "Unexpected reply")
+
+	payload := `{"type": "block_actions", "user": {"username": "bob"}, "actions": [{"action_id": "acknowledge", "value": "chatops-slack"}]}`
+	recorder = serve(url.Values{"payload": {payload}}.Encode(), "signing-secret")
+	testutils.AssertEqual(t, http.StatusOK, recorder.Code, "Expected the button to succeed")
+
+	acknowledgements := readAcknowledgements(t, "chatops-slack")
+	testutils.AssertEqual(t, 2, len(acknowledgements), "Expected both acknowledgements to be recorded")
+	testutils.AssertEqual(t, "bob", acknowledgements[0].AcknowledgedBy, "Expected the button to record the user")
+	testutils.AssertEqual(t, "looking into it", acknowledgements[1].Comment, "Expected the comment of the slash command")
+}
+
+func TestChatOps_Discord(t *testing.T) {
+	publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	testutils.AssertNoError(t, err, "Failed to generate key")
+
+	server := newChatOpsServer(t, main.ChatOpsConfig{DiscordPublicKey: hex.EncodeToString(publicKey)}, "chatops-discord")
+
+	serve := func(body string, key ed25519.PrivateKey) *httptest.ResponseRecorder {
+		timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+		request := httptest.NewRequest(http.MethodPost, "/api/v1/chatops/discord", strings.NewReader(body))
+		request.Header.Set("X-Signature-Timestamp", timestamp)
+		request.Header.Set("X-Signature-Ed25519", hex.EncodeToString(ed25519.Sign(key, []byte(timestamp+body))))
+		recorder := httptest.NewRecorder()
+		server.Handler.ServeHTTP(recorder, request)
+		return recorder
+	}
+
+	_, otherKey, err := ed25519.GenerateKey(rand.Reader)
+	testutils.AssertNoError(t, err, "Failed to generate key")
+	recorder := serve(`{"type": 1}`, otherKey)
+	testutils.AssertEqual(t, http.StatusUnauthorized, recorder.Code, "Expected an invalid signature to be rejected")
+
+	recorder = serve(`{"type": 1}`, privateKey)
+	testutils.AssertEqual(t, http.StatusOK, recorder.Code, "Expected the ping to succeed")
+	testutils.AssertEqual(t, "{\"type\":1}\n", recorder.Body.String(), "Expected a pong")
+
+	recorder = serve(`{"type": 3, "data": {"custom_id": "ack:chatops-discord"}, "member": {"user": {"username": "carol"}}}`, privateKey)
+	testutils.AssertEqual(t, http.StatusOK, recorder.Code, "Expected the button to succeed")
+
+	var response struct {
+		Type int `json:"type"`
+		Data struct {
+			Content string `json:"content"`
+		} `json:"data"`
+	}
+	err = json.NewDecoder(recorder.Body).Decode(&response)
+	testutils.AssertNoError(t, err, "Failed to decode response")
+	testutils.AssertEqual(t, 4, response.Type, "Expected a message response")
+	testutils.AssertContains(t, response.Data.Content, "carol acknowledged", "Unexpected reply")
+
+	acknowledgements := readAcknowledgements(t, "chatops-discord")
+	testutils.AssertEqual(t, 1, len(acknowledgements), "Expected the acknowledgement to be recorded")
+	testutils.AssertEqual(t, main.AcknowledgementSourceDiscord, acknowledgements[0].Source, "Unexpected source")
+
+	_, err = main.NewChatOps(main.ChatOpsConfig{DiscordPublicKey: "not-a-key"}, nil, nil, nil, nil)
+	testutils.AssertError(t, err, "Expected an invalid public key to be rejected")
+}
+
+func TestChatOps_Telegram(t *testing.T) {
+	server := newChatOpsServer(t, main.ChatOpsConfig{TelegramSecretToken: "token"}, "chatops-telegram")
+
+	serve := func(body string, token string) *httptest.ResponseRecorder {
+		request := httptest.NewRequest(http.MethodPost, "/api/v1/chatops/telegram", strings.NewReader(body))
+		request.Header.Set("X-Telegram-Bot-Api-Secret-Token", token)
+		recorder := httptest.NewRecorder()
+		server.Handler.ServeHTTP(recorder, request)
+		return recorder
+	}
+
+	recorder := serve(`{"message": {"chat": {"id": 42}, "from": {"username": "dave"}, "text": "/ack chatops-telegram"}}`, "wrong")
+	testutils.AssertEqual(t, http.StatusUnauthorized, recorder.Code, "Expected an invalid secret token to be rejected")
+
+	recorder = serve(`{"message": {"chat": {"id": 42}, "from": {"username": "dave"}, "text": "/ack@semyi_bot"}}`, "token")
+	testutils.AssertContains(t, recorder.Body.String(), "Usage", "Expected the usage without a monitor ID")
+
+	recorder = serve(`{"message": {"chat": {"id": 42}, "from": {"username": "dave"}, "text": "/ack chatops-unknown"}}`, "token")
+	testutils.AssertContains(t, recorder.Body.String(), "Unknown monitor", "Expected an unknown monitor to be rejected")
+
+	// Anyone can add the bot to a chat, so the chats that do not receive the alerts are rejected
+	recorder = serve(`{"message": {"chat": {"id": 7}, "from": {"username": "mallory"}, "text": "/ack chatops-telegram"}}`, "token")
+	testutils.AssertContains(t, recorder.Body.String(), "not allowed", "Expected a message from another chat to be rejected")
+
+	recorder = serve(`{"callback_query": {"id": "q0", "from": {"first_name": "Mallory"}, "data": "ack:chatops-telegram", "message": {"chat": {"id": 7}}}}`, "token")
+	testutils.AssertContains(t, recorder.Body.String(), "not allowed", "Expected a button from another chat to be rejected")
+
+	recorder = serve(`{"callback_query": {"id": "q1", "from": {"first_name": "Erin"}, "data": "ack:chatops-telegram", "message": {"chat": {"id": 42}}}}`, "token")
+	testutils.AssertEqual(t, http.StatusOK, recorder.Code, "Expected the button to succeed")
+
+	var response map[string]any
+	err := json.NewDecoder(recorder.Body).Decode(&response)
+	testutils.AssertNoError(t, err, "Failed to decode response")
+	testutils.AssertEqual(t, "answerCallbackQuery", response["method"], "Expected the callback query to be answered")
+	testutils.AssertContains(t, response["text"].(string), "Erin acknowledged", "Unexpected reply")
+
+	acknowledgements := readAcknowledgements(t, "chatops-telegram")
+	testutils.AssertEqual(t, 1, len(acknowledgements), "Expected the acknowledgement to be recorded")
+	testutils.AssertEqual(t, "Erin", acknowledgements[0].AcknowledgedBy, "Expected the first name without a user name")
+}
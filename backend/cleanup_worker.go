@@ -4,56 +4,165 @@ import (
 	"context"
 	"database/sql"
 	"fmt"
+	"maps"
+	"slices"
+	"strings"
 	"time"
 
 	"github.com/getsentry/sentry-go"
 	"github.com/rs/zerolog/log"
 )
 
+// RetentionPolicy specifies how many days of historical data to keep for each tier.
+type RetentionPolicy struct {
+	// Raw specifies how many days of raw check results to keep.
+	Raw int `json:"raw" yaml:"raw" toml:"raw"`
+	// Hourly specifies how many days of hourly aggregates to keep.
+	Hourly int `json:"hourly" yaml:"hourly" toml:"hourly"`
+	// Daily specifies how many days of daily aggregates to keep.
+	Daily int `json:"daily" yaml:"daily" toml:"daily"`
+}
+
+// WithDefaults returns the policy with every tier that is not set taken from the fallback policy.
+func (p RetentionPolicy) WithDefaults(fallback RetentionPolicy) RetentionPolicy {
+	if p.Raw <= 0 {
+		p.Raw = fallback.Raw
+	}
+
+	if p.Hourly <= 0 {
+		p.Hourly = fallback.Hourly
+	}
+
+	if p.Daily <= 0 {
+		p.Daily = fallback.Daily
+	}
+
+	return p
+}
+
+// retentionTiers maps every historical table to its tier of the retention policy.
+var retentionTiers = []struct {
+	table string
+	name  string
+	days  func(policy RetentionPolicy) int
+}{
+	{table: "monitor_historical", name: "raw", days: func(policy RetentionPolicy) int { return policy.Raw }},
+	{table: "monitor_historical_hourly_aggregate", name: "hourly", days: func(policy RetentionPolicy) int { return policy.Hourly }},
+	{table: "monitor_historical_daily_aggregate", name: "daily", days: func(policy RetentionPolicy) int { return policy.Daily }},
+}
+
 // CleanupWorker handles the cleanup of old historical data based on retention period
 type CleanupWorker struct {
-	db              *sql.DB
-	retentionPeriod int
+	storage   RetentionStorage
+	retention RetentionPolicy
+	// overrides holds the retention policy of every monitor that overrides at least one tier.
+	overrides map[string]RetentionPolicy
+	// outbox holds the alert deliveries, which are kept as long as the raw data. They are not deleted if nil.
+	outbox *AlertOutbox
 }
 
-// NewCleanupWorker creates a new cleanup worker
-func NewCleanupWorker(db *sql.DB, retentionPeriod int) *CleanupWorker {
+// NewCleanupWorker creates a new cleanup worker. Monitors can override each tier of the retention policy.
+func NewCleanupWorker(storage RetentionStorage, retention RetentionPolicy, monitors []Monitor, outbox *AlertOutbox) *CleanupWorker {
 	return &CleanupWorker{
-		db:              db,
-		retentionPeriod: retentionPeriod,
+		storage:   storage,
+		retention: retention,
+		overrides: retentionOverrides(retention, monitors),
+		outbox:    outbox,
+	}
+}
+
+// retentionOverrides returns the retention policy of every monitor that overrides at least one tier.
+func retentionOverrides(retention RetentionPolicy, monitors []Monitor) map[string]RetentionPolicy {
+	overrides := make(map[string]RetentionPolicy)
+	for _, monitor := range monitors {
+		if monitor.Retention == (RetentionPolicy{}) {
+			continue
+		}
+
+		overrides[monitor.UniqueID] = monitor.Retention.WithDefaults(retention)
 	}
+
+	return overrides
 }
 
 // Run starts the cleanup worker
 func (w *CleanupWorker) Run(ctx context.Context) {
-	// Run cleanup every 24 hours
+	// Run cleanup at startup, then every 24 hours
 	ticker := time.NewTicker(24 * time.Hour)
 	defer ticker.Stop()
 
 	for {
+		ctx := sentry.SetHubOnContext(ctx, sentry.CurrentHub().Clone())
+		if err := w.Cleanup(ctx); err != nil {
+			log.Error().Err(err).Msg("Failed to run cleanup")
+		}
+
 		select {
 		case <-ctx.Done():
 			return
 		case <-ticker.C:
-			ctx = sentry.SetHubOnContext(ctx, sentry.CurrentHub().Clone())
-			if err := w.Cleanup(ctx); err != nil {
-				log.Error().Err(err).Msg("Failed to run cleanup")
-			}
 		}
 	}
 }
 
-// Cleanup removes historical data older than the retention period
+// Cleanup removes historical data older than the retention period of its tier, and the alert deliveries older
+// than the raw retention period.
 func (w *CleanupWorker) Cleanup(ctx context.Context) error {
 	span := sentry.StartSpan(ctx, "function", sentry.WithDescription("CleanupWorker.Cleanup"))
 	ctx = span.Context()
 	defer span.Finish()
 
-	// Calculate the cutoff date
-	cutoffDate := time.Now().AddDate(0, 0, -w.retentionPeriod)
+	now := time.Now().UTC()
+	err := w.storage.DeleteExpired(ctx, w.retention, w.overrides, now)
+	if err != nil {
+		return err
+	}
+
+	if w.outbox != nil {
+		err = w.outbox.DeleteExpired(ctx, now.AddDate(0, 0, -w.retention.Raw))
+		if err != nil {
+			return err
+		}
+	}
+
+	log.Info().
+		Int("raw_retention_days", w.retention.Raw).
+		Int("hourly_retention_days", w.retention.Hourly).
+		Int("daily_retention_days", w.retention.Daily).
+		Int("monitor_overrides", len(w.overrides)).
+		Msg("Successfully cleaned up old historical data")
+
+	return nil
+}
+
+// MonitorHistoricalCleaner deletes the expired historical data of the SQL storage.
+type MonitorHistoricalCleaner struct {
+	db *sql.DB
+
+	// archive receives the expiring raw data before it is deleted. Archiving is disabled if nil.
+	archive *Archive
+
+	ttlApplied bool
+}
+
+// NewMonitorHistoricalCleaner creates a new MonitorHistoricalCleaner. If archive is not nil, the raw data
+// is archived before it is deleted.
+func NewMonitorHistoricalCleaner(db *sql.DB, archive *Archive) *MonitorHistoricalCleaner {
+	return &MonitorHistoricalCleaner{
+		db:      db,
+		archive: archive,
+	}
+}
+
+// DeleteExpired removes historical data older than the retention period of its tier. On ClickHouse, the
+// retention is enforced by the table TTL instead, which is set on the first run.
+func (c *MonitorHistoricalCleaner) DeleteExpired(ctx context.Context, retention RetentionPolicy, overrides map[string]RetentionPolicy, now time.Time) error {
+	span := sentry.StartSpan(ctx, "function", sentry.WithDescription("MonitorHistoricalCleaner.DeleteExpired"))
+	ctx = span.Context()
+	defer span.Finish()
 
 	// Get a connection from the pool
-	conn, err := w.db.Conn(ctx)
+	conn, err := c.db.Conn(ctx)
 	if err != nil {
 		return fmt.Errorf("failed to get connection: %w", err)
 	}
@@ -63,37 +172,48 @@ func (w *CleanupWorker) Cleanup(ctx context.Context) error {
 		}
 	}()
 
-	// Start a transaction
-	tx, err := conn.BeginTx(ctx, nil)
+	dialect, err := DetectDialect(ctx, conn)
 	if err != nil {
-		return fmt.Errorf("failed to begin transaction: %w", err)
+		return err
 	}
 
-	// Delete old data from raw historical table
-	_, err = tx.ExecContext(ctx, "DELETE FROM monitor_historical WHERE timestamp < ?", cutoffDate)
-	if err != nil {
-		if rollbackErr := tx.Rollback(); rollbackErr != nil {
-			log.Error().Err(rollbackErr).Msg("Failed to rollback transaction after raw historical data deletion")
+	if dialect == DialectClickHouse {
+		if c.ttlApplied {
+			return nil
+		}
+
+		err = c.applyTTL(ctx, conn, retention, overrides)
+		if err != nil {
+			return err
 		}
-		return fmt.Errorf("failed to delete old raw historical data: %w", err)
+
+		c.ttlApplied = true
+		return nil
 	}
 
-	// Delete old data from hourly aggregate table
-	_, err = tx.ExecContext(ctx, "DELETE FROM monitor_historical_hourly_aggregate WHERE timestamp < ?", cutoffDate)
+	materialized, err := MaterializedAggregates(ctx, conn, dialect)
 	if err != nil {
-		if rollbackErr := tx.Rollback(); rollbackErr != nil {
-			log.Error().Err(rollbackErr).Msg("Failed to rollback transaction after hourly historical data deletion")
-		}
-		return fmt.Errorf("failed to delete old hourly historical data: %w", err)
+		return err
 	}
 
-	// Delete old data from daily aggregate table
-	_, err = tx.ExecContext(ctx, "DELETE FROM monitor_historical_daily_aggregate WHERE timestamp < ?", cutoffDate)
+	// Start a transaction
+	tx, err := conn.BeginTx(ctx, nil)
 	if err != nil {
-		if rollbackErr := tx.Rollback(); rollbackErr != nil {
-			log.Error().Err(rollbackErr).Msg("Failed to rollback transaction after daily historical data deletion")
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+
+	for _, tier := range retentionTiers {
+		if materialized && tier.table != "monitor_historical" {
+			err = c.dropContinuousAggregateChunks(ctx, tx, tier.table, tier.days, retention, overrides)
+		} else {
+			err = c.deleteTier(ctx, tx, tier.table, tier.days, retention, overrides, now)
+		}
+		if err != nil {
+			if rollbackErr := tx.Rollback(); rollbackErr != nil {
+				log.Error().Err(rollbackErr).Msgf("Failed to rollback transaction after %s historical data deletion", tier.name)
+			}
+			return fmt.Errorf("failed to delete old %s historical data: %w", tier.name, err)
 		}
-		return fmt.Errorf("failed to delete old daily historical data: %w", err)
 	}
 
 	// Commit the transaction
@@ -104,10 +224,115 @@ func (w *CleanupWorker) Cleanup(ctx context.Context) error {
 		return fmt.Errorf("failed to commit transaction: %w", err)
 	}
 
-	log.Info().
-		Time("cutoff_date", cutoffDate).
-		Int("retention_period_days", w.retentionPeriod).
-		Msg("Successfully cleaned up old historical data")
+	return nil
+}
+
+// deleteTier deletes the data of a single table, with the cutoff of each monitor that overrides the retention,
+// and the default cutoff for every other monitor. Raw data is archived first if the archive is enabled.
+func (c *MonitorHistoricalCleaner) deleteTier(ctx context.Context, tx *sql.Tx, table string, days func(policy RetentionPolicy) int, retention RetentionPolicy, overrides map[string]RetentionPolicy, now time.Time) error {
+	var overridden []any
+	for _, monitorId := range slices.Sorted(maps.Keys(overrides)) {
+		policy := overrides[monitorId]
+		if days(policy) == days(retention) {
+			continue
+		}
+
+		overridden = append(overridden, monitorId)
+		cutoffDate := now.AddDate(0, 0, -days(policy))
+		err := c.deleteWhere(ctx, tx, table, "monitor_id = ? AND timestamp < ?", monitorId, cutoffDate)
+		if err != nil {
+			return err
+		}
+	}
+
+	cutoffDate := now.AddDate(0, 0, -days(retention))
+	condition := "timestamp < ?"
+	args := []any{cutoffDate}
+	if len(overridden) > 0 {
+		condition += fmt.Sprintf(" AND monitor_id NOT IN (%s)", strings.TrimSuffix(strings.Repeat("?, ", len(overridden)), ", "))
+		args = append(args, overridden...)
+	}
+
+	return c.deleteWhere(ctx, tx, table, condition, args...)
+}
+
+// deleteWhere deletes the rows of a table that match the condition, archiving them first if they are raw data.
+func (c *MonitorHistoricalCleaner) deleteWhere(ctx context.Context, tx *sql.Tx, table string, condition string, args ...any) error {
+	if c.archive != nil && table == "monitor_historical" {
+		err := c.archive.Export(ctx, tx, condition, args...)
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err := tx.ExecContext(ctx, fmt.Sprintf("DELETE FROM %s WHERE %s", table, condition), args...)
+	return err
+}
+
+// dropContinuousAggregateChunks drops the expired chunks of the TimescaleDB continuous aggregate behind an
+// aggregate table. Chunks hold every monitor, so they are kept for the longest retention of the tier.
+func (c *MonitorHistoricalCleaner) dropContinuousAggregateChunks(ctx context.Context, tx *sql.Tx, table string, days func(policy RetentionPolicy) int, retention RetentionPolicy, overrides map[string]RetentionPolicy) error {
+	retentionDays := days(retention)
+	for _, policy := range overrides {
+		retentionDays = max(retentionDays, days(policy))
+	}
+
+	for _, aggregate := range continuousAggregates {
+		if aggregate.table != table {
+			continue
+		}
+
+		_, err := tx.ExecContext(ctx, fmt.Sprintf("SELECT drop_chunks('%s', older_than => INTERVAL '%d days')", aggregate.continuousView, retentionDays))
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// applyTTL sets the TTL of every historical table, so ClickHouse drops the expired rows in the background
+// while merging parts, which is far cheaper than a DELETE mutation.
+// The aggregates of the native ClickHouse schema are views, so their TTL is set on the underlying state tables.
+func (c *MonitorHistoricalCleaner) applyTTL(ctx context.Context, conn *sql.Conn, retention RetentionPolicy, overrides map[string]RetentionPolicy) error {
+	materialized, err := MaterializedAggregates(ctx, conn, DialectClickHouse)
+	if err != nil {
+		return err
+	}
+
+	for _, tier := range retentionTiers {
+		table := tier.table
+		if materialized && table != "monitor_historical" {
+			table += "_state"
+		}
+
+		_, err := conn.ExecContext(ctx, fmt.Sprintf("ALTER TABLE %s MODIFY TTL %s", table, ttlExpression(tier.days, retention, overrides)))
+		if err != nil {
+			return fmt.Errorf("failed to set the TTL of %s historical data: %w", tier.name, err)
+		}
+	}
 
 	return nil
 }
+
+// ttlExpression returns the TTL expression of a single table. Monitors that override the retention get
+// their own number of days through multiIf. The timestamp is converted to DateTime, since a TTL can not be
+// a DateTime64, which the native schema uses for the raw data.
+func ttlExpression(days func(policy RetentionPolicy) int, retention RetentionPolicy, overrides map[string]RetentionPolicy) string {
+	var branches []string
+	for _, monitorId := range slices.Sorted(maps.Keys(overrides)) {
+		policy := overrides[monitorId]
+		if days(policy) == days(retention) {
+			continue
+		}
+
+		quoted := "'" + strings.ReplaceAll(strings.ReplaceAll(monitorId, `\`, `\\`), "'", `\'`) + "'"
+		branches = append(branches, fmt.Sprintf("monitor_id = %s, %d", quoted, days(policy)))
+	}
+
+	if len(branches) == 0 {
+		return fmt.Sprintf("toDateTime(timestamp) + INTERVAL %d DAY", days(retention))
+	}
+
+	return fmt.Sprintf("addDays(toDateTime(timestamp), multiIf(%s, %d))", strings.Join(branches, ", "), days(retention))
+}
@@ -9,6 +9,9 @@ import (
 )
 
 func TestCleanupWorker(t *testing.T) {
+	// The database maintains materialized aggregates by itself, only the raw data is written by the test then
+	materialized := materializedAggregates(t)
+
 	// Insert test data
 	now := time.Now()
 	oldDate := now.AddDate(0, 0, -5)    // 5 days old
@@ -30,28 +33,30 @@ func TestCleanupWorker(t *testing.T) {
 		t.Fatalf("Failed to insert test data into monitor_historical: %v", err)
 	}
 
-	// Insert data into hourly aggregate table
-	_, err = database.Exec(`
-		INSERT INTO monitor_historical_hourly_aggregate (timestamp, monitor_id, status, latency) VALUES
-		(?, ?, 1, 100),
-		(?, ?, 1, 100),
-		(?, ?, 1, 200),
-		(?, ?, 1, 200)
-	`, oldDate, monitorID1, recentDate, monitorID1, oldDate, monitorID2, recentDate, monitorID2)
-	if err != nil {
-		t.Fatalf("Failed to insert test data into monitor_historical_hourly_aggregate: %v", err)
-	}
+	if !materialized {
+		// Insert data into hourly aggregate table
+		_, err = database.Exec(`
+			INSERT INTO monitor_historical_hourly_aggregate (timestamp, monitor_id, status, latency) VALUES
+			(?, ?, 1, 100),
+			(?, ?, 1, 100),
+			(?, ?, 1, 200),
+			(?, ?, 1, 200)
+		`, oldDate, monitorID1, recentDate, monitorID1, oldDate, monitorID2, recentDate, monitorID2)
+		if err != nil {
+			t.Fatalf("Failed to insert test data into monitor_historical_hourly_aggregate: %v", err)
+		}
 
-	// Insert data into daily aggregate table
-	_, err = database.Exec(`
-		INSERT INTO monitor_historical_daily_aggregate (timestamp, monitor_id, status, latency) VALUES
-		(?, ?, 1, 100),
-		(?, ?, 1, 100),
-		(?, ?, 1, 200),
-		(?, ?, 1, 200)
-	`, oldDate, monitorID1, recentDate, monitorID1, oldDate, monitorID2, recentDate, monitorID2)
-	if err != nil {
-		t.Fatalf("Failed to insert test data into monitor_historical_daily_aggregate: %v", err)
+		// Insert data into daily aggregate table
+		_, err = database.Exec(`
+			INSERT INTO monitor_historical_daily_aggregate (timestamp, monitor_id, status, latency) VALUES
+			(?, ?, 1, 100),
+			(?, ?, 1, 100),
+			(?, ?, 1, 200),
+			(?, ?, 1, 200)
+		`, oldDate, monitorID1, recentDate, monitorID1, oldDate, monitorID2, recentDate, monitorID2)
+		if err != nil {
+			t.Fatalf("Failed to insert test data into monitor_historical_daily_aggregate: %v", err)
+		}
 	}
 
 	// Register cleanup function to remove test data
@@ -62,6 +67,10 @@ func TestCleanupWorker(t *testing.T) {
 			t.Logf("Warning: failed to clean up monitor_historical: %v", err)
 		}
 
+		if materialized {
+			return
+		}
+
 		// Clean up monitor_historical_hourly_aggregate
 		_, err = database.Exec("DELETE FROM monitor_historical_hourly_aggregate WHERE monitor_id IN (?, ?)", monitorID1, monitorID2)
 		if err != nil {
@@ -76,7 +85,7 @@ func TestCleanupWorker(t *testing.T) {
 	})
 
 	// Create cleanup worker with 3 days retention period
-	worker := main.NewCleanupWorker(database, 3)
+	worker := main.NewCleanupWorker(main.NewSQLStorage(database, nil), main.RetentionPolicy{Raw: 3, Hourly: 3, Daily: 3}, nil, nil)
 
 	// Run cleanup
 	err = worker.Cleanup(context.Background())
@@ -94,20 +103,22 @@ func TestCleanupWorker(t *testing.T) {
 		t.Errorf("Expected 0 old records in monitor_historical, got %d", count)
 	}
 
-	err = database.QueryRow("SELECT COUNT(*) FROM monitor_historical_hourly_aggregate WHERE timestamp < ? AND monitor_id IN (?, ?)", now.AddDate(0, 0, -3), monitorID1, monitorID2).Scan(&count)
-	if err != nil {
-		t.Fatalf("Failed to query monitor_historical_hourly_aggregate: %v", err)
-	}
-	if count != 0 {
-		t.Errorf("Expected 0 old records in monitor_historical_hourly_aggregate, got %d", count)
-	}
+	if !materialized {
+		err = database.QueryRow("SELECT COUNT(*) FROM monitor_historical_hourly_aggregate WHERE timestamp < ? AND monitor_id IN (?, ?)", now.AddDate(0, 0, -3), monitorID1, monitorID2).Scan(&count)
+		if err != nil {
+			t.Fatalf("Failed to query monitor_historical_hourly_aggregate: %v", err)
+		}
+		if count != 0 {
+			t.Errorf("Expected 0 old records in monitor_historical_hourly_aggregate, got %d", count)
+		}
 
-	err = database.QueryRow("SELECT COUNT(*) FROM monitor_historical_daily_aggregate WHERE timestamp < ? AND monitor_id IN (?, ?)", now.AddDate(0, 0, -3), monitorID1, monitorID2).Scan(&count)
-	if err != nil {
-		t.Fatalf("Failed to query monitor_historical_daily_aggregate: %v", err)
-	}
-	if count != 0 {
-		t.Errorf("Expected 0 old records in monitor_historical_daily_aggregate, got %d", count)
+		err = database.QueryRow("SELECT COUNT(*) FROM monitor_historical_daily_aggregate WHERE timestamp < ? AND monitor_id IN (?, ?)", now.AddDate(0, 0, -3), monitorID1, monitorID2).Scan(&count)
+		if err != nil {
+			t.Fatalf("Failed to query monitor_historical_daily_aggregate: %v", err)
+		}
+		if count != 0 {
+			t.Errorf("Expected 0 old records in monitor_historical_daily_aggregate, got %d", count)
+		}
 	}
 
 	// Verify that recent data is preserved
@@ -119,19 +130,87 @@ func TestCleanupWorker(t *testing.T) {
 		t.Errorf("Expected 2 recent records in monitor_historical, got %d", count)
 	}
 
-	err = database.QueryRow("SELECT COUNT(*) FROM monitor_historical_hourly_aggregate WHERE timestamp >= ? AND monitor_id IN (?, ?)", now.AddDate(0, 0, -3), monitorID1, monitorID2).Scan(&count)
-	if err != nil {
-		t.Fatalf("Failed to query monitor_historical_hourly_aggregate: %v", err)
+	if !materialized {
+		err = database.QueryRow("SELECT COUNT(*) FROM monitor_historical_hourly_aggregate WHERE timestamp >= ? AND monitor_id IN (?, ?)", now.AddDate(0, 0, -3), monitorID1, monitorID2).Scan(&count)
+		if err != nil {
+			t.Fatalf("Failed to query monitor_historical_hourly_aggregate: %v", err)
+		}
+		if count != 2 {
+			t.Errorf("Expected 2 recent records in monitor_historical_hourly_aggregate, got %d", count)
+		}
+
+		err = database.QueryRow("SELECT COUNT(*) FROM monitor_historical_daily_aggregate WHERE timestamp >= ? AND monitor_id IN (?, ?)", now.AddDate(0, 0, -3), monitorID1, monitorID2).Scan(&count)
+		if err != nil {
+			t.Fatalf("Failed to query monitor_historical_daily_aggregate: %v", err)
+		}
+		if count != 2 {
+			t.Errorf("Expected 2 recent records in monitor_historical_daily_aggregate, got %d", count)
+		}
 	}
-	if count != 2 {
-		t.Errorf("Expected 2 recent records in monitor_historical_hourly_aggregate, got %d", count)
+}
+
+func TestCleanupWorker_RetentionPolicy(t *testing.T) {
+	// Materialized aggregates are maintained by the database, only the raw data is written by the test then
+	tables := []string{"monitor_historical", "monitor_historical_hourly_aggregate"}
+	materialized := materializedAggregates(t)
+	if materialized {
+		tables = tables[:1]
+	}
+
+	now := time.Now()
+	oldDate := now.AddDate(0, 0, -5) // 5 days old
+
+	// The first monitor follows the global retention, the second one keeps its raw data longer
+	monitorID1 := "cleanup_policy_test1"
+	monitorID2 := "cleanup_policy_test2"
+
+	for _, table := range tables {
+		_, err := database.Exec("INSERT INTO "+table+" (timestamp, monitor_id, status, latency) VALUES (?, ?, 0, 100), (?, ?, 0, 100)", oldDate, monitorID1, oldDate, monitorID2)
+		if err != nil {
+			t.Fatalf("Failed to insert test data into %s: %v", table, err)
+		}
 	}
 
-	err = database.QueryRow("SELECT COUNT(*) FROM monitor_historical_daily_aggregate WHERE timestamp >= ? AND monitor_id IN (?, ?)", now.AddDate(0, 0, -3), monitorID1, monitorID2).Scan(&count)
+	t.Cleanup(func() {
+		for _, table := range tables {
+			_, err := database.Exec("DELETE FROM "+table+" WHERE monitor_id IN (?, ?)", monitorID1, monitorID2)
+			if err != nil {
+				t.Logf("Warning: failed to clean up %s: %v", table, err)
+			}
+		}
+	})
+
+	worker := main.NewCleanupWorker(main.NewSQLStorage(database, nil), main.RetentionPolicy{Raw: 3, Hourly: 30, Daily: 30}, []main.Monitor{
+		{UniqueID: monitorID2, Retention: main.RetentionPolicy{Raw: 10}},
+	}, nil)
+
+	err := worker.Cleanup(context.Background())
 	if err != nil {
-		t.Fatalf("Failed to query monitor_historical_daily_aggregate: %v", err)
+		t.Fatalf("Cleanup failed: %v", err)
 	}
-	if count != 2 {
-		t.Errorf("Expected 2 recent records in monitor_historical_daily_aggregate, got %d", count)
+
+	expectations := []struct {
+		table     string
+		monitorID string
+		expected  int
+	}{
+		{table: "monitor_historical", monitorID: monitorID1, expected: 0},
+		{table: "monitor_historical", monitorID: monitorID2, expected: 1},
+		{table: "monitor_historical_hourly_aggregate", monitorID: monitorID1, expected: 1},
+		{table: "monitor_historical_hourly_aggregate", monitorID: monitorID2, expected: 1},
+	}
+	for _, expectation := range expectations {
+		if materialized && expectation.table != "monitor_historical" {
+			continue
+		}
+
+		var count int
+		err = database.QueryRow("SELECT COUNT(*) FROM "+expectation.table+" WHERE monitor_id = ?", expectation.monitorID).Scan(&count)
+		if err != nil {
+			t.Fatalf("Failed to query %s: %v", expectation.table, err)
+		}
+		if count != expectation.expected {
+			t.Errorf("Expected %d records of %s in %s, got %d", expectation.expected, expectation.monitorID, expectation.table, count)
+		}
 	}
 }
@@ -0,0 +1,405 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// CommandDependencies holds what the command line commands need, after the configuration file has been
+// read and the database has been migrated.
+type CommandDependencies struct {
+	Monitors        []Monitor
+	AggregateWorker *AggregateWorker
+	// Archive is nil if archiving is not enabled.
+	Archive  *Archive
+	Exporter *HistoricalExporter
+}
+
+// RunCommand runs a one-off command given on the command line, instead of starting the server.
+func RunCommand(ctx context.Context, args []string, dependencies CommandDependencies) error {
+	switch args[0] {
+	case "rebuild-aggregates":
+		return runRebuildAggregatesCommand(ctx, args[1:], dependencies)
+	case "import-archive":
+		return runImportArchiveCommand(ctx, args[1:], dependencies)
+	case "export":
+		return runExportCommand(ctx, args[1:], dependencies)
+	case "import":
+		return runImportCommand(ctx, args[1:], dependencies)
+	default:
+		return fmt.Errorf("unknown command %q, available commands: migrate, rebuild-aggregates, import-archive, export, import", args[0])
+	}
+}
+
+// RunMigrateCommand shows, applies, or reverts the migrations. Unlike the other commands, it runs before
+// the pending migrations are applied on startup, so the schema can be inspected and rolled back.
+func RunMigrateCommand(ctx context.Context, db *sql.DB, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("missing subcommand, available subcommands: status, up, down")
+	}
+
+	flags := flag.NewFlagSet("migrate "+args[0], flag.ContinueOnError)
+	toFlag := flags.Int64("to", 0, "version to migrate to (up: default to the latest version, down: required, 0 reverts every migration)")
+	err := flags.Parse(args[1:])
+	if err != nil {
+		return err
+	}
+
+	switch args[0] {
+	case "status":
+		statuses, err := MigrationStatuses(ctx, db)
+		if err != nil {
+			return err
+		}
+
+		writer := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		_, _ = fmt.Fprintln(writer, "VERSION\tNAME\tSTATUS\tAPPLIED AT")
+		for _, status := range statuses {
+			state, appliedAt := "pending", "-"
+			if status.Applied {
+				state, appliedAt = "applied", status.AppliedAt.Format(time.RFC3339)
+			}
+
+			_, _ = fmt.Fprintf(writer, "%d\t%s\t%s\t%s\n", status.Version, status.Name, state, appliedAt)
+		}
+
+		return writer.Flush()
+	case "up":
+		return MigrateUp(ctx, db, *toFlag)
+	case "down":
+		var toSet bool
+		flags.Visit(func(f *flag.Flag) {
+			toSet = toSet || f.Name == "to"
+		})
+		if !toSet {
+			return fmt.Errorf("-to is required, use -to 0 to revert every migration")
+		}
+
+		return MigrateDown(ctx, db, *toFlag)
+	default:
+		return fmt.Errorf("unknown subcommand %q, available subcommands: status, up, down", args[0])
+	}
+}
+
+// runRebuildAggregatesCommand recomputes the hourly and daily aggregates for a time range,
+// e.g. after the raw historical data has been repaired. The range must be within the raw retention.
+func runRebuildAggregatesCommand(ctx context.Context, args []string, dependencies CommandDependencies) error {
+	flags := flag.NewFlagSet("rebuild-aggregates", flag.ContinueOnError)
+	fromFlag := flags.String("from", "", "start of the time range, in RFC 3339 format (required)")
+	toFlag := flags.String("to", "", "end of the time range, in RFC 3339 format (default: now)")
+	monitorFlag := flags.String("monitor", "", "unique ID of the monitor to rebuild (default: every monitor)")
+	intervalFlag := flags.String("interval", "all", "aggregate interval to rebuild: hour, day, or all")
+	err := flags.Parse(args)
+	if err != nil {
+		return err
+	}
+
+	if *fromFlag == "" {
+		return fmt.Errorf("-from is required")
+	}
+
+	from, err := time.Parse(time.RFC3339, *fromFlag)
+	if err != nil {
+		return fmt.Errorf("invalid -from: %w", err)
+	}
+
+	to := time.Now()
+	if *toFlag != "" {
+		to, err = time.Parse(time.RFC3339, *toFlag)
+		if err != nil {
+			return fmt.Errorf("invalid -to: %w", err)
+		}
+	}
+
+	if !to.After(from) {
+		return fmt.Errorf("-to must be after -from")
+	}
+
+	var intervals []AggregateInterval
+	switch *intervalFlag {
+	case "hour":
+		intervals = []AggregateInterval{AggregateIntervalHour}
+	case "day":
+		intervals = []AggregateInterval{AggregateIntervalDay}
+	case "all":
+		intervals = []AggregateInterval{AggregateIntervalHour, AggregateIntervalDay}
+	default:
+		return fmt.Errorf("invalid -interval %q, must be hour, day, or all", *intervalFlag)
+	}
+
+	var monitorIds []string
+	for _, monitor := range dependencies.Monitors {
+		monitorIds = append(monitorIds, monitor.UniqueID)
+	}
+
+	if *monitorFlag != "" {
+		if !slices.Contains(monitorIds, *monitorFlag) {
+			return fmt.Errorf("monitor %q is not in the configuration file", *monitorFlag)
+		}
+
+		monitorIds = []string{*monitorFlag}
+	}
+
+	// The aggregates are recomputed from the raw historical data, rebuilding them without it would wipe them out
+	now := time.Now()
+	for _, monitorId := range monitorIds {
+		for _, interval := range intervals {
+			start := dependencies.AggregateWorker.RawRetentionStart(monitorId, interval, now)
+			if interval.Truncate(from).Before(start) {
+				return fmt.Errorf("-from of monitor %s: %w, %s aggregates can only be rebuilt from %s", monitorId, ErrPastRawRetention, interval, start.Format(time.RFC3339))
+			}
+		}
+	}
+
+	for _, monitorId := range monitorIds {
+		for _, interval := range intervals {
+			err = dependencies.AggregateWorker.Rebuild(ctx, monitorId, interval, from, to)
+			if err != nil {
+				return fmt.Errorf("failed to rebuild %s aggregates for monitor %s: %w", interval, monitorId, err)
+			}
+
+			log.Info().Str("monitor_id", monitorId).Str("interval", string(interval)).Msg("rebuilt aggregates")
+		}
+	}
+
+	return nil
+}
+
+// runImportArchiveCommand copies the archived raw historical data for a time range back into the database,
+// e.g. to investigate an old incident with the regular API.
+func runImportArchiveCommand(ctx context.Context, args []string, dependencies CommandDependencies) error {
+	flags := flag.NewFlagSet("import-archive", flag.ContinueOnError)
+	fromFlag := flags.String("from", "", "start of the time range, in RFC 3339 format (required)")
+	toFlag := flags.String("to", "", "end of the time range, in RFC 3339 format (required)")
+	monitorFlag := flags.String("monitor", "", "unique ID of the monitor to import (default: every monitor)")
+	err := flags.Parse(args)
+	if err != nil {
+		return err
+	}
+
+	if dependencies.Archive == nil {
+		return fmt.Errorf("archive is not enabled, set archive_directory in the configuration file")
+	}
+
+	if *fromFlag == "" || *toFlag == "" {
+		return fmt.Errorf("-from and -to are required")
+	}
+
+	from, err := time.Parse(time.RFC3339, *fromFlag)
+	if err != nil {
+		return fmt.Errorf("invalid -from: %w", err)
+	}
+
+	to, err := time.Parse(time.RFC3339, *toFlag)
+	if err != nil {
+		return fmt.Errorf("invalid -to: %w", err)
+	}
+
+	if !to.After(from) {
+		return fmt.Errorf("-to must be after -from")
+	}
+
+	var monitorIds []string
+	for _, monitor := range dependencies.Monitors {
+		monitorIds = append(monitorIds, monitor.UniqueID)
+	}
+
+	if *monitorFlag != "" {
+		if !slices.Contains(monitorIds, *monitorFlag) {
+			return fmt.Errorf("monitor %q is not in the configuration file", *monitorFlag)
+		}
+
+		monitorIds = []string{*monitorFlag}
+	}
+
+	for _, monitorId := range monitorIds {
+		imported, err := dependencies.Archive.Import(ctx, monitorId, from, to)
+		if err != nil {
+			return fmt.Errorf("failed to import archive for monitor %s: %w", monitorId, err)
+		}
+
+		log.Info().Str("monitor_id", monitorId).Int64("rows", imported).Msg("imported archive")
+	}
+
+	return nil
+}
+
+// commandTables resolves the -table flag of the export and import commands, where "all" selects every table.
+func commandTables(value string) ([]string, error) {
+	if value == "all" {
+		return ExportTableNames(), nil
+	}
+
+	_, err := findExportTable(value)
+	if err != nil {
+		return nil, err
+	}
+
+	return []string{value}, nil
+}
+
+// runExportCommand writes the historical data and incidents to a file, or to the standard output.
+// With -table all, every table is written to <output>/<table>.<format>.
+func runExportCommand(ctx context.Context, args []string, dependencies CommandDependencies) error {
+	flags := flag.NewFlagSet("export", flag.ContinueOnError)
+	tableFlag := flags.String("table", "monitor_historical", "table to export: "+strings.Join(ExportTableNames(), ", ")+", or all")
+	formatFlag := flags.String("format", "csv", "file format: csv, jsonl, or parquet")
+	fromFlag := flags.String("from", "", "start of the time range, in RFC 3339 format (default: the oldest row)")
+	toFlag := flags.String("to", "", "end of the time range, in RFC 3339 format (default: the newest row)")
+	monitorFlag := flags.String("monitor", "", "comma separated unique IDs of the monitors to export (default: every monitor)")
+	outputFlag := flags.String("output", "-", "file to write to, - for the standard output, or a directory with -table all")
+	err := flags.Parse(args)
+	if err != nil {
+		return err
+	}
+
+	tables, err := commandTables(*tableFlag)
+	if err != nil {
+		return err
+	}
+
+	format, err := ParseExportFormat(*formatFlag)
+	if err != nil {
+		return err
+	}
+
+	var filter ExportFilter
+	if *fromFlag != "" {
+		filter.From, err = time.Parse(time.RFC3339, *fromFlag)
+		if err != nil {
+			return fmt.Errorf("invalid -from: %w", err)
+		}
+	}
+
+	if *toFlag != "" {
+		filter.To, err = time.Parse(time.RFC3339, *toFlag)
+		if err != nil {
+			return fmt.Errorf("invalid -to: %w", err)
+		}
+	}
+
+	if *monitorFlag != "" {
+		filter.MonitorIDs = strings.Split(*monitorFlag, ",")
+	}
+
+	if *tableFlag == "all" {
+		if *outputFlag == "-" {
+			return fmt.Errorf("-output must be a directory with -table all")
+		}
+
+		err = os.MkdirAll(*outputFlag, 0o755)
+		if err != nil {
+			return fmt.Errorf("failed to create output directory: %w", err)
+		}
+	}
+
+	for _, table := range tables {
+		output := *outputFlag
+		if *tableFlag == "all" {
+			output = filepath.Join(*outputFlag, table+"."+string(format))
+		}
+
+		var writer io.Writer = os.Stdout
+		var file *os.File
+		if output != "-" {
+			file, err = os.Create(output)
+			if err != nil {
+				return fmt.Errorf("failed to create %s: %w", output, err)
+			}
+			writer = file
+		}
+
+		exported, err := dependencies.Exporter.Export(ctx, writer, table, format, filter)
+		if file != nil {
+			if closeErr := file.Close(); err == nil {
+				err = closeErr
+			}
+		}
+		if err != nil {
+			return err
+		}
+
+		log.Info().Str("table", table).Int64("rows", exported).Msg("exported table")
+	}
+
+	return nil
+}
+
+// runImportCommand writes the historical data and incidents from a file, or from the standard input, to the
+// database. With -table all, every <input>/<table>.<format> file that exists is imported.
+func runImportCommand(ctx context.Context, args []string, dependencies CommandDependencies) error {
+	flags := flag.NewFlagSet("import", flag.ContinueOnError)
+	tableFlag := flags.String("table", "monitor_historical", "table to import: "+strings.Join(ExportTableNames(), ", ")+", or all")
+	formatFlag := flags.String("format", "csv", "file format: csv, jsonl, or parquet")
+	inputFlag := flags.String("input", "-", "file to read from, - for the standard input, or a directory with -table all")
+	err := flags.Parse(args)
+	if err != nil {
+		return err
+	}
+
+	tables, err := commandTables(*tableFlag)
+	if err != nil {
+		return err
+	}
+
+	format, err := ParseExportFormat(*formatFlag)
+	if err != nil {
+		return err
+	}
+
+	if *tableFlag == "all" && *inputFlag == "-" {
+		return fmt.Errorf("-input must be a directory with -table all")
+	}
+
+	for _, table := range tables {
+		input := *inputFlag
+		if *tableFlag == "all" {
+			input = filepath.Join(*inputFlag, table+"."+string(format))
+			if _, err := os.Stat(input); errors.Is(err, fs.ErrNotExist) {
+				log.Info().Str("table", table).Str("input", input).Msg("skipping table without a file")
+				continue
+			}
+		}
+
+		var reader io.Reader = os.Stdin
+		var file *os.File
+		if input != "-" {
+			file, err = os.Open(input)
+			if err != nil {
+				return fmt.Errorf("failed to open %s: %w", input, err)
+			}
+			reader = file
+		}
+
+		imported, err := dependencies.Exporter.Import(ctx, reader, table, format)
+		if file != nil {
+			if closeErr := file.Close(); err == nil {
+				err = closeErr
+			}
+		}
+		if errors.Is(err, ErrMaterializedAggregates) && *tableFlag == "all" {
+			log.Info().Str("table", table).Msg("skipping aggregates that are maintained by materialized views")
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		log.Info().Str("table", table).Int64("rows", imported).Msg("imported table")
+	}
+
+	return nil
+}
@@ -23,6 +23,68 @@ type AlertingConfig struct {
 	HTTP HTTPConfig `json:"http" yaml:"http" toml:"http"`
 	// Slack configuration for sending alerts via Slack
 	Slack SlackConfig `json:"slack" yaml:"slack" toml:"slack"`
+	// Providers specifies named alert provider instances, for example a Slack channel per team. Monitors
+	// reference them by name through AlertProviders. The providers above are named after their type
+	// ("telegram", "discord", "http" and "slack").
+	Providers []AlertProviderConfig `json:"providers" yaml:"providers" toml:"providers"`
+	// DefaultProviders specifies the names of the providers that receive the alerts of monitors that do not
+	// reference any provider. Defaults to every provider.
+	DefaultProviders []string `json:"default_providers" yaml:"default_providers" toml:"default_providers"`
+	// StatusPageURL specifies the public URL of the status page (e.g., "https://status.example.com"). If set,
+	// alerts link to the page of their monitor.
+	StatusPageURL string `json:"status_page_url" yaml:"status_page_url" toml:"status_page_url"`
+	// Delivery specifies how failed alert deliveries are retried.
+	Delivery AlertDeliveryConfig `json:"delivery" yaml:"delivery" toml:"delivery"`
+	// EscalationPolicies specifies the escalation policies that monitors reference through EscalationPolicy.
+	EscalationPolicies []EscalationPolicy `json:"escalation_policies" yaml:"escalation_policies" toml:"escalation_policies"`
+	// ChatOps specifies the chat platforms that can acknowledge alerts through buttons and slash commands.
+	ChatOps ChatOpsConfig `json:"chat_ops" yaml:"chat_ops" toml:"chat_ops"`
+	// Rules specifies the alert rules that filter and hold the alerts of the monitors.
+	Rules []AlertRule `json:"rules" yaml:"rules" toml:"rules"`
+	// Grouping specifies how the alerts of many monitors are summarized into one notification.
+	Grouping AlertGroupingConfig `json:"grouping" yaml:"grouping" toml:"grouping"`
+}
+
+// ChatOpsConfig holds the secrets that verify the requests of each chat platform. A platform is enabled once
+// its secret is set, which adds an acknowledge button to the down alerts sent through it.
+type ChatOpsConfig struct {
+	// SlackSigningSecret specifies the signing secret of the Slack app that receives the interactions and slash
+	// commands, see https://api.slack.com/authentication/verifying-requests-from-slack.
+	SlackSigningSecret string `json:"slack_signing_secret" yaml:"slack_signing_secret" toml:"slack_signing_secret"`
+	// DiscordPublicKey specifies the hex encoded public key of the Discord application that receives the
+	// interactions. Buttons require the Discord webhooks to be owned by the application.
+	DiscordPublicKey string `json:"discord_public_key" yaml:"discord_public_key" toml:"discord_public_key"`
+	// TelegramSecretToken specifies the secret token given to setWebhook of the Telegram bot that sends the alerts.
+	// Only the chats of the Telegram providers may acknowledge outages.
+	TelegramSecretToken string `json:"telegram_secret_token" yaml:"telegram_secret_token" toml:"telegram_secret_token"`
+}
+
+// AlertDeliveryConfig holds the retry policy of the alert outbox. The delay between attempts starts at
+// InitialBackoff, and doubles after every failed attempt up to MaxBackoff.
+type AlertDeliveryConfig struct {
+	// MaxAttempts specifies how many times an alert is sent through a provider before it is given up. Defaults to 8.
+	MaxAttempts int `json:"max_attempts" yaml:"max_attempts" toml:"max_attempts"`
+	// InitialBackoff specifies the delay after the first failed attempt, in Go's duration format. Defaults to "30s".
+	InitialBackoff string `json:"initial_backoff" yaml:"initial_backoff" toml:"initial_backoff"`
+	// MaxBackoff specifies the longest delay between attempts, in Go's duration format. Defaults to "30m".
+	MaxBackoff string `json:"max_backoff" yaml:"max_backoff" toml:"max_backoff"`
+}
+
+// AlertProviderConfig holds configuration for a named alert provider instance
+type AlertProviderConfig struct {
+	// Name identifies the provider. It must be unique, and must not be the type of an enabled provider above.
+	Name string `json:"name" yaml:"name" toml:"name"`
+	// Type specifies the type of the provider: "telegram", "discord", "http" or "slack"
+	Type AlertProviderType `json:"type" yaml:"type" toml:"type"`
+	// URL specifies the Telegram Bot API URL, for Telegram providers
+	URL string `json:"url" yaml:"url" toml:"url"`
+	// ChatID specifies the Telegram chat ID to send alerts to, for Telegram providers
+	ChatID string `json:"chat_id" yaml:"chat_id" toml:"chat_id"`
+	// WebhookURL specifies the webhook URL, for Discord, HTTP and Slack providers
+	WebhookURL string `json:"webhook_url" yaml:"webhook_url" toml:"webhook_url"`
+	// Template specifies the text/template of the alert messages, which renders the message text for Telegram
+	// providers, and the webhook body for the other providers. Defaults to the built-in format of the type
+	Template string `json:"template" yaml:"template" toml:"template"`
 }
 
 // TelegramConfig holds configuration for Telegram alert provider
@@ -33,6 +95,8 @@ type TelegramConfig struct {
 	URL string `json:"url" yaml:"url" toml:"url"`
 	// ChatID specifies the Telegram chat ID to send alerts to
 	ChatID string `json:"chat_id" yaml:"chat_id" toml:"chat_id"`
+	// Template specifies the text/template that renders the Telegram message text. Defaults to the built-in format
+	Template string `json:"template" yaml:"template" toml:"template"`
 }
 
 // DiscordConfig holds configuration for Discord alert provider
@@ -41,6 +105,8 @@ type DiscordConfig struct {
 	Enabled bool `json:"enabled" yaml:"enabled" toml:"enabled"`
 	// WebhookURL specifies the Discord webhook URL
 	WebhookURL string `json:"webhook_url" yaml:"webhook_url" toml:"webhook_url"`
+	// Template specifies the text/template that renders the Discord webhook body. Defaults to the built-in format
+	Template string `json:"template" yaml:"template" toml:"template"`
 }
 
 // HTTPConfig holds configuration for HTTP alert provider
@@ -49,6 +115,8 @@ type HTTPConfig struct {
 	Enabled bool `json:"enabled" yaml:"enabled" toml:"enabled"`
 	// WebhookURL specifies the HTTP webhook URL
 	WebhookURL string `json:"webhook_url" yaml:"webhook_url" toml:"webhook_url"`
+	// Template specifies the text/template that renders the HTTP webhook body. Defaults to the built-in format
+	Template string `json:"template" yaml:"template" toml:"template"`
 }
 
 // SlackConfig holds configuration for Slack alert provider
@@ -57,6 +125,8 @@ type SlackConfig struct {
 	Enabled bool `json:"enabled" yaml:"enabled" toml:"enabled"`
 	// WebhookURL specifies the Slack webhook URL
 	WebhookURL string `json:"webhook_url" yaml:"webhook_url" toml:"webhook_url"`
+	// Template specifies the text/template that renders the Slack webhook body. Defaults to the built-in format
+	Template string `json:"template" yaml:"template" toml:"template"`
 }
 
 type ConfigurationFile struct {
@@ -67,6 +137,19 @@ type ConfigurationFile struct {
 	// RetentionPeriod specifies how long to keep historical data in days.
 	// Defaults to 120 days if not specified.
 	RetentionPeriod int `json:"retention_period" yaml:"retention_period" toml:"retention_period"`
+	// Retention specifies how long to keep historical data in days, for each tier separately
+	// (e.g., 14 days of raw data, 180 days of hourly aggregates, 1825 days of daily aggregates).
+	// Every tier that is not set defaults to RetentionPeriod.
+	Retention RetentionPolicy `json:"retention" yaml:"retention" toml:"retention"`
+	// ArchiveDirectory specifies the local directory where expiring raw historical data is archived to
+	// Parquet files before it is deleted. Archiving is disabled if empty, and is only supported on DuckDB.
+	ArchiveDirectory string `json:"archive_directory" yaml:"archive_directory" toml:"archive_directory"`
+	// MaintenanceWindows specifies the scheduled maintenance windows. During a maintenance window, the
+	// affected monitors record "Under Maintenance" status and no alerts are sent.
+	MaintenanceWindows []MaintenanceWindow `json:"maintenance_windows" yaml:"maintenance_windows" toml:"maintenance_windows"`
+	// SLOs specifies the service level objectives. Their error budgets are tracked, and alerts are sent
+	// through the alert providers when an error budget burns too fast.
+	SLOs []ServiceLevelObjective `json:"slos" yaml:"slos" toml:"slos"`
 }
 
 // ConfigureDefaults configures the configuration file with default values.
@@ -74,6 +157,12 @@ func (c *ConfigurationFile) ConfigureDefaults() {
 	if c.RetentionPeriod <= 0 {
 		c.RetentionPeriod = 120
 	}
+
+	c.Retention = c.Retention.WithDefaults(RetentionPolicy{
+		Raw:    c.RetentionPeriod,
+		Hourly: c.RetentionPeriod,
+		Daily:  c.RetentionPeriod,
+	})
 }
 
 type MonitorType string
@@ -104,6 +193,12 @@ type Monitor struct {
 	// Description specifies the description of the monitor. This is helpful as a friendly description of what
 	// we are monitoring (e.g., "Push notification for email and SMS").
 	Description string `json:"description" yaml:"description" toml:"description"`
+	// Group specifies the group that the monitor belongs to (e.g., "database"). Groups can be referenced
+	// by maintenance windows to target multiple monitors at once. This is optional.
+	Group string `json:"group" yaml:"group" toml:"group"`
+	// Tags specifies free-form labels of the monitor (e.g., "production", "core-network"), which alert rules
+	// match against, see AlertingConfig.Rules. This is optional.
+	Tags []string `json:"tags" yaml:"tags" toml:"tags"`
 	// PublicUrl specifies the public URL that will be shown in the dashboard. This is helpful to provide a different
 	// public URL rather than providing the exact URL that's used for the HTTP monitor.
 	PublicUrl string `json:"public_url" yaml:"public_url" toml:"public_url"`
@@ -130,10 +225,34 @@ type Monitor struct {
 	// IcmpPacketSize specifies the packet size that will be used for the ICMP request. It must be greater than zero.
 	// The default packet size is 56 bytes.
 	IcmpPacketSize int `json:"packet_size" yaml:"packet_size" toml:"packet_size"`
-	// AlertProvider specifies the type of alert provider that will be used to send alerts. It can be a string value such as
-	// "telegram" or "discord".
-	// THe default alert provider is "telegram"
-	AlertProvider AlertProviderType `json:"alert_provider" yam:"alert_provider" toml:"alert_provider"`
+	// FailureThreshold specifies how many consecutive failed checks are needed before the monitor is considered
+	// down and an alert is sent. Defaults to 1, which alerts on the first failed check.
+	FailureThreshold int `json:"failure_threshold" yaml:"failure_threshold" toml:"failure_threshold"`
+	// SuccessThreshold specifies how many consecutive successful checks are needed before the monitor is considered
+	// up again and a recovery alert is sent. Defaults to 1, which alerts on the first successful check.
+	SuccessThreshold int `json:"success_threshold" yaml:"success_threshold" toml:"success_threshold"`
+	// RetryInterval specifies the interval in seconds between checks while the monitor is suspect, that is, while the
+	// latest check result differs from the confirmed state but the threshold has not been reached yet.
+	// Defaults to the Interval value.
+	RetryInterval int `json:"retry_interval" yaml:"retry_interval" toml:"retry_interval"`
+	// FlapDetection specifies the flap detection configuration. When a monitor is flapping (oscillating between up
+	// and down), alerts are held until the monitor settles down. This is optional.
+	FlapDetection FlapDetection `json:"flap_detection" yaml:"flap_detection" toml:"flap_detection"`
+	// AlertProvider specifies a single alert provider that will be used to send alerts, such as "telegram" or
+	// "discord". It is kept for backward compatibility, use AlertProviders instead.
+	AlertProvider AlertProviderType `json:"alert_provider" yaml:"alert_provider" toml:"alert_provider"`
+	// AlertProviders specifies the names of the alert providers that will be used to send alerts, see
+	// AlertingConfig.Providers. The default providers are used if neither this nor AlertProvider is set.
+	AlertProviders []string `json:"alert_providers" yaml:"alert_providers" toml:"alert_providers"`
+	// AlertTemplates overrides the alert templates of every provider of a type, such as "slack", for this monitor.
+	// This is optional.
+	AlertTemplates map[AlertProviderType]string `json:"alert_templates" yaml:"alert_templates" toml:"alert_templates"`
+	// EscalationPolicy specifies the name of the escalation policy of the monitor, see AlertingConfig.EscalationPolicies.
+	// This is optional.
+	EscalationPolicy string `json:"escalation_policy" yaml:"escalation_policy" toml:"escalation_policy"`
+	// Retention overrides the retention of the monitor's historical data in days, for each tier separately.
+	// Every tier that is not set follows the global retention. This is optional.
+	Retention RetentionPolicy `json:"retention" yaml:"retention" toml:"retention"`
 }
 
 func (m Monitor) MarshalJSON() ([]byte, error) {
@@ -219,6 +338,22 @@ func (m Monitor) Validate() (bool, error) {
 		return false, fmt.Errorf("interval must be greater than 0")
 	}
 
+	if m.FailureThreshold < 0 {
+		return false, fmt.Errorf("failure_threshold must be greater than 0")
+	}
+
+	if m.SuccessThreshold < 0 {
+		return false, fmt.Errorf("success_threshold must be greater than 0")
+	}
+
+	if m.RetryInterval < 0 {
+		return false, fmt.Errorf("retry_interval must be greater than 0")
+	}
+
+	if m.FlapDetection.LowThreshold > m.FlapDetection.HighThreshold && m.FlapDetection.HighThreshold > 0 {
+		return false, fmt.Errorf("flap_detection.low_threshold must not be greater than flap_detection.high_threshold")
+	}
+
 	switch m.Type {
 	case MonitorTypeHTTP:
 		if m.HttpEndpoint == "" {
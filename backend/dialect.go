@@ -0,0 +1,130 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/marcboeker/go-duckdb/v2"
+)
+
+// Dialect is the SQL dialect of the configured database. Most queries are written in the SQL subset
+// that every supported database understands, the dialect is only consulted for functions that differ.
+type Dialect string
+
+const (
+	DialectDuckDB     Dialect = "duckdb"
+	DialectClickHouse Dialect = "clickhouse"
+	DialectPostgres   Dialect = "postgres"
+)
+
+// DetectDialect asks the database for its version to find out which dialect it speaks.
+// The database connector is usually wrapped for tracing, so the driver type can not be used.
+func DetectDialect(ctx context.Context, conn *sql.Conn) (Dialect, error) {
+	var version string
+	err := conn.QueryRowContext(ctx, "SELECT version()").Scan(&version)
+	if err != nil {
+		return "", fmt.Errorf("failed to read database version: %w", err)
+	}
+
+	// DuckDB reports its version as "v1.2.0", ClickHouse as "24.3.1.1", and PostgreSQL as "PostgreSQL 16.2 on ...".
+	if strings.HasPrefix(version, "v") {
+		return DialectDuckDB, nil
+	}
+
+	if strings.HasPrefix(version, "PostgreSQL") {
+		return DialectPostgres, nil
+	}
+
+	return DialectClickHouse, nil
+}
+
+// MaterializedAggregates reports whether the aggregate tables are views over aggregates that the database
+// maintains by itself, in which case the aggregates must not be written by the AggregateWorker. These are the
+// materialized views of the native ClickHouse schema, and the TimescaleDB continuous aggregates on PostgreSQL.
+// ClickHouse databases that were created with the generic migrations keep plain aggregate tables.
+func MaterializedAggregates(ctx context.Context, conn *sql.Conn, dialect Dialect) (bool, error) {
+	var query string
+	switch dialect {
+	case DialectClickHouse:
+		query = "SELECT engine FROM system.tables WHERE database = currentDatabase() AND name = 'monitor_historical_hourly_aggregate'"
+	case DialectPostgres:
+		query = "SELECT table_type FROM information_schema.tables WHERE table_schema = current_schema() AND table_name = 'monitor_historical_hourly_aggregate'"
+	default:
+		return false, nil
+	}
+
+	var tableType string
+	err := conn.QueryRowContext(ctx, query).Scan(&tableType)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return false, nil
+		}
+
+		return false, fmt.Errorf("failed to read the type of the aggregate table: %w", err)
+	}
+
+	return tableType == "View" || tableType == "VIEW", nil
+}
+
+// Quantile returns the expression that computes the q-th quantile (0-1) of the column.
+func (d Dialect) Quantile(column string, q float64) string {
+	switch d {
+	case DialectClickHouse:
+		return fmt.Sprintf("quantile(%g)(%s)", q, column)
+	case DialectPostgres:
+		return fmt.Sprintf("percentile_cont(%g) WITHIN GROUP (ORDER BY %s)", q, column)
+	}
+
+	return fmt.Sprintf("quantile_cont(%s, %g)", column, q)
+}
+
+// EpochSeconds returns the expression that converts the timestamp expression into seconds since the Unix epoch.
+func (d Dialect) EpochSeconds(expression string) string {
+	switch d {
+	case DialectClickHouse:
+		return fmt.Sprintf("toUnixTimestamp(%s)", expression)
+	case DialectPostgres:
+		return fmt.Sprintf("EXTRACT(EPOCH FROM %s)", expression)
+	}
+
+	return fmt.Sprintf("epoch(%s)", expression)
+}
+
+// LatestWhere returns the expression that picks the value of the column from the row with the latest
+// timestamp, among the rows where the column is not empty and the condition holds.
+func (d Dialect) LatestWhere(column string, condition string) string {
+	notEmpty := column + " IS NOT NULL"
+	if condition != "" {
+		notEmpty += " AND " + condition
+	}
+
+	switch d {
+	case DialectClickHouse:
+		return fmt.Sprintf("argMaxIf(%s, timestamp, %s)", column, notEmpty)
+	case DialectPostgres:
+		return fmt.Sprintf("(array_agg(%s ORDER BY timestamp DESC) FILTER (WHERE %s))[1]", column, notEmpty)
+	}
+
+	return fmt.Sprintf("arg_max(%s, timestamp) FILTER (WHERE %s)", column, notEmpty)
+}
+
+// IsUniqueViolation reports whether the error is caused by a row that conflicts with the primary key
+// (or another unique constraint) of the table. ClickHouse has no unique constraints, its ReplacingMergeTree
+// tables merge the duplicate rows instead.
+func IsUniqueViolation(err error) bool {
+	var duckdbError *duckdb.Error
+	if errors.As(err, &duckdbError) {
+		return duckdbError.Type == duckdb.ErrorTypeConstraint && strings.Contains(duckdbError.Msg, "Duplicate key")
+	}
+
+	var postgresError *pgconn.PgError
+	if errors.As(err, &postgresError) {
+		return postgresError.Code == "23505"
+	}
+
+	return false
+}
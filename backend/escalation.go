@@ -0,0 +1,516 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/getsentry/sentry-go"
+	"github.com/rs/zerolog/log"
+)
+
+// EscalationPolicy notifies more alert providers the longer a monitor stays down, and reminds them until the
+// monitor recovers or the alert is acknowledged. The down alert itself is sent to the providers of the monitor
+// as usual, see AlertRouter.
+type EscalationPolicy struct {
+	// Name identifies the policy. Monitors reference it through EscalationPolicy.
+	Name string `json:"name" yaml:"name" toml:"name"`
+	// Steps specifies the providers to notify after the monitor has been down for a while.
+	Steps []EscalationStep `json:"steps" yaml:"steps" toml:"steps"`
+	// ReminderInterval specifies how often every notified provider is reminded while the monitor is down, in
+	// Go's duration format (e.g., "30m"). Reminders are disabled if empty.
+	ReminderInterval string `json:"reminder_interval" yaml:"reminder_interval" toml:"reminder_interval"`
+}
+
+// EscalationStep notifies alert providers once a monitor has been down for the given duration.
+type EscalationStep struct {
+	// After specifies how long the monitor has to be down, in Go's duration format (e.g., "15m", "1h").
+	After string `json:"after" yaml:"after" toml:"after"`
+	// Providers specifies the names of the alert providers to notify, see AlertingConfig.Providers.
+	Providers []string `json:"providers" yaml:"providers" toml:"providers"`
+}
+
+type escalationStep struct {
+	after     time.Duration
+	providers []string
+}
+
+type escalationPolicy struct {
+	steps            []escalationStep
+	reminderInterval time.Duration
+}
+
+// escalation is the state of a monitor that is down and has an escalation policy.
+type escalation struct {
+	policy *escalationPolicy
+	// msg is the down alert, which the escalations and reminders are based on.
+	msg       AlertMessage
+	startedAt time.Time
+	// reached is the number of steps that have been notified.
+	reached      int
+	lastNotified time.Time
+	acknowledged bool
+}
+
+// EscalationStore persists the escalation steps that were notified, so a restart neither pages a step twice nor
+// skips the steps that came due while the process was down.
+type EscalationStore struct {
+	db *sql.DB
+}
+
+func NewEscalationStore(db *sql.DB) *EscalationStore {
+	return &EscalationStore{db: db}
+}
+
+// Save records that a step of the escalation of an outage was notified. Steps are numbered from 0, in the
+// order of the policy.
+func (s *EscalationStore) Save(ctx context.Context, monitorId string, outageStartedAt time.Time, step int, notifiedAt time.Time) error {
+	span := sentry.StartSpan(ctx, "function", sentry.WithDescription("EscalationStore.Save"))
+	span.SetData("semyi.monitor.id", monitorId)
+	ctx = span.Context()
+	defer span.Finish()
+
+	conn, err := s.db.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get connection: %w", err)
+	}
+	defer func() {
+		err := conn.Close()
+		if err != nil {
+			log.Warn().Err(err).Msg("failed to close connection")
+		}
+	}()
+
+	_, err = conn.ExecContext(
+		ctx,
+		"INSERT INTO alert_escalations (monitor_id, outage_started_at, step, notified_at) VALUES (?, ?, ?, ?)",
+		monitorId,
+		EnsureUTC(outageStartedAt),
+		step,
+		EnsureUTC(notifiedAt),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to insert escalation step: %w", err)
+	}
+
+	return nil
+}
+
+// Reached returns the number of steps of the escalation of an outage that were notified.
+func (s *EscalationStore) Reached(ctx context.Context, monitorId string, outageStartedAt time.Time) (int, error) {
+	span := sentry.StartSpan(ctx, "function", sentry.WithDescription("EscalationStore.Reached"))
+	span.SetData("semyi.monitor.id", monitorId)
+	ctx = span.Context()
+	defer span.Finish()
+
+	conn, err := s.db.Conn(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get connection: %w", err)
+	}
+	defer func() {
+		err := conn.Close()
+		if err != nil {
+			log.Warn().Err(err).Msg("failed to close connection")
+		}
+	}()
+
+	// ClickHouse returns 0 instead of NULL for the maximum of no rows, so the rows are counted as well
+	var count int64
+	var step sql.NullInt64
+	err = conn.QueryRowContext(
+		ctx,
+		"SELECT COUNT(*), MAX(step) FROM alert_escalations WHERE monitor_id = ? AND outage_started_at = ?",
+		monitorId,
+		EnsureUTC(outageStartedAt),
+	).Scan(&count, &step)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read escalation steps: %w", err)
+	}
+
+	if count == 0 || !step.Valid {
+		return 0, nil
+	}
+
+	return int(step.Int64) + 1, nil
+}
+
+// Delete removes the steps of the escalation of an outage, once the outage is over.
+func (s *EscalationStore) Delete(ctx context.Context, monitorId string, outageStartedAt time.Time) error {
+	span := sentry.StartSpan(ctx, "function", sentry.WithDescription("EscalationStore.Delete"))
+	span.SetData("semyi.monitor.id", monitorId)
+	ctx = span.Context()
+	defer span.Finish()
+
+	conn, err := s.db.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get connection: %w", err)
+	}
+	defer func() {
+		err := conn.Close()
+		if err != nil {
+			log.Warn().Err(err).Msg("failed to close connection")
+		}
+	}()
+
+	_, err = conn.ExecContext(
+		ctx,
+		"DELETE FROM alert_escalations WHERE monitor_id = ? AND outage_started_at = ?",
+		monitorId,
+		EnsureUTC(outageStartedAt),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to delete escalation steps: %w", err)
+	}
+
+	return nil
+}
+
+// Escalator escalates the down alerts of monitors with an escalation policy, and sends reminders while they are down.
+type Escalator struct {
+	router *AlertRouter
+	// store persists the notified steps. They only live in memory if nil.
+	store    *EscalationStore
+	policies map[string]*escalationPolicy
+	// monitorPolicies holds the policy of every monitor that has one.
+	monitorPolicies map[string]*escalationPolicy
+
+	mutex       sync.Mutex
+	escalations map[string]*escalation
+}
+
+type EscalatorConfig struct {
+	Policies []EscalationPolicy
+	Monitors []Monitor
+	// Router sends the escalations and reminders.
+	Router *AlertRouter
+	// Store persists the notified steps, see Escalator.Hydrate. It is optional.
+	Store *EscalationStore
+}
+
+// NewEscalator creates a new Escalator. An error is returned if a policy is invalid, references a provider
+// that is not configured, or if a monitor references a policy that does not exist.
+func NewEscalator(config EscalatorConfig) (*Escalator, error) {
+	escalator := &Escalator{
+		router:          config.Router,
+		store:           config.Store,
+		policies:        make(map[string]*escalationPolicy),
+		monitorPolicies: make(map[string]*escalationPolicy),
+		escalations:     make(map[string]*escalation),
+	}
+
+	for _, policy := range config.Policies {
+		if policy.Name == "" {
+			return nil, fmt.Errorf("escalation policy name is required")
+		}
+
+		if _, ok := escalator.policies[policy.Name]; ok {
+			return nil, fmt.Errorf("duplicate escalation policy %q", policy.Name)
+		}
+
+		parsed := &escalationPolicy{}
+		if policy.ReminderInterval != "" {
+			interval, err := time.ParseDuration(policy.ReminderInterval)
+			if err != nil || interval <= 0 {
+				return nil, fmt.Errorf("escalation policy %q: reminder_interval must be a valid positive duration", policy.Name)
+			}
+
+			parsed.reminderInterval = interval
+		}
+
+		for i, step := range policy.Steps {
+			after, err := time.ParseDuration(step.After)
+			if err != nil || after < 0 {
+				return nil, fmt.Errorf("escalation policy %q: after of step %d must be a valid duration", policy.Name, i+1)
+			}
+
+			if len(step.Providers) == 0 {
+				return nil, fmt.Errorf("escalation policy %q: step %d has no providers", policy.Name, i+1)
+			}
+
+			for _, provider := range step.Providers {
+				if config.Router == nil || !config.Router.HasProvider(provider) {
+					return nil, fmt.Errorf("escalation policy %q: alert provider %q is not configured", policy.Name, provider)
+				}
+			}
+
+			parsed.steps = append(parsed.steps, escalationStep{after: after, providers: step.Providers})
+		}
+
+		sort.SliceStable(parsed.steps, func(i, j int) bool {
+			return parsed.steps[i].after < parsed.steps[j].after
+		})
+
+		escalator.policies[policy.Name] = parsed
+	}
+
+	for _, monitor := range config.Monitors {
+		if monitor.EscalationPolicy == "" {
+			continue
+		}
+
+		policy, ok := escalator.policies[monitor.EscalationPolicy]
+		if !ok {
+			return nil, fmt.Errorf("monitor %q: escalation policy %q does not exist", monitor.UniqueID, monitor.EscalationPolicy)
+		}
+
+		escalator.monitorPolicies[monitor.UniqueID] = policy
+	}
+
+	return escalator, nil
+}
+
+// Hydrate resumes the escalation of the monitors that were down before a restart. With a store, the steps that
+// were not notified before the restart, including the ones that came due while the process was down, are sent
+// by the next Evaluate. Without a store, the steps that were due before the restart are considered notified, so
+// nobody is paged twice. The remaining outages are still resumed if the steps of one can not be read.
+func (e *Escalator) Hydrate(ctx context.Context, outages []Outage, monitors []Monitor, now time.Time) error {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	var errs []error
+	for _, outage := range outages {
+		policy, ok := e.monitorPolicies[outage.MonitorID]
+		if !ok || !outage.Ongoing() {
+			continue
+		}
+
+		msg := AlertMessage{
+			MonitorID:         outage.MonitorID,
+			Timestamp:         outage.StartedAt,
+			Status:            MonitorStatusFailure,
+			AdditionalMessage: outage.FirstFailureMessage,
+		}
+		for _, monitor := range monitors {
+			if monitor.UniqueID == outage.MonitorID {
+				msg.MonitorName = monitor.Name
+				msg.Monitor = monitor
+			}
+		}
+
+		entry := &escalation{policy: policy, msg: msg, startedAt: outage.StartedAt, lastNotified: now}
+		if e.store != nil {
+			reached, err := e.store.Reached(ctx, outage.MonitorID, outage.StartedAt)
+			if err == nil {
+				entry.reached = min(reached, len(policy.steps))
+				e.escalations[outage.MonitorID] = entry
+				continue
+			}
+
+			errs = append(errs, fmt.Errorf("failed to read escalation of %s: %w", outage.MonitorID, err))
+		}
+
+		for entry.reached < len(policy.steps) && !outage.StartedAt.Add(policy.steps[entry.reached].after).After(now) {
+			entry.reached++
+		}
+
+		e.escalations[outage.MonitorID] = entry
+	}
+
+	return errors.Join(errs...)
+}
+
+// Observe starts the escalation of a down alert, and stops it once the monitor recovers. The providers that
+// were notified by the escalation are sent the recovery alert as well, and startedAt is the start of the outage.
+func (e *Escalator) Observe(ctx context.Context, msg AlertMessage, startedAt time.Time) {
+	policy, ok := e.monitorPolicies[msg.MonitorID]
+	if !ok {
+		return
+	}
+
+	e.mutex.Lock()
+	entry, escalating := e.escalations[msg.MonitorID]
+	if msg.Status == MonitorStatusFailure {
+		if !escalating {
+			e.escalations[msg.MonitorID] = &escalation{policy: policy, msg: msg, startedAt: startedAt, lastNotified: msg.Timestamp}
+		}
+		e.mutex.Unlock()
+		return
+	}
+
+	delete(e.escalations, msg.MonitorID)
+	e.mutex.Unlock()
+
+	if !escalating {
+		return
+	}
+
+	if e.store != nil {
+		err := e.store.Delete(ctx, msg.MonitorID, entry.startedAt)
+		if err != nil {
+			log.Error().Err(err).Str("monitor_id", msg.MonitorID).Msg("failed to delete escalation steps")
+			sentry.GetHubFromContext(ctx).CaptureException(err)
+		}
+	}
+
+	providers := e.escalatedProviders(entry)
+	if len(providers) == 0 {
+		return
+	}
+
+	err := e.router.SendTo(ctx, providers, msg)
+	if err != nil {
+		log.Error().Err(err).Str("monitor_id", msg.MonitorID).Msg("failed to send recovery to escalated providers")
+		sentry.GetHubFromContext(ctx).CaptureException(err)
+	}
+}
+
+// Stop stops the escalation of a monitor without notifying anyone, for the recoveries that the alert rules drop.
+func (e *Escalator) Stop(ctx context.Context, monitorId string) {
+	e.mutex.Lock()
+	entry, escalating := e.escalations[monitorId]
+	delete(e.escalations, monitorId)
+	e.mutex.Unlock()
+
+	if !escalating || e.store == nil {
+		return
+	}
+
+	err := e.store.Delete(ctx, monitorId, entry.startedAt)
+	if err != nil {
+		log.Error().Err(err).Str("monitor_id", monitorId).Msg("failed to delete escalation steps")
+		sentry.GetHubFromContext(ctx).CaptureException(err)
+	}
+}
+
+// Acknowledge stops the escalations and reminders of a monitor until it recovers. It returns false if the
+// monitor is not being escalated.
+func (e *Escalator) Acknowledge(monitorId string) bool {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	entry, ok := e.escalations[monitorId]
+	if !ok {
+		return false
+	}
+
+	entry.acknowledged = true
+	return true
+}
+
+// Run evaluates the escalations every 30 seconds.
+func (e *Escalator) Run(ctx context.Context) {
+	ctx = sentry.SetHubOnContext(ctx, sentry.CurrentHub().Clone())
+
+	ticker := time.NewTicker(30 * time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			e.Evaluate(ctx, now.UTC())
+		}
+	}
+}
+
+// escalationNotification is an alert that is due, along with the providers it is sent to.
+type escalationNotification struct {
+	providers []string
+	msg       AlertMessage
+	// startedAt and steps identify the steps that the alert escalates to, which are empty for reminders.
+	startedAt time.Time
+	steps     []int
+}
+
+// Evaluate sends the escalations and reminders that are due at the given time.
+func (e *Escalator) Evaluate(ctx context.Context, now time.Time) {
+	span := sentry.StartSpan(ctx, "function", sentry.WithDescription("Escalator.Evaluate"))
+	ctx = span.Context()
+	defer span.Finish()
+
+	var notifications []escalationNotification
+
+	e.mutex.Lock()
+	for _, entry := range e.escalations {
+		if entry.acknowledged {
+			continue
+		}
+
+		down := now.Sub(entry.startedAt).Round(time.Second)
+
+		var escalated []string
+		var steps []int
+		for entry.reached < len(entry.policy.steps) && !entry.startedAt.Add(entry.policy.steps[entry.reached].after).After(now) {
+			escalated = append(escalated, entry.policy.steps[entry.reached].providers...)
+			steps = append(steps, entry.reached)
+			entry.reached++
+		}
+
+		if len(escalated) > 0 {
+			msg := entry.msg
+			msg.Title = "🚨 Escalated: Service Down"
+			msg.Message = fmt.Sprintf("%s has been down for %s.", msg.MonitorName, down)
+			msg.Timestamp = now
+			notifications = append(notifications, escalationNotification{providers: dedupe(escalated), msg: msg, startedAt: entry.startedAt, steps: steps})
+			entry.lastNotified = now
+			continue
+		}
+
+		if entry.policy.reminderInterval > 0 && !entry.lastNotified.Add(entry.policy.reminderInterval).After(now) {
+			msg := entry.msg
+			msg.Title = "🔴 Still Down"
+			msg.Message = fmt.Sprintf("%s has been down for %s.", msg.MonitorName, down)
+			msg.Timestamp = now
+			providers := dedupe(append(slices.Clone(e.router.Route(msg.MonitorID)), e.escalatedProviders(entry)...))
+			notifications = append(notifications, escalationNotification{providers: providers, msg: msg})
+			entry.lastNotified = now
+		}
+	}
+	e.mutex.Unlock()
+
+	for _, notification := range notifications {
+		err := e.router.SendTo(ctx, notification.providers, notification.msg)
+		if err != nil {
+			log.Error().Err(err).Str("monitor_id", notification.msg.MonitorID).Msg("failed to send escalation")
+			sentry.GetHubFromContext(ctx).CaptureException(err)
+		}
+
+		if e.store == nil {
+			continue
+		}
+
+		// The steps are recorded even if a provider failed, they are not sent again either way
+		for _, step := range notification.steps {
+			err := e.store.Save(ctx, notification.msg.MonitorID, notification.startedAt, step, notification.msg.Timestamp)
+			if err != nil {
+				log.Error().Err(err).Str("monitor_id", notification.msg.MonitorID).Msg("failed to save escalation step")
+				sentry.GetHubFromContext(ctx).CaptureException(err)
+			}
+		}
+	}
+}
+
+// escalatedProviders returns the providers of the steps that have been notified, except the providers of the
+// monitor itself, which receive every alert anyway.
+func (e *Escalator) escalatedProviders(entry *escalation) []string {
+	route := e.router.Route(entry.msg.MonitorID)
+
+	var providers []string
+	for _, step := range entry.policy.steps[:entry.reached] {
+		for _, provider := range step.providers {
+			if !slices.Contains(route, provider) && !slices.Contains(providers, provider) {
+				providers = append(providers, provider)
+			}
+		}
+	}
+
+	return providers
+}
+
+// dedupe removes the duplicate names, keeping the first occurrence of each.
+func dedupe(names []string) []string {
+	var unique []string
+	for _, name := range names {
+		if !slices.Contains(unique, name) {
+			unique = append(unique, name)
+		}
+	}
+
+	return unique
+}
@@ -0,0 +1,159 @@
+package main_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	main "semyi"
+	"semyi/testutils"
+)
+
+// newEscalationFixture creates an escalator for the "escalated" monitor. The store is optional.
+func newEscalationFixture(t *testing.T, store *main.EscalationStore) (*main.Escalator, map[string]*MockAlerter) {
+	t.Helper()
+
+	alerters := map[string]*MockAlerter{"team-a": {}, "team-b": {}, "team-c": {}}
+	monitors := []main.Monitor{{UniqueID: "escalated", Name: "Escalated", AlertProviders: []string{"team-a"}, EscalationPolicy: "on-call"}}
+	router := newMockAlertRouter(t, main.AlertRouterConfig{Monitors: monitors}, alerters)
+
+	escalator, err := main.NewEscalator(main.EscalatorConfig{
+		Policies: []main.EscalationPolicy{{
+			Name: "on-call",
+			Steps: []main.EscalationStep{
+				{After: "1h", Providers: []string{"team-c"}},
+				{After: "15m", Providers: []string{"team-b"}},
+			},
+			ReminderInterval: "30m",
+		}},
+		Monitors: monitors,
+		Router:   router,
+		Store:    store,
+	})
+	testutils.AssertNoError(t, err, "Failed to create escalator")
+
+	return escalator, alerters
+}
+
+func TestEscalator_Escalate(t *testing.T) {
+	ctx := context.Background()
+	escalator, alerters := newEscalationFixture(t, nil)
+
+	start := time.Date(2025, 9, 1, 8, 0, 0, 0, time.UTC)
+	escalator.Observe(ctx, main.AlertMessage{MonitorID: "escalated", MonitorName: "Escalated", Status: main.MonitorStatusFailure, Timestamp: start}, start)
+
+	escalator.Evaluate(ctx, start.Add(10*time.Minute))
+	testutils.AssertEqual(t, 0, len(alerters["team-b"].alertsSent), "Nobody should be escalated to before the first step")
+
+	escalator.Evaluate(ctx, start.Add(15*time.Minute))
+	testutils.AssertEqual(t, 1, len(alerters["team-b"].alertsSent), "Expected the first step to be notified")
+	testutils.AssertContains(t, alerters["team-b"].alertsSent[0].Message, "15m0s", "Expected the escalation to tell the downtime")
+	testutils.AssertEqual(t, 0, len(alerters["team-c"].alertsSent), "The second step should not be notified yet")
+
+	// Reminders go to the providers of the monitor and to the escalated providers
+	escalator.Evaluate(ctx, start.Add(45*time.Minute))
+	testutils.AssertEqual(t, 1, len(alerters["team-a"].alertsSent), "Expected a reminder to the providers of the monitor")
+	testutils.AssertEqual(t, 2, len(alerters["team-b"].alertsSent), "Expected a reminder to the escalated providers")
+	testutils.AssertEqual(t, "🔴 Still Down", alerters["team-a"].alertsSent[0].Title, "Unexpected reminder title")
+
+	escalator.Evaluate(ctx, start.Add(time.Hour))
+	testutils.AssertEqual(t, 1, len(alerters["team-c"].alertsSent), "Expected the second step to be notified")
+
+	// The recovery is sent to the escalated providers, the router sends it to the providers of the monitor
+	escalator.Observe(ctx, main.AlertMessage{MonitorID: "escalated", Success: true, Status: main.MonitorStatusSuccess, Timestamp: start.Add(70 * time.Minute)}, start)
+	testutils.AssertEqual(t, 3, len(alerters["team-b"].alertsSent), "Expected the recovery to reach the first step")
+	testutils.AssertEqual(t, 2, len(alerters["team-c"].alertsSent), "Expected the recovery to reach the second step")
+	testutils.AssertEqual(t, 1, len(alerters["team-a"].alertsSent), "The router sends the recovery to the providers of the monitor")
+
+	escalator.Evaluate(ctx, start.Add(3*time.Hour))
+	testutils.AssertEqual(t, 3, len(alerters["team-b"].alertsSent), "Nothing should be sent after the recovery")
+}
+
+func TestEscalator_Acknowledge(t *testing.T) {
+	ctx := context.Background()
+	escalator, alerters := newEscalationFixture(t, nil)
+
+	testutils.AssertEqual(t, false, escalator.Acknowledge("escalated"), "A monitor that is up can not be acknowledged")
+
+	start := time.Date(2025, 9, 1, 8, 0, 0, 0, time.UTC)
+	escalator.Observe(ctx, main.AlertMessage{MonitorID: "escalated", Status: main.MonitorStatusFailure, Timestamp: start}, start)
+	testutils.AssertEqual(t, true, escalator.Acknowledge("escalated"), "Expected the escalation to be acknowledged")
+
+	escalator.Evaluate(ctx, start.Add(2*time.Hour))
+	for name, alerter := range alerters {
+		testutils.AssertEqual(t, 0, len(alerter.alertsSent), "Nothing should be sent to "+name+" once acknowledged")
+	}
+}
+
+func TestEscalator_Hydrate(t *testing.T) {
+	ctx := context.Background()
+	escalator, alerters := newEscalationFixture(t, nil)
+
+	now := time.Date(2025, 9, 1, 8, 0, 0, 0, time.UTC)
+	err := escalator.Hydrate(ctx, []main.Outage{{MonitorID: "escalated", StartedAt: now.Add(-20 * time.Minute)}}, nil, now)
+	testutils.AssertNoError(t, err, "Failed to hydrate escalations")
+
+	// The first step was due before the restart, so it is not paged again
+	escalator.Evaluate(ctx, now.Add(time.Minute))
+	testutils.AssertEqual(t, 0, len(alerters["team-b"].alertsSent), "The steps due before the restart should not be notified again")
+
+	escalator.Evaluate(ctx, now.Add(40*time.Minute))
+	testutils.AssertEqual(t, 1, len(alerters["team-c"].alertsSent), "Expected the escalation to resume after the restart")
+}
+
+func TestEscalator_HydrateFromStore(t *testing.T) {
+	ctx := context.Background()
+	store := main.NewEscalationStore(database)
+	start := time.Date(2025, 9, 2, 8, 0, 0, 0, time.UTC)
+	t.Cleanup(func() {
+		_, err := database.Exec("DELETE FROM alert_escalations WHERE monitor_id = ?", "escalated")
+		if err != nil {
+			t.Logf("Warning: failed to clean up test data: %v", err)
+		}
+	})
+
+	escalator, alerters := newEscalationFixture(t, store)
+	escalator.Observe(ctx, main.AlertMessage{MonitorID: "escalated", MonitorName: "Escalated", Status: main.MonitorStatusFailure, Timestamp: start}, start)
+	escalator.Evaluate(ctx, start.Add(20*time.Minute))
+	testutils.AssertEqual(t, 1, len(alerters["team-b"].alertsSent), "Expected the first step to be notified")
+
+	// The process was down when the second step came due
+	escalator, alerters = newEscalationFixture(t, store)
+	err := escalator.Hydrate(ctx, []main.Outage{{MonitorID: "escalated", StartedAt: start}}, nil, start.Add(90*time.Minute))
+	testutils.AssertNoError(t, err, "Failed to hydrate escalations")
+
+	escalator.Evaluate(ctx, start.Add(91*time.Minute))
+	testutils.AssertEqual(t, 0, len(alerters["team-b"].alertsSent), "The step notified before the restart should not be notified again")
+	testutils.AssertEqual(t, 1, len(alerters["team-c"].alertsSent), "Expected the step that came due while down to be notified")
+
+	// The recovery clears the persisted steps
+	escalator.Observe(ctx, main.AlertMessage{MonitorID: "escalated", Success: true, Status: main.MonitorStatusSuccess, Timestamp: start.Add(2 * time.Hour)}, start)
+	reached, err := store.Reached(ctx, "escalated", start)
+	testutils.AssertNoError(t, err, "Failed to read escalation steps")
+	testutils.AssertEqual(t, 0, reached, "Expected the steps to be deleted on recovery")
+}
+
+func TestNewEscalator_Invalid(t *testing.T) {
+	router, err := main.NewAlertRouter(main.AlertRouterConfig{Providers: map[string]main.Alerter{"ops": &MockAlerter{}}})
+	testutils.AssertNoError(t, err, "Failed to create alert router")
+
+	tests := []struct {
+		name     string
+		policies []main.EscalationPolicy
+		monitors []main.Monitor
+	}{
+		{name: "missing name", policies: []main.EscalationPolicy{{}}},
+		{name: "duplicate name", policies: []main.EscalationPolicy{{Name: "p"}, {Name: "p"}}},
+		{name: "invalid after", policies: []main.EscalationPolicy{{Name: "p", Steps: []main.EscalationStep{{After: "later", Providers: []string{"ops"}}}}}},
+		{name: "unknown provider", policies: []main.EscalationPolicy{{Name: "p", Steps: []main.EscalationStep{{After: "5m", Providers: []string{"pager"}}}}}},
+		{name: "invalid reminder", policies: []main.EscalationPolicy{{Name: "p", ReminderInterval: "0s"}}},
+		{name: "unknown policy", monitors: []main.Monitor{{UniqueID: "m", EscalationPolicy: "p"}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := main.NewEscalator(main.EscalatorConfig{Policies: tt.policies, Monitors: tt.monitors, Router: router})
+			testutils.AssertError(t, err, "Expected an invalid configuration to be rejected")
+		})
+	}
+}
@@ -0,0 +1,570 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/getsentry/sentry-go"
+	"github.com/rs/zerolog/log"
+)
+
+type exportColumnType int
+
+const (
+	exportColumnString exportColumnType = iota
+	exportColumnSmallInt
+	exportColumnInteger
+	exportColumnDouble
+	exportColumnTimestamp
+)
+
+type exportColumn struct {
+	name     string
+	kind     exportColumnType
+	nullable bool
+}
+
+// required returns true if every imported row must have a value for the column.
+func (c exportColumn) required() bool {
+	return !c.nullable && c.name != "created_at"
+}
+
+// missing returns the value of the column when an imported row does not have it. created_at defaults to
+// the current time, the same as the table default.
+func (c exportColumn) missing() (any, error) {
+	if c.nullable {
+		return nil, nil
+	}
+
+	if c.name == "created_at" {
+		return time.Now().UTC(), nil
+	}
+
+	return nil, fmt.Errorf("missing %s", c.name)
+}
+
+// driverValue converts a row value to the exact type of the column, since the ClickHouse driver and the
+// DuckDB appender do not convert between integer widths.
+func (c exportColumn) driverValue(value any) any {
+	integer, ok := value.(int64)
+	if !ok {
+		return value
+	}
+
+	switch c.kind {
+	case exportColumnSmallInt:
+		return int16(integer)
+	case exportColumnInteger:
+		return int32(integer)
+	default:
+		return value
+	}
+}
+
+// exportTable describes a table that can be exported and imported. Every table has a monitor_id and a
+// timestamp column, which identify a row.
+type exportTable struct {
+	name    string
+	columns []exportColumn
+}
+
+var exportAggregateColumns = []exportColumn{
+	{name: "monitor_id", kind: exportColumnString},
+	{name: "timestamp", kind: exportColumnTimestamp},
+	{name: "status", kind: exportColumnSmallInt},
+	{name: "latency", kind: exportColumnInteger},
+	{name: "check_count", kind: exportColumnInteger, nullable: true},
+	{name: "failure_count", kind: exportColumnInteger, nullable: true},
+	{name: "uptime_ratio", kind: exportColumnDouble, nullable: true},
+	{name: "latency_min", kind: exportColumnInteger, nullable: true},
+	{name: "latency_max", kind: exportColumnInteger, nullable: true},
+	{name: "latency_p50", kind: exportColumnInteger, nullable: true},
+	{name: "latency_p95", kind: exportColumnInteger, nullable: true},
+	{name: "latency_p99", kind: exportColumnInteger, nullable: true},
+	{name: "worst_status", kind: exportColumnSmallInt, nullable: true},
+	{name: "dominant_status", kind: exportColumnSmallInt, nullable: true},
+	{name: "created_at", kind: exportColumnTimestamp},
+}
+
+// exportTables holds every table that can be exported and imported, by name.
+var exportTables = map[string]exportTable{
+	"monitor_historical": {
+		name: "monitor_historical",
+		columns: []exportColumn{
+			{name: "monitor_id", kind: exportColumnString},
+			{name: "timestamp", kind: exportColumnTimestamp},
+			{name: "status", kind: exportColumnSmallInt},
+			{name: "latency", kind: exportColumnInteger},
+			{name: "additional_message", kind: exportColumnString, nullable: true},
+			{name: "http_protocol", kind: exportColumnString, nullable: true},
+			{name: "tls_version", kind: exportColumnString, nullable: true},
+			{name: "tls_cipher", kind: exportColumnString, nullable: true},
+			{name: "tls_expiry", kind: exportColumnTimestamp, nullable: true},
+		},
+	},
+	"monitor_historical_hourly_aggregate": {
+		name:    "monitor_historical_hourly_aggregate",
+		columns: exportAggregateColumns,
+	},
+	"monitor_historical_daily_aggregate": {
+		name:    "monitor_historical_daily_aggregate",
+		columns: exportAggregateColumns,
+	},
+	"incident_data": {
+		name: "incident_data",
+		columns: []exportColumn{
+			{name: "monitor_id", kind: exportColumnString},
+			{name: "timestamp", kind: exportColumnTimestamp},
+			{name: "title", kind: exportColumnString},
+			{name: "description", kind: exportColumnString},
+			{name: "severity", kind: exportColumnSmallInt},
+			{name: "status", kind: exportColumnSmallInt},
+			{name: "created_at", kind: exportColumnTimestamp},
+			{name: "created_by", kind: exportColumnString},
+		},
+	},
+}
+
+// ExportTableNames returns the name of every table that can be exported and imported.
+func ExportTableNames() []string {
+	return slices.Sorted(maps.Keys(exportTables))
+}
+
+func findExportTable(name string) (exportTable, error) {
+	table, ok := exportTables[name]
+	if !ok {
+		return exportTable{}, fmt.Errorf("invalid table %q, must be one of %s", name, strings.Join(ExportTableNames(), ", "))
+	}
+
+	return table, nil
+}
+
+func (t exportTable) columnNames() string {
+	names := make([]string, len(t.columns))
+	for i, column := range t.columns {
+		names[i] = column.name
+	}
+
+	return strings.Join(names, ", ")
+}
+
+// scanExportRow scans the current row into values of the given columns.
+func scanExportRow(rows *sql.Rows, columns []exportColumn) ([]any, error) {
+	destinations := make([]any, len(columns))
+	for i, column := range columns {
+		switch column.kind {
+		case exportColumnSmallInt, exportColumnInteger:
+			destinations[i] = &sql.NullInt64{}
+		case exportColumnDouble:
+			destinations[i] = &sql.NullFloat64{}
+		case exportColumnTimestamp:
+			destinations[i] = &sql.NullTime{}
+		default:
+			destinations[i] = &sql.NullString{}
+		}
+	}
+
+	err := rows.Scan(destinations...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan row: %w", err)
+	}
+
+	values := make([]any, len(columns))
+	for i, destination := range destinations {
+		switch destination := destination.(type) {
+		case *sql.NullInt64:
+			if destination.Valid {
+				values[i] = destination.Int64
+			}
+		case *sql.NullFloat64:
+			if destination.Valid {
+				values[i] = destination.Float64
+			}
+		case *sql.NullTime:
+			if destination.Valid {
+				values[i] = destination.Time.UTC()
+			}
+		case *sql.NullString:
+			if destination.Valid {
+				values[i] = destination.String
+			} else if !columns[i].nullable {
+				values[i] = ""
+			}
+		}
+	}
+
+	return values, nil
+}
+
+// ExportFilter selects the rows to export.
+type ExportFilter struct {
+	// MonitorIDs exports every monitor if empty.
+	MonitorIDs []string
+	// From and To select the rows within [From, To). Both are optional.
+	From time.Time
+	To   time.Time
+}
+
+// ErrMaterializedAggregates is returned when importing aggregates into a ClickHouse database that maintains
+// them with materialized views. The aggregates follow from the imported raw data there.
+var ErrMaterializedAggregates = errors.New("aggregates are maintained by materialized views, import monitor_historical instead")
+
+// HistoricalExporter exports and imports the historical data and incidents, so they can be moved between
+// databases or handed to other tools.
+type HistoricalExporter struct {
+	db *sql.DB
+	// aggregates is told about the imported raw historical data, so the buckets it falls into are aggregated
+	// again. The aggregates are left alone if nil.
+	aggregates *AggregateWorker
+}
+
+func NewHistoricalExporter(db *sql.DB, aggregates *AggregateWorker) *HistoricalExporter {
+	return &HistoricalExporter{db: db, aggregates: aggregates}
+}
+
+// Export streams the rows of the table that match the filter to the writer, ordered by monitor and timestamp.
+// It returns the number of exported rows.
+func (e *HistoricalExporter) Export(ctx context.Context, w io.Writer, tableName string, format ExportFormat, filter ExportFilter) (int64, error) {
+	span := sentry.StartSpan(ctx, "function", sentry.WithDescription("HistoricalExporter.Export"))
+	span.SetData("semyi.export.table", tableName)
+	span.SetData("semyi.export.format", string(format))
+	ctx = span.Context()
+	defer span.Finish()
+
+	table, err := findExportTable(tableName)
+	if err != nil {
+		return 0, err
+	}
+
+	var conditions []string
+	var args []any
+	if len(filter.MonitorIDs) > 0 {
+		conditions = append(conditions, fmt.Sprintf("monitor_id IN (%s)", strings.TrimSuffix(strings.Repeat("?, ", len(filter.MonitorIDs)), ", ")))
+		for _, monitorId := range filter.MonitorIDs {
+			args = append(args, monitorId)
+		}
+	}
+	if !filter.From.IsZero() {
+		conditions = append(conditions, "timestamp >= ?")
+		args = append(args, EnsureUTC(filter.From))
+	}
+	if !filter.To.IsZero() {
+		conditions = append(conditions, "timestamp < ?")
+		args = append(args, EnsureUTC(filter.To))
+	}
+
+	query := fmt.Sprintf("SELECT %s FROM %s", table.columnNames(), table.name)
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	query += " ORDER BY monitor_id, timestamp"
+
+	conn, err := e.db.Conn(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get connection: %w", err)
+	}
+	defer func() {
+		err := conn.Close()
+		if err != nil {
+			log.Warn().Err(err).Msg("failed to close connection")
+		}
+	}()
+
+	rows, err := conn.QueryContext(ctx, query, args...)
+	if err != nil {
+		return 0, fmt.Errorf("failed to query %s: %w", table.name, err)
+	}
+	defer func() {
+		if err := rows.Close(); err != nil {
+			log.Warn().Err(err).Msg("failed to close rows")
+		}
+	}()
+
+	encoder, err := newExportEncoder(w, table, format)
+	if err != nil {
+		return 0, err
+	}
+
+	var exported int64
+	for rows.Next() {
+		row, err := scanExportRow(rows, table.columns)
+		if err == nil {
+			err = encoder.Write(row)
+		}
+		if err != nil {
+			_ = encoder.Close()
+			return exported, fmt.Errorf("failed to export %s: %w", table.name, err)
+		}
+
+		exported++
+	}
+
+	if err := rows.Err(); err != nil {
+		_ = encoder.Close()
+		return exported, fmt.Errorf("failed to iterate rows: %w", err)
+	}
+
+	err = encoder.Close()
+	if err != nil {
+		return exported, fmt.Errorf("failed to export %s: %w", table.name, err)
+	}
+
+	return exported, nil
+}
+
+// importBatchSize is the number of rows that are replaced at once while importing.
+const importBatchSize = 1000
+
+// Import reads the rows of the table from the reader and writes them to the database. A row replaces the
+// stored row of the same monitor and timestamp, so importing the same file twice does not duplicate rows.
+// It returns the number of imported rows.
+func (e *HistoricalExporter) Import(ctx context.Context, r io.Reader, tableName string, format ExportFormat) (int64, error) {
+	span := sentry.StartSpan(ctx, "function", sentry.WithDescription("HistoricalExporter.Import"))
+	span.SetData("semyi.export.table", tableName)
+	span.SetData("semyi.export.format", string(format))
+	ctx = span.Context()
+	defer span.Finish()
+
+	table, err := findExportTable(tableName)
+	if err != nil {
+		return 0, err
+	}
+
+	decoder, err := newExportDecoder(r, table, format)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read %s: %w", table.name, err)
+	}
+	defer func() {
+		if err := decoder.Close(); err != nil {
+			log.Warn().Err(err).Msg("failed to close decoder")
+		}
+	}()
+
+	conn, err := e.db.Conn(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get connection: %w", err)
+	}
+	defer func() {
+		err := conn.Close()
+		if err != nil {
+			log.Warn().Err(err).Msg("failed to close connection")
+		}
+	}()
+
+	dialect, err := DetectDialect(ctx, conn)
+	if err != nil {
+		return 0, err
+	}
+
+	if strings.HasSuffix(table.name, "_aggregate") {
+		materialized, err := MaterializedAggregates(ctx, conn, dialect)
+		if err != nil {
+			return 0, err
+		}
+
+		if materialized {
+			return 0, fmt.Errorf("%s: %w", table.name, ErrMaterializedAggregates)
+		}
+	}
+
+	// The earliest imported raw historical data of every monitor, to aggregate its buckets again
+	earliest := make(map[string]time.Time)
+	if table.name == "monitor_historical" && e.aggregates != nil {
+		defer e.invalidateAggregates(ctx, earliest)
+	}
+
+	var imported int64
+	batch := make([][]any, 0, importBatchSize)
+	for {
+		row, err := decoder.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return imported, fmt.Errorf("failed to read %s: %w", table.name, err)
+		}
+
+		batch = append(batch, row)
+		if len(batch) < importBatchSize {
+			continue
+		}
+
+		err = replaceExportRows(ctx, conn, dialect, table, batch)
+		if err != nil {
+			return imported, err
+		}
+
+		trackEarliestRows(earliest, batch)
+		imported += int64(len(batch))
+		batch = batch[:0]
+	}
+
+	if len(batch) > 0 {
+		err = replaceExportRows(ctx, conn, dialect, table, batch)
+		if err != nil {
+			return imported, err
+		}
+
+		trackEarliestRows(earliest, batch)
+		imported += int64(len(batch))
+	}
+
+	return imported, nil
+}
+
+// trackEarliestRows keeps the earliest timestamp of every monitor within the rows.
+func trackEarliestRows(earliest map[string]time.Time, rows [][]any) {
+	for _, row := range rows {
+		monitorId, ok := row[0].(string)
+		if !ok {
+			continue
+		}
+
+		timestamp, ok := row[1].(time.Time)
+		if !ok {
+			continue
+		}
+
+		if current, found := earliest[monitorId]; !found || timestamp.Before(current) {
+			earliest[monitorId] = timestamp
+		}
+	}
+}
+
+// invalidateAggregates makes the aggregate worker aggregate the buckets of the imported raw historical data
+// again. The rows are imported already, so a failure is only logged.
+func (e *HistoricalExporter) invalidateAggregates(ctx context.Context, earliest map[string]time.Time) {
+	for monitorId, timestamp := range earliest {
+		err := e.aggregates.Invalidate(ctx, monitorId, timestamp)
+		if err != nil {
+			log.Error().Err(err).Str("monitor_id", monitorId).Msg("failed to invalidate the aggregates of imported historical data")
+			sentry.GetHubFromContext(ctx).CaptureException(err)
+		}
+	}
+}
+
+// dedupeExportRows removes the rows whose monitor and timestamp appear again later within the rows, keeping
+// the order of the remaining rows.
+func dedupeExportRows(rows [][]any) [][]any {
+	type exportRowKey struct {
+		monitorId string
+		timestamp string
+	}
+
+	last := make(map[exportRowKey]int, len(rows))
+	keys := make([]exportRowKey, len(rows))
+	for i, row := range rows {
+		key := exportRowKey{monitorId: fmt.Sprint(row[0]), timestamp: fmt.Sprint(row[1])}
+		if timestamp, ok := row[1].(time.Time); ok {
+			key.timestamp = timestamp.UTC().Format(time.RFC3339Nano)
+		}
+		keys[i] = key
+		last[key] = i
+	}
+
+	if len(last) == len(rows) {
+		return rows
+	}
+
+	deduped := make([][]any, 0, len(last))
+	for i, row := range rows {
+		if last[keys[i]] == i {
+			deduped = append(deduped, row)
+		}
+	}
+
+	return deduped
+}
+
+// replaceExportRows deletes the stored rows with the same monitor and timestamp as the given rows, and inserts
+// the rows, in a single transaction. Rows with the same monitor and timestamp within the batch are replaced by
+// the last one. ClickHouse has no transactions, the rows are deleted first there, and inserted with a prepared
+// statement inside a transaction, so they are sent as a single native batch.
+func replaceExportRows(ctx context.Context, conn *sql.Conn, dialect Dialect, table exportTable, rows [][]any) error {
+	rows = dedupeExportRows(rows)
+
+	// monitor_id and timestamp are the first columns of every table.
+	keys := make([]string, len(rows))
+	args := make([]any, 0, len(rows)*2)
+	for i, row := range rows {
+		keys[i] = "(monitor_id = ? AND timestamp = ?)"
+		args = append(args, row[0], row[1])
+	}
+	deleteQuery := fmt.Sprintf("DELETE FROM %s WHERE %s", table.name, strings.Join(keys, " OR "))
+
+	if dialect == DialectClickHouse {
+		_, err := conn.ExecContext(ctx, deleteQuery, args...)
+		if err != nil {
+			return fmt.Errorf("failed to delete existing %s rows: %w", table.name, err)
+		}
+	}
+
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+
+	if dialect != DialectClickHouse {
+		_, err = tx.ExecContext(ctx, deleteQuery, args...)
+		if err != nil {
+			if rollbackErr := tx.Rollback(); rollbackErr != nil {
+				log.Error().Err(rollbackErr).Msg("failed to rollback transaction")
+			}
+			return fmt.Errorf("failed to delete existing %s rows: %w", table.name, err)
+		}
+	}
+
+	statement, err := tx.PrepareContext(
+		ctx,
+		fmt.Sprintf(
+			"INSERT INTO %s (%s) VALUES (%s)",
+			table.name,
+			table.columnNames(),
+			strings.TrimSuffix(strings.Repeat("?, ", len(table.columns)), ", "),
+		),
+	)
+	if err != nil {
+		if rollbackErr := tx.Rollback(); rollbackErr != nil {
+			log.Error().Err(rollbackErr).Msg("failed to rollback transaction")
+		}
+		return fmt.Errorf("failed to prepare statement: %w", err)
+	}
+
+	values := make([]any, len(table.columns))
+	for _, row := range rows {
+		for i, column := range table.columns {
+			values[i] = column.driverValue(row[i])
+		}
+
+		_, err = statement.ExecContext(ctx, values...)
+		if err != nil {
+			_ = statement.Close()
+			if rollbackErr := tx.Rollback(); rollbackErr != nil {
+				log.Error().Err(rollbackErr).Msg("failed to rollback transaction")
+			}
+			return fmt.Errorf("failed to insert %s rows: %w", table.name, err)
+		}
+	}
+
+	err = statement.Close()
+	if err != nil {
+		if rollbackErr := tx.Rollback(); rollbackErr != nil {
+			log.Error().Err(rollbackErr).Msg("failed to rollback transaction")
+		}
+		return fmt.Errorf("failed to close statement: %w", err)
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,605 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/marcboeker/go-duckdb/v2"
+	"github.com/rs/zerolog/log"
+)
+
+// ExportFormat is the file format of exported data.
+type ExportFormat string
+
+const (
+	ExportFormatCSV     ExportFormat = "csv"
+	ExportFormatJSONL   ExportFormat = "jsonl"
+	ExportFormatParquet ExportFormat = "parquet"
+)
+
+// ParseExportFormat parses csv, jsonl, or parquet.
+func ParseExportFormat(value string) (ExportFormat, error) {
+	switch format := ExportFormat(strings.ToLower(value)); format {
+	case ExportFormatCSV, ExportFormatJSONL, ExportFormatParquet:
+		return format, nil
+	default:
+		return "", fmt.Errorf("invalid format %q, must be csv, jsonl, or parquet", value)
+	}
+}
+
+// ContentType returns the MIME type of the format.
+func (f ExportFormat) ContentType() string {
+	switch f {
+	case ExportFormatJSONL:
+		return "application/x-ndjson"
+	case ExportFormatParquet:
+		return "application/vnd.apache.parquet"
+	default:
+		return "text/csv"
+	}
+}
+
+// exportEncoder writes the rows of a single table. Each row holds the values of every column of the table,
+// in order, as nil, string, int64, float64, or time.Time.
+type exportEncoder interface {
+	Write(row []any) error
+	// Close flushes the remaining rows. It must be called even if a write failed.
+	Close() error
+}
+
+// exportDecoder reads the rows of a single table, in the same form as exportEncoder writes them.
+// Read returns io.EOF after the last row.
+type exportDecoder interface {
+	Read() ([]any, error)
+	Close() error
+}
+
+func newExportEncoder(w io.Writer, table exportTable, format ExportFormat) (exportEncoder, error) {
+	switch format {
+	case ExportFormatCSV:
+		return newCSVExportEncoder(w, table)
+	case ExportFormatJSONL:
+		return &jsonlExportEncoder{writer: w, table: table}, nil
+	case ExportFormatParquet:
+		return newParquetExportEncoder(w, table)
+	default:
+		return nil, fmt.Errorf("unsupported format %q", format)
+	}
+}
+
+func newExportDecoder(r io.Reader, table exportTable, format ExportFormat) (exportDecoder, error) {
+	switch format {
+	case ExportFormatCSV:
+		return newCSVExportDecoder(r, table)
+	case ExportFormatJSONL:
+		decoder := json.NewDecoder(r)
+		decoder.UseNumber()
+		return &jsonlExportDecoder{decoder: decoder, table: table}, nil
+	case ExportFormatParquet:
+		return newParquetExportDecoder(r, table)
+	default:
+		return nil, fmt.Errorf("unsupported format %q", format)
+	}
+}
+
+// formatExportValue formats a value as text, for CSV. Null values are written as an empty string.
+func formatExportValue(value any) string {
+	switch value := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return value
+	case int64:
+		return strconv.FormatInt(value, 10)
+	case float64:
+		return strconv.FormatFloat(value, 'g', -1, 64)
+	case time.Time:
+		return value.UTC().Format(time.RFC3339Nano)
+	default:
+		return fmt.Sprint(value)
+	}
+}
+
+// parseExportValue parses a text value of the column. An empty value is null for nullable columns,
+// and the current time for created_at.
+func parseExportValue(column exportColumn, value string) (any, error) {
+	if value == "" && column.kind != exportColumnString {
+		return column.missing()
+	}
+
+	if value == "" && column.nullable {
+		return nil, nil
+	}
+
+	switch column.kind {
+	case exportColumnString:
+		return value, nil
+	case exportColumnSmallInt, exportColumnInteger:
+		parsed, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s %q: must be an integer", column.name, value)
+		}
+		return parsed, nil
+	case exportColumnDouble:
+		parsed, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s %q: must be a number", column.name, value)
+		}
+		return parsed, nil
+	case exportColumnTimestamp:
+		parsed, err := time.Parse(time.RFC3339Nano, value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s %q: must be a RFC 3339 timestamp", column.name, value)
+		}
+		return parsed.UTC(), nil
+	default:
+		return nil, fmt.Errorf("unsupported type of column %s", column.name)
+	}
+}
+
+type csvExportEncoder struct {
+	writer *csv.Writer
+	record []string
+}
+
+func newCSVExportEncoder(w io.Writer, table exportTable) (*csvExportEncoder, error) {
+	writer := csv.NewWriter(w)
+	header := make([]string, len(table.columns))
+	for i, column := range table.columns {
+		header[i] = column.name
+	}
+
+	err := writer.Write(header)
+	if err != nil {
+		return nil, fmt.Errorf("failed to write header: %w", err)
+	}
+
+	return &csvExportEncoder{writer: writer, record: make([]string, len(table.columns))}, nil
+}
+
+func (e *csvExportEncoder) Write(row []any) error {
+	for i, value := range row {
+		e.record[i] = formatExportValue(value)
+	}
+
+	return e.writer.Write(e.record)
+}
+
+func (e *csvExportEncoder) Close() error {
+	e.writer.Flush()
+	return e.writer.Error()
+}
+
+type csvExportDecoder struct {
+	reader *csv.Reader
+	table  exportTable
+	// indexes holds the index of each column of the table in the records, or -1 if the file does not have it.
+	indexes []int
+}
+
+func newCSVExportDecoder(r io.Reader, table exportTable) (*csvExportDecoder, error) {
+	reader := csv.NewReader(r)
+	reader.ReuseRecord = true
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read header: %w", err)
+	}
+
+	indexes := make([]int, len(table.columns))
+	for i, column := range table.columns {
+		indexes[i] = -1
+		for j, name := range header {
+			if strings.TrimSpace(name) == column.name {
+				indexes[i] = j
+				break
+			}
+		}
+
+		if indexes[i] == -1 && column.required() {
+			return nil, fmt.Errorf("missing column %s", column.name)
+		}
+	}
+
+	return &csvExportDecoder{reader: reader, table: table, indexes: indexes}, nil
+}
+
+func (d *csvExportDecoder) Read() ([]any, error) {
+	record, err := d.reader.Read()
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, io.EOF
+		}
+		return nil, fmt.Errorf("failed to read record: %w", err)
+	}
+
+	row := make([]any, len(d.table.columns))
+	for i, column := range d.table.columns {
+		if d.indexes[i] == -1 {
+			row[i], err = column.missing()
+		} else {
+			row[i], err = parseExportValue(column, record[d.indexes[i]])
+		}
+		if err != nil {
+			line, _ := d.reader.FieldPos(0)
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+	}
+
+	return row, nil
+}
+
+func (d *csvExportDecoder) Close() error {
+	return nil
+}
+
+type jsonlExportEncoder struct {
+	writer io.Writer
+	table  exportTable
+	buffer bytes.Buffer
+}
+
+func (e *jsonlExportEncoder) Write(row []any) error {
+	// The object is written by hand, so the keys keep the order of the columns.
+	e.buffer.Reset()
+	e.buffer.WriteByte('{')
+	for i, column := range e.table.columns {
+		if i > 0 {
+			e.buffer.WriteByte(',')
+		}
+
+		name, err := json.Marshal(column.name)
+		if err != nil {
+			return err
+		}
+		e.buffer.Write(name)
+		e.buffer.WriteByte(':')
+
+		value := row[i]
+		if timestamp, ok := value.(time.Time); ok {
+			value = timestamp.UTC()
+		}
+
+		encoded, err := json.Marshal(value)
+		if err != nil {
+			return fmt.Errorf("failed to encode %s: %w", column.name, err)
+		}
+		e.buffer.Write(encoded)
+	}
+	e.buffer.WriteString("}\n")
+
+	_, err := e.writer.Write(e.buffer.Bytes())
+	return err
+}
+
+func (e *jsonlExportEncoder) Close() error {
+	return nil
+}
+
+type jsonlExportDecoder struct {
+	decoder *json.Decoder
+	table   exportTable
+	line    int
+}
+
+func (d *jsonlExportDecoder) Read() ([]any, error) {
+	var object map[string]any
+	err := d.decoder.Decode(&object)
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, io.EOF
+		}
+		return nil, fmt.Errorf("failed to decode object %d: %w", d.line+1, err)
+	}
+	d.line++
+
+	row := make([]any, len(d.table.columns))
+	for i, column := range d.table.columns {
+		switch value := object[column.name].(type) {
+		case nil:
+			row[i], err = column.missing()
+		case string:
+			row[i], err = parseExportValue(column, value)
+		case json.Number:
+			row[i], err = parseExportValue(column, value.String())
+		case bool:
+			err = fmt.Errorf("invalid %s %t", column.name, value)
+		default:
+			err = fmt.Errorf("invalid %s: must be a string or a number", column.name)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("object %d: %w", d.line, err)
+		}
+	}
+
+	return row, nil
+}
+
+func (d *jsonlExportDecoder) Close() error {
+	return nil
+}
+
+// duckDBType returns the DuckDB type of the column, used to build the Parquet schema.
+func (c exportColumn) duckDBType() string {
+	switch c.kind {
+	case exportColumnSmallInt:
+		return "SMALLINT"
+	case exportColumnInteger:
+		return "INTEGER"
+	case exportColumnDouble:
+		return "DOUBLE"
+	case exportColumnTimestamp:
+		return "TIMESTAMP"
+	default:
+		return "VARCHAR"
+	}
+}
+
+// parquetExportEncoder collects the rows in a temporary DuckDB database, since Parquet files cannot be
+// written row by row, and copies them to a Parquet file once closed. This works regardless of the database
+// that Semyi runs on.
+type parquetExportEncoder struct {
+	writer    io.Writer
+	table     exportTable
+	directory string
+	connector *duckdb.Connector
+	conn      driver.Conn
+	appender  *duckdb.Appender
+	values    []driver.Value
+}
+
+func newParquetExportEncoder(w io.Writer, table exportTable) (*parquetExportEncoder, error) {
+	directory, err := os.MkdirTemp("", "semyi-export-*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temporary directory: %w", err)
+	}
+
+	encoder := &parquetExportEncoder{writer: w, table: table, directory: directory, values: make([]driver.Value, len(table.columns))}
+	err = encoder.open()
+	if err != nil {
+		encoder.cleanup()
+		return nil, err
+	}
+
+	return encoder, nil
+}
+
+func (e *parquetExportEncoder) open() error {
+	connector, err := duckdb.NewConnector(filepath.Join(e.directory, "export.duckdb"), nil)
+	if err != nil {
+		return fmt.Errorf("failed to create duckdb connector: %w", err)
+	}
+	e.connector = connector
+
+	conn, err := connector.Connect(context.Background())
+	if err != nil {
+		return fmt.Errorf("failed to connect to duckdb: %w", err)
+	}
+	e.conn = conn
+
+	columns := make([]string, len(e.table.columns))
+	for i, column := range e.table.columns {
+		columns[i] = column.name + " " + column.duckDBType()
+	}
+
+	_, err = conn.(driver.ExecerContext).ExecContext(context.Background(), fmt.Sprintf("CREATE TABLE %s (%s)", e.table.name, strings.Join(columns, ", ")), nil)
+	if err != nil {
+		return fmt.Errorf("failed to create table: %w", err)
+	}
+
+	appender, err := duckdb.NewAppenderFromConn(conn, "", e.table.name)
+	if err != nil {
+		return fmt.Errorf("failed to create appender: %w", err)
+	}
+	e.appender = appender
+
+	return nil
+}
+
+func (e *parquetExportEncoder) Write(row []any) error {
+	for i, column := range e.table.columns {
+		e.values[i] = column.driverValue(row[i])
+	}
+
+	return e.appender.AppendRow(e.values...)
+}
+
+func (e *parquetExportEncoder) Close() error {
+	defer e.cleanup()
+
+	err := e.appender.Close()
+	e.appender = nil
+	if err != nil {
+		return fmt.Errorf("failed to close appender: %w", err)
+	}
+
+	path := filepath.Join(e.directory, "export.parquet")
+	_, err = e.conn.(driver.ExecerContext).ExecContext(
+		context.Background(),
+		fmt.Sprintf("COPY %s TO %s (FORMAT PARQUET)", e.table.name, quoteDuckDBString(path)),
+		nil,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to write parquet file: %w", err)
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open parquet file: %w", err)
+	}
+	defer func() {
+		if err := file.Close(); err != nil {
+			log.Warn().Err(err).Msg("failed to close parquet file")
+		}
+	}()
+
+	_, err = io.Copy(e.writer, file)
+	if err != nil {
+		return fmt.Errorf("failed to copy parquet file: %w", err)
+	}
+
+	return nil
+}
+
+func (e *parquetExportEncoder) cleanup() {
+	if e.appender != nil {
+		_ = e.appender.Close()
+	}
+
+	if e.conn != nil {
+		_ = e.conn.Close()
+	}
+
+	if e.connector != nil {
+		_ = e.connector.Close()
+	}
+
+	err := os.RemoveAll(e.directory)
+	if err != nil {
+		log.Warn().Err(err).Str("directory", e.directory).Msg("failed to remove temporary directory")
+	}
+}
+
+// parquetExportDecoder reads a Parquet file with an in-memory DuckDB database. The file is copied
+// to a temporary file first, since Parquet files are read from the end.
+type parquetExportDecoder struct {
+	table     exportTable
+	directory string
+	db        *sql.DB
+	rows      *sql.Rows
+	// present holds whether the file has each column of the table, and selected the columns it has.
+	present  []bool
+	selected []exportColumn
+}
+
+func newParquetExportDecoder(r io.Reader, table exportTable) (*parquetExportDecoder, error) {
+	directory, err := os.MkdirTemp("", "semyi-import-*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temporary directory: %w", err)
+	}
+
+	decoder := &parquetExportDecoder{table: table, directory: directory}
+	err = decoder.open(r)
+	if err != nil {
+		_ = decoder.Close()
+		return nil, err
+	}
+
+	return decoder, nil
+}
+
+func (d *parquetExportDecoder) open(r io.Reader) error {
+	path := filepath.Join(d.directory, "import.parquet")
+	file, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to create temporary file: %w", err)
+	}
+
+	_, err = io.Copy(file, r)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to copy parquet file: %w", err)
+	}
+
+	connector, err := duckdb.NewConnector("", nil)
+	if err != nil {
+		return fmt.Errorf("failed to create duckdb connector: %w", err)
+	}
+	d.db = sql.OpenDB(connector)
+
+	source := fmt.Sprintf("read_parquet(%s)", quoteDuckDBString(path))
+	names, err := d.db.Query("SELECT column_name FROM (DESCRIBE SELECT * FROM " + source + ")")
+	if err != nil {
+		return fmt.Errorf("failed to read parquet schema: %w", err)
+	}
+
+	available := make(map[string]bool)
+	for names.Next() {
+		var name string
+		err = names.Scan(&name)
+		if err != nil {
+			_ = names.Close()
+			return fmt.Errorf("failed to scan parquet schema: %w", err)
+		}
+		available[name] = true
+	}
+	_ = names.Close()
+
+	d.present = make([]bool, len(d.table.columns))
+	var columns []string
+	for i, column := range d.table.columns {
+		if !available[column.name] {
+			if column.required() {
+				return fmt.Errorf("missing column %s", column.name)
+			}
+			continue
+		}
+
+		d.present[i] = true
+		d.selected = append(d.selected, column)
+		columns = append(columns, column.name)
+	}
+
+	d.rows, err = d.db.Query(fmt.Sprintf("SELECT %s FROM %s", strings.Join(columns, ", "), source))
+	if err != nil {
+		return fmt.Errorf("failed to read parquet file: %w", err)
+	}
+
+	return nil
+}
+
+func (d *parquetExportDecoder) Read() ([]any, error) {
+	if !d.rows.Next() {
+		if err := d.rows.Err(); err != nil {
+			return nil, fmt.Errorf("failed to read parquet file: %w", err)
+		}
+		return nil, io.EOF
+	}
+
+	values, err := scanExportRow(d.rows, d.selected)
+	if err != nil {
+		return nil, err
+	}
+
+	row := make([]any, len(d.table.columns))
+	for i, column := range d.table.columns {
+		if d.present[i] {
+			row[i], values = values[0], values[1:]
+			if row[i] == nil && !column.nullable {
+				row[i], err = column.missing()
+			}
+		} else {
+			row[i], err = column.missing()
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return row, nil
+}
+
+func (d *parquetExportDecoder) Close() error {
+	if d.rows != nil {
+		_ = d.rows.Close()
+	}
+
+	if d.db != nil {
+		_ = d.db.Close()
+	}
+
+	return os.RemoveAll(d.directory)
+}
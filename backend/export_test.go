@@ -0,0 +1,188 @@
+package main_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	main "semyi"
+	"semyi/testutils"
+
+	"github.com/getsentry/sentry-go"
+)
+
+func TestHistoricalExporter_RoundTrip(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	ctx = sentry.SetHubOnContext(ctx, sentry.CurrentHub())
+
+	exporter := main.NewHistoricalExporter(database, nil)
+	start := time.Date(2025, 8, 1, 10, 0, 0, 0, time.UTC)
+
+	for _, format := range []main.ExportFormat{main.ExportFormatCSV, main.ExportFormatJSONL, main.ExportFormatParquet} {
+		t.Run(string(format), func(t *testing.T) {
+			monitorId := "export-monitor-" + string(format)
+			t.Cleanup(func() {
+				_, err := database.Exec("DELETE FROM monitor_historical WHERE monitor_id = ?", monitorId)
+				if err != nil {
+					t.Logf("Warning: failed to clean up test data: %v", err)
+				}
+			})
+
+			_, err := database.ExecContext(ctx,
+				`INSERT INTO monitor_historical (monitor_id, status, latency, timestamp, additional_message, tls_expiry)
+				VALUES (?, 0, 120, ?, NULL, ?), (?, 1, 3000, ?, 'connection refused, retrying', NULL), (?, 0, 90, ?, NULL, NULL)`,
+				monitorId, start, start.AddDate(0, 3, 0),
+				monitorId, start.Add(time.Minute),
+				monitorId, start.Add(2*time.Hour),
+			)
+			testutils.AssertNoError(t, err, "Failed to insert test data")
+
+			var buffer bytes.Buffer
+			exported, err := exporter.Export(ctx, &buffer, "monitor_historical", format, main.ExportFilter{
+				MonitorIDs: []string{monitorId},
+				From:       start,
+				To:         start.Add(time.Hour),
+			})
+			testutils.AssertNoError(t, err, "Failed to export")
+			testutils.AssertEqual(t, int64(2), exported, "Expected the rows within the range only")
+
+			_, err = database.ExecContext(ctx, "DELETE FROM monitor_historical WHERE monitor_id = ?", monitorId)
+			testutils.AssertNoError(t, err, "Failed to delete test data")
+
+			data := buffer.Bytes()
+			for i := 0; i < 2; i++ {
+				imported, err := exporter.Import(ctx, bytes.NewReader(data), "monitor_historical", format)
+				testutils.AssertNoError(t, err, "Failed to import")
+				testutils.AssertEqual(t, int64(2), imported, "Expected every exported row to be imported")
+			}
+
+			historicals, err := main.NewMonitorHistoricalReader(database).ReadRawHistorical(ctx, monitorId, false)
+			testutils.AssertNoError(t, err, "Failed to read imported data")
+			testutils.AssertEqual(t, 2, len(historicals), "Importing twice should not duplicate rows")
+
+			for _, historical := range historicals {
+				if historical.Timestamp.Equal(start) {
+					testutils.AssertEqual(t, main.MonitorStatusSuccess, historical.Status, "Unexpected status")
+					testutils.AssertEqual(t, int64(120), historical.Latency, "Unexpected latency")
+					testutils.AssertTrue(t, historical.TLSExpiryDate.Equal(start.AddDate(0, 3, 0)), "Unexpected TLS expiry")
+				} else {
+					testutils.AssertEqual(t, main.MonitorStatusFailure, historical.Status, "Unexpected status")
+					testutils.AssertEqual(t, "connection refused, retrying", historical.AdditionalMessage, "Unexpected additional message")
+				}
+			}
+		})
+	}
+}
+
+func TestHistoricalExporter_Import(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	ctx = sentry.SetHubOnContext(ctx, sentry.CurrentHub())
+
+	exporter := main.NewHistoricalExporter(database, nil)
+	t.Cleanup(func() {
+		_, err := database.Exec("DELETE FROM incident_data WHERE monitor_id = 'export-incident-monitor'")
+		if err != nil {
+			t.Logf("Warning: failed to clean up test data: %v", err)
+		}
+	})
+
+	// created_at can be omitted, the other columns are required
+	imported, err := exporter.Import(ctx, strings.NewReader(
+		"monitor_id,timestamp,title,description,severity,status,created_by\n"+
+			"export-incident-monitor,2025-08-02T10:00:00Z,Outage,Database is down,2,0,ops\n",
+	), "incident_data", main.ExportFormatCSV)
+	testutils.AssertNoError(t, err, "Failed to import incidents")
+	testutils.AssertEqual(t, int64(1), imported, "Expected a single incident")
+
+	// A row that appears twice within the file is replaced by the last one
+	_, err = exporter.Import(ctx, strings.NewReader(
+		"monitor_id,timestamp,title,description,severity,status,created_by\n"+
+			"export-incident-monitor,2025-08-02T10:00:00Z,Outage,Database is down,2,0,ops\n"+
+			"export-incident-monitor,2025-08-02T10:00:00Z,Outage,Database is back,2,1,ops\n",
+	), "incident_data", main.ExportFormatCSV)
+	testutils.AssertNoError(t, err, "Failed to import duplicate incidents")
+
+	var descriptions []string
+	rows, err := database.QueryContext(ctx, "SELECT description FROM incident_data WHERE monitor_id = 'export-incident-monitor'")
+	testutils.AssertNoError(t, err, "Failed to read incidents")
+	for rows.Next() {
+		var description string
+		testutils.AssertNoError(t, rows.Scan(&description), "Failed to scan incident")
+		descriptions = append(descriptions, description)
+	}
+	testutils.AssertNoError(t, rows.Close(), "Failed to close rows")
+	testutils.AssertEqual(t, 1, len(descriptions), "Expected the duplicate incident to be replaced")
+	testutils.AssertEqual(t, "Database is back", descriptions[0], "Expected the last row of the file")
+
+	_, err = exporter.Import(ctx, strings.NewReader(
+		`{"monitor_id":"export-incident-monitor","timestamp":"2025-08-02T11:00:00Z","title":"Outage"}`+"\n",
+	), "incident_data", main.ExportFormatJSONL)
+	testutils.AssertError(t, err, "Expected an error for missing columns")
+
+	_, err = exporter.Import(ctx, strings.NewReader("monitor_id,timestamp\n"), "incident_data", main.ExportFormatCSV)
+	testutils.AssertError(t, err, "Expected an error for missing columns")
+
+	_, err = exporter.Import(ctx, strings.NewReader(""), "unknown_table", main.ExportFormatCSV)
+	testutils.AssertError(t, err, "Expected an error for an unknown table")
+}
+
+func TestServer_ExportImport(t *testing.T) {
+	t.Cleanup(func() {
+		_, err := database.Exec("DELETE FROM monitor_historical WHERE monitor_id = 'export-api-monitor'")
+		if err != nil {
+			t.Logf("Warning: failed to clean up test data: %v", err)
+		}
+	})
+
+	server := main.NewServer(main.ServerConfig{
+		HistoricalExporter: main.NewHistoricalExporter(database, nil),
+		ApiKey:             "secret",
+	})
+
+	serve := func(method string, path string, body string, apiKey string) *httptest.ResponseRecorder {
+		request := httptest.NewRequest(method, path, strings.NewReader(body))
+		if apiKey != "" {
+			request.Header.Set("X-API-Key", apiKey)
+		}
+		recorder := httptest.NewRecorder()
+		server.Handler.ServeHTTP(recorder, request)
+		return recorder
+	}
+
+	recorder := serve(http.MethodGet, "/api/v1/export", "", "")
+	testutils.AssertEqual(t, http.StatusUnauthorized, recorder.Code, "Expected the API key to be required")
+
+	recorder = serve(http.MethodGet, "/api/v1/export", "", "wrong")
+	testutils.AssertEqual(t, http.StatusUnauthorized, recorder.Code, "Expected an invalid API key to be rejected")
+
+	recorder = serve(http.MethodGet, "/api/v1/export?format=xml", "", "secret")
+	testutils.AssertEqual(t, http.StatusBadRequest, recorder.Code, "Expected an invalid format to be rejected")
+
+	recorder = serve(http.MethodPost, "/api/v1/import?table=monitor_historical&format=jsonl", `{"monitor_id":"export-api-monitor","timestamp":"2025-08-03T10:00:00Z","status":0,"latency":42}`+"\n", "secret")
+	testutils.AssertEqual(t, http.StatusOK, recorder.Code, "Expected the import to succeed")
+
+	var response main.ImportResponse
+	err := json.NewDecoder(recorder.Body).Decode(&response)
+	testutils.AssertNoError(t, err, "Failed to decode import response")
+	testutils.AssertEqual(t, int64(1), response.Imported, "Expected a single imported row")
+
+	recorder = serve(http.MethodGet, "/api/v1/export?table=monitor_historical&format=csv&monitor=export-api-monitor", "", "secret")
+	testutils.AssertEqual(t, http.StatusOK, recorder.Code, "Expected the export to succeed")
+	testutils.AssertEqual(t, "text/csv", recorder.Header().Get("Content-Type"), "Unexpected content type")
+
+	lines := strings.Split(strings.TrimSpace(recorder.Body.String()), "\n")
+	testutils.AssertEqual(t, 2, len(lines), "Expected a header and a single row")
+	testutils.AssertTrue(t, strings.HasPrefix(lines[1], "export-api-monitor,2025-08-03T10:00:00Z,0,42"), "Unexpected row: "+lines[1])
+
+	// The endpoints are disabled without an API key
+	server = main.NewServer(main.ServerConfig{HistoricalExporter: main.NewHistoricalExporter(database, nil)})
+	recorder = serve(http.MethodGet, "/api/v1/export", "", "secret")
+	testutils.AssertEqual(t, http.StatusForbidden, recorder.Code, "Expected the export to be disabled")
+}
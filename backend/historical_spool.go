@@ -0,0 +1,328 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/getsentry/sentry-go"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	historicalSpoolFileName       = "historical.jsonl"
+	historicalSpoolReplayFileName = "historical.replay.jsonl"
+	// defaultHistoricalSpoolMaxSize specifies the default size limit of the spool, in bytes.
+	defaultHistoricalSpoolMaxSize = 64 * 1024 * 1024
+	historicalSpoolReplayInterval = 10 * time.Second
+)
+
+// ErrSpoolFull is returned when the spool has reached its size limit.
+var ErrSpoolFull = errors.New("spool is full")
+
+// HistoricalSpool is an on-disk write-ahead buffer of check results that could not be written
+// to the database. Entries are stored as JSON lines and replayed in order once the database recovers.
+// Delivery is at-least-once: if the process stops in the middle of a replay, the entries of that replay
+// will be written again on the next one. Entries that turn out to be written already are skipped.
+type HistoricalSpool struct {
+	mutex     sync.Mutex
+	directory string
+	maxSize   int64
+	size      int64
+	pending   int64
+	replayed  uint64
+	dropped   uint64
+}
+
+// NewHistoricalSpool opens (or creates) the spool in the given directory. Entries that were left over
+// from a previous run, including a replay that was interrupted, are kept and replayed first.
+func NewHistoricalSpool(directory string, maxSize int64) (*HistoricalSpool, error) {
+	if maxSize <= 0 {
+		maxSize = defaultHistoricalSpoolMaxSize
+	}
+
+	err := os.MkdirAll(directory, 0o755)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create spool directory: %w", err)
+	}
+
+	s := &HistoricalSpool{
+		directory: directory,
+		maxSize:   maxSize,
+	}
+
+	// An interrupted replay is older than anything in the active file, so it goes first.
+	replayContent, err := os.ReadFile(s.replayPath())
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("failed to read spool replay file: %w", err)
+	}
+
+	if len(replayContent) > 0 {
+		err = s.prepend(replayContent)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err = os.Remove(s.replayPath())
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("failed to remove spool replay file: %w", err)
+	}
+
+	content, err := os.ReadFile(s.activePath())
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("failed to read spool file: %w", err)
+	}
+
+	s.size = int64(len(content))
+	s.pending = int64(bytes.Count(content, []byte("\n")))
+
+	return s, nil
+}
+
+func (s *HistoricalSpool) activePath() string {
+	return filepath.Join(s.directory, historicalSpoolFileName)
+}
+
+func (s *HistoricalSpool) replayPath() string {
+	return filepath.Join(s.directory, historicalSpoolReplayFileName)
+}
+
+// prepend puts the content in front of the active file. The caller must hold the mutex,
+// or be the only one accessing the spool.
+func (s *HistoricalSpool) prepend(content []byte) error {
+	existing, err := os.ReadFile(s.activePath())
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to read spool file: %w", err)
+	}
+
+	temporaryPath := s.activePath() + ".tmp"
+	err = os.WriteFile(temporaryPath, append(content, existing...), 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to write spool file: %w", err)
+	}
+
+	err = os.Rename(temporaryPath, s.activePath())
+	if err != nil {
+		return fmt.Errorf("failed to replace spool file: %w", err)
+	}
+
+	s.size = int64(len(content) + len(existing))
+	return nil
+}
+
+// Append writes the check result to the end of the spool.
+// It returns ErrSpoolFull if the entry does not fit within the size limit.
+func (s *HistoricalSpool) Append(historical MonitorHistorical) error {
+	line, err := json.Marshal(historical)
+	if err != nil {
+		return fmt.Errorf("failed to marshal historical data: %w", err)
+	}
+	line = append(line, '\n')
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.size+int64(len(line)) > s.maxSize {
+		s.dropped++
+		return ErrSpoolFull
+	}
+
+	file, err := os.OpenFile(s.activePath(), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to open spool file: %w", err)
+	}
+	defer func() {
+		err := file.Close()
+		if err != nil {
+			log.Warn().Err(err).Msg("failed to close spool file")
+		}
+	}()
+
+	_, err = file.Write(line)
+	if err != nil {
+		return fmt.Errorf("failed to write spool file: %w", err)
+	}
+
+	err = file.Sync()
+	if err != nil {
+		return fmt.Errorf("failed to sync spool file: %w", err)
+	}
+
+	s.size += int64(len(line))
+	s.pending++
+	return nil
+}
+
+// Pending returns the number of entries that are waiting to be written to the database.
+func (s *HistoricalSpool) Pending() int64 {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.pending
+}
+
+// Replay writes every spooled entry to the database, in order. It stops on the first failing write
+// and keeps the remaining entries in the spool. Entries that can never be written (e.g. invalid data)
+// are dropped, and entries that conflict with a stored row were written by an earlier, interrupted replay.
+// The entries that are being replayed keep counting towards the size limit until they are written.
+// The aggregate worker is told about the replayed entries, since they may fall into buckets that have
+// been aggregated already. It can be nil.
+func (s *HistoricalSpool) Replay(ctx context.Context, writer RawHistoricalWriter, aggregates *AggregateWorker) error {
+	span := sentry.StartSpan(ctx, "function", sentry.WithDescription("HistoricalSpool.Replay"))
+	ctx = span.Context()
+	defer span.Finish()
+
+	s.mutex.Lock()
+	if s.pending == 0 {
+		s.mutex.Unlock()
+		return nil
+	}
+
+	// Move the active file aside, so new entries can be appended while we are replaying.
+	err := os.Rename(s.activePath(), s.replayPath())
+	if err != nil {
+		s.mutex.Unlock()
+		return fmt.Errorf("failed to move spool file: %w", err)
+	}
+	s.mutex.Unlock()
+
+	content, err := os.ReadFile(s.replayPath())
+	if err != nil {
+		return fmt.Errorf("failed to read spool replay file: %w", err)
+	}
+
+	// The earliest replayed entry of every monitor, to aggregate its buckets again
+	earliest := make(map[string]time.Time)
+	if aggregates != nil {
+		defer func() {
+			for monitorId, timestamp := range earliest {
+				err := aggregates.Invalidate(ctx, monitorId, timestamp)
+				if err != nil {
+					log.Warn().Err(err).Str("monitor_id", monitorId).Msg("failed to invalidate the aggregates of replayed historical data")
+				}
+			}
+		}()
+	}
+
+	reader := bufio.NewReader(bytes.NewReader(content))
+	var offset int
+	for {
+		line, err := reader.ReadBytes('\n')
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read spool replay file: %w", err)
+		}
+
+		var historical MonitorHistorical
+		err = json.Unmarshal(line, &historical)
+		if err == nil {
+			err = writer.Write(ctx, historical)
+		}
+
+		duplicate := IsUniqueViolation(err)
+		if duplicate {
+			err = nil
+		}
+
+		var validationError *ValidationError
+		var syntaxError *json.SyntaxError
+		if err != nil && !errors.As(err, &validationError) && !errors.As(err, &syntaxError) {
+			s.mutex.Lock()
+			defer s.mutex.Unlock()
+
+			restoreErr := s.prepend(content[offset:])
+			if restoreErr != nil {
+				return errors.Join(err, restoreErr)
+			}
+
+			restoreErr = os.Remove(s.replayPath())
+			if restoreErr != nil {
+				return errors.Join(err, fmt.Errorf("failed to remove spool replay file: %w", restoreErr))
+			}
+
+			return fmt.Errorf("failed to replay historical data: %w", err)
+		}
+
+		s.mutex.Lock()
+		s.pending--
+		s.size -= int64(len(line))
+		switch {
+		case err != nil:
+			log.Warn().Err(err).Msg("dropping invalid entry from the spool")
+			s.dropped++
+		case duplicate:
+			log.Debug().Str("monitor_id", historical.MonitorID).Msg("skipping spooled entry that was already written")
+		default:
+			s.replayed++
+		}
+		s.mutex.Unlock()
+
+		if err == nil {
+			if current, found := earliest[historical.MonitorID]; !found || historical.Timestamp.Before(current) {
+				earliest[historical.MonitorID] = historical.Timestamp
+			}
+		}
+
+		offset += len(line)
+	}
+
+	err = os.Remove(s.replayPath())
+	if err != nil {
+		return fmt.Errorf("failed to remove spool replay file: %w", err)
+	}
+
+	return nil
+}
+
+// Run periodically replays the spool until the context is cancelled.
+func (s *HistoricalSpool) Run(ctx context.Context, writer RawHistoricalWriter, aggregates *AggregateWorker) {
+	ticker := time.NewTicker(historicalSpoolReplayInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			pending := s.Pending()
+			if pending == 0 {
+				continue
+			}
+
+			ctx := sentry.SetHubOnContext(ctx, sentry.CurrentHub().Clone())
+			err := s.Replay(ctx, writer, aggregates)
+			if err != nil {
+				log.Warn().Err(err).Int64("pending", s.Pending()).Msg("failed to replay spooled historical data, will retry")
+				continue
+			}
+
+			log.Info().Int64("replayed", pending).Msg("replayed spooled historical data")
+		}
+	}
+}
+
+// CollectMetrics writes the spool metrics in the Prometheus text exposition format.
+func (s *HistoricalSpool) CollectMetrics(w io.Writer) error {
+	s.mutex.Lock()
+	pending, size, maxSize, replayed, dropped := s.pending, s.size, s.maxSize, s.replayed, s.dropped
+	s.mutex.Unlock()
+
+	return WriteMetrics(w,
+		Metric{Name: "semyi_spool_pending_entries", Help: "Number of check results waiting in the spool.", Type: MetricTypeGauge, Value: float64(pending)},
+		Metric{Name: "semyi_spool_size_bytes", Help: "Size of the spool file in bytes.", Type: MetricTypeGauge, Value: float64(size)},
+		Metric{Name: "semyi_spool_max_size_bytes", Help: "Size limit of the spool in bytes.", Type: MetricTypeGauge, Value: float64(maxSize)},
+		Metric{Name: "semyi_spool_replayed_total", Help: "Number of spooled check results written to the database.", Type: MetricTypeCounter, Value: float64(replayed)},
+		Metric{Name: "semyi_spool_dropped_total", Help: "Number of check results dropped because the spool was full or the entry was invalid.", Type: MetricTypeCounter, Value: float64(dropped)},
+	)
+}
@@ -0,0 +1,158 @@
+package main_test
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"testing"
+	"time"
+
+	main "semyi"
+	"semyi/testutils"
+
+	"github.com/getsentry/sentry-go"
+	"github.com/marcboeker/go-duckdb/v2"
+)
+
+func TestHistoricalSpool_AppendAndReplay(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	ctx = sentry.SetHubOnContext(ctx, sentry.CurrentHub())
+
+	directory := t.TempDir()
+	spool, err := main.NewHistoricalSpool(directory, 0)
+	testutils.AssertNoError(t, err, "Failed to create spool")
+
+	now := time.Now().UTC().Truncate(time.Second)
+	for i := 0; i < 3; i++ {
+		err := spool.Append(main.MonitorHistorical{
+			MonitorID: "spool-monitor",
+			Status:    main.MonitorStatusSuccess,
+			Latency:   int64(100 + i),
+			Timestamp: now.Add(time.Duration(i) * time.Second),
+		})
+		testutils.AssertNoError(t, err, "Failed to append to spool")
+	}
+	testutils.AssertEqual(t, int64(3), spool.Pending(), "Unexpected pending entries")
+
+	// Entries should survive a restart
+	spool, err = main.NewHistoricalSpool(directory, 0)
+	testutils.AssertNoError(t, err, "Failed to reopen spool")
+	testutils.AssertEqual(t, int64(3), spool.Pending(), "Unexpected pending entries after reopening")
+
+	// Replaying against an unavailable database keeps every entry
+	unavailable := openClosedDatabase(t)
+	err = spool.Replay(ctx, main.NewMonitorHistoricalWriter(unavailable), nil)
+	testutils.AssertError(t, err, "Expected replay to fail")
+	testutils.AssertEqual(t, int64(3), spool.Pending(), "Entries should be kept after a failed replay")
+
+	err = spool.Replay(ctx, main.NewMonitorHistoricalWriter(database), nil)
+	testutils.AssertNoError(t, err, "Failed to replay spool")
+	testutils.AssertEqual(t, int64(0), spool.Pending(), "Expected an empty spool after replay")
+
+	historical, err := main.NewMonitorHistoricalReader(database).ReadRawHistorical(ctx, "spool-monitor", false)
+	testutils.AssertNoError(t, err, "Failed to read historical data")
+	testutils.AssertEqual(t, 3, len(historical), "Expected every spooled entry to be written")
+
+	var metrics bytes.Buffer
+	err = spool.CollectMetrics(&metrics)
+	testutils.AssertNoError(t, err, "Failed to collect metrics")
+	testutils.AssertContains(t, metrics.String(), "semyi_spool_replayed_total 3", "Expected replayed entries in metrics")
+}
+
+func TestHistoricalSpool_Full(t *testing.T) {
+	spool, err := main.NewHistoricalSpool(t.TempDir(), 200)
+	testutils.AssertNoError(t, err, "Failed to create spool")
+
+	historical := main.MonitorHistorical{
+		MonitorID: "spool-full-monitor",
+		Status:    main.MonitorStatusFailure,
+		Timestamp: time.Now(),
+	}
+
+	err = spool.Append(historical)
+	testutils.AssertNoError(t, err, "Failed to append to spool")
+
+	err = spool.Append(historical)
+	testutils.AssertTrue(t, errors.Is(err, main.ErrSpoolFull), "Expected the spool to be full")
+	testutils.AssertEqual(t, int64(1), spool.Pending(), "Unexpected pending entries")
+}
+
+// appendingWriter appends to the spool on every write, like the processor does while a replay is running.
+type appendingWriter struct {
+	spool  *main.HistoricalSpool
+	writer main.RawHistoricalWriter
+	errs   []error
+}
+
+func (w *appendingWriter) Write(ctx context.Context, historical main.MonitorHistorical) error {
+	w.errs = append(w.errs, w.spool.Append(historical))
+	return w.writer.Write(ctx, historical)
+}
+
+func TestHistoricalSpool_ReplayDuplicates(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	ctx = sentry.SetHubOnContext(ctx, sentry.CurrentHub())
+
+	spool, err := main.NewHistoricalSpool(t.TempDir(), 0)
+	testutils.AssertNoError(t, err, "Failed to create spool")
+
+	now := time.Now().UTC().Truncate(time.Second)
+	for i := 0; i < 2; i++ {
+		err := spool.Append(main.MonitorHistorical{MonitorID: "spool-duplicate-monitor", Status: main.MonitorStatusSuccess, Timestamp: now.Add(time.Duration(i) * time.Second)})
+		testutils.AssertNoError(t, err, "Failed to append to spool")
+	}
+
+	// Appending while replaying puts the same entries back into the spool, as if the replay was interrupted
+	writer := &appendingWriter{spool: spool, writer: main.NewMonitorHistoricalWriter(database)}
+	err = spool.Replay(ctx, writer, nil)
+	testutils.AssertNoError(t, err, "Failed to replay spool")
+	testutils.AssertEqual(t, int64(2), spool.Pending(), "Expected the entries appended during the replay to be pending")
+
+	err = spool.Replay(ctx, main.NewMonitorHistoricalWriter(database), nil)
+	testutils.AssertNoError(t, err, "Entries that were written already should not fail the replay")
+	testutils.AssertEqual(t, int64(0), spool.Pending(), "Expected an empty spool after replay")
+
+	historical, err := main.NewMonitorHistoricalReader(database).ReadRawHistorical(ctx, "spool-duplicate-monitor", false)
+	testutils.AssertNoError(t, err, "Failed to read historical data")
+	testutils.AssertEqual(t, 2, len(historical), "Expected every entry to be written once")
+}
+
+func TestHistoricalSpool_FullWhileReplaying(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	ctx = sentry.SetHubOnContext(ctx, sentry.CurrentHub())
+
+	spool, err := main.NewHistoricalSpool(t.TempDir(), 200)
+	testutils.AssertNoError(t, err, "Failed to create spool")
+
+	historical := main.MonitorHistorical{MonitorID: "spool-full-replay-monitor", Status: main.MonitorStatusFailure, Timestamp: time.Now().UTC()}
+	err = spool.Append(historical)
+	testutils.AssertNoError(t, err, "Failed to append to spool")
+
+	// The entry that is being replayed still takes up its space
+	writer := &appendingWriter{spool: spool, writer: main.NewMonitorHistoricalWriter(openClosedDatabase(t))}
+	err = spool.Replay(ctx, writer, nil)
+	testutils.AssertError(t, err, "Expected replay to fail")
+	testutils.AssertEqual(t, 1, len(writer.errs), "Expected a single write")
+	testutils.AssertTrue(t, errors.Is(writer.errs[0], main.ErrSpoolFull), "Expected the spool to be full while replaying")
+	testutils.AssertEqual(t, int64(1), spool.Pending(), "Unexpected pending entries")
+}
+
+func openClosedDatabase(t *testing.T) *sql.DB {
+	t.Helper()
+
+	connector, err := duckdb.NewConnector("", func(execer driver.ExecerContext) error {
+		return nil
+	})
+	testutils.AssertNoError(t, err, "Failed to create duckdb connector")
+
+	db := sql.OpenDB(connector)
+	err = db.Close()
+	testutils.AssertNoError(t, err, "Failed to close database")
+
+	return db
+}
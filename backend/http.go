@@ -2,7 +2,9 @@ package main
 
 import (
 	"context"
+	"crypto/subtle"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net"
 	"net/http"
@@ -23,12 +25,21 @@ import (
 )
 
 type Server struct {
-	HistoricalWriter *MonitorHistoricalWriter
-	HistoricalReader *MonitorHistoricalReader
+	HistoricalWriter HistoricalWriter
+	HistoricalReader HistoricalReader
 	CentralBroker    *Broker[MonitorHistorical]
-	IncidentWriter   *IncidentWriter
+	Incidents        IncidentStorage
 	Monitors         []Monitor
 	Processor        *Processor
+	States           *MonitorStateStore
+	Maintenance      *MaintenanceSchedule
+	SLOs             *SLOTracker
+	Outages          *OutageStore
+	AlertOutbox      *AlertOutbox
+	Acknowledger     *Acknowledger
+	Archive          *Archive
+	Exporter         *HistoricalExporter
+	MetricsCollector []MetricsCollector
 	APIKey           string
 
 	monitorIds []string
@@ -40,11 +51,22 @@ type ServerConfig struct {
 	Hostname                string
 	Port                    string
 	StaticPath              string
-	MonitorHistoricalReader *MonitorHistoricalReader
-	MonitorHistoricalWriter *MonitorHistoricalWriter
+	MonitorHistoricalReader HistoricalReader
+	MonitorHistoricalWriter HistoricalWriter
 	CentralBroker           *Broker[MonitorHistorical]
-	IncidentWriter          *IncidentWriter
+	IncidentStorage         IncidentStorage
 	MonitorList             []Monitor
+	Processor               *Processor
+	MonitorStates           *MonitorStateStore
+	Maintenance             *MaintenanceSchedule
+	SLOTracker              *SLOTracker
+	OutageStore             *OutageStore
+	AlertOutbox             *AlertOutbox
+	Acknowledger            *Acknowledger
+	ChatOps                 *ChatOps
+	Archive                 *Archive
+	HistoricalExporter      *HistoricalExporter
+	MetricsCollector        []MetricsCollector
 
 	ApiKey string
 }
@@ -60,8 +82,17 @@ func NewServer(config ServerConfig) *http.Server {
 		HistoricalWriter: config.MonitorHistoricalWriter,
 		CentralBroker:    config.CentralBroker,
 		Monitors:         config.MonitorList,
-		IncidentWriter:   config.IncidentWriter,
-		Processor:        nil,
+		Incidents:        config.IncidentStorage,
+		Processor:        config.Processor,
+		States:           config.MonitorStates,
+		Maintenance:      config.Maintenance,
+		SLOs:             config.SLOTracker,
+		Outages:          config.OutageStore,
+		AlertOutbox:      config.AlertOutbox,
+		Acknowledger:     config.Acknowledger,
+		Archive:          config.Archive,
+		Exporter:         config.HistoricalExporter,
+		MetricsCollector: config.MetricsCollector,
 		APIKey:           config.ApiKey,
 		monitorIds:       monitorIds,
 	}
@@ -86,13 +117,33 @@ func NewServer(config ServerConfig) *http.Server {
 	api.Get("/api/overview", server.SnapshotOverview)
 	api.Get("/api/by", server.SnapshotBy)
 	api.Get("/api/static", server.StaticSnapshot)
+	api.Get("/api/status", server.LatestStatus)
 	api.Post("/api/incident", server.SubmitIncident)
+	api.Get("/api/maintenance", server.MaintenanceOverview)
 	api.Get("/api/push/{monitor_id}", server.PushHealthcheck)
+	api.Get("/api/v1/monitors/{id}/series", server.MonitorSeries)
+	api.Get("/api/v1/monitors/{id}/uptime", server.MonitorUptime)
+	api.Get("/api/v1/slos", server.SLOStatuses)
+	api.Get("/api/v1/outages", server.OutageHistory)
+	api.Get("/api/v1/monitors/{id}/outages", server.OutageHistory)
+	api.Get("/api/v1/alerts/deliveries", server.AlertDeliveryHistory)
+	api.Get("/api/v1/monitors/{id}/alerts/deliveries", server.AlertDeliveryHistory)
+	api.Post("/api/v1/monitors/{id}/acknowledge", server.AcknowledgeOutage)
+	api.Get("/api/v1/monitors/{id}/acknowledgements", server.AcknowledgementHistory)
+	api.Get("/api/v1/monitors/{id}/archive", server.MonitorArchive)
+	api.Get("/api/v1/export", server.ExportData)
+	api.Post("/api/v1/import", server.ImportData)
+	if config.ChatOps != nil {
+		api.Post("/api/v1/chatops/slack", config.ChatOps.Slack)
+		api.Post("/api/v1/chatops/discord", config.ChatOps.Discord)
+		api.Post("/api/v1/chatops/telegram", config.ChatOps.Telegram)
+	}
 
 	r := chi.NewRouter()
 	r.Use(middleware.Recoverer)
 	r.Use(middleware.RealIP)
 	r.Use(secureMiddleware.Handler)
+	r.Get("/metrics", server.Metrics)
 	r.Handle("/api/*", corsMiddleware.Handler(api))
 	r.Handle("/*", server.SpaHandler(config.StaticPath))
 
@@ -182,6 +233,14 @@ func (s *Server) SnapshotOverview(w http.ResponseWriter, r *http.Request) {
 		log.Error().Str("request_id", requestId).Str("component", "snapshotOverview").Err(err).Msg("failed to write data")
 		sentry.GetHubFromContext(ctx).CaptureException(err)
 	}
+
+	// Send the latest known result of every monitor first, so the client does not have to wait
+	// for the next check to know the current status.
+	err = s.writeLatestSnapshot(w, s.monitorIds)
+	if err != nil {
+		log.Error().Str("request_id", requestId).Str("component", "snapshotOverview").Err(err).Msg("failed to write data")
+		sentry.GetHubFromContext(ctx).CaptureException(err)
+	}
 	flusher.Flush()
 
 	for {
@@ -272,6 +331,12 @@ func (s *Server) SnapshotBy(w http.ResponseWriter, r *http.Request) {
 		log.Error().Str("wanted_monitor_ids", ids).Str("request_id", requestId).Str("component", "snapshotBy").Err(err).Msg("failed to write data")
 		sentry.GetHubFromContext(ctx).CaptureException(err)
 	}
+
+	err = s.writeLatestSnapshot(w, wantedMonitorIds)
+	if err != nil {
+		log.Error().Str("wanted_monitor_ids", ids).Str("request_id", requestId).Str("component", "snapshotBy").Err(err).Msg("failed to write data")
+		sentry.GetHubFromContext(ctx).CaptureException(err)
+	}
 	flusher.Flush()
 
 	for {
@@ -300,6 +365,98 @@ func (s *Server) SnapshotBy(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// writeLatestSnapshot writes the latest check result of each monitor as server-sent events,
+// in the same shape as the events that are published by the central broker.
+func (s *Server) writeLatestSnapshot(w http.ResponseWriter, monitorIds []string) error {
+	if s.States == nil {
+		return nil
+	}
+
+	for _, monitorId := range monitorIds {
+		state, ok := s.States.Get(monitorId)
+		if !ok {
+			continue
+		}
+
+		latest, ok := state.Latest()
+		if !ok {
+			continue
+		}
+
+		marshaled, err := json.Marshal(latest)
+		if err != nil {
+			return fmt.Errorf("failed to marshal data: %w", err)
+		}
+
+		_, err = w.Write([]byte("data: " + string(marshaled) + "\n\n"))
+		if err != nil {
+			return fmt.Errorf("failed to write data: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// Metrics exposes the metrics of every registered collector in the Prometheus text exposition format.
+func (s *Server) Metrics(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+
+	for _, collector := range s.MetricsCollector {
+		err := collector.CollectMetrics(w)
+		if err != nil {
+			log.Error().Err(err).Msg("failed to write metrics")
+			sentry.GetHubFromContext(r.Context()).CaptureException(err)
+			return
+		}
+	}
+}
+
+func (s *Server) LatestStatus(w http.ResponseWriter, r *http.Request) {
+	monitorId := r.URL.Query().Get("id")
+
+	// Add breadcrumb for request
+	sentry.AddBreadcrumb(&sentry.Breadcrumb{
+		Category: "http",
+		Message:  "Handling latest status request",
+		Level:    sentry.LevelInfo,
+		Data: map[string]interface{}{
+			"monitor_id": monitorId,
+			"path":       r.URL.Path,
+		},
+	})
+
+	if monitorId != "" && !slices.Contains(s.monitorIds, monitorId) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		_ = json.NewEncoder(w).Encode(HttpCommonError{Error: "id is not in the list of monitors"})
+		return
+	}
+
+	latestStatusResponse := []LatestStatusResponse{}
+	for _, monitor := range s.Monitors {
+		if monitorId != "" && monitor.UniqueID != monitorId {
+			continue
+		}
+
+		var state *MonitorState
+		if s.States != nil {
+			if monitorState, ok := s.States.Get(monitor.UniqueID); ok {
+				state = &monitorState
+			}
+		}
+
+		latestStatusResponse = append(latestStatusResponse, LatestStatusResponse{
+			Metadata: monitor,
+			State:    state,
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(latestStatusResponse)
+}
+
 func (s *Server) StaticSnapshot(w http.ResponseWriter, r *http.Request) {
 	monitorId := r.URL.Query().Get("id")
 	ctx := r.Context()
@@ -470,7 +627,7 @@ func (s *Server) SubmitIncident(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err = s.IncidentWriter.Write(ctx, incident)
+	err = s.Incidents.WriteIncident(ctx, incident)
 	if err != nil {
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusInternalServerError)
@@ -570,3 +727,854 @@ func (s *Server) PushHealthcheck(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusOK)
 	_ = json.NewEncoder(w).Encode(HttpCommonSuccess{Message: "success"})
 }
+
+func (s *Server) MaintenanceOverview(w http.ResponseWriter, r *http.Request) {
+	monitorId := r.URL.Query().Get("id")
+
+	// Add breadcrumb for request
+	sentry.AddBreadcrumb(&sentry.Breadcrumb{
+		Category: "http",
+		Message:  "Handling maintenance schedule request",
+		Level:    sentry.LevelInfo,
+		Data: map[string]interface{}{
+			"monitor_id": monitorId,
+			"path":       r.URL.Path,
+		},
+	})
+
+	if monitorId != "" && !slices.Contains(s.monitorIds, monitorId) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		_ = json.NewEncoder(w).Encode(HttpCommonError{Error: "id is not in the list of monitors"})
+		return
+	}
+
+	// By default, we show the ongoing and upcoming maintenance windows for the next 7 days.
+	days := 7
+	if value := r.URL.Query().Get("days"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed <= 0 || parsed > 365 {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			_ = json.NewEncoder(w).Encode(HttpCommonError{Error: "days must be a number between 1 and 365"})
+			return
+		}
+		days = parsed
+	}
+
+	now := time.Now()
+	occurrences := s.Maintenance.Occurrences(monitorId, now, now.AddDate(0, 0, days))
+	if occurrences == nil {
+		occurrences = []MaintenanceOccurrence{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(occurrences)
+}
+
+func (s *Server) MonitorSeries(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	monitorId := chi.URLParam(r, "id")
+
+	// Add breadcrumb for request
+	sentry.AddBreadcrumb(&sentry.Breadcrumb{
+		Category: "http",
+		Message:  "Handling monitor series request",
+		Level:    sentry.LevelInfo,
+		Data: map[string]interface{}{
+			"monitor_id": monitorId,
+			"from":       r.URL.Query().Get("from"),
+			"to":         r.URL.Query().Get("to"),
+			"step":       r.URL.Query().Get("step"),
+			"path":       r.URL.Path,
+		},
+	})
+
+	monitor, found := s.findMonitor(monitorId)
+	if !found {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusNotFound)
+		_ = json.NewEncoder(w).Encode(HttpCommonError{Error: "monitor not found"})
+		return
+	}
+
+	// By default, we show the last 24 hours in 5 minutes steps.
+	to := time.Now().UTC()
+	if value := r.URL.Query().Get("to"); value != "" {
+		parsed, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			_ = json.NewEncoder(w).Encode(HttpCommonError{Error: "to must be a RFC 3339 timestamp"})
+			return
+		}
+		to = parsed
+	}
+
+	from := to.Add(-24 * time.Hour)
+	if value := r.URL.Query().Get("from"); value != "" {
+		parsed, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			_ = json.NewEncoder(w).Encode(HttpCommonError{Error: "from must be a RFC 3339 timestamp"})
+			return
+		}
+		from = parsed
+	}
+
+	if !to.After(from) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		_ = json.NewEncoder(w).Encode(HttpCommonError{Error: "to must be after from"})
+		return
+	}
+
+	stepValue := r.URL.Query().Get("step")
+	if stepValue == "" {
+		stepValue = "5m"
+	}
+
+	step, err := ParseSeriesStep(stepValue)
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		_ = json.NewEncoder(w).Encode(HttpCommonError{Error: err.Error()})
+		return
+	}
+
+	if step.BucketCount(from, to) > maxSeriesBuckets {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		_ = json.NewEncoder(w).Encode(HttpCommonError{Error: fmt.Sprintf("the range must contain at most %d steps", maxSeriesBuckets)})
+		return
+	}
+
+	series, err := s.HistoricalReader.ReadSeries(ctx, monitorId, from, to, step)
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		_ = json.NewEncoder(w).Encode(HttpCommonError{Error: fmt.Sprintf("failed to read series: %s", err)})
+		sentry.GetHubFromContext(ctx).CaptureException(err)
+		return
+	}
+
+	if series == nil {
+		series = []MonitorSeriesBucket{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(MonitorSeriesResponse{
+		Metadata: monitor,
+		From:     from.UTC(),
+		To:       to.UTC(),
+		Step:     step.String(),
+		Buckets:  series,
+	})
+}
+
+func (s *Server) MonitorUptime(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	monitorId := chi.URLParam(r, "id")
+
+	// Add breadcrumb for request
+	sentry.AddBreadcrumb(&sentry.Breadcrumb{
+		Category: "http",
+		Message:  "Handling monitor uptime request",
+		Level:    sentry.LevelInfo,
+		Data: map[string]interface{}{
+			"monitor_id": monitorId,
+			"path":       r.URL.Path,
+		},
+	})
+
+	monitor, found := s.findMonitor(monitorId)
+	if !found {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusNotFound)
+		_ = json.NewEncoder(w).Encode(HttpCommonError{Error: "monitor not found"})
+		return
+	}
+
+	summary, err := NewUptimeCalculator(s.HistoricalReader, s.Maintenance).Calculate(ctx, monitorId, time.Now())
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		_ = json.NewEncoder(w).Encode(HttpCommonError{Error: fmt.Sprintf("failed to calculate uptime: %s", err)})
+		sentry.GetHubFromContext(ctx).CaptureException(err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(MonitorUptimeResponse{
+		Metadata: monitor,
+		Windows:  summary.Windows,
+		Months:   summary.Months,
+		Calendar: summary.Calendar,
+	})
+}
+
+func (s *Server) SLOStatuses(w http.ResponseWriter, r *http.Request) {
+	monitorId := r.URL.Query().Get("id")
+
+	// Add breadcrumb for request
+	sentry.AddBreadcrumb(&sentry.Breadcrumb{
+		Category: "http",
+		Message:  "Handling slo status request",
+		Level:    sentry.LevelInfo,
+		Data: map[string]interface{}{
+			"monitor_id": monitorId,
+			"path":       r.URL.Path,
+		},
+	})
+
+	if monitorId != "" && !slices.Contains(s.monitorIds, monitorId) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		_ = json.NewEncoder(w).Encode(HttpCommonError{Error: "id is not in the list of monitors"})
+		return
+	}
+
+	statuses := []SLOStatus{}
+	if s.SLOs != nil {
+		statuses = s.SLOs.Statuses(monitorId)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(statuses)
+}
+
+// OutageHistory lists the outages, filtered by the monitor (from the URL or the "id" query parameter),
+// the time range, the minimum duration, and whether the outage is ongoing.
+func (s *Server) OutageHistory(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	monitorId := chi.URLParam(r, "id")
+	if monitorId == "" {
+		monitorId = r.URL.Query().Get("id")
+	}
+
+	// Add breadcrumb for request
+	sentry.AddBreadcrumb(&sentry.Breadcrumb{
+		Category: "http",
+		Message:  "Handling outage history request",
+		Level:    sentry.LevelInfo,
+		Data: map[string]interface{}{
+			"monitor_id": monitorId,
+			"query":      r.URL.RawQuery,
+			"path":       r.URL.Path,
+		},
+	})
+
+	if monitorId != "" && !slices.Contains(s.monitorIds, monitorId) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusNotFound)
+		_ = json.NewEncoder(w).Encode(HttpCommonError{Error: "monitor not found"})
+		return
+	}
+
+	filter := OutageFilter{MonitorID: monitorId}
+	query := r.URL.Query()
+	if value := query.Get("from"); value != "" {
+		parsed, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			_ = json.NewEncoder(w).Encode(HttpCommonError{Error: "from must be a RFC 3339 timestamp"})
+			return
+		}
+		filter.From = parsed
+	}
+
+	if value := query.Get("to"); value != "" {
+		parsed, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			_ = json.NewEncoder(w).Encode(HttpCommonError{Error: "to must be a RFC 3339 timestamp"})
+			return
+		}
+		filter.To = parsed
+	}
+
+	if value := query.Get("min_duration"); value != "" {
+		parsed, err := parseDuration(value)
+		if err != nil || parsed < 0 {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			_ = json.NewEncoder(w).Encode(HttpCommonError{Error: "min_duration must be a valid duration (e.g. 5m, 1h)"})
+			return
+		}
+		filter.MinDuration = parsed
+	}
+
+	if value := query.Get("ongoing"); value != "" {
+		parsed, err := strconv.ParseBool(value)
+		if err != nil {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			_ = json.NewEncoder(w).Encode(HttpCommonError{Error: "ongoing must be a boolean"})
+			return
+		}
+		filter.Ongoing = parsed
+	}
+
+	if value := query.Get("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed <= 0 || parsed > 1000 {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			_ = json.NewEncoder(w).Encode(HttpCommonError{Error: "limit must be a number between 1 and 1000"})
+			return
+		}
+		filter.Limit = parsed
+	}
+
+	outages, err := s.Outages.Read(ctx, filter)
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		_ = json.NewEncoder(w).Encode(HttpCommonError{Error: fmt.Sprintf("failed to read outages: %s", err)})
+		sentry.GetHubFromContext(ctx).CaptureException(err)
+		return
+	}
+
+	if outages == nil {
+		outages = []Outage{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(outages)
+}
+
+// AlertDeliveryHistory lists the alert deliveries and their attempts, filtered by the monitor (from the URL or
+// the "id" query parameter), the provider, the state, and the time range. Since failed attempts may contain
+// webhook URLs, the endpoint requires the API key.
+func (s *Server) AlertDeliveryHistory(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	monitorId := chi.URLParam(r, "id")
+	if monitorId == "" {
+		monitorId = r.URL.Query().Get("id")
+	}
+
+	// Add breadcrumb for request
+	sentry.AddBreadcrumb(&sentry.Breadcrumb{
+		Category: "http",
+		Message:  "Handling alert delivery history request",
+		Level:    sentry.LevelInfo,
+		Data: map[string]interface{}{
+			"monitor_id": monitorId,
+			"query":      r.URL.RawQuery,
+			"path":       r.URL.Path,
+		},
+	})
+
+	if !s.authorize(w, r) {
+		return
+	}
+
+	if monitorId != "" && !slices.Contains(s.monitorIds, monitorId) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusNotFound)
+		_ = json.NewEncoder(w).Encode(HttpCommonError{Error: "monitor not found"})
+		return
+	}
+
+	query := r.URL.Query()
+	filter := AlertDeliveryFilter{
+		MonitorID: monitorId,
+		Provider:  query.Get("provider"),
+		State:     AlertDeliveryState(query.Get("state")),
+	}
+
+	switch filter.State {
+	case "", AlertDeliveryStatePending, AlertDeliveryStateDelivered, AlertDeliveryStateFailed:
+	default:
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		_ = json.NewEncoder(w).Encode(HttpCommonError{Error: "state must be one of pending, delivered or failed"})
+		return
+	}
+
+	if value := query.Get("from"); value != "" {
+		parsed, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			_ = json.NewEncoder(w).Encode(HttpCommonError{Error: "from must be a RFC 3339 timestamp"})
+			return
+		}
+		filter.From = parsed
+	}
+
+	if value := query.Get("to"); value != "" {
+		parsed, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			_ = json.NewEncoder(w).Encode(HttpCommonError{Error: "to must be a RFC 3339 timestamp"})
+			return
+		}
+		filter.To = parsed
+	}
+
+	if value := query.Get("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed <= 0 || parsed > 1000 {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			_ = json.NewEncoder(w).Encode(HttpCommonError{Error: "limit must be a number between 1 and 1000"})
+			return
+		}
+		filter.Limit = parsed
+	}
+
+	deliveries, err := s.AlertOutbox.Read(ctx, filter)
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		_ = json.NewEncoder(w).Encode(HttpCommonError{Error: fmt.Sprintf("failed to read alert deliveries: %s", err)})
+		sentry.GetHubFromContext(ctx).CaptureException(err)
+		return
+	}
+
+	if deliveries == nil {
+		deliveries = []AlertDelivery{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(deliveries)
+}
+
+// AcknowledgeOutage acknowledges the ongoing outage of a monitor, which stops its escalations and reminders.
+func (s *Server) AcknowledgeOutage(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	monitorId := chi.URLParam(r, "id")
+
+	// Add breadcrumb for request
+	sentry.AddBreadcrumb(&sentry.Breadcrumb{
+		Category: "http",
+		Message:  "Handling outage acknowledgement",
+		Level:    sentry.LevelInfo,
+		Data: map[string]interface{}{
+			"monitor_id": monitorId,
+			"path":       r.URL.Path,
+		},
+	})
+
+	if !s.authorize(w, r) {
+		return
+	}
+
+	if !slices.Contains(s.monitorIds, monitorId) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusNotFound)
+		_ = json.NewEncoder(w).Encode(HttpCommonError{Error: "monitor not found"})
+		return
+	}
+
+	var request struct {
+		AcknowledgedBy string `json:"acknowledged_by"`
+		Comment        string `json:"comment"`
+	}
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		_ = json.NewEncoder(w).Encode(HttpCommonError{Error: fmt.Sprintf("failed to decode request body: %s", err)})
+		return
+	}
+
+	if strings.TrimSpace(request.AcknowledgedBy) == "" {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		_ = json.NewEncoder(w).Encode(HttpCommonError{Error: "acknowledged_by is required"})
+		return
+	}
+
+	acknowledgement, err := s.Acknowledger.Acknowledge(ctx, monitorId, request.AcknowledgedBy, AcknowledgementSourceAPI, request.Comment)
+	if err != nil {
+		if errors.Is(err, ErrNotDown) {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusConflict)
+			_ = json.NewEncoder(w).Encode(HttpCommonError{Error: "monitor is not down"})
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		_ = json.NewEncoder(w).Encode(HttpCommonError{Error: fmt.Sprintf("failed to acknowledge outage: %s", err)})
+		sentry.GetHubFromContext(ctx).CaptureException(err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	_ = json.NewEncoder(w).Encode(acknowledgement)
+}
+
+// AcknowledgementHistory returns who acknowledged the outages of a monitor, from the newest to the oldest.
+func (s *Server) AcknowledgementHistory(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	monitorId := chi.URLParam(r, "id")
+
+	// Add breadcrumb for request
+	sentry.AddBreadcrumb(&sentry.Breadcrumb{
+		Category: "http",
+		Message:  "Handling acknowledgement history request",
+		Level:    sentry.LevelInfo,
+		Data: map[string]interface{}{
+			"monitor_id": monitorId,
+			"query":      r.URL.RawQuery,
+			"path":       r.URL.Path,
+		},
+	})
+
+	if !s.authorize(w, r) {
+		return
+	}
+
+	if !slices.Contains(s.monitorIds, monitorId) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusNotFound)
+		_ = json.NewEncoder(w).Encode(HttpCommonError{Error: "monitor not found"})
+		return
+	}
+
+	var limit int
+	if value := r.URL.Query().Get("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed <= 0 || parsed > 1000 {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			_ = json.NewEncoder(w).Encode(HttpCommonError{Error: "limit must be a number between 1 and 1000"})
+			return
+		}
+		limit = parsed
+	}
+
+	acknowledgements, err := s.Acknowledger.Read(ctx, monitorId, limit)
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		_ = json.NewEncoder(w).Encode(HttpCommonError{Error: fmt.Sprintf("failed to read acknowledgements: %s", err)})
+		sentry.GetHubFromContext(ctx).CaptureException(err)
+		return
+	}
+
+	if acknowledgements == nil {
+		acknowledgements = []Acknowledgement{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(acknowledgements)
+}
+
+// maxArchiveRange limits the range of an archive request, so a single request does not read the whole archive.
+// Longer ranges can be copied back into the database with the import-archive command instead.
+const maxArchiveRange = 31 * 24 * time.Hour
+
+func (s *Server) MonitorArchive(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	monitorId := chi.URLParam(r, "id")
+
+	// Add breadcrumb for request
+	sentry.AddBreadcrumb(&sentry.Breadcrumb{
+		Category: "http",
+		Message:  "Handling monitor archive request",
+		Level:    sentry.LevelInfo,
+		Data: map[string]interface{}{
+			"monitor_id": monitorId,
+			"query":      r.URL.RawQuery,
+			"path":       r.URL.Path,
+		},
+	})
+
+	if !s.authorize(w, r) {
+		return
+	}
+
+	if s.Archive == nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusNotFound)
+		_ = json.NewEncoder(w).Encode(HttpCommonError{Error: "archive is not enabled"})
+		return
+	}
+
+	monitor, found := s.findMonitor(monitorId)
+	if !found {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusNotFound)
+		_ = json.NewEncoder(w).Encode(HttpCommonError{Error: "monitor not found"})
+		return
+	}
+
+	query := r.URL.Query()
+
+	// By default, we show the first checks of the last 30 days.
+	to := time.Now().UTC()
+	if value := query.Get("to"); value != "" {
+		parsed, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			_ = json.NewEncoder(w).Encode(HttpCommonError{Error: "to must be a RFC 3339 timestamp"})
+			return
+		}
+		to = parsed
+	}
+
+	from := to.AddDate(0, 0, -30)
+	if value := query.Get("from"); value != "" {
+		parsed, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			_ = json.NewEncoder(w).Encode(HttpCommonError{Error: "from must be a RFC 3339 timestamp"})
+			return
+		}
+		from = parsed
+	}
+
+	if !to.After(from) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		_ = json.NewEncoder(w).Encode(HttpCommonError{Error: "to must be after from"})
+		return
+	}
+
+	if to.Sub(from) > maxArchiveRange {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		_ = json.NewEncoder(w).Encode(HttpCommonError{Error: "the range must be at most 31 days"})
+		return
+	}
+
+	limit := 1000
+	if value := query.Get("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed <= 0 || parsed > 10000 {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			_ = json.NewEncoder(w).Encode(HttpCommonError{Error: "limit must be a number between 1 and 10000"})
+			return
+		}
+		limit = parsed
+	}
+
+	historicals, err := s.Archive.Read(ctx, monitorId, from, to, limit)
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		_ = json.NewEncoder(w).Encode(HttpCommonError{Error: fmt.Sprintf("failed to read archive: %s", err)})
+		sentry.GetHubFromContext(ctx).CaptureException(err)
+		return
+	}
+
+	if historicals == nil {
+		historicals = []MonitorHistorical{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(MonitorArchiveResponse{
+		Metadata:   monitor,
+		From:       from.UTC(),
+		To:         to.UTC(),
+		Historical: historicals,
+	})
+}
+
+func (s *Server) ExportData(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	query := r.URL.Query()
+
+	// Add breadcrumb for request
+	sentry.AddBreadcrumb(&sentry.Breadcrumb{
+		Category: "http",
+		Message:  "Handling data export request",
+		Level:    sentry.LevelInfo,
+		Data: map[string]interface{}{
+			"query": r.URL.RawQuery,
+			"path":  r.URL.Path,
+		},
+	})
+
+	if !s.authorize(w, r) {
+		return
+	}
+
+	table := query.Get("table")
+	if table == "" {
+		table = "monitor_historical"
+	}
+
+	format := ExportFormatCSV
+	if value := query.Get("format"); value != "" {
+		parsed, err := ParseExportFormat(value)
+		if err != nil {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			_ = json.NewEncoder(w).Encode(HttpCommonError{Error: err.Error()})
+			return
+		}
+		format = parsed
+	}
+
+	var filter ExportFilter
+	if value := query.Get("monitor"); value != "" {
+		filter.MonitorIDs = strings.Split(value, ",")
+	}
+
+	if value := query.Get("from"); value != "" {
+		parsed, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			_ = json.NewEncoder(w).Encode(HttpCommonError{Error: "from must be a RFC 3339 timestamp"})
+			return
+		}
+		filter.From = parsed
+	}
+
+	if value := query.Get("to"); value != "" {
+		parsed, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			_ = json.NewEncoder(w).Encode(HttpCommonError{Error: "to must be a RFC 3339 timestamp"})
+			return
+		}
+		filter.To = parsed
+	}
+
+	if _, err := findExportTable(table); err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		_ = json.NewEncoder(w).Encode(HttpCommonError{Error: err.Error()})
+		return
+	}
+
+	// The rows are streamed, so an error after the first row can only be reported by cutting the response short.
+	w.Header().Set("Content-Type", format.ContentType())
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", table+"."+string(format)))
+	w.WriteHeader(http.StatusOK)
+	_, err := s.Exporter.Export(ctx, w, table, format, filter)
+	if err != nil {
+		log.Error().Err(err).Str("table", table).Msg("failed to export data")
+		sentry.GetHubFromContext(ctx).CaptureException(err)
+	}
+}
+
+// maxImportBodySize limits the size of an import request, in bytes. Larger files can be imported with
+// the import command instead.
+const maxImportBodySize = 512 * 1024 * 1024
+
+func (s *Server) ImportData(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	query := r.URL.Query()
+
+	// Add breadcrumb for request
+	sentry.AddBreadcrumb(&sentry.Breadcrumb{
+		Category: "http",
+		Message:  "Handling data import request",
+		Level:    sentry.LevelInfo,
+		Data: map[string]interface{}{
+			"query": r.URL.RawQuery,
+			"path":  r.URL.Path,
+		},
+	})
+
+	if !s.authorize(w, r) {
+		return
+	}
+
+	table := query.Get("table")
+	if table == "" {
+		table = "monitor_historical"
+	}
+
+	format := ExportFormatCSV
+	if value := query.Get("format"); value != "" {
+		parsed, err := ParseExportFormat(value)
+		if err != nil {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			_ = json.NewEncoder(w).Encode(HttpCommonError{Error: err.Error()})
+			return
+		}
+		format = parsed
+	}
+
+	if _, err := findExportTable(table); err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		_ = json.NewEncoder(w).Encode(HttpCommonError{Error: err.Error()})
+		return
+	}
+
+	imported, err := s.Exporter.Import(ctx, http.MaxBytesReader(w, r.Body, maxImportBodySize), table, format)
+	if err != nil {
+		statusCode := http.StatusBadRequest
+		var maxBytesError *http.MaxBytesError
+		if errors.As(err, &maxBytesError) {
+			statusCode = http.StatusRequestEntityTooLarge
+		}
+
+		// The rows before the failing one have been imported already.
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(statusCode)
+		_ = json.NewEncoder(w).Encode(ImportResponse{Table: table, Imported: imported, Error: err.Error()})
+		sentry.GetHubFromContext(ctx).CaptureException(err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(ImportResponse{Table: table, Imported: imported})
+}
+
+// authorize checks the X-API-Key header of requests that read or write the whole database. Unlike incident
+// submission, these endpoints are disabled when no API key is configured.
+func (s *Server) authorize(w http.ResponseWriter, r *http.Request) bool {
+	if s.APIKey == "" {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusForbidden)
+		_ = json.NewEncoder(w).Encode(HttpCommonError{Error: "API_KEY must be configured to use this endpoint"})
+		return false
+	}
+
+	apiKey := r.Header.Get("X-API-Key")
+	if apiKey == "" {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusUnauthorized)
+		_ = json.NewEncoder(w).Encode(HttpCommonError{Error: "X-API-Key is required"})
+		return false
+	}
+
+	if subtle.ConstantTimeCompare([]byte(apiKey), []byte(s.APIKey)) != 1 {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusUnauthorized)
+		_ = json.NewEncoder(w).Encode(HttpCommonError{Error: "invalid X-API-Key"})
+		return false
+	}
+
+	return true
+}
+
+// findMonitor returns the monitor with the given unique ID from the configuration.
+func (s *Server) findMonitor(monitorId string) (Monitor, bool) {
+	for _, monitor := range s.Monitors {
+		if monitor.UniqueID == monitorId {
+			return monitor, true
+		}
+	}
+
+	return Monitor{}, false
+}
@@ -25,6 +25,45 @@ type StaticSnapshotResponse struct {
 	Historical []MonitorHistorical `json:"historical"`
 }
 
+// LatestStatusResponse represents the response for /api/status endpoint.
+// State is null if the monitor has not been checked yet.
+type LatestStatusResponse struct {
+	Metadata Monitor       `json:"metadata"`
+	State    *MonitorState `json:"state"`
+}
+
+// MonitorSeriesResponse represents the response for /api/v1/monitors/{id}/series endpoint
+type MonitorSeriesResponse struct {
+	Metadata Monitor               `json:"metadata"`
+	From     time.Time             `json:"from"`
+	To       time.Time             `json:"to"`
+	Step     string                `json:"step"`
+	Buckets  []MonitorSeriesBucket `json:"buckets"`
+}
+
+// MonitorArchiveResponse represents the response for /api/v1/monitors/{id}/archive endpoint
+type MonitorArchiveResponse struct {
+	Metadata   Monitor             `json:"metadata"`
+	From       time.Time           `json:"from"`
+	To         time.Time           `json:"to"`
+	Historical []MonitorHistorical `json:"historical"`
+}
+
+// ImportResponse represents the response for /api/v1/import endpoint
+type ImportResponse struct {
+	Table    string `json:"table"`
+	Imported int64  `json:"imported"`
+	Error    string `json:"error,omitempty"`
+}
+
+// MonitorUptimeResponse represents the response for /api/v1/monitors/{id}/uptime endpoint
+type MonitorUptimeResponse struct {
+	Metadata Monitor             `json:"metadata"`
+	Windows  []UptimeReport      `json:"windows"`
+	Months   []UptimeReport      `json:"months"`
+	Calendar []UptimeCalendarDay `json:"calendar"`
+}
+
 // MonitorHistoricalResponse represents a single monitor historical data point
 type MonitorHistoricalResponse struct {
 	MonitorID string        `json:"monitor_id"`
@@ -24,10 +24,11 @@ func TestNewServer(t *testing.T) {
 		Hostname:                "localhost",
 		Port:                    "8080",
 		StaticPath:              "/tmp/test-static",
-		MonitorHistoricalReader: &main.MonitorHistoricalReader{},
-		MonitorHistoricalWriter: &main.MonitorHistoricalWriter{},
+		MonitorHistoricalReader: main.NewMemoryStorage(),
+		MonitorHistoricalWriter: main.NewMemoryStorage(),
 		CentralBroker:           &main.Broker[main.MonitorHistorical]{},
-		IncidentWriter:          &main.IncidentWriter{},
+		MonitorStates:           main.NewMonitorStateStore(0),
+		IncidentStorage:         main.NewMemoryStorage(),
 		MonitorList:             []main.Monitor{},
 		ApiKey:                  "test-key",
 	}
@@ -41,7 +42,7 @@ func TestServer_SnapshotOverview(t *testing.T) {
 	t.Skip()
 	// Create a test server with mock dependencies
 	server := &main.Server{
-		HistoricalReader: &main.MonitorHistoricalReader{},
+		HistoricalReader: main.NewMemoryStorage(),
 		Monitors: []main.Monitor{
 			{UniqueID: "test-1", Name: "Test Monitor 1"},
 			{UniqueID: "test-2", Name: "Test Monitor 2"},
@@ -72,8 +73,8 @@ func TestServer_SnapshotOverview(t *testing.T) {
 func TestServer_SubmitIncident(t *testing.T) {
 	// Create a test server with mock dependencies
 	server := &main.Server{
-		IncidentWriter: main.NewIncidentWriter(database),
-		APIKey:         "test-key",
+		Incidents: main.NewSQLStorage(database, nil),
+		APIKey:    "test-key",
 	}
 
 	// Create test incident data
@@ -103,6 +104,41 @@ func TestServer_SubmitIncident(t *testing.T) {
 	testutils.AssertEqual(t, http.StatusOK, w.Code, "HTTP status code should be OK")
 }
 
+func TestServer_MonitorArchive_Unauthorized(t *testing.T) {
+	archive, err := main.NewArchive(database, t.TempDir())
+	testutils.AssertNoError(t, err, "Failed to create archive")
+
+	tests := []struct {
+		name       string
+		apiKey     string
+		header     string
+		wantStatus int
+	}{
+		{name: "missing API key", apiKey: "secret", wantStatus: http.StatusUnauthorized},
+		{name: "invalid API key", apiKey: "secret", header: "wrong", wantStatus: http.StatusUnauthorized},
+		{name: "API key not configured", header: "secret", wantStatus: http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := main.NewServer(main.ServerConfig{
+				MonitorList: []main.Monitor{{UniqueID: "archive-api-monitor"}},
+				Archive:     archive,
+				ApiKey:      tt.apiKey,
+			})
+
+			request := httptest.NewRequest(http.MethodGet, "/api/v1/monitors/archive-api-monitor/archive", nil)
+			if tt.header != "" {
+				request.Header.Set("X-API-Key", tt.header)
+			}
+			recorder := httptest.NewRecorder()
+			server.Handler.ServeHTTP(recorder, request)
+
+			testutils.AssertEqual(t, tt.wantStatus, recorder.Code, "Unexpected status code")
+		})
+	}
+}
+
 func TestServer_SPAHandler(t *testing.T) {
 	// Create a temporary directory for static files
 	tempDir, err := os.MkdirTemp("", "test-static")
@@ -158,13 +194,11 @@ func TestServer_PushHealthcheck(t *testing.T) {
 
 	// Create a real processor with mock dependencies
 	processor := &main.Processor{
-		TelegramAlertProvider: mockAlerter,
-		DiscordAlertProvider:  mockAlerter,
-		HTTPAlertProvider:     mockAlerter,
-		SlackAlertProvider:    mockAlerter,
-		HistoricalWriter:      main.NewMonitorHistoricalWriter(database),
-		HistoricalReader:      main.NewMonitorHistoricalReader(database),
-		CentralBroker:         main.NewBroker[main.MonitorHistorical](),
+		AlertRouter:      newMockAlertRouter(t, main.AlertRouterConfig{}, map[string]*MockAlerter{"mock": mockAlerter}),
+		HistoricalWriter: main.NewMonitorHistoricalWriter(database),
+		HistoricalReader: main.NewMonitorHistoricalReader(database),
+		CentralBroker:    main.NewBroker[main.MonitorHistorical](),
+		States:           main.NewMonitorStateStore(0),
 	}
 
 	// Create server with test monitors and processor
@@ -174,7 +208,7 @@ func TestServer_PushHealthcheck(t *testing.T) {
 		HistoricalWriter: main.NewMonitorHistoricalWriter(database),
 		HistoricalReader: main.NewMonitorHistoricalReader(database),
 		CentralBroker:    main.NewBroker[main.MonitorHistorical](),
-		IncidentWriter:   main.NewIncidentWriter(database),
+		Incidents:        main.NewSQLStorage(database, nil),
 		APIKey:           "",
 	}
 
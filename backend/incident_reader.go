@@ -82,7 +82,7 @@ func (r *IncidentDataReader) ReadIncidentByTimestamp(ctx context.Context, incide
 	var incidentDetail Incident
 	err = dbCon.
 		QueryRowContext(ctx, "SELECT monitor_id, title, description, timestamp, severity, status FROM incident_data WHERE monitor_id = ? AND title = ? AND timestamp = ?", monitorID, incidentTitle, timestamp).
-		Scan(incidentDetail.MonitorID, incidentDetail.Title, incidentDetail.Description, incidentDetail.Timestamp, incidentDetail.Severity, incidentDetail.Status)
+		Scan(&incidentDetail.MonitorID, &incidentDetail.Title, &incidentDetail.Description, &incidentDetail.Timestamp, &incidentDetail.Severity, &incidentDetail.Status)
 	if err != nil {
 		return Incident{}, err
 	}
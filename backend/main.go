@@ -79,6 +79,38 @@ func main() {
 		log.Warn().Msg("API_KEY is not set")
 	}
 
+	spoolPath, ok := os.LookupEnv("SPOOL_PATH")
+	if !ok {
+		spoolPath = "../spool"
+	}
+
+	var spoolMaxSize int64 = defaultHistoricalSpoolMaxSize
+	if value, ok := os.LookupEnv("SPOOL_MAX_SIZE_MB"); ok {
+		parsed, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			log.Fatal().Err(err).Msg("failed to parse spool max size")
+		}
+		spoolMaxSize = parsed * 1024 * 1024
+	}
+
+	batchMaxSize := defaultBatchMaxSize
+	if value, ok := os.LookupEnv("BATCH_MAX_SIZE"); ok {
+		parsed, err := strconv.Atoi(value)
+		if err != nil {
+			log.Fatal().Err(err).Msg("failed to parse batch max size")
+		}
+		batchMaxSize = parsed
+	}
+
+	batchFlushInterval := defaultBatchFlushInterval
+	if value, ok := os.LookupEnv("BATCH_FLUSH_INTERVAL"); ok {
+		parsed, err := time.ParseDuration(value)
+		if err != nil {
+			log.Fatal().Err(err).Msg("failed to parse batch flush interval")
+		}
+		batchFlushInterval = parsed
+	}
+
 	enableDumpFailureResponse := false
 	if value, ok := os.LookupEnv("ENABLE_DUMP_FAILURE_RESPONSE"); ok {
 		enableDumpFailureResponse, _ = strconv.ParseBool(value)
@@ -135,9 +167,25 @@ func main() {
 	}
 
 	var connector driver.Connector
+	// batchDB is used by the batch writer. For DuckDB, it is opened from the DuckDB connector directly,
+	// since the Appender API needs the underlying DuckDB connection.
+	var batchDB *sql.DB
 	// If the dbPath has `clickhouse://` or `http://` prefix, we use clickhouse by parsing the DSN and using the clickhouse-go driver
-	// to create a new `database/sql` compatible connector. Otherwise, we use the duckdb driver by using the `dbPath` as is.
-	if strings.HasPrefix(dbPath, "clickhouse://") || strings.HasPrefix(dbPath, "http://") {
+	// to create a new `database/sql` compatible connector. If it has `postgres://` or `postgresql://` prefix, we use PostgreSQL
+	// through pgx. Otherwise, we use the duckdb driver by using the `dbPath` as is.
+	useClickHouse := strings.HasPrefix(dbPath, "clickhouse://") || strings.HasPrefix(dbPath, "http://")
+	usePostgres := strings.HasPrefix(dbPath, "postgres://") || strings.HasPrefix(dbPath, "postgresql://")
+	if usePostgres {
+		postgresConnector, err := NewPostgresConnector(dbPath)
+		if err != nil {
+			log.Fatal().Err(err).Msg("failed to create postgres connector")
+		}
+
+		connector = sqltracer.NewSentrySQLConnector(
+			postgresConnector,
+			sqltracer.WithDatabaseSystem("postgresql"),
+		)
+	} else if useClickHouse {
 		clickHouseOptions, err := clickhouse.ParseDSN(dbPath)
 		if err != nil {
 			log.Fatal().Err(err).Msg("failed to parse clickhouse DSN")
@@ -155,6 +203,8 @@ func main() {
 			log.Fatal().Err(err).Msg("failed to create duckdb connector")
 		}
 
+		batchDB = sql.OpenDB(connector)
+
 		connector = sqltracer.NewSentrySQLConnector(
 			connector,
 			sqltracer.WithDatabaseSystem("duckdb"),
@@ -171,60 +221,217 @@ func main() {
 		}
 	}(db)
 
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
-	defer cancel()
+	if batchDB == nil {
+		batchDB = db
+	} else {
+		defer func(db *sql.DB) {
+			err := db.Close()
+			if err != nil {
+				log.Warn().Err(err).Msg("failed to close database")
+			}
+		}(batchDB)
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		commandCtx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+		err = RunMigrateCommand(commandCtx, db, os.Args[2:])
+		stop()
+		if err != nil {
+			log.Fatal().Err(err).Msg("failed to run migrate command")
+		}
+
+		return
+	}
 
-	err = Migrate(db, ctx, true)
+	// Every startup phase gets its own deadline, so a slow phase does not eat into the ones after it
+	migrateCtx, migrateCancel := context.WithTimeout(context.Background(), time.Second*10)
+	err = Migrate(db, migrateCtx, true)
+	migrateCancel()
 	if err != nil {
 		log.Fatal().Err(err).Msg("failed to migrate database")
 	}
 
-	monitorHistoricalReader := NewMonitorHistoricalReader(db)
-	monitorHistoricalWriter := NewMonitorHistoricalWriter(db)
+	if usePostgres {
+		// Folding the existing raw data into the continuous aggregates may take longer than the migrations
+		timescaleCtx, timescaleCancel := context.WithTimeout(context.Background(), time.Minute*10)
+		timescale, err := EnableTimescale(timescaleCtx, db)
+		timescaleCancel()
+		if err != nil {
+			log.Warn().Err(err).Msg("failed to enable timescaledb, continuing with plain tables")
+		} else if timescale {
+			log.Info().Msg("timescaledb is enabled")
+		}
+	}
+
+	maintenanceSchedule, err := NewMaintenanceSchedule(config.MaintenanceWindows, config.Monitors)
+	if err != nil {
+		log.Fatal().Err(err).Msg("failed to parse maintenance windows")
+	}
+
+	var archive *Archive
+	if config.ArchiveDirectory != "" {
+		if useClickHouse || usePostgres {
+			log.Warn().Msg("archiving is only supported on DuckDB, ignoring the archive directory")
+		} else {
+			archive, err = NewArchive(db, config.ArchiveDirectory)
+			if err != nil {
+				log.Fatal().Err(err).Msg("failed to open archive")
+			}
+		}
+	}
+
+	storage := NewSQLStorage(db, archive)
+	monitorHistoricalBatchWriter := NewMonitorHistoricalBatchWriter(MonitorHistoricalBatchWriterConfig{
+		DB:            batchDB,
+		MaxBatchSize:  batchMaxSize,
+		FlushInterval: batchFlushInterval,
+	})
 	centralBroker := NewBroker[MonitorHistorical]()
 
-	aggregateWorker := NewAggregateWorker(monitorIds, monitorHistoricalReader, monitorHistoricalWriter)
+	hydrateCtx, hydrateCancel := context.WithTimeout(context.Background(), time.Second*10)
+	monitorStates := NewMonitorStateStore(0)
+	err = monitorStates.Hydrate(hydrateCtx, storage, config.Monitors)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to hydrate monitor states")
+		sentry.CaptureException(err)
+	}
+
+	outageStore := NewOutageStore(db)
+	outageTracker := NewOutageTracker(outageStore)
+	err = outageTracker.Hydrate(hydrateCtx)
+	hydrateCancel()
+	if err != nil {
+		log.Error().Err(err).Msg("failed to hydrate ongoing outages")
+		sentry.CaptureException(err)
+	}
+
+	historicalSpool, err := NewHistoricalSpool(spoolPath, spoolMaxSize)
+	if err != nil {
+		log.Fatal().Err(err).Msg("failed to open historical spool")
+	}
+
+	for _, monitor := range config.Monitors {
+		monitorIds = append(monitorIds, monitor.UniqueID)
+	}
+
+	aggregateWorker := NewAggregateWorker(config.Monitors, storage.MonitorHistoricalReader, storage.MonitorHistoricalWriter, NewAggregateWatermarkStore(db), config.Retention)
+
+	if len(os.Args) > 1 {
+		commandCtx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+		err = RunCommand(commandCtx, os.Args[1:], CommandDependencies{
+			Monitors:        config.Monitors,
+			AggregateWorker: aggregateWorker,
+			Archive:         archive,
+			Exporter:        NewHistoricalExporter(db, aggregateWorker),
+		})
+		stop()
+		if err != nil {
+			log.Fatal().Err(err).Msg("failed to run command")
+		}
+
+		return
+	}
 
 	processor := &Processor{
-		HistoricalWriter: monitorHistoricalWriter,
-		HistoricalReader: monitorHistoricalReader,
+		HistoricalWriter: monitorHistoricalBatchWriter,
+		HistoricalReader: storage,
 		CentralBroker:    centralBroker,
+		States:           monitorStates,
+		Spool:            historicalSpool,
+		Maintenance:      maintenanceSchedule,
+		Outages:          outageTracker,
 	}
 
-	// Initialize alert providers if enabled
-	if config.Alerting.Telegram.Enabled && config.Alerting.Telegram.URL != "" && config.Alerting.Telegram.ChatID != "" {
-		processor.TelegramAlertProvider = NewTelegramAlertProvider(TelegramProviderConfig{
-			Url:        config.Alerting.Telegram.URL,
-			ChatID:     config.Alerting.Telegram.ChatID,
-			HttpClient: httpClient,
-		})
+	alertProviders, err := NewAlertProviders(config.Alerting, httpClient)
+	if err != nil {
+		log.Fatal().Err(err).Msg("failed to configure alert providers")
 	}
 
-	if config.Alerting.Discord.Enabled && config.Alerting.Discord.WebhookURL != "" {
-		processor.DiscordAlertProvider = NewDiscordAlertProvider(DiscordProviderConfig{
-			WebhookURL: config.Alerting.Discord.WebhookURL,
-			HttpClient: httpClient,
-		})
+	alertOutbox := NewAlertOutbox(db)
+	processor.AlertRouter, err = NewAlertRouter(AlertRouterConfig{
+		Providers:     alertProviders,
+		Defaults:      config.Alerting.DefaultProviders,
+		Monitors:      config.Monitors,
+		StatusPageURL: config.Alerting.StatusPageURL,
+		Outbox:        alertOutbox,
+		ChatOps:       config.Alerting.ChatOps,
+	})
+	if err != nil {
+		log.Fatal().Err(err).Msg("failed to configure alert routing")
 	}
 
-	if config.Alerting.HTTP.Enabled && config.Alerting.HTTP.WebhookURL != "" {
-		processor.HTTPAlertProvider = NewHTTPAlertProvider(HTTPProviderConfig{
-			WebhookURL: config.Alerting.HTTP.WebhookURL,
-			HttpClient: httpClient,
-		})
+	processor.Escalations, err = NewEscalator(EscalatorConfig{
+		Policies: config.Alerting.EscalationPolicies,
+		Monitors: config.Monitors,
+		Router:   processor.AlertRouter,
+		Store:    NewEscalationStore(db),
+	})
+	if err != nil {
+		log.Fatal().Err(err).Msg("failed to configure escalation policies")
 	}
 
-	if config.Alerting.Slack.Enabled && config.Alerting.Slack.WebhookURL != "" {
-		processor.SlackAlertProvider = NewSlackAlertProvider(SlackProviderConfig{
-			WebhookURL: config.Alerting.Slack.WebhookURL,
-			HttpClient: httpClient,
-		})
+	processor.AlertRules, err = NewAlertRules(AlertRulesConfig{
+		Rules:       config.Alerting.Rules,
+		Grouping:    config.Alerting.Grouping,
+		Monitors:    config.Monitors,
+		Router:      processor.AlertRouter,
+		Store:       NewPendingAlertStore(db),
+		Escalations: processor.Escalations,
+	})
+	if err != nil {
+		log.Fatal().Err(err).Msg("failed to configure alert rules")
+	}
+
+	restoreCtx, restoreCancel := context.WithTimeout(context.Background(), time.Second*10)
+	ongoingOutages, err := outageStore.Read(restoreCtx, OutageFilter{Ongoing: true, Limit: 10000})
+	if err != nil {
+		log.Error().Err(err).Msg("failed to read ongoing outages")
+		sentry.CaptureException(err)
+	}
+	err = processor.Escalations.Hydrate(restoreCtx, ongoingOutages, config.Monitors, time.Now().UTC())
+	if err != nil {
+		log.Error().Err(err).Msg("failed to restore escalations")
+		sentry.CaptureException(err)
+	}
+	err = processor.AlertRules.Hydrate(restoreCtx)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to restore held and grouped alerts")
+		sentry.CaptureException(err)
+	}
+
+	acknowledger := NewAcknowledger(NewAcknowledgementStore(db), outageStore, processor.Escalations)
+	err = acknowledger.Hydrate(restoreCtx, ongoingOutages)
+	restoreCancel()
+	if err != nil {
+		log.Error().Err(err).Msg("failed to restore acknowledgements")
+		sentry.CaptureException(err)
+	}
+
+	var chatOps *ChatOps
+	if config.Alerting.ChatOps != (ChatOpsConfig{}) {
+		chatOps, err = NewChatOps(config.Alerting.ChatOps, acknowledger, config.Monitors, processor.AlertRouter, httpClient)
+		if err != nil {
+			log.Fatal().Err(err).Msg("failed to configure chat-ops")
+		}
+	}
+
+	alertOutboxWorker, err := NewAlertOutboxWorker(alertOutbox, processor.AlertRouter, config.Alerting.Delivery)
+	if err != nil {
+		log.Fatal().Err(err).Msg("failed to configure alert delivery")
+	}
+
+	sloTracker, err := NewSLOTracker(SLOTrackerConfig{
+		Objectives: config.SLOs,
+		Monitors:   config.Monitors,
+		Reader:     storage,
+		Alerter:    processor,
+	})
+	if err != nil {
+		log.Fatal().Err(err).Msg("failed to parse slos")
 	}
 
 	// Create a new worker
 	for _, monitor := range config.Monitors {
-		monitorIds = append(monitorIds, monitor.UniqueID)
-
 		worker, err := NewWorker(monitor, processor, enableDumpFailureResponse)
 		if err != nil {
 			log.Fatal().Err(err).Msg("Failed to create worker")
@@ -249,9 +456,15 @@ func main() {
 
 	go aggregateWorker.RunDailyAggregate(ctx)
 	go aggregateWorker.RunHourlyAggregate(ctx)
+	go monitorHistoricalBatchWriter.Run(ctx)
+	go historicalSpool.Run(ctx, storage, aggregateWorker)
+	go sloTracker.Run(ctx)
+	go alertOutboxWorker.Run(ctx)
+	go processor.Escalations.Run(ctx)
+	go processor.AlertRules.Run(ctx)
 
 	// Initialize cleanup worker
-	cleanupWorker := NewCleanupWorker(db, config.RetentionPeriod)
+	cleanupWorker := NewCleanupWorker(storage, config.Retention, config.Monitors, alertOutbox)
 	go cleanupWorker.Run(ctx)
 
 	server := NewServer(ServerConfig{
@@ -260,11 +473,22 @@ func main() {
 		Hostname:                hostname,
 		Port:                    port,
 		StaticPath:              staticPath,
-		MonitorHistoricalReader: monitorHistoricalReader,
-		MonitorHistoricalWriter: monitorHistoricalWriter,
+		MonitorHistoricalReader: storage,
+		MonitorHistoricalWriter: storage,
 		CentralBroker:           centralBroker,
-		IncidentWriter:          NewIncidentWriter(db),
+		IncidentStorage:         storage,
 		MonitorList:             config.Monitors,
+		Processor:               processor,
+		MonitorStates:           monitorStates,
+		Maintenance:             maintenanceSchedule,
+		SLOTracker:              sloTracker,
+		OutageStore:             outageStore,
+		AlertOutbox:             alertOutbox,
+		Acknowledger:            acknowledger,
+		ChatOps:                 chatOps,
+		Archive:                 archive,
+		HistoricalExporter:      NewHistoricalExporter(db, aggregateWorker),
+		MetricsCollector:        []MetricsCollector{historicalSpool, monitorHistoricalBatchWriter},
 		ApiKey:                  apiKey,
 	})
 	go func() {
@@ -32,6 +32,13 @@ func TestMain(m *testing.M) {
 		}
 
 		connector = clickhouse.Connector(clickHouseOptions)
+	} else if strings.HasPrefix(databasePath, "postgres://") || strings.HasPrefix(databasePath, "postgresql://") {
+		connector, err = main.NewPostgresConnector(databasePath)
+		if err != nil {
+			log.Error().Err(err).Msg("failed to create postgres connector")
+			os.Exit(1)
+			return
+		}
 	} else {
 		connector, err = duckdb.NewConnector(databasePath, func(execer driver.ExecerContext) error {
 			return nil
@@ -66,3 +73,60 @@ func TestMain(m *testing.M) {
 
 	os.Exit(exitCode)
 }
+
+// materializedAggregates reports whether the aggregate tables of the test database are views over aggregates
+// that the database maintains by itself, so they can not be written by the tests.
+func materializedAggregates(t *testing.T) bool {
+	t.Helper()
+
+	conn, err := database.Conn(t.Context())
+	if err != nil {
+		t.Fatalf("failed to get connection: %v", err)
+	}
+	defer func() {
+		_ = conn.Close()
+	}()
+
+	dialect, err := main.DetectDialect(t.Context(), conn)
+	if err != nil {
+		t.Fatalf("failed to detect dialect: %v", err)
+	}
+
+	materialized, err := main.MaterializedAggregates(t.Context(), conn, dialect)
+	if err != nil {
+		t.Fatalf("failed to detect materialized aggregates: %v", err)
+	}
+
+	return materialized
+}
+
+// skipIfMaterializedAggregates skips tests that write the aggregate tables directly.
+func skipIfMaterializedAggregates(t *testing.T) {
+	t.Helper()
+
+	if materializedAggregates(t) {
+		t.Skip("the aggregates are maintained by the database")
+	}
+}
+
+// skipUnlessDuckDB skips tests of features that are only available on DuckDB.
+func skipUnlessDuckDB(t *testing.T) {
+	t.Helper()
+
+	conn, err := database.Conn(t.Context())
+	if err != nil {
+		t.Fatalf("failed to get connection: %v", err)
+	}
+	defer func() {
+		_ = conn.Close()
+	}()
+
+	dialect, err := main.DetectDialect(t.Context(), conn)
+	if err != nil {
+		t.Fatalf("failed to detect dialect: %v", err)
+	}
+
+	if dialect != main.DialectDuckDB {
+		t.Skip("only available on DuckDB")
+	}
+}
@@ -0,0 +1,282 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"time"
+
+	"github.com/robfig/cron/v3"
+	"github.com/teambition/rrule-go"
+)
+
+// MaintenanceWindow describes a period of time where one or more monitors are expected to be unavailable.
+// A window is either a one-off window (Start and End are set), or a recurring window (Cron or RRule is set,
+// alongside the Duration of each occurrence).
+type MaintenanceWindow struct {
+	// ID specifies the unique identifier of the maintenance window.
+	ID string `json:"id" yaml:"id" toml:"id"`
+	// Title specifies the display name of the maintenance window (e.g., "Weekly database maintenance").
+	Title string `json:"title" yaml:"title" toml:"title"`
+	// Description specifies what is going on during the maintenance window. This is optional.
+	Description string `json:"description" yaml:"description" toml:"description"`
+	// MonitorIDs specifies the list of monitor's UniqueID that are affected by the maintenance window.
+	MonitorIDs []string `json:"monitor_ids" yaml:"monitor_ids" toml:"monitor_ids"`
+	// Groups specifies the list of monitor groups that are affected by the maintenance window.
+	// Every monitor that has the same Group value will be affected.
+	Groups []string `json:"groups" yaml:"groups" toml:"groups"`
+	// Start specifies the start time of a one-off maintenance window. For RRule based windows,
+	// Start is used as the DTSTART value if the rule does not provide one.
+	Start time.Time `json:"start" yaml:"start" toml:"start"`
+	// End specifies the end time of a one-off maintenance window.
+	End time.Time `json:"end" yaml:"end" toml:"end"`
+	// Cron specifies a standard 5-field cron expression (e.g., "0 2 * * 0" for every Sunday at 02:00)
+	// that marks the start of each occurrence of a recurring maintenance window.
+	Cron string `json:"cron" yaml:"cron" toml:"cron"`
+	// RRule specifies an RFC 5545 recurrence rule (e.g., "FREQ=WEEKLY;BYDAY=SU;BYHOUR=2;BYMINUTE=0;BYSECOND=0")
+	// that marks the start of each occurrence of a recurring maintenance window.
+	RRule string `json:"rrule" yaml:"rrule" toml:"rrule"`
+	// Duration specifies how long each occurrence of a recurring maintenance window lasts,
+	// in Go's duration format (e.g., "2h", "90m").
+	Duration string `json:"duration" yaml:"duration" toml:"duration"`
+	// Timezone specifies the IANA timezone that is used to evaluate Cron and RRule. Defaults to UTC.
+	Timezone string `json:"timezone" yaml:"timezone" toml:"timezone"`
+}
+
+func (w MaintenanceWindow) Validate() error {
+	validationError := NewValidationError()
+
+	if w.ID == "" {
+		validationError.AddIssue("id", "id is required")
+	}
+
+	if len(w.MonitorIDs) == 0 && len(w.Groups) == 0 {
+		validationError.AddIssue("monitor_ids", "either monitor_ids or groups must be set")
+	}
+
+	if w.Cron != "" && w.RRule != "" {
+		validationError.AddIssue("cron", "cron and rrule cannot be set at the same time")
+	}
+
+	if w.Cron == "" && w.RRule == "" {
+		if w.Start.IsZero() || w.End.IsZero() {
+			validationError.AddIssue("start", "start and end are required for a one-off maintenance window")
+		} else if !w.End.After(w.Start) {
+			validationError.AddIssue("end", "end must be after start")
+		}
+	} else {
+		duration, err := time.ParseDuration(w.Duration)
+		if err != nil || duration <= 0 {
+			validationError.AddIssue("duration", "duration must be a valid positive duration for a recurring maintenance window")
+		}
+	}
+
+	if w.Timezone != "" {
+		if _, err := time.LoadLocation(w.Timezone); err != nil {
+			validationError.AddIssue("timezone", fmt.Sprintf("invalid timezone: %s", err))
+		}
+	}
+
+	if validationError.HasIssues() {
+		return validationError
+	}
+
+	return nil
+}
+
+// MaintenanceOccurrence is a single, concrete occurrence of a MaintenanceWindow.
+type MaintenanceOccurrence struct {
+	ID          string    `json:"id"`
+	Title       string    `json:"title"`
+	Description string    `json:"description,omitempty"`
+	MonitorIDs  []string  `json:"monitor_ids"`
+	Start       time.Time `json:"start"`
+	End         time.Time `json:"end"`
+	Active      bool      `json:"active"`
+}
+
+type maintenanceEntry struct {
+	window     MaintenanceWindow
+	monitorIDs []string
+	duration   time.Duration
+	cron       cron.Schedule
+	rrule      *rrule.RRule
+}
+
+// occurrenceAt returns the start time of the occurrence that covers the given time, if any.
+func (e maintenanceEntry) occurrenceAt(at time.Time) (time.Time, bool) {
+	switch {
+	case e.cron != nil:
+		// An occurrence [start, start+duration) covers `at` if and only if its start is within (at-duration, at].
+		start := e.cron.Next(at.Add(-e.duration))
+		if start.IsZero() || start.After(at) {
+			return time.Time{}, false
+		}
+		return start, true
+	case e.rrule != nil:
+		start := e.rrule.Before(at, true)
+		if start.IsZero() || !at.Before(start.Add(e.duration)) {
+			return time.Time{}, false
+		}
+		return start, true
+	default:
+		if at.Before(e.window.Start) || !at.Before(e.window.End) {
+			return time.Time{}, false
+		}
+		return e.window.Start, true
+	}
+}
+
+// occurrencesBetween returns the start time of every occurrence that overlaps with [from, to).
+func (e maintenanceEntry) occurrencesBetween(from, to time.Time) []time.Time {
+	var starts []time.Time
+	switch {
+	case e.cron != nil:
+		for start := e.cron.Next(from.Add(-e.duration)); !start.IsZero() && start.Before(to); start = e.cron.Next(start) {
+			starts = append(starts, start)
+		}
+	case e.rrule != nil:
+		starts = e.rrule.Between(from.Add(-e.duration), to, false)
+	default:
+		if e.window.Start.Before(to) && e.window.End.After(from) {
+			starts = append(starts, e.window.Start)
+		}
+	}
+
+	return starts
+}
+
+func (e maintenanceEntry) end(start time.Time) time.Time {
+	if e.cron == nil && e.rrule == nil {
+		return e.window.End
+	}
+
+	return start.Add(e.duration)
+}
+
+func (e maintenanceEntry) occurrence(start time.Time, now time.Time) MaintenanceOccurrence {
+	end := e.end(start)
+	return MaintenanceOccurrence{
+		ID:          e.window.ID,
+		Title:       e.window.Title,
+		Description: e.window.Description,
+		MonitorIDs:  e.monitorIDs,
+		Start:       start.UTC(),
+		End:         end.UTC(),
+		Active:      !now.Before(start) && now.Before(end),
+	}
+}
+
+// MaintenanceSchedule resolves the configured maintenance windows into concrete occurrences
+// per monitor. It is safe for concurrent use as it is never modified after creation.
+type MaintenanceSchedule struct {
+	entries []maintenanceEntry
+}
+
+// NewMaintenanceSchedule validates and parses the maintenance windows. Groups are resolved against
+// the given monitors, so a maintenance window only needs to be matched by the monitor ID afterward.
+func NewMaintenanceSchedule(windows []MaintenanceWindow, monitors []Monitor) (*MaintenanceSchedule, error) {
+	schedule := &MaintenanceSchedule{}
+	for _, window := range windows {
+		if err := window.Validate(); err != nil {
+			return nil, fmt.Errorf("invalid maintenance window %q: %w", window.ID, err)
+		}
+
+		location := time.UTC
+		if window.Timezone != "" {
+			// Validate has made sure that the timezone is loadable
+			location, _ = time.LoadLocation(window.Timezone)
+		}
+
+		entry := maintenanceEntry{window: window}
+		entry.monitorIDs = append(entry.monitorIDs, window.MonitorIDs...)
+		for _, monitor := range monitors {
+			if monitor.Group != "" && slices.Contains(window.Groups, monitor.Group) && !slices.Contains(entry.monitorIDs, monitor.UniqueID) {
+				entry.monitorIDs = append(entry.monitorIDs, monitor.UniqueID)
+			}
+		}
+
+		if window.Cron != "" || window.RRule != "" {
+			// Validate has made sure that the duration is parseable
+			entry.duration, _ = time.ParseDuration(window.Duration)
+		}
+
+		if window.Cron != "" {
+			// CRON_TZ is robfig/cron's way of evaluating the expression in a specific timezone.
+			cronSchedule, err := cron.ParseStandard("CRON_TZ=" + location.String() + " " + window.Cron)
+			if err != nil {
+				return nil, fmt.Errorf("invalid cron expression for maintenance window %q: %w", window.ID, err)
+			}
+			entry.cron = cronSchedule
+		}
+
+		if window.RRule != "" {
+			option, err := rrule.StrToROptionInLocation(window.RRule, location)
+			if err != nil {
+				return nil, fmt.Errorf("invalid rrule for maintenance window %q: %w", window.ID, err)
+			}
+
+			if option.Dtstart.IsZero() {
+				if window.Start.IsZero() {
+					return nil, fmt.Errorf("invalid rrule for maintenance window %q: start or DTSTART is required", window.ID)
+				}
+				option.Dtstart = window.Start.In(location)
+			}
+
+			recurrence, err := rrule.NewRRule(*option)
+			if err != nil {
+				return nil, fmt.Errorf("invalid rrule for maintenance window %q: %w", window.ID, err)
+			}
+			entry.rrule = recurrence
+		}
+
+		schedule.entries = append(schedule.entries, entry)
+	}
+
+	return schedule, nil
+}
+
+// IsUnderMaintenance returns true if the monitor has an ongoing maintenance at the given time.
+func (s *MaintenanceSchedule) IsUnderMaintenance(monitorID string, at time.Time) bool {
+	if s == nil {
+		return false
+	}
+
+	for _, entry := range s.entries {
+		if !slices.Contains(entry.monitorIDs, monitorID) {
+			continue
+		}
+
+		if _, ok := entry.occurrenceAt(at); ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Occurrences returns every maintenance occurrence that overlaps with [from, to), sorted by its start time.
+// If monitorID is empty, occurrences for every monitor are returned.
+func (s *MaintenanceSchedule) Occurrences(monitorID string, from, to time.Time) []MaintenanceOccurrence {
+	if s == nil {
+		return nil
+	}
+
+	now := time.Now()
+	var occurrences []MaintenanceOccurrence
+	for _, entry := range s.entries {
+		if monitorID != "" && !slices.Contains(entry.monitorIDs, monitorID) {
+			continue
+		}
+
+		for _, start := range entry.occurrencesBetween(from, to) {
+			occurrences = append(occurrences, entry.occurrence(start, now))
+		}
+	}
+
+	sort.SliceStable(occurrences, func(i, j int) bool {
+		return occurrences[i].Start.Before(occurrences[j].Start)
+	})
+
+	return occurrences
+}
@@ -0,0 +1,172 @@
+package main_test
+
+import (
+	"testing"
+	"time"
+
+	main "semyi"
+	"semyi/testutils"
+)
+
+func TestMaintenanceWindow_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		window  main.MaintenanceWindow
+		wantErr bool
+	}{
+		{
+			name: "valid one-off window",
+			window: main.MaintenanceWindow{
+				ID:         "one-off",
+				MonitorIDs: []string{"monitor-1"},
+				Start:      time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC),
+				End:        time.Date(2025, 1, 1, 2, 0, 0, 0, time.UTC),
+			},
+		},
+		{
+			name: "valid cron window",
+			window: main.MaintenanceWindow{
+				ID:       "weekly",
+				Groups:   []string{"database"},
+				Cron:     "0 2 * * 0",
+				Duration: "2h",
+				Timezone: "Asia/Jakarta",
+			},
+		},
+		{
+			name: "missing targets",
+			window: main.MaintenanceWindow{
+				ID:    "no-targets",
+				Start: time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC),
+				End:   time.Date(2025, 1, 1, 2, 0, 0, 0, time.UTC),
+			},
+			wantErr: true,
+		},
+		{
+			name: "end before start",
+			window: main.MaintenanceWindow{
+				ID:         "backwards",
+				MonitorIDs: []string{"monitor-1"},
+				Start:      time.Date(2025, 1, 1, 2, 0, 0, 0, time.UTC),
+				End:        time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC),
+			},
+			wantErr: true,
+		},
+		{
+			name: "recurring without duration",
+			window: main.MaintenanceWindow{
+				ID:         "no-duration",
+				MonitorIDs: []string{"monitor-1"},
+				Cron:       "0 2 * * 0",
+			},
+			wantErr: true,
+		},
+		{
+			name: "both cron and rrule",
+			window: main.MaintenanceWindow{
+				ID:         "both",
+				MonitorIDs: []string{"monitor-1"},
+				Cron:       "0 2 * * 0",
+				RRule:      "FREQ=DAILY",
+				Duration:   "1h",
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.window.Validate()
+			if tt.wantErr {
+				testutils.AssertError(t, err, "Expected validation error")
+			} else {
+				testutils.AssertNoError(t, err, "Expected no validation error")
+			}
+		})
+	}
+}
+
+func TestMaintenanceSchedule_IsUnderMaintenance(t *testing.T) {
+	monitors := []main.Monitor{
+		{UniqueID: "db-1", Group: "database"},
+		{UniqueID: "db-2", Group: "database"},
+		{UniqueID: "web-1", Group: "web"},
+	}
+
+	schedule, err := main.NewMaintenanceSchedule([]main.MaintenanceWindow{
+		{
+			ID:         "one-off",
+			MonitorIDs: []string{"web-1"},
+			Start:      time.Date(2025, 3, 10, 10, 0, 0, 0, time.UTC),
+			End:        time.Date(2025, 3, 10, 11, 0, 0, 0, time.UTC),
+		},
+		{
+			// Every Sunday at 02:00 in Jakarta, which is Saturday 19:00 UTC
+			ID:       "weekly-database",
+			Groups:   []string{"database"},
+			Cron:     "0 2 * * 0",
+			Duration: "2h",
+			Timezone: "Asia/Jakarta",
+		},
+		{
+			ID:         "daily-rrule",
+			MonitorIDs: []string{"web-1"},
+			RRule:      "FREQ=DAILY;BYHOUR=23;BYMINUTE=30;BYSECOND=0",
+			Start:      time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC),
+			Duration:   "30m",
+		},
+	}, monitors)
+	testutils.AssertNoError(t, err, "Failed to create maintenance schedule")
+
+	tests := []struct {
+		name      string
+		monitorID string
+		at        time.Time
+		expected  bool
+	}{
+		{"one-off start is inclusive", "web-1", time.Date(2025, 3, 10, 10, 0, 0, 0, time.UTC), true},
+		{"one-off end is exclusive", "web-1", time.Date(2025, 3, 10, 11, 0, 0, 0, time.UTC), false},
+		{"one-off does not affect other monitors", "db-1", time.Date(2025, 3, 10, 10, 30, 0, 0, time.UTC), false},
+		{"cron window by group", "db-1", time.Date(2025, 3, 15, 19, 30, 0, 0, time.UTC), true},
+		{"cron window by group for second monitor", "db-2", time.Date(2025, 3, 15, 20, 59, 0, 0, time.UTC), true},
+		{"cron window is over", "db-1", time.Date(2025, 3, 15, 21, 0, 0, 0, time.UTC), false},
+		{"cron window on another day", "db-1", time.Date(2025, 3, 14, 19, 30, 0, 0, time.UTC), false},
+		{"rrule window", "web-1", time.Date(2025, 3, 12, 23, 45, 0, 0, time.UTC), true},
+		{"rrule window is over", "web-1", time.Date(2025, 3, 13, 0, 0, 0, 0, time.UTC), false},
+		{"unknown monitor", "unknown", time.Date(2025, 3, 15, 19, 30, 0, 0, time.UTC), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			testutils.AssertEqual(t, tt.expected, schedule.IsUnderMaintenance(tt.monitorID, tt.at), "Unexpected maintenance state")
+		})
+	}
+}
+
+func TestMaintenanceSchedule_Occurrences(t *testing.T) {
+	schedule, err := main.NewMaintenanceSchedule([]main.MaintenanceWindow{
+		{
+			ID:         "weekly",
+			MonitorIDs: []string{"monitor-1"},
+			Cron:       "0 2 * * 0",
+			Duration:   "2h",
+		},
+	}, nil)
+	testutils.AssertNoError(t, err, "Failed to create maintenance schedule")
+
+	// March 2025 has 5 Sundays
+	occurrences := schedule.Occurrences("monitor-1", time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC), time.Date(2025, 4, 1, 0, 0, 0, 0, time.UTC))
+	testutils.AssertEqual(t, 5, len(occurrences), "Expected 5 occurrences")
+	testutils.AssertEqual(t, time.Date(2025, 3, 2, 2, 0, 0, 0, time.UTC), occurrences[0].Start, "Unexpected first occurrence start")
+	testutils.AssertEqual(t, time.Date(2025, 3, 2, 4, 0, 0, 0, time.UTC), occurrences[0].End, "Unexpected first occurrence end")
+
+	// An occurrence that started before `from` but is still ongoing should be included
+	occurrences = schedule.Occurrences("monitor-1", time.Date(2025, 3, 2, 3, 0, 0, 0, time.UTC), time.Date(2025, 3, 3, 0, 0, 0, 0, time.UTC))
+	testutils.AssertEqual(t, 1, len(occurrences), "Expected the ongoing occurrence")
+
+	occurrences = schedule.Occurrences("monitor-2", time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC), time.Date(2025, 4, 1, 0, 0, 0, 0, time.UTC))
+	testutils.AssertEqual(t, 0, len(occurrences), "Expected no occurrences for another monitor")
+
+	var nilSchedule *main.MaintenanceSchedule
+	testutils.AssertFalse(t, nilSchedule.IsUnderMaintenance("monitor-1", time.Now()), "Nil schedule should never be under maintenance")
+}
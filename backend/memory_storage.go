@@ -0,0 +1,385 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"math"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+)
+
+// MemoryStorage is a Storage that keeps everything in memory. It is meant for tests and for trying out
+// Semyi, since nothing survives a restart. The aggregates are computed the same way as on the SQL storage.
+type MemoryStorage struct {
+	mutex sync.RWMutex
+	// raw, hourly and daily hold the historical data of every monitor, from the oldest to the newest.
+	raw    map[string][]MonitorHistorical
+	hourly map[string][]MonitorHistorical
+	daily  map[string][]MonitorHistorical
+	// incidents is kept in the order the incidents were written.
+	incidents []Incident
+}
+
+var _ Storage = (*MemoryStorage)(nil)
+
+// NewMemoryStorage creates an empty MemoryStorage.
+func NewMemoryStorage() *MemoryStorage {
+	return &MemoryStorage{
+		raw:    make(map[string][]MonitorHistorical),
+		hourly: make(map[string][]MonitorHistorical),
+		daily:  make(map[string][]MonitorHistorical),
+	}
+}
+
+func (s *MemoryStorage) Write(ctx context.Context, historical MonitorHistorical) error {
+	valid, err := historical.Validate()
+	if err != nil {
+		return err
+	}
+	if !valid {
+		return nil
+	}
+
+	historical.Timestamp = EnsureUTC(historical.Timestamp)
+	historical.Aggregate = nil
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.raw[historical.MonitorID] = insertSortedHistorical(s.raw[historical.MonitorID], historical, false)
+	return nil
+}
+
+func (s *MemoryStorage) WriteHourly(ctx context.Context, historical MonitorHistorical) error {
+	return s.writeAggregate(s.hourly, historical)
+}
+
+func (s *MemoryStorage) WriteDaily(ctx context.Context, historical MonitorHistorical) error {
+	return s.writeAggregate(s.daily, historical)
+}
+
+func (s *MemoryStorage) writeAggregate(table map[string][]MonitorHistorical, historical MonitorHistorical) error {
+	valid, err := historical.Validate()
+	if err != nil {
+		return err
+	}
+	if !valid {
+		return nil
+	}
+
+	historical.Timestamp = EnsureUTC(historical.Timestamp)
+	if historical.Aggregate != nil {
+		// Aggregates written without statistics are read back as nil, same as on the SQL storage
+		statistics := *historical.Aggregate
+		historical.Aggregate = nil
+		if statistics.CheckCount != 0 {
+			historical.Aggregate = &statistics
+		}
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	table[historical.MonitorID] = insertSortedHistorical(table[historical.MonitorID], historical, true)
+	return nil
+}
+
+// insertSortedHistorical inserts the historical data while keeping the slice sorted by timestamp. If replace is
+// true, an entry with the same timestamp is replaced instead.
+func insertSortedHistorical(historicals []MonitorHistorical, historical MonitorHistorical, replace bool) []MonitorHistorical {
+	index := sort.Search(len(historicals), func(i int) bool {
+		return !historicals[i].Timestamp.Before(historical.Timestamp)
+	})
+
+	if replace && index < len(historicals) && historicals[index].Timestamp.Equal(historical.Timestamp) {
+		historicals[index] = historical
+		return historicals
+	}
+
+	// Raw data with the same timestamp is kept in the order it was written
+	for !replace && index < len(historicals) && historicals[index].Timestamp.Equal(historical.Timestamp) {
+		index++
+	}
+
+	return slices.Insert(historicals, index, historical)
+}
+
+func (s *MemoryStorage) DeleteAggregates(ctx context.Context, monitorId string, interval AggregateInterval, from time.Time, to time.Time) error {
+	table := s.hourly
+	if interval == AggregateIntervalDay {
+		table = s.daily
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	table[monitorId] = slices.DeleteFunc(table[monitorId], func(historical MonitorHistorical) bool {
+		return !historical.Timestamp.Before(from) && historical.Timestamp.Before(to)
+	})
+	return nil
+}
+
+func (s *MemoryStorage) ReadRawHistorical(ctx context.Context, monitorId string, limitResults bool) ([]MonitorHistorical, error) {
+	return s.readNewest(s.raw, monitorId, limitResults), nil
+}
+
+func (s *MemoryStorage) ReadHourlyHistorical(ctx context.Context, monitorId string, limitResults bool) ([]MonitorHistorical, error) {
+	return s.readNewest(s.hourly, monitorId, limitResults), nil
+}
+
+func (s *MemoryStorage) ReadDailyHistorical(ctx context.Context, monitorId string, limitResults bool) ([]MonitorHistorical, error) {
+	return s.readNewest(s.daily, monitorId, limitResults), nil
+}
+
+// readNewest returns the historical data of a monitor from the newest to the oldest, limited to the
+// latest 100 entries if limitResults is true.
+func (s *MemoryStorage) readNewest(table map[string][]MonitorHistorical, monitorId string, limitResults bool) []MonitorHistorical {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	historicals := table[monitorId]
+	count := len(historicals)
+	if limitResults {
+		count = min(count, 100)
+	}
+
+	var newest []MonitorHistorical
+	for i := len(historicals) - 1; i >= len(historicals)-count; i-- {
+		newest = append(newest, historicals[i])
+	}
+
+	return newest
+}
+
+func (s *MemoryStorage) ReadRawLatest(ctx context.Context, monitorId string) (MonitorHistorical, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	historicals := s.raw[monitorId]
+	if len(historicals) == 0 {
+		return MonitorHistorical{}, fmt.Errorf("failed to read latest raw historical data: %w", sql.ErrNoRows)
+	}
+
+	return historicals[len(historicals)-1], nil
+}
+
+func (s *MemoryStorage) ReadRawOldestTimestamp(ctx context.Context, monitorId string) (time.Time, bool, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	historicals := s.raw[monitorId]
+	if len(historicals) == 0 {
+		return time.Time{}, false, nil
+	}
+
+	return historicals[0].Timestamp, true, nil
+}
+
+func (s *MemoryStorage) ReadRawStatuses(ctx context.Context, monitorId string, from time.Time, to time.Time, fn func(timestamp time.Time, status MonitorStatus) error) error {
+	for _, historical := range s.readRange(monitorId, from, to) {
+		if err := fn(historical.Timestamp, historical.Status); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// readRange returns a copy of the raw historical data of a monitor within [from, to), from the oldest to the newest.
+func (s *MemoryStorage) readRange(monitorId string, from time.Time, to time.Time) []MonitorHistorical {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	var historicals []MonitorHistorical
+	for _, historical := range s.raw[monitorId] {
+		if !historical.Timestamp.Before(from) && historical.Timestamp.Before(to) {
+			historicals = append(historicals, historical)
+		}
+	}
+
+	return historicals
+}
+
+func (s *MemoryStorage) ReadAggregate(ctx context.Context, monitorId string, interval AggregateInterval, from time.Time, to time.Time) ([]MonitorHistorical, error) {
+	buckets := aggregateHistoricals(monitorId, s.readRange(monitorId, from, to), interval.Truncate)
+
+	aggregates := make([]MonitorHistorical, len(buckets))
+	for i, bucket := range buckets {
+		aggregates[i] = bucket.historical
+	}
+
+	return aggregates, nil
+}
+
+func (s *MemoryStorage) ReadSeries(ctx context.Context, monitorId string, from time.Time, to time.Time, step SeriesStep) ([]MonitorSeriesBucket, error) {
+	if count := step.BucketCount(from, to); count > maxSeriesBuckets {
+		return nil, fmt.Errorf("too many buckets, the range must contain at most %d steps", maxSeriesBuckets)
+	}
+
+	origin := step.Truncate(from)
+	buckets := aggregateHistoricals(monitorId, s.readRange(monitorId, origin, to), step.Truncate)
+	return newSeries(buckets, origin, to, step), nil
+}
+
+func (s *MemoryStorage) ReadSLOCheckCounts(ctx context.Context, monitorId string, from time.Time, to time.Time, latencyThreshold int64) (SLOCheckCounts, error) {
+	var counts SLOCheckCounts
+	for _, historical := range s.readRange(monitorId, from, to) {
+		switch historical.Status {
+		case MonitorStatusUnderMaintenance:
+			continue
+		case MonitorStatusFailure:
+			counts.Failed++
+		default:
+			counts.Succeeded++
+			if historical.Latency > latencyThreshold {
+				counts.Slow++
+			}
+		}
+
+		counts.Checked++
+	}
+
+	return counts, nil
+}
+
+// aggregateHistoricals groups the raw historical data, sorted from the oldest to the newest, into buckets
+// that start at the given function of their timestamp. It mirrors MonitorHistoricalReader.readBuckets.
+func aggregateHistoricals(monitorId string, historicals []MonitorHistorical, bucketStart func(t time.Time) time.Time) []aggregateBucket {
+	var buckets []aggregateBucket
+	for start := 0; start < len(historicals); {
+		bucketTime := bucketStart(historicals[start].Timestamp)
+		end := start
+		for end < len(historicals) && bucketStart(historicals[end].Timestamp).Equal(bucketTime) {
+			end++
+		}
+
+		buckets = append(buckets, aggregateBucket{})
+		bucket := &buckets[len(buckets)-1]
+		bucket.statusCounts = make(map[MonitorStatus]int64)
+
+		latencies := make([]float64, 0, end-start)
+		var latencySum float64
+		historical := MonitorHistorical{MonitorID: monitorId, Timestamp: bucketTime}
+		for _, raw := range historicals[start:end] {
+			bucket.statusCounts[raw.Status]++
+			latencies = append(latencies, float64(raw.Latency))
+			latencySum += float64(raw.Latency)
+
+			// The latest value wins, the additional message is only relevant when the check was not successful
+			if raw.Status != MonitorStatusSuccess && raw.AdditionalMessage != "" {
+				historical.AdditionalMessage = raw.AdditionalMessage
+			}
+			if raw.HttpProtocol != "" {
+				historical.HttpProtocol = raw.HttpProtocol
+			}
+			if raw.TLSVersion != "" {
+				historical.TLSVersion = raw.TLSVersion
+			}
+			if raw.TLSCipherName != "" {
+				historical.TLSCipherName = raw.TLSCipherName
+			}
+			if !raw.TLSExpiryDate.IsZero() {
+				historical.TLSExpiryDate = raw.TLSExpiryDate
+			}
+		}
+
+		slices.Sort(latencies)
+		statistics := NewAggregateStatistics(bucket.statusCounts)
+		statistics.LatencyMin = int64(latencies[0])
+		statistics.LatencyMax = int64(latencies[len(latencies)-1])
+		statistics.LatencyP50 = int64(math.Round(quantile(latencies, 0.5)))
+		statistics.LatencyP95 = int64(math.Round(quantile(latencies, 0.95)))
+		statistics.LatencyP99 = int64(math.Round(quantile(latencies, 0.99)))
+
+		historical.Status = statistics.DominantStatus
+		historical.Latency = int64(math.Round(latencySum / float64(len(latencies))))
+		if historical.Status == MonitorStatusSuccess {
+			historical.AdditionalMessage = ""
+		}
+		historical.Aggregate = &statistics
+		bucket.historical = historical
+
+		start = end
+	}
+
+	return buckets
+}
+
+// quantile returns the quantile of sorted values with linear interpolation, same as quantile_cont.
+func quantile(sorted []float64, q float64) float64 {
+	position := q * float64(len(sorted)-1)
+	lower := int(math.Floor(position))
+	upper := int(math.Ceil(position))
+	return sorted[lower] + (sorted[upper]-sorted[lower])*(position-float64(lower))
+}
+
+func (s *MemoryStorage) WriteIncident(ctx context.Context, incident Incident) error {
+	incident.Timestamp = EnsureUTC(incident.Timestamp)
+	if incident.Timestamp.After(time.Now()) {
+		incident.Status = IncidentStatusScheduled
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.incidents = append(s.incidents, incident)
+	return nil
+}
+
+func (s *MemoryStorage) ReadRelatedIncidents(ctx context.Context, incidentTitle string, monitorID string) ([]Incident, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	var incidents []Incident
+	for i := len(s.incidents) - 1; i >= 0; i-- {
+		if s.incidents[i].MonitorID == monitorID && s.incidents[i].Title == incidentTitle {
+			incidents = append(incidents, s.incidents[i])
+		}
+	}
+
+	return incidents, nil
+}
+
+func (s *MemoryStorage) ReadIncidentByTimestamp(ctx context.Context, incidentTitle string, monitorID string, timestamp time.Time) (Incident, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	for _, incident := range s.incidents {
+		if incident.MonitorID == monitorID && incident.Title == incidentTitle && incident.Timestamp.Equal(timestamp) {
+			return incident, nil
+		}
+	}
+
+	return Incident{}, sql.ErrNoRows
+}
+
+func (s *MemoryStorage) DeleteExpired(ctx context.Context, retention RetentionPolicy, overrides map[string]RetentionPolicy, now time.Time) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	tables := map[string]map[string][]MonitorHistorical{
+		"monitor_historical":                  s.raw,
+		"monitor_historical_hourly_aggregate": s.hourly,
+		"monitor_historical_daily_aggregate":  s.daily,
+	}
+
+	for _, tier := range retentionTiers {
+		table := tables[tier.table]
+		for monitorId, historicals := range table {
+			policy, ok := overrides[monitorId]
+			if !ok {
+				policy = retention
+			}
+
+			cutoffDate := now.AddDate(0, 0, -tier.days(policy))
+			table[monitorId] = slices.DeleteFunc(historicals, func(historical MonitorHistorical) bool {
+				return historical.Timestamp.Before(cutoffDate)
+			})
+		}
+	}
+
+	return nil
+}
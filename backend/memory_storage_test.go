@@ -0,0 +1,245 @@
+package main_test
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+
+	main "semyi"
+	"semyi/testutils"
+
+	"github.com/getsentry/sentry-go"
+)
+
+func TestMemoryStorage_Historical(t *testing.T) {
+	ctx := context.Background()
+	storage := main.NewMemoryStorage()
+
+	_, err := storage.ReadRawLatest(ctx, "memory-monitor")
+	testutils.AssertTrue(t, errors.Is(err, sql.ErrNoRows), "Expected sql.ErrNoRows without any data")
+
+	start := time.Date(2025, 9, 1, 10, 0, 0, 0, time.UTC)
+	for i := 0; i < 150; i++ {
+		// Written out of order, the storage keeps them sorted
+		timestamp := start.Add(time.Duration((i*37)%150) * time.Minute)
+		err := storage.Write(ctx, main.MonitorHistorical{MonitorID: "memory-monitor", Status: main.MonitorStatusSuccess, Latency: int64(i), Timestamp: timestamp})
+		testutils.AssertNoError(t, err, "Failed to write raw data")
+	}
+
+	err = storage.Write(ctx, main.MonitorHistorical{Status: main.MonitorStatusSuccess, Timestamp: start})
+	testutils.AssertError(t, err, "Expected a validation error")
+
+	historicals, err := storage.ReadRawHistorical(ctx, "memory-monitor", false)
+	testutils.AssertNoError(t, err, "Failed to read raw data")
+	testutils.AssertEqual(t, 150, len(historicals), "Expected every raw data")
+	for i := 1; i < len(historicals); i++ {
+		testutils.AssertTrue(t, historicals[i-1].Timestamp.After(historicals[i].Timestamp), "Expected the newest raw data first")
+	}
+
+	historicals, err = storage.ReadRawHistorical(ctx, "memory-monitor", true)
+	testutils.AssertNoError(t, err, "Failed to read raw data")
+	testutils.AssertEqual(t, 100, len(historicals), "Expected the latest 100 raw data")
+
+	latest, err := storage.ReadRawLatest(ctx, "memory-monitor")
+	testutils.AssertNoError(t, err, "Failed to read the latest raw data")
+	testutils.AssertTrue(t, latest.Timestamp.Equal(start.Add(149*time.Minute)), "Unexpected latest raw data")
+
+	oldest, ok, err := storage.ReadRawOldestTimestamp(ctx, "memory-monitor")
+	testutils.AssertNoError(t, err, "Failed to read the oldest timestamp")
+	testutils.AssertTrue(t, ok && oldest.Equal(start), "Unexpected oldest timestamp")
+
+	// Aggregates replace the aggregate of the same timestamp
+	for _, latency := range []int64{10, 20} {
+		err := storage.WriteHourly(ctx, main.MonitorHistorical{
+			MonitorID: "memory-monitor",
+			Status:    main.MonitorStatusSuccess,
+			Latency:   latency,
+			Timestamp: start,
+			Aggregate: &main.AggregateStatistics{CheckCount: 60},
+		})
+		testutils.AssertNoError(t, err, "Failed to write hourly aggregate")
+	}
+
+	err = storage.WriteHourly(ctx, main.MonitorHistorical{MonitorID: "memory-monitor", Status: main.MonitorStatusSuccess, Timestamp: start.Add(time.Hour)})
+	testutils.AssertNoError(t, err, "Failed to write hourly aggregate")
+
+	hourly, err := storage.ReadHourlyHistorical(ctx, "memory-monitor", true)
+	testutils.AssertNoError(t, err, "Failed to read hourly aggregates")
+	testutils.AssertEqual(t, 2, len(hourly), "Expected a single aggregate per hour")
+	testutils.AssertTrue(t, hourly[0].Aggregate == nil, "Expected nil statistics for an aggregate without statistics")
+	testutils.AssertEqual(t, int64(20), hourly[1].Latency, "Expected the aggregate to be replaced")
+
+	err = storage.DeleteAggregates(ctx, "memory-monitor", main.AggregateIntervalHour, start, start.Add(time.Hour))
+	testutils.AssertNoError(t, err, "Failed to delete aggregates")
+
+	hourly, err = storage.ReadHourlyHistorical(ctx, "memory-monitor", true)
+	testutils.AssertNoError(t, err, "Failed to read hourly aggregates")
+	testutils.AssertEqual(t, 1, len(hourly), "Expected the aggregates within the range to be deleted")
+}
+
+func TestMemoryStorage_ReadAggregate(t *testing.T) {
+	skipUnlessDuckDB(t)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	ctx = sentry.SetHubOnContext(ctx, sentry.CurrentHub())
+
+	monitorId := "memory-aggregate-monitor"
+	t.Cleanup(func() {
+		_, err := database.Exec("DELETE FROM monitor_historical WHERE monitor_id = ?", monitorId)
+		if err != nil {
+			t.Logf("Warning: failed to clean up test data: %v", err)
+		}
+	})
+
+	sqlStorage := main.NewSQLStorage(database, nil)
+	memoryStorage := main.NewMemoryStorage()
+
+	start := time.Date(2025, 9, 2, 10, 0, 0, 0, time.UTC)
+	statuses := []main.MonitorStatus{
+		main.MonitorStatusSuccess,
+		main.MonitorStatusFailure,
+		main.MonitorStatusSuccess,
+		main.MonitorStatusDegradedPerformance,
+		main.MonitorStatusUnderMaintenance,
+		main.MonitorStatusFailure,
+		main.MonitorStatusSuccess,
+	}
+	for i, status := range statuses {
+		historical := main.MonitorHistorical{
+			MonitorID:         monitorId,
+			Status:            status,
+			Latency:           int64(100 + i*i*13),
+			Timestamp:         start.Add(time.Duration(i*25) * time.Minute),
+			AdditionalMessage: "check " + status.String(),
+			HttpProtocol:      "HTTP/2.0",
+		}
+
+		for _, storage := range []main.Storage{sqlStorage, memoryStorage} {
+			err := storage.Write(ctx, historical)
+			testutils.AssertNoError(t, err, "Failed to write raw data")
+		}
+	}
+
+	// Both storages aggregate the same way
+	for _, interval := range []main.AggregateInterval{main.AggregateIntervalHour, main.AggregateIntervalDay} {
+		expected, err := sqlStorage.ReadAggregate(ctx, monitorId, interval, start, start.Add(24*time.Hour))
+		testutils.AssertNoError(t, err, "Failed to read SQL aggregates")
+
+		actual, err := memoryStorage.ReadAggregate(ctx, monitorId, interval, start, start.Add(24*time.Hour))
+		testutils.AssertNoError(t, err, "Failed to read memory aggregates")
+
+		testutils.AssertEqual(t, len(expected), len(actual), "Unexpected number of buckets")
+		for i := range expected {
+			testutils.AssertTrue(t, expected[i].Timestamp.Equal(actual[i].Timestamp), "Unexpected bucket timestamp")
+			testutils.AssertEqual(t, expected[i].Status, actual[i].Status, "Unexpected bucket status")
+			testutils.AssertEqual(t, expected[i].Latency, actual[i].Latency, "Unexpected bucket latency")
+			testutils.AssertEqual(t, expected[i].AdditionalMessage, actual[i].AdditionalMessage, "Unexpected bucket additional message")
+			testutils.AssertEqual(t, expected[i].HttpProtocol, actual[i].HttpProtocol, "Unexpected bucket HTTP protocol")
+			testutils.AssertEqual(t, *expected[i].Aggregate, *actual[i].Aggregate, "Unexpected bucket statistics")
+		}
+	}
+
+	step, err := main.ParseSeriesStep("30m")
+	testutils.AssertNoError(t, err, "Failed to parse step")
+
+	expectedSeries, err := sqlStorage.ReadSeries(ctx, monitorId, start, start.Add(4*time.Hour), step)
+	testutils.AssertNoError(t, err, "Failed to read SQL series")
+
+	actualSeries, err := memoryStorage.ReadSeries(ctx, monitorId, start, start.Add(4*time.Hour), step)
+	testutils.AssertNoError(t, err, "Failed to read memory series")
+	testutils.AssertEqual(t, len(expectedSeries), len(actualSeries), "Unexpected number of series buckets")
+	for i := range expectedSeries {
+		testutils.AssertEqual(t, expectedSeries[i].StatusRatios, actualSeries[i].StatusRatios, "Unexpected status ratios")
+		testutils.AssertEqual(t, expectedSeries[i].Latency, actualSeries[i].Latency, "Unexpected series latency")
+	}
+
+	expectedCounts, err := sqlStorage.ReadSLOCheckCounts(ctx, monitorId, start, start.Add(24*time.Hour), 200)
+	testutils.AssertNoError(t, err, "Failed to read SQL check counts")
+
+	actualCounts, err := memoryStorage.ReadSLOCheckCounts(ctx, monitorId, start, start.Add(24*time.Hour), 200)
+	testutils.AssertNoError(t, err, "Failed to read memory check counts")
+	testutils.AssertEqual(t, expectedCounts, actualCounts, "Unexpected check counts")
+}
+
+func TestMemoryStorage_DeleteExpired(t *testing.T) {
+	ctx := context.Background()
+	storage := main.NewMemoryStorage()
+	now := time.Date(2025, 9, 10, 0, 0, 0, 0, time.UTC)
+
+	for _, monitorId := range []string{"memory-default", "memory-override"} {
+		for _, days := range []int{1, 5, 20} {
+			historical := main.MonitorHistorical{MonitorID: monitorId, Status: main.MonitorStatusSuccess, Timestamp: now.AddDate(0, 0, -days)}
+			testutils.AssertNoError(t, storage.Write(ctx, historical), "Failed to write raw data")
+			testutils.AssertNoError(t, storage.WriteDaily(ctx, historical), "Failed to write daily aggregate")
+		}
+	}
+
+	err := storage.DeleteExpired(ctx, main.RetentionPolicy{Raw: 3, Hourly: 30, Daily: 30}, map[string]main.RetentionPolicy{
+		"memory-override": {Raw: 10, Hourly: 30, Daily: 2},
+	}, now)
+	testutils.AssertNoError(t, err, "Failed to delete expired data")
+
+	tests := []struct {
+		monitorId string
+		raw       int
+		daily     int
+	}{
+		{monitorId: "memory-default", raw: 1, daily: 3},
+		{monitorId: "memory-override", raw: 2, daily: 1},
+	}
+
+	for _, tt := range tests {
+		raw, err := storage.ReadRawHistorical(ctx, tt.monitorId, false)
+		testutils.AssertNoError(t, err, "Failed to read raw data")
+		testutils.AssertEqual(t, tt.raw, len(raw), "Unexpected raw data of "+tt.monitorId)
+
+		daily, err := storage.ReadDailyHistorical(ctx, tt.monitorId, false)
+		testutils.AssertNoError(t, err, "Failed to read daily aggregates")
+		testutils.AssertEqual(t, tt.daily, len(daily), "Unexpected daily aggregates of "+tt.monitorId)
+	}
+}
+
+func TestMemoryStorage_Incidents(t *testing.T) {
+	ctx := context.Background()
+	storage := main.NewMemoryStorage()
+
+	timestamp := time.Date(2025, 9, 3, 10, 0, 0, 0, time.UTC)
+	for _, description := range []string{"first", "second"} {
+		err := storage.WriteIncident(ctx, main.Incident{
+			MonitorID:   "memory-incident-monitor",
+			Title:       "Outage",
+			Description: description,
+			Timestamp:   timestamp,
+			Status:      main.IncidentStatusInvestigating,
+		})
+		testutils.AssertNoError(t, err, "Failed to write incident")
+		timestamp = timestamp.Add(time.Hour)
+	}
+
+	err := storage.WriteIncident(ctx, main.Incident{
+		MonitorID: "memory-incident-monitor",
+		Title:     "Maintenance",
+		Timestamp: time.Now().Add(time.Hour),
+		Status:    main.IncidentStatusInvestigating,
+	})
+	testutils.AssertNoError(t, err, "Failed to write incident")
+
+	incidents, err := storage.ReadRelatedIncidents(ctx, "Outage", "memory-incident-monitor")
+	testutils.AssertNoError(t, err, "Failed to read related incidents")
+	testutils.AssertEqual(t, 2, len(incidents), "Expected the incidents with the same title")
+	testutils.AssertEqual(t, "second", incidents[0].Description, "Expected the newest incident first")
+
+	incidents, err = storage.ReadRelatedIncidents(ctx, "Maintenance", "memory-incident-monitor")
+	testutils.AssertNoError(t, err, "Failed to read related incidents")
+	testutils.AssertEqual(t, main.IncidentStatusScheduled, incidents[0].Status, "Expected a future incident to be scheduled")
+
+	incident, err := storage.ReadIncidentByTimestamp(ctx, "Outage", "memory-incident-monitor", time.Date(2025, 9, 3, 10, 0, 0, 0, time.UTC))
+	testutils.AssertNoError(t, err, "Failed to read incident")
+	testutils.AssertEqual(t, "first", incident.Description, "Unexpected incident")
+
+	_, err = storage.ReadIncidentByTimestamp(ctx, "Outage", "memory-incident-monitor", time.Date(2025, 9, 3, 12, 0, 0, 0, time.UTC))
+	testutils.AssertTrue(t, errors.Is(err, sql.ErrNoRows), "Expected sql.ErrNoRows for an unknown incident")
+}
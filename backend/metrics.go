@@ -0,0 +1,71 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+type MetricType string
+
+const (
+	MetricTypeGauge   MetricType = "gauge"
+	MetricTypeCounter MetricType = "counter"
+)
+
+// Metric is a single sample in the Prometheus text exposition format.
+type Metric struct {
+	Name   string
+	Help   string
+	Type   MetricType
+	Labels map[string]string
+	Value  float64
+}
+
+// MetricsCollector is implemented by every component that exposes metrics on the /metrics endpoint.
+type MetricsCollector interface {
+	CollectMetrics(w io.Writer) error
+}
+
+// WriteMetrics writes the metrics in the Prometheus text exposition format. Metrics with the same name
+// must be passed next to each other, so the HELP and TYPE lines are only written once.
+func WriteMetrics(w io.Writer, metrics ...Metric) error {
+	var previousName string
+	for _, metric := range metrics {
+		if metric.Name != previousName {
+			_, err := fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", metric.Name, metric.Help, metric.Name, metric.Type)
+			if err != nil {
+				return err
+			}
+			previousName = metric.Name
+		}
+
+		_, err := fmt.Fprintf(w, "%s%s %s\n", metric.Name, formatMetricLabels(metric.Labels), strconv.FormatFloat(metric.Value, 'g', -1, 64))
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func formatMetricLabels(labels map[string]string) string {
+	if len(labels) == 0 {
+		return ""
+	}
+
+	keys := make([]string, 0, len(labels))
+	for key := range labels {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	pairs := make([]string, len(keys))
+	for i, key := range keys {
+		pairs[i] = key + "=" + strconv.Quote(labels[key])
+	}
+
+	return "{" + strings.Join(pairs, ",") + "}"
+}
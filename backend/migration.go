@@ -6,143 +6,519 @@ import (
 	"database/sql"
 	"embed"
 	"fmt"
+	"io/fs"
+	"slices"
 	"sort"
 	"strconv"
 	"strings"
+	"time"
 
+	"github.com/getsentry/sentry-go"
 	"github.com/rs/zerolog/log"
 )
 
-//go:embed migrations/*.sql
+//go:embed migrations/*.sql migrations/clickhouse/*.sql
 var migrationFiles embed.FS
 
-func Migrate(db *sql.DB, ctx context.Context, directionUp bool) error {
-	dir, err := migrationFiles.ReadDir("migrations")
+// migrationDirectory returns the directory of the migrations of the dialect. ClickHouse has its own
+// migrations, since it needs table engines, ordering keys and materialized views that the generic DDL
+// can not express. DuckDB and PostgreSQL share the generic migrations, which stick to standard SQL.
+func migrationDirectory(dialect Dialect) string {
+	if dialect == DialectClickHouse {
+		return "migrations/clickhouse"
+	}
+
+	return "migrations"
+}
+
+// Migration is a single embedded migration file, named <version>_<name>.sql, where the version is
+// a YYYYMMDDHHmmss timestamp.
+type Migration struct {
+	Version int64
+	Name    string
+	Up      string
+	Down    string
+	// Condition is the schema condition that the migration depends on, given by a "-- +semyi If <condition>"
+	// line, see migrationConditions. It is prefixed with "!" if the condition must not hold. A migration whose
+	// condition is not met is recorded without running it. Empty if the migration always runs.
+	Condition string
+}
+
+// migrationConditions are the conditions that migrations can depend on, by name.
+var migrationConditions = map[string]func(ctx context.Context, conn *sql.Conn, dialect Dialect) (bool, error){
+	// plain_aggregates holds if the aggregates are stored in plain tables, e.g. a ClickHouse database that
+	// was created with the generic migrations, before it had its own.
+	"plain_aggregates": func(ctx context.Context, conn *sql.Conn, dialect Dialect) (bool, error) {
+		query := "SELECT COUNT(*) FROM information_schema.tables WHERE table_name = 'monitor_historical_hourly_aggregate' AND table_type = 'BASE TABLE'"
+		if dialect == DialectClickHouse {
+			query = "SELECT count() FROM system.tables WHERE database = currentDatabase() AND name = 'monitor_historical_hourly_aggregate' AND engine != 'View'"
+		}
+
+		var count int64
+		err := conn.QueryRowContext(ctx, query).Scan(&count)
+		if err != nil {
+			return false, fmt.Errorf("failed to look up the aggregate tables: %w", err)
+		}
+
+		return count > 0, nil
+	},
+}
+
+// conditionMet reports whether the condition of the migration holds on the database.
+func (m Migration) conditionMet(ctx context.Context, conn *sql.Conn, dialect Dialect) (bool, error) {
+	if m.Condition == "" {
+		return true, nil
+	}
+
+	name, negated := strings.CutPrefix(m.Condition, "!")
+	met, err := migrationConditions[name](ctx, conn, dialect)
 	if err != nil {
-		return fmt.Errorf("failed to read migrations directory: %w", err)
+		return false, err
+	}
+
+	return met != negated, nil
+}
+
+// MigrationStatus describes whether a migration has been applied.
+type MigrationStatus struct {
+	Migration
+	Applied bool
+	// AppliedAt is zero if the migration has not been applied.
+	AppliedAt time.Time
+}
+
+// schemaMigrationsTable records the applied migrations. It is created outside the migrations, since the
+// migrations need it to know which of them are pending.
+const schemaMigrationsTable = `CREATE TABLE IF NOT EXISTS schema_migrations (
+    version BIGINT NOT NULL,
+    name VARCHAR(255) NOT NULL,
+    applied_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (version)
+)`
+
+const clickHouseSchemaMigrationsTable = `CREATE TABLE IF NOT EXISTS schema_migrations (
+    version Int64,
+    name String,
+    applied_at DateTime64(3, 'UTC')
+) ENGINE = MergeTree
+ORDER BY version`
+
+// Migrate applies every pending migration if directionUp is true, or reverts every applied migration otherwise.
+func Migrate(db *sql.DB, ctx context.Context, directionUp bool) error {
+	if directionUp {
+		return MigrateUp(ctx, db, 0)
 	}
 
-	var files []string
+	return MigrateDown(ctx, db, 0)
+}
+
+// LoadMigrations returns the embedded migrations of the dialect, ordered by version.
+func LoadMigrations(dialect Dialect) ([]Migration, error) {
+	directory := migrationDirectory(dialect)
+	dir, err := migrationFiles.ReadDir(directory)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read migrations directory: %w", err)
+	}
 
+	var migrations []Migration
 	for _, file := range dir {
 		if file.IsDir() {
 			continue
 		}
 
-		files = append(files, file.Name())
-	}
+		// The first 14 characters of the file name are the version, as YYYYMMDDHHmmss.
+		fileName := file.Name()
+		if len(fileName) < 15 || fileName[14] != '_' {
+			return nil, fmt.Errorf("invalid migration file name %q, must be <YYYYMMDDHHmmss>_<name>.sql", fileName)
+		}
 
-	sort.SliceStable(files, func(i, j int) bool {
-		// Gather the first 14 characters of the file name. Then we can parse it as YYYYMMDDHHmmss and sort by that.
-		firstFileName := files[i][:14]
-		secondFileName := files[j][:14]
+		version, err := strconv.ParseInt(fileName[:14], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid migration file name %q, must be <YYYYMMDDHHmmss>_<name>.sql", fileName)
+		}
+
+		up, err := readMigrationSection(directory+"/"+fileName, "-- +goose Up")
+		if err != nil {
+			return nil, err
+		}
 
-		firstTime, _ := strconv.ParseInt(firstFileName, 10, 64)
-		secondTime, _ := strconv.ParseInt(secondFileName, 10, 64)
+		down, err := readMigrationSection(directory+"/"+fileName, "-- +goose Down")
+		if err != nil {
+			return nil, err
+		}
 
-		return firstTime < secondTime
+		condition, err := readMigrationCondition(directory + "/" + fileName)
+		if err != nil {
+			return nil, err
+		}
+
+		if _, ok := migrationConditions[strings.TrimPrefix(condition, "!")]; condition != "" && !ok {
+			return nil, fmt.Errorf("unknown condition %q in migration file %q", condition, fileName)
+		}
+
+		migrations = append(migrations, Migration{
+			Version:   version,
+			Name:      strings.TrimSuffix(fileName[15:], ".sql"),
+			Up:        up,
+			Down:      down,
+			Condition: condition,
+		})
+	}
+
+	sort.SliceStable(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
 	})
 
-	var migrationScripts []string
-	for _, file := range files {
-		content, err := migrationFiles.Open("migrations/" + file)
+	for i := 1; i < len(migrations); i++ {
+		if migrations[i].Version == migrations[i-1].Version {
+			return nil, fmt.Errorf("duplicate migration version %d", migrations[i].Version)
+		}
+	}
+
+	return migrations, nil
+}
+
+// readMigrationSection reads from the line that has the marker until the first occurrence of
+// "-- +goose StatementEnd".
+func readMigrationSection(filePath string, marker string) (string, error) {
+	content, err := migrationFiles.Open(filePath)
+	if err != nil {
+		return "", fmt.Errorf("failed to read migration file: %w", err)
+	}
+	defer func(content fs.File) {
+		err := content.Close()
 		if err != nil {
-			if content != nil {
-				_ = content.Close()
-			}
+			log.Error().Err(err).Msg("failed to close file")
+		}
+	}(content)
 
-			return fmt.Errorf("failed to read migration file: %w", err)
-		}
-
-		var contentAccumulator strings.Builder
-		var foundStartMarker = false
-		scanner := bufio.NewScanner(content)
-		scanner.Split(bufio.ScanLines)
-		if directionUp {
-			// Read from the line that has "-- +goose Up" until the first occurrence of "-- +goose StatementEnd"
-			for scanner.Scan() {
-				line := strings.TrimSpace(scanner.Text())
-				if line == "-- +goose Up" {
-					foundStartMarker = true
-					continue
-				}
-
-				if foundStartMarker {
-					if line == "-- +goose StatementEnd" {
-						break
-					}
-
-					contentAccumulator.WriteString(line)
-					contentAccumulator.WriteString("\n")
-				}
-			}
-		} else {
-			// Read from the line that has "-- +goose Down" until the first occurrence of "-- +goose StatementEnd"
-			for scanner.Scan() {
-				line := strings.TrimSpace(scanner.Text())
-				if line == "-- +goose Down" {
-					foundStartMarker = true
-					continue
-				}
-
-				if foundStartMarker {
-					if line == "-- +goose StatementEnd" {
-						break
-					}
-
-					contentAccumulator.WriteString(line)
-					contentAccumulator.WriteString("\n")
-				}
+	var contentAccumulator strings.Builder
+	var foundStartMarker = false
+	scanner := bufio.NewScanner(content)
+	scanner.Split(bufio.ScanLines)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == marker {
+			foundStartMarker = true
+			continue
+		}
+
+		if foundStartMarker {
+			if line == "-- +goose StatementEnd" {
+				break
 			}
+
+			contentAccumulator.WriteString(line)
+			contentAccumulator.WriteString("\n")
 		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return "", fmt.Errorf("failed to read migration file: %w", err)
+	}
 
-		if err := scanner.Err(); err != nil {
-			return fmt.Errorf("failed to read migration file: %w", err)
+	return contentAccumulator.String(), nil
+}
+
+// readMigrationCondition reads the condition of the "-- +semyi If <condition>" line, if the file has one.
+func readMigrationCondition(filePath string) (string, error) {
+	content, err := migrationFiles.ReadFile(filePath)
+	if err != nil {
+		return "", fmt.Errorf("failed to read migration file: %w", err)
+	}
+
+	for line := range strings.Lines(string(content)) {
+		condition, ok := strings.CutPrefix(strings.TrimSpace(line), "-- +semyi If ")
+		if ok {
+			return strings.TrimSpace(condition), nil
 		}
+	}
 
-		err = content.Close()
+	return "", nil
+}
+
+// MigrationStatuses returns every embedded migration, and whether it has been applied.
+func MigrationStatuses(ctx context.Context, db *sql.DB) ([]MigrationStatus, error) {
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open connection: %w", err)
+	}
+	defer func() {
+		err := conn.Close()
 		if err != nil {
-			log.Error().Err(err).Msg("failed to close file")
+			log.Error().Err(err).Msg("failed to close connection")
+		}
+	}()
+
+	dialect, migrations, err := loadDialectMigrations(ctx, conn)
+	if err != nil {
+		return nil, err
+	}
+
+	applied, err := appliedMigrations(ctx, conn, dialect)
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]MigrationStatus, len(migrations))
+	for i, migration := range migrations {
+		appliedAt, ok := applied[migration.Version]
+		statuses[i] = MigrationStatus{Migration: migration, Applied: ok, AppliedAt: appliedAt}
+	}
+
+	return statuses, nil
+}
+
+// loadDialectMigrations detects the dialect of the connection and loads its migrations.
+func loadDialectMigrations(ctx context.Context, conn *sql.Conn) (Dialect, []Migration, error) {
+	dialect, err := DetectDialect(ctx, conn)
+	if err != nil {
+		return "", nil, err
+	}
+
+	migrations, err := LoadMigrations(dialect)
+	if err != nil {
+		return "", nil, err
+	}
+
+	return dialect, migrations, nil
+}
+
+// appliedMigrations returns the applied time of every applied migration, by version.
+func appliedMigrations(ctx context.Context, conn *sql.Conn, dialect Dialect) (map[int64]time.Time, error) {
+	createTable := schemaMigrationsTable
+	if dialect == DialectClickHouse {
+		createTable = clickHouseSchemaMigrationsTable
+	}
+
+	_, err := conn.ExecContext(ctx, createTable)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create schema_migrations table: %w", err)
+	}
+
+	rows, err := conn.QueryContext(ctx, "SELECT version, applied_at FROM schema_migrations")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read applied migrations: %w", err)
+	}
+	defer func() {
+		if err := rows.Close(); err != nil {
+			log.Warn().Err(err).Msg("failed to close rows")
 		}
+	}()
 
-		migrationScripts = append(migrationScripts, contentAccumulator.String())
+	applied := make(map[int64]time.Time)
+	for rows.Next() {
+		var version int64
+		var appliedAt time.Time
+		err := rows.Scan(&version, &appliedAt)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+
+		applied[version] = appliedAt.UTC()
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate rows: %w", err)
 	}
 
-	c, err := db.Conn(ctx)
+	return applied, nil
+}
+
+// MigrateUp applies the pending migrations up to and including the target version, in order.
+// A target of 0 applies every pending migration.
+func MigrateUp(ctx context.Context, db *sql.DB, target int64) error {
+	span := sentry.StartSpan(ctx, "function", sentry.WithDescription("MigrateUp"))
+	ctx = span.Context()
+	defer span.Finish()
+
+	conn, err := db.Conn(ctx)
 	if err != nil {
 		return fmt.Errorf("failed to open connection: %w", err)
 	}
 	defer func() {
-		err := c.Close()
+		err := conn.Close()
 		if err != nil {
 			log.Error().Err(err).Msg("failed to close connection")
 		}
 	}()
 
-	tx, err := c.BeginTx(ctx, &sql.TxOptions{})
+	dialect, migrations, err := loadDialectMigrations(ctx, conn)
 	if err != nil {
-		return fmt.Errorf("failed to begin transaction: %w", err)
+		return err
 	}
 
-	for _, migrationScript := range migrationScripts {
-		// We split everything by `;` and execute each statement in the transaction.
-		for statement := range strings.SplitSeq(migrationScript, ";") {
-			if strings.TrimSpace(statement) == "" {
-				continue
-			}
+	err = validateMigrationTarget(migrations, target)
+	if err != nil {
+		return err
+	}
+
+	applied, err := appliedMigrations(ctx, conn, dialect)
+	if err != nil {
+		return err
+	}
+
+	for _, migration := range migrations {
+		if target != 0 && migration.Version > target {
+			break
+		}
+
+		if _, ok := applied[migration.Version]; ok {
+			continue
+		}
+
+		met, err := migration.conditionMet(ctx, conn, dialect)
+		if err != nil {
+			return fmt.Errorf("failed to apply migration %d_%s: %w", migration.Version, migration.Name, err)
+		}
 
-			_, err = tx.ExecContext(
+		script := migration.Up
+		if !met {
+			log.Info().Int64("version", migration.Version).Str("name", migration.Name).Str("condition", migration.Condition).Msg("skipping migration whose condition is not met")
+			script = ""
+		}
+
+		err = runMigration(ctx, conn, script, func(tx *sql.Tx) error {
+			_, err := tx.ExecContext(
 				ctx,
-				statement,
+				"INSERT INTO schema_migrations (version, name, applied_at) VALUES (?, ?, ?)",
+				migration.Version,
+				migration.Name,
+				time.Now().UTC(),
 			)
-			if err != nil {
-				if e := tx.Rollback(); e != nil {
-					return fmt.Errorf("failed to rollback transaction: %w (%s)", e, err.Error())
-				}
+			return err
+		})
+		if err != nil {
+			return fmt.Errorf("failed to apply migration %d_%s: %w", migration.Version, migration.Name, err)
+		}
+
+		log.Info().Int64("version", migration.Version).Str("name", migration.Name).Msg("applied migration")
+	}
+
+	return nil
+}
+
+// MigrateDown reverts the applied migrations newer than the target version, from the newest to the oldest.
+// A target of 0 reverts every applied migration.
+func MigrateDown(ctx context.Context, db *sql.DB, target int64) error {
+	span := sentry.StartSpan(ctx, "function", sentry.WithDescription("MigrateDown"))
+	ctx = span.Context()
+	defer span.Finish()
+
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to open connection: %w", err)
+	}
+	defer func() {
+		err := conn.Close()
+		if err != nil {
+			log.Error().Err(err).Msg("failed to close connection")
+		}
+	}()
+
+	dialect, migrations, err := loadDialectMigrations(ctx, conn)
+	if err != nil {
+		return err
+	}
+
+	err = validateMigrationTarget(migrations, target)
+	if err != nil {
+		return err
+	}
+
+	applied, err := appliedMigrations(ctx, conn, dialect)
+	if err != nil {
+		return err
+	}
+
+	if dialect == DialectPostgres && slices.ContainsFunc(migrations, func(migration Migration) bool {
+		_, ok := applied[migration.Version]
+		return ok && migration.Version > target
+	}) {
+		err = disableContinuousAggregates(ctx, conn)
+		if err != nil {
+			return err
+		}
+	}
+
+	for i := len(migrations) - 1; i >= 0; i-- {
+		migration := migrations[i]
+		if migration.Version <= target {
+			break
+		}
+
+		if _, ok := applied[migration.Version]; !ok {
+			continue
+		}
+
+		met, err := migration.conditionMet(ctx, conn, dialect)
+		if err != nil {
+			return fmt.Errorf("failed to revert migration %d_%s: %w", migration.Version, migration.Name, err)
+		}
+
+		script := migration.Down
+		if !met {
+			script = ""
+		}
+
+		err = runMigration(ctx, conn, script, func(tx *sql.Tx) error {
+			_, err := tx.ExecContext(ctx, "DELETE FROM schema_migrations WHERE version = ?", migration.Version)
+			return err
+		})
+		if err != nil {
+			return fmt.Errorf("failed to revert migration %d_%s: %w", migration.Version, migration.Name, err)
+		}
+
+		log.Info().Int64("version", migration.Version).Str("name", migration.Name).Msg("reverted migration")
+	}
+
+	return nil
+}
 
-				return fmt.Errorf("failed to execute migration script: %w", err)
+func validateMigrationTarget(migrations []Migration, target int64) error {
+	if target == 0 {
+		return nil
+	}
+
+	for _, migration := range migrations {
+		if migration.Version == target {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("unknown migration version %d", target)
+}
+
+// runMigration executes the statements of a migration script and records it, within a single transaction.
+func runMigration(ctx context.Context, conn *sql.Conn, script string, record func(tx *sql.Tx) error) error {
+	tx, err := conn.BeginTx(ctx, &sql.TxOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+
+	// We split everything by `;` and execute each statement in the transaction.
+	for statement := range strings.SplitSeq(script, ";") {
+		if strings.TrimSpace(statement) == "" {
+			continue
+		}
+
+		_, err = tx.ExecContext(ctx, statement)
+		if err != nil {
+			if e := tx.Rollback(); e != nil {
+				return fmt.Errorf("failed to rollback transaction: %w (%s)", e, err.Error())
 			}
+
+			return fmt.Errorf("failed to execute migration script: %w", err)
+		}
+	}
+
+	err = record(tx)
+	if err != nil {
+		if e := tx.Rollback(); e != nil {
+			return fmt.Errorf("failed to rollback transaction: %w (%s)", e, err.Error())
 		}
+
+		return fmt.Errorf("failed to record migration: %w", err)
 	}
 
 	err = tx.Commit()
@@ -1,9 +1,13 @@
 package main_test
 
 import (
+	"database/sql"
+	"strings"
 	"testing"
 
 	"semyi"
+
+	"github.com/marcboeker/go-duckdb/v2"
 )
 
 func TestMigrate(t *testing.T) {
@@ -17,3 +21,145 @@ func TestMigrate(t *testing.T) {
 		}
 	}
 }
+
+func TestMigrateUpDown(t *testing.T) {
+	ctx := t.Context()
+
+	// A separate database, so the shared database keeps every migration applied
+	connector, err := duckdb.NewConnector("", nil)
+	if err != nil {
+		t.Fatalf("failed to create duckdb connector: %v", err)
+	}
+	db := sql.OpenDB(connector)
+	t.Cleanup(func() {
+		_ = db.Close()
+	})
+
+	migrations, err := main.LoadMigrations(main.DialectDuckDB)
+	if err != nil {
+		t.Fatalf("failed to load migrations: %v", err)
+	}
+	if len(migrations) < 3 {
+		t.Fatalf("expected at least 3 migrations, got %d", len(migrations))
+	}
+
+	countApplied := func() int {
+		statuses, err := main.MigrationStatuses(ctx, db)
+		if err != nil {
+			t.Fatalf("failed to read migration statuses: %v", err)
+		}
+
+		applied := 0
+		for _, status := range statuses {
+			if status.Applied {
+				applied++
+			}
+		}
+		return applied
+	}
+
+	tableExists := func(table string) bool {
+		var count int
+		err := db.QueryRowContext(ctx, "SELECT COUNT(*) FROM information_schema.tables WHERE table_name = ?", table).Scan(&count)
+		if err != nil {
+			t.Fatalf("failed to query tables: %v", err)
+		}
+		return count > 0
+	}
+
+	err = main.MigrateUp(ctx, db, migrations[1].Version)
+	if err != nil {
+		t.Fatalf("failed to migrate up to the second version: %v", err)
+	}
+	if applied := countApplied(); applied != 2 {
+		t.Errorf("expected 2 applied migrations, got %d", applied)
+	}
+
+	err = main.MigrateUp(ctx, db, 0)
+	if err != nil {
+		t.Fatalf("failed to migrate up: %v", err)
+	}
+	if applied := countApplied(); applied != len(migrations) {
+		t.Errorf("expected %d applied migrations, got %d", len(migrations), applied)
+	}
+
+	// Only pending migrations are applied, so running it again is a no-op
+	err = main.MigrateUp(ctx, db, 0)
+	if err != nil {
+		t.Fatalf("failed to migrate up again: %v", err)
+	}
+
+	err = main.MigrateDown(ctx, db, migrations[len(migrations)-2].Version)
+	if err != nil {
+		t.Fatalf("failed to migrate down: %v", err)
+	}
+	if applied := countApplied(); applied != len(migrations)-1 {
+		t.Errorf("expected %d applied migrations, got %d", len(migrations)-1, applied)
+	}
+
+	err = main.MigrateDown(ctx, db, 0)
+	if err != nil {
+		t.Fatalf("failed to migrate down to nothing: %v", err)
+	}
+	if applied := countApplied(); applied != 0 {
+		t.Errorf("expected no applied migrations, got %d", applied)
+	}
+	if tableExists("monitor_historical") {
+		t.Errorf("expected the monitor_historical table to be dropped")
+	}
+
+	err = main.MigrateDown(ctx, db, 12345)
+	if err == nil {
+		t.Errorf("expected an error for an unknown version")
+	}
+}
+
+func TestLoadMigrations_ClickHouse(t *testing.T) {
+	generic, err := main.LoadMigrations(main.DialectDuckDB)
+	if err != nil {
+		t.Fatalf("failed to load migrations: %v", err)
+	}
+
+	migrations, err := main.LoadMigrations(main.DialectClickHouse)
+	if err != nil {
+		t.Fatalf("failed to load ClickHouse migrations: %v", err)
+	}
+	if len(migrations) == 0 {
+		t.Fatal("expected ClickHouse migrations")
+	}
+
+	// Databases that applied the generic migrations must not apply the native ones on top
+	versions := make(map[int64]bool)
+	for _, migration := range generic {
+		versions[migration.Version] = true
+	}
+
+	for _, migration := range migrations {
+		// A migration with a condition checks the schema it runs on by itself
+		if !versions[migration.Version] && migration.Condition == "" {
+			t.Errorf("ClickHouse migration %d_%s has no generic counterpart", migration.Version, migration.Name)
+		}
+
+		if strings.TrimSpace(migration.Up) == "" || strings.TrimSpace(migration.Down) == "" {
+			t.Errorf("ClickHouse migration %d_%s must have both an up and a down section", migration.Version, migration.Name)
+		}
+
+		if strings.Contains(migration.Up, "PRIMARY KEY") {
+			t.Errorf("ClickHouse migration %d_%s should use ORDER BY instead of PRIMARY KEY", migration.Version, migration.Name)
+		}
+	}
+
+	// Databases with plain aggregate tables get the statistics columns instead of the materialized views
+	conditions := make(map[string]string)
+	for _, migration := range migrations {
+		conditions[migration.Name] = migration.Condition
+	}
+
+	if conditions["aggregate_statistics"] != "!plain_aggregates" {
+		t.Errorf("expected the materialized views to be skipped on plain aggregate tables, got condition %q", conditions["aggregate_statistics"])
+	}
+
+	if conditions["plain_aggregate_statistics"] != "plain_aggregates" {
+		t.Errorf("expected the statistics columns to be added to plain aggregate tables only, got condition %q", conditions["plain_aggregate_statistics"])
+	}
+}
@@ -0,0 +1,49 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE monitor_historical_hourly_aggregate ADD COLUMN IF NOT EXISTS check_count INTEGER DEFAULT 0;
+ALTER TABLE monitor_historical_hourly_aggregate ADD COLUMN IF NOT EXISTS failure_count INTEGER DEFAULT 0;
+ALTER TABLE monitor_historical_hourly_aggregate ADD COLUMN IF NOT EXISTS uptime_ratio DOUBLE PRECISION DEFAULT 0;
+ALTER TABLE monitor_historical_hourly_aggregate ADD COLUMN IF NOT EXISTS latency_min INTEGER DEFAULT 0;
+ALTER TABLE monitor_historical_hourly_aggregate ADD COLUMN IF NOT EXISTS latency_max INTEGER DEFAULT 0;
+ALTER TABLE monitor_historical_hourly_aggregate ADD COLUMN IF NOT EXISTS latency_p50 INTEGER DEFAULT 0;
+ALTER TABLE monitor_historical_hourly_aggregate ADD COLUMN IF NOT EXISTS latency_p95 INTEGER DEFAULT 0;
+ALTER TABLE monitor_historical_hourly_aggregate ADD COLUMN IF NOT EXISTS latency_p99 INTEGER DEFAULT 0;
+ALTER TABLE monitor_historical_hourly_aggregate ADD COLUMN IF NOT EXISTS worst_status SMALLINT DEFAULT 0;
+ALTER TABLE monitor_historical_hourly_aggregate ADD COLUMN IF NOT EXISTS dominant_status SMALLINT DEFAULT 0;
+
+ALTER TABLE monitor_historical_daily_aggregate ADD COLUMN IF NOT EXISTS check_count INTEGER DEFAULT 0;
+ALTER TABLE monitor_historical_daily_aggregate ADD COLUMN IF NOT EXISTS failure_count INTEGER DEFAULT 0;
+ALTER TABLE monitor_historical_daily_aggregate ADD COLUMN IF NOT EXISTS uptime_ratio DOUBLE PRECISION DEFAULT 0;
+ALTER TABLE monitor_historical_daily_aggregate ADD COLUMN IF NOT EXISTS latency_min INTEGER DEFAULT 0;
+ALTER TABLE monitor_historical_daily_aggregate ADD COLUMN IF NOT EXISTS latency_max INTEGER DEFAULT 0;
+ALTER TABLE monitor_historical_daily_aggregate ADD COLUMN IF NOT EXISTS latency_p50 INTEGER DEFAULT 0;
+ALTER TABLE monitor_historical_daily_aggregate ADD COLUMN IF NOT EXISTS latency_p95 INTEGER DEFAULT 0;
+ALTER TABLE monitor_historical_daily_aggregate ADD COLUMN IF NOT EXISTS latency_p99 INTEGER DEFAULT 0;
+ALTER TABLE monitor_historical_daily_aggregate ADD COLUMN IF NOT EXISTS worst_status SMALLINT DEFAULT 0;
+ALTER TABLE monitor_historical_daily_aggregate ADD COLUMN IF NOT EXISTS dominant_status SMALLINT DEFAULT 0;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE monitor_historical_hourly_aggregate DROP COLUMN IF EXISTS check_count;
+ALTER TABLE monitor_historical_hourly_aggregate DROP COLUMN IF EXISTS failure_count;
+ALTER TABLE monitor_historical_hourly_aggregate DROP COLUMN IF EXISTS uptime_ratio;
+ALTER TABLE monitor_historical_hourly_aggregate DROP COLUMN IF EXISTS latency_min;
+ALTER TABLE monitor_historical_hourly_aggregate DROP COLUMN IF EXISTS latency_max;
+ALTER TABLE monitor_historical_hourly_aggregate DROP COLUMN IF EXISTS latency_p50;
+ALTER TABLE monitor_historical_hourly_aggregate DROP COLUMN IF EXISTS latency_p95;
+ALTER TABLE monitor_historical_hourly_aggregate DROP COLUMN IF EXISTS latency_p99;
+ALTER TABLE monitor_historical_hourly_aggregate DROP COLUMN IF EXISTS worst_status;
+ALTER TABLE monitor_historical_hourly_aggregate DROP COLUMN IF EXISTS dominant_status;
+
+ALTER TABLE monitor_historical_daily_aggregate DROP COLUMN IF EXISTS check_count;
+ALTER TABLE monitor_historical_daily_aggregate DROP COLUMN IF EXISTS failure_count;
+ALTER TABLE monitor_historical_daily_aggregate DROP COLUMN IF EXISTS uptime_ratio;
+ALTER TABLE monitor_historical_daily_aggregate DROP COLUMN IF EXISTS latency_min;
+ALTER TABLE monitor_historical_daily_aggregate DROP COLUMN IF EXISTS latency_max;
+ALTER TABLE monitor_historical_daily_aggregate DROP COLUMN IF EXISTS latency_p50;
+ALTER TABLE monitor_historical_daily_aggregate DROP COLUMN IF EXISTS latency_p95;
+ALTER TABLE monitor_historical_daily_aggregate DROP COLUMN IF EXISTS latency_p99;
+ALTER TABLE monitor_historical_daily_aggregate DROP COLUMN IF EXISTS worst_status;
+ALTER TABLE monitor_historical_daily_aggregate DROP COLUMN IF EXISTS dominant_status;
+-- +goose StatementEnd
@@ -0,0 +1,15 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS aggregate_watermark (
+    monitor_id VARCHAR(255) NOT NULL,
+    tier VARCHAR(16) NOT NULL,
+    watermark TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (monitor_id, tier)
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS aggregate_watermark;
+-- +goose StatementEnd
@@ -0,0 +1,20 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS outages (
+    monitor_id VARCHAR(255) NOT NULL,
+    started_at TIMESTAMP NOT NULL,
+    ended_at TIMESTAMP,
+    duration_seconds BIGINT,
+    first_failure_message TEXT,
+    failed_checks INTEGER NOT NULL DEFAULT 0,
+    recovery_status SMALLINT,
+    recovery_latency INTEGER,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (monitor_id, started_at)
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS outages;
+-- +goose StatementEnd
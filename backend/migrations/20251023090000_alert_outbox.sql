@@ -0,0 +1,34 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS alert_outbox (
+    id VARCHAR(36) NOT NULL,
+    monitor_id VARCHAR(255) NOT NULL,
+    provider VARCHAR(255) NOT NULL,
+    message TEXT NOT NULL,
+    state VARCHAR(16) NOT NULL,
+    attempt_count INTEGER NOT NULL DEFAULT 0,
+    next_attempt_at TIMESTAMP NOT NULL,
+    last_status_code INTEGER,
+    last_error TEXT,
+    created_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (id)
+);
+
+CREATE TABLE IF NOT EXISTS alert_delivery_attempts (
+    delivery_id VARCHAR(36) NOT NULL,
+    attempt INTEGER NOT NULL,
+    attempted_at TIMESTAMP NOT NULL,
+    status_code INTEGER,
+    error TEXT,
+    success BOOLEAN NOT NULL,
+    PRIMARY KEY (delivery_id, attempt)
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS alert_delivery_attempts;
+
+DROP TABLE IF EXISTS alert_outbox;
+-- +goose StatementEnd
@@ -0,0 +1,17 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS alert_acknowledgements (
+    monitor_id VARCHAR(255) NOT NULL,
+    outage_started_at TIMESTAMP NOT NULL,
+    acknowledged_by VARCHAR(255) NOT NULL,
+    source VARCHAR(16) NOT NULL,
+    comment TEXT,
+    acknowledged_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (monitor_id, outage_started_at, acknowledged_at)
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS alert_acknowledgements;
+-- +goose StatementEnd
@@ -0,0 +1,15 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS alert_escalations (
+    monitor_id VARCHAR(255) NOT NULL,
+    outage_started_at TIMESTAMP NOT NULL,
+    step INTEGER NOT NULL,
+    notified_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (monitor_id, outage_started_at, step)
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS alert_escalations;
+-- +goose StatementEnd
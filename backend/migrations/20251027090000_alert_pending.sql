@@ -0,0 +1,18 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS alert_pending (
+    id VARCHAR(36) NOT NULL,
+    monitor_id VARCHAR(255) NOT NULL,
+    kind VARCHAR(16) NOT NULL,
+    message TEXT NOT NULL,
+    due TIMESTAMP NOT NULL,
+    outage_started_at TIMESTAMP NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (id)
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS alert_pending;
+-- +goose StatementEnd
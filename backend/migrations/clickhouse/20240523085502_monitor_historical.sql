@@ -0,0 +1,21 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS monitor_historical (
+    monitor_id String,
+    status Int16,
+    latency Int32 DEFAULT 0,
+    timestamp DateTime64(3, 'UTC') DEFAULT now64(3),
+    additional_message Nullable(String),
+    http_protocol Nullable(String),
+    tls_version Nullable(String),
+    tls_cipher Nullable(String),
+    tls_expiry Nullable(DateTime64(3, 'UTC'))
+) ENGINE = ReplacingMergeTree
+PARTITION BY toYYYYMM(timestamp)
+ORDER BY (monitor_id, timestamp);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS monitor_historical;
+-- +goose StatementEnd
@@ -0,0 +1,20 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS incident_data (
+    monitor_id String,
+    title String,
+    description String,
+    timestamp DateTime64(3, 'UTC'),
+    severity Int16,
+    status Int16,
+    created_at DateTime64(3, 'UTC') DEFAULT now64(3),
+    created_by String
+) ENGINE = ReplacingMergeTree(created_at)
+PARTITION BY toYYYYMM(timestamp)
+ORDER BY (monitor_id, timestamp);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS incident_data;
+-- +goose StatementEnd
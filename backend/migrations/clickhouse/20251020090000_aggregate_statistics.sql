@@ -0,0 +1,240 @@
+-- +semyi If !plain_aggregates
+-- Databases that were created with the generic migrations keep their plain aggregate tables, see
+-- 20251025090000_plain_aggregate_statistics.
+-- +goose Up
+-- +goose StatementBegin
+-- The aggregates are maintained by ClickHouse itself. Every insert into monitor_historical is folded into
+-- the aggregate states by the materialized views, and the views of the aggregate table names finalize the
+-- states into the same columns as the aggregate tables of the other databases.
+CREATE TABLE IF NOT EXISTS monitor_historical_hourly_aggregate_state (
+    monitor_id String,
+    timestamp DateTime('UTC'),
+    success_count SimpleAggregateFunction(sum, UInt64),
+    failure_count SimpleAggregateFunction(sum, UInt64),
+    degraded_count SimpleAggregateFunction(sum, UInt64),
+    maintenance_count SimpleAggregateFunction(sum, UInt64),
+    limited_count SimpleAggregateFunction(sum, UInt64),
+    latency_sum SimpleAggregateFunction(sum, Int64),
+    latency_min SimpleAggregateFunction(min, Int32),
+    latency_max SimpleAggregateFunction(max, Int32),
+    latency_quantiles AggregateFunction(quantiles(0.5, 0.95, 0.99), Int32),
+    additional_message AggregateFunction(argMaxIf, String, DateTime64(3, 'UTC'), UInt8),
+    http_protocol AggregateFunction(argMaxIf, String, DateTime64(3, 'UTC'), UInt8),
+    tls_version AggregateFunction(argMaxIf, String, DateTime64(3, 'UTC'), UInt8),
+    tls_cipher AggregateFunction(argMaxIf, String, DateTime64(3, 'UTC'), UInt8),
+    tls_expiry AggregateFunction(argMaxIf, DateTime64(3, 'UTC'), DateTime64(3, 'UTC'), UInt8),
+    created_at SimpleAggregateFunction(max, DateTime('UTC'))
+) ENGINE = AggregatingMergeTree
+PARTITION BY toYYYYMM(timestamp)
+ORDER BY (monitor_id, timestamp);
+
+CREATE TABLE IF NOT EXISTS monitor_historical_daily_aggregate_state (
+    monitor_id String,
+    timestamp DateTime('UTC'),
+    success_count SimpleAggregateFunction(sum, UInt64),
+    failure_count SimpleAggregateFunction(sum, UInt64),
+    degraded_count SimpleAggregateFunction(sum, UInt64),
+    maintenance_count SimpleAggregateFunction(sum, UInt64),
+    limited_count SimpleAggregateFunction(sum, UInt64),
+    latency_sum SimpleAggregateFunction(sum, Int64),
+    latency_min SimpleAggregateFunction(min, Int32),
+    latency_max SimpleAggregateFunction(max, Int32),
+    latency_quantiles AggregateFunction(quantiles(0.5, 0.95, 0.99), Int32),
+    additional_message AggregateFunction(argMaxIf, String, DateTime64(3, 'UTC'), UInt8),
+    http_protocol AggregateFunction(argMaxIf, String, DateTime64(3, 'UTC'), UInt8),
+    tls_version AggregateFunction(argMaxIf, String, DateTime64(3, 'UTC'), UInt8),
+    tls_cipher AggregateFunction(argMaxIf, String, DateTime64(3, 'UTC'), UInt8),
+    tls_expiry AggregateFunction(argMaxIf, DateTime64(3, 'UTC'), DateTime64(3, 'UTC'), UInt8),
+    created_at SimpleAggregateFunction(max, DateTime('UTC'))
+) ENGINE = AggregatingMergeTree
+PARTITION BY toYYYYMM(timestamp)
+ORDER BY (monitor_id, timestamp);
+
+CREATE MATERIALIZED VIEW IF NOT EXISTS monitor_historical_hourly_aggregate_mv TO monitor_historical_hourly_aggregate_state AS
+SELECT
+    monitor_id,
+    bucket AS timestamp,
+    countIf(status = 0) AS success_count,
+    countIf(status = 1) AS failure_count,
+    countIf(status = 2) AS degraded_count,
+    countIf(status = 3) AS maintenance_count,
+    countIf(status = 4) AS limited_count,
+    sum(toInt64(latency)) AS latency_sum,
+    min(latency) AS latency_min,
+    max(latency) AS latency_max,
+    quantilesState(0.5, 0.95, 0.99)(latency) AS latency_quantiles,
+    argMaxIfState(assumeNotNull(additional_message), checked_at, isNotNull(additional_message) AND status != 0) AS additional_message,
+    argMaxIfState(assumeNotNull(http_protocol), checked_at, isNotNull(http_protocol)) AS http_protocol,
+    argMaxIfState(assumeNotNull(tls_version), checked_at, isNotNull(tls_version)) AS tls_version,
+    argMaxIfState(assumeNotNull(tls_cipher), checked_at, isNotNull(tls_cipher)) AS tls_cipher,
+    argMaxIfState(assumeNotNull(tls_expiry), checked_at, isNotNull(tls_expiry)) AS tls_expiry,
+    max(now()) AS created_at
+FROM (
+    SELECT
+        monitor_id,
+        status,
+        latency,
+        additional_message,
+        http_protocol,
+        tls_version,
+        tls_cipher,
+        tls_expiry,
+        timestamp AS checked_at,
+        toDateTime(toStartOfHour(timestamp), 'UTC') AS bucket
+    FROM monitor_historical
+)
+GROUP BY monitor_id, bucket;
+
+CREATE MATERIALIZED VIEW IF NOT EXISTS monitor_historical_daily_aggregate_mv TO monitor_historical_daily_aggregate_state AS
+SELECT
+    monitor_id,
+    bucket AS timestamp,
+    countIf(status = 0) AS success_count,
+    countIf(status = 1) AS failure_count,
+    countIf(status = 2) AS degraded_count,
+    countIf(status = 3) AS maintenance_count,
+    countIf(status = 4) AS limited_count,
+    sum(toInt64(latency)) AS latency_sum,
+    min(latency) AS latency_min,
+    max(latency) AS latency_max,
+    quantilesState(0.5, 0.95, 0.99)(latency) AS latency_quantiles,
+    argMaxIfState(assumeNotNull(additional_message), checked_at, isNotNull(additional_message) AND status != 0) AS additional_message,
+    argMaxIfState(assumeNotNull(http_protocol), checked_at, isNotNull(http_protocol)) AS http_protocol,
+    argMaxIfState(assumeNotNull(tls_version), checked_at, isNotNull(tls_version)) AS tls_version,
+    argMaxIfState(assumeNotNull(tls_cipher), checked_at, isNotNull(tls_cipher)) AS tls_cipher,
+    argMaxIfState(assumeNotNull(tls_expiry), checked_at, isNotNull(tls_expiry)) AS tls_expiry,
+    max(now()) AS created_at
+FROM (
+    SELECT
+        monitor_id,
+        status,
+        latency,
+        additional_message,
+        http_protocol,
+        tls_version,
+        tls_cipher,
+        tls_expiry,
+        timestamp AS checked_at,
+        toDateTime(toStartOfDay(timestamp), 'UTC') AS bucket
+    FROM monitor_historical
+)
+GROUP BY monitor_id, bucket;
+
+CREATE VIEW IF NOT EXISTS monitor_historical_hourly_aggregate AS
+SELECT
+    monitor_id,
+    timestamp,
+    toInt16(dominant) AS status,
+    toInt32(if(checks > 0, round(latency_total / checks), 0)) AS latency,
+    nullIf(message, '') AS additional_message,
+    nullIf(protocol, '') AS http_protocol,
+    nullIf(version, '') AS tls_version,
+    nullIf(cipher, '') AS tls_cipher,
+    nullIf(expiry, toDateTime64(0, 3, 'UTC')) AS tls_expiry,
+    toInt32(checks) AS check_count,
+    toInt32(failures) AS failure_count,
+    if(checks > maintenance, (checks - maintenance - failures) / (checks - maintenance), 1) AS uptime_ratio,
+    minimum AS latency_min,
+    maximum AS latency_max,
+    toInt32(round(quantile_values[1])) AS latency_p50,
+    toInt32(round(quantile_values[2])) AS latency_p95,
+    toInt32(round(quantile_values[3])) AS latency_p99,
+    toInt16(multiIf(failures > 0, 1, limited > 0, 4, degraded > 0, 2, successes > 0, 0, 3)) AS worst_status,
+    toInt16(dominant) AS dominant_status,
+    updated_at AS created_at
+FROM (
+    SELECT
+        monitor_id,
+        timestamp,
+        sum(success_count) AS successes,
+        sum(failure_count) AS failures,
+        sum(degraded_count) AS degraded,
+        sum(maintenance_count) AS maintenance,
+        sum(limited_count) AS limited,
+        successes + failures + degraded + maintenance + limited AS checks,
+        -- The most frequent status besides maintenance, ties go to the more severe status
+        multiIf(
+            failures > 0 AND failures >= limited AND failures >= degraded AND failures >= successes, 1,
+            limited > 0 AND limited > failures AND limited >= degraded AND limited >= successes, 4,
+            degraded > 0 AND degraded > failures AND degraded > limited AND degraded >= successes, 2,
+            successes > 0, 0,
+            3
+        ) AS dominant,
+        sum(latency_sum) AS latency_total,
+        min(latency_min) AS minimum,
+        max(latency_max) AS maximum,
+        quantilesMerge(0.5, 0.95, 0.99)(latency_quantiles) AS quantile_values,
+        argMaxIfMerge(additional_message) AS message,
+        argMaxIfMerge(http_protocol) AS protocol,
+        argMaxIfMerge(tls_version) AS version,
+        argMaxIfMerge(tls_cipher) AS cipher,
+        argMaxIfMerge(tls_expiry) AS expiry,
+        max(created_at) AS updated_at
+    FROM monitor_historical_hourly_aggregate_state
+    GROUP BY monitor_id, timestamp
+);
+
+CREATE VIEW IF NOT EXISTS monitor_historical_daily_aggregate AS
+SELECT
+    monitor_id,
+    timestamp,
+    toInt16(dominant) AS status,
+    toInt32(if(checks > 0, round(latency_total / checks), 0)) AS latency,
+    nullIf(message, '') AS additional_message,
+    nullIf(protocol, '') AS http_protocol,
+    nullIf(version, '') AS tls_version,
+    nullIf(cipher, '') AS tls_cipher,
+    nullIf(expiry, toDateTime64(0, 3, 'UTC')) AS tls_expiry,
+    toInt32(checks) AS check_count,
+    toInt32(failures) AS failure_count,
+    if(checks > maintenance, (checks - maintenance - failures) / (checks - maintenance), 1) AS uptime_ratio,
+    minimum AS latency_min,
+    maximum AS latency_max,
+    toInt32(round(quantile_values[1])) AS latency_p50,
+    toInt32(round(quantile_values[2])) AS latency_p95,
+    toInt32(round(quantile_values[3])) AS latency_p99,
+    toInt16(multiIf(failures > 0, 1, limited > 0, 4, degraded > 0, 2, successes > 0, 0, 3)) AS worst_status,
+    toInt16(dominant) AS dominant_status,
+    updated_at AS created_at
+FROM (
+    SELECT
+        monitor_id,
+        timestamp,
+        sum(success_count) AS successes,
+        sum(failure_count) AS failures,
+        sum(degraded_count) AS degraded,
+        sum(maintenance_count) AS maintenance,
+        sum(limited_count) AS limited,
+        successes + failures + degraded + maintenance + limited AS checks,
+        -- The most frequent status besides maintenance, ties go to the more severe status
+        multiIf(
+            failures > 0 AND failures >= limited AND failures >= degraded AND failures >= successes, 1,
+            limited > 0 AND limited > failures AND limited >= degraded AND limited >= successes, 4,
+            degraded > 0 AND degraded > failures AND degraded > limited AND degraded >= successes, 2,
+            successes > 0, 0,
+            3
+        ) AS dominant,
+        sum(latency_sum) AS latency_total,
+        min(latency_min) AS minimum,
+        max(latency_max) AS maximum,
+        quantilesMerge(0.5, 0.95, 0.99)(latency_quantiles) AS quantile_values,
+        argMaxIfMerge(additional_message) AS message,
+        argMaxIfMerge(http_protocol) AS protocol,
+        argMaxIfMerge(tls_version) AS version,
+        argMaxIfMerge(tls_cipher) AS cipher,
+        argMaxIfMerge(tls_expiry) AS expiry,
+        max(created_at) AS updated_at
+    FROM monitor_historical_daily_aggregate_state
+    GROUP BY monitor_id, timestamp
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP VIEW IF EXISTS monitor_historical_hourly_aggregate;
+DROP VIEW IF EXISTS monitor_historical_daily_aggregate;
+DROP VIEW IF EXISTS monitor_historical_hourly_aggregate_mv;
+DROP VIEW IF EXISTS monitor_historical_daily_aggregate_mv;
+DROP TABLE IF EXISTS monitor_historical_hourly_aggregate_state;
+DROP TABLE IF EXISTS monitor_historical_daily_aggregate_state;
+-- +goose StatementEnd
@@ -0,0 +1,21 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS outages (
+    monitor_id String,
+    started_at DateTime64(3, 'UTC'),
+    ended_at Nullable(DateTime64(3, 'UTC')),
+    duration_seconds Nullable(Int64),
+    first_failure_message Nullable(String),
+    failed_checks Int32 DEFAULT 0,
+    recovery_status Nullable(Int16),
+    recovery_latency Nullable(Int32),
+    created_at DateTime64(3, 'UTC') DEFAULT now64(3)
+) ENGINE = ReplacingMergeTree(created_at)
+PARTITION BY toYYYYMM(started_at)
+ORDER BY (monitor_id, started_at);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS outages;
+-- +goose StatementEnd
@@ -0,0 +1,35 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS alert_outbox (
+    id String,
+    monitor_id String,
+    provider String,
+    message String,
+    state LowCardinality(String),
+    attempt_count Int32 DEFAULT 0,
+    next_attempt_at DateTime64(3, 'UTC'),
+    last_status_code Nullable(Int32),
+    last_error Nullable(String),
+    created_at DateTime64(3, 'UTC'),
+    updated_at DateTime64(3, 'UTC')
+) ENGINE = ReplacingMergeTree(updated_at)
+ORDER BY id;
+
+CREATE TABLE IF NOT EXISTS alert_delivery_attempts (
+    delivery_id String,
+    attempt Int32,
+    attempted_at DateTime64(3, 'UTC'),
+    status_code Nullable(Int32),
+    error Nullable(String),
+    success Bool
+) ENGINE = MergeTree
+PARTITION BY toYYYYMM(attempted_at)
+ORDER BY (delivery_id, attempt);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS alert_delivery_attempts;
+
+DROP TABLE IF EXISTS alert_outbox;
+-- +goose StatementEnd
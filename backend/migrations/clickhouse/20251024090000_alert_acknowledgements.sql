@@ -0,0 +1,18 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS alert_acknowledgements (
+    monitor_id String,
+    outage_started_at DateTime64(3, 'UTC'),
+    acknowledged_by String,
+    source LowCardinality(String),
+    comment Nullable(String),
+    acknowledged_at DateTime64(3, 'UTC')
+) ENGINE = MergeTree
+PARTITION BY toYYYYMM(acknowledged_at)
+ORDER BY (monitor_id, outage_started_at, acknowledged_at);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS alert_acknowledgements;
+-- +goose StatementEnd
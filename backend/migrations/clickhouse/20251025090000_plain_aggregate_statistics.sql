@@ -0,0 +1,58 @@
+-- +semyi If plain_aggregates
+-- +goose Up
+-- +goose StatementBegin
+-- ClickHouse databases that were created with the generic migrations store the aggregates in plain tables,
+-- which are written by Semyi. They get the statistics columns of the generic migrations, and the materialized
+-- views that an earlier version created next to them are dropped, since nothing reads their states.
+DROP VIEW IF EXISTS monitor_historical_hourly_aggregate_mv;
+DROP VIEW IF EXISTS monitor_historical_daily_aggregate_mv;
+DROP TABLE IF EXISTS monitor_historical_hourly_aggregate_state;
+DROP TABLE IF EXISTS monitor_historical_daily_aggregate_state;
+
+ALTER TABLE monitor_historical_hourly_aggregate ADD COLUMN IF NOT EXISTS check_count Int32 DEFAULT 0;
+ALTER TABLE monitor_historical_hourly_aggregate ADD COLUMN IF NOT EXISTS failure_count Int32 DEFAULT 0;
+ALTER TABLE monitor_historical_hourly_aggregate ADD COLUMN IF NOT EXISTS uptime_ratio Float64 DEFAULT 0;
+ALTER TABLE monitor_historical_hourly_aggregate ADD COLUMN IF NOT EXISTS latency_min Int32 DEFAULT 0;
+ALTER TABLE monitor_historical_hourly_aggregate ADD COLUMN IF NOT EXISTS latency_max Int32 DEFAULT 0;
+ALTER TABLE monitor_historical_hourly_aggregate ADD COLUMN IF NOT EXISTS latency_p50 Int32 DEFAULT 0;
+ALTER TABLE monitor_historical_hourly_aggregate ADD COLUMN IF NOT EXISTS latency_p95 Int32 DEFAULT 0;
+ALTER TABLE monitor_historical_hourly_aggregate ADD COLUMN IF NOT EXISTS latency_p99 Int32 DEFAULT 0;
+ALTER TABLE monitor_historical_hourly_aggregate ADD COLUMN IF NOT EXISTS worst_status Int16 DEFAULT 0;
+ALTER TABLE monitor_historical_hourly_aggregate ADD COLUMN IF NOT EXISTS dominant_status Int16 DEFAULT 0;
+
+ALTER TABLE monitor_historical_daily_aggregate ADD COLUMN IF NOT EXISTS check_count Int32 DEFAULT 0;
+ALTER TABLE monitor_historical_daily_aggregate ADD COLUMN IF NOT EXISTS failure_count Int32 DEFAULT 0;
+ALTER TABLE monitor_historical_daily_aggregate ADD COLUMN IF NOT EXISTS uptime_ratio Float64 DEFAULT 0;
+ALTER TABLE monitor_historical_daily_aggregate ADD COLUMN IF NOT EXISTS latency_min Int32 DEFAULT 0;
+ALTER TABLE monitor_historical_daily_aggregate ADD COLUMN IF NOT EXISTS latency_max Int32 DEFAULT 0;
+ALTER TABLE monitor_historical_daily_aggregate ADD COLUMN IF NOT EXISTS latency_p50 Int32 DEFAULT 0;
+ALTER TABLE monitor_historical_daily_aggregate ADD COLUMN IF NOT EXISTS latency_p95 Int32 DEFAULT 0;
+ALTER TABLE monitor_historical_daily_aggregate ADD COLUMN IF NOT EXISTS latency_p99 Int32 DEFAULT 0;
+ALTER TABLE monitor_historical_daily_aggregate ADD COLUMN IF NOT EXISTS worst_status Int16 DEFAULT 0;
+ALTER TABLE monitor_historical_daily_aggregate ADD COLUMN IF NOT EXISTS dominant_status Int16 DEFAULT 0;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE monitor_historical_hourly_aggregate DROP COLUMN IF EXISTS check_count;
+ALTER TABLE monitor_historical_hourly_aggregate DROP COLUMN IF EXISTS failure_count;
+ALTER TABLE monitor_historical_hourly_aggregate DROP COLUMN IF EXISTS uptime_ratio;
+ALTER TABLE monitor_historical_hourly_aggregate DROP COLUMN IF EXISTS latency_min;
+ALTER TABLE monitor_historical_hourly_aggregate DROP COLUMN IF EXISTS latency_max;
+ALTER TABLE monitor_historical_hourly_aggregate DROP COLUMN IF EXISTS latency_p50;
+ALTER TABLE monitor_historical_hourly_aggregate DROP COLUMN IF EXISTS latency_p95;
+ALTER TABLE monitor_historical_hourly_aggregate DROP COLUMN IF EXISTS latency_p99;
+ALTER TABLE monitor_historical_hourly_aggregate DROP COLUMN IF EXISTS worst_status;
+ALTER TABLE monitor_historical_hourly_aggregate DROP COLUMN IF EXISTS dominant_status;
+
+ALTER TABLE monitor_historical_daily_aggregate DROP COLUMN IF EXISTS check_count;
+ALTER TABLE monitor_historical_daily_aggregate DROP COLUMN IF EXISTS failure_count;
+ALTER TABLE monitor_historical_daily_aggregate DROP COLUMN IF EXISTS uptime_ratio;
+ALTER TABLE monitor_historical_daily_aggregate DROP COLUMN IF EXISTS latency_min;
+ALTER TABLE monitor_historical_daily_aggregate DROP COLUMN IF EXISTS latency_max;
+ALTER TABLE monitor_historical_daily_aggregate DROP COLUMN IF EXISTS latency_p50;
+ALTER TABLE monitor_historical_daily_aggregate DROP COLUMN IF EXISTS latency_p95;
+ALTER TABLE monitor_historical_daily_aggregate DROP COLUMN IF EXISTS latency_p99;
+ALTER TABLE monitor_historical_daily_aggregate DROP COLUMN IF EXISTS worst_status;
+ALTER TABLE monitor_historical_daily_aggregate DROP COLUMN IF EXISTS dominant_status;
+-- +goose StatementEnd
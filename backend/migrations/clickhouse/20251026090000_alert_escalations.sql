@@ -0,0 +1,16 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS alert_escalations (
+    monitor_id String,
+    outage_started_at DateTime64(3, 'UTC'),
+    step Int32,
+    notified_at DateTime64(3, 'UTC')
+) ENGINE = MergeTree
+PARTITION BY toYYYYMM(outage_started_at)
+ORDER BY (monitor_id, outage_started_at, step);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS alert_escalations;
+-- +goose StatementEnd
@@ -0,0 +1,18 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS alert_pending (
+    id String,
+    monitor_id String,
+    kind LowCardinality(String),
+    message String,
+    due DateTime64(3, 'UTC'),
+    outage_started_at DateTime64(3, 'UTC'),
+    created_at DateTime64(3, 'UTC')
+) ENGINE = MergeTree
+ORDER BY id;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS alert_pending;
+-- +goose StatementEnd
@@ -12,6 +12,66 @@ type MonitorHistorical struct {
 	TLSVersion        string        `json:"tls_version,omitempty"`
 	TLSCipherName     string        `json:"tls_cipher_name,omitempty"`
 	TLSExpiryDate     time.Time     `json:"tls_expiry_date,omitempty"`
+	// Aggregate is only set for the hourly and daily aggregates.
+	Aggregate *AggregateStatistics `json:"aggregate,omitempty"`
+}
+
+// AggregateStatistics summarizes the raw check results within an aggregate bucket.
+type AggregateStatistics struct {
+	CheckCount   int64 `json:"check_count"`
+	FailureCount int64 `json:"failure_count"`
+	// UptimeRatio is the ratio (0-1) of checks that were not failing, excluding checks during maintenance.
+	UptimeRatio float64 `json:"uptime_ratio"`
+	LatencyMin  int64   `json:"latency_min"`
+	LatencyMax  int64   `json:"latency_max"`
+	LatencyP50  int64   `json:"latency_p50"`
+	LatencyP95  int64   `json:"latency_p95"`
+	LatencyP99  int64   `json:"latency_p99"`
+	// WorstStatus is the most severe status within the bucket, see MonitorStatus.Severity.
+	WorstStatus MonitorStatus `json:"worst_status"`
+	// DominantStatus is the most frequent status within the bucket, excluding maintenance unless
+	// every check was under maintenance. Ties are resolved to the more severe status.
+	DominantStatus MonitorStatus `json:"dominant_status"`
+}
+
+// NewAggregateStatistics computes the statistics from the number of checks per status.
+// Latency statistics are left for the caller to fill in.
+func NewAggregateStatistics(statusCounts map[MonitorStatus]int64) AggregateStatistics {
+	var statistics AggregateStatistics
+	var dominantCount int64 = -1
+	statistics.DominantStatus = MonitorStatusUnderMaintenance
+	statistics.WorstStatus = MonitorStatusUnderMaintenance
+	for status, count := range statusCounts {
+		if count == 0 {
+			continue
+		}
+
+		statistics.CheckCount += count
+		if status == MonitorStatusFailure {
+			statistics.FailureCount += count
+		}
+
+		if status.Severity() > statistics.WorstStatus.Severity() {
+			statistics.WorstStatus = status
+		}
+
+		if status == MonitorStatusUnderMaintenance {
+			continue
+		}
+
+		if count > dominantCount || (count == dominantCount && status.Severity() > statistics.DominantStatus.Severity()) {
+			statistics.DominantStatus = status
+			dominantCount = count
+		}
+	}
+
+	checked := statistics.CheckCount - statusCounts[MonitorStatusUnderMaintenance]
+	statistics.UptimeRatio = 1
+	if checked > 0 {
+		statistics.UptimeRatio = float64(checked-statistics.FailureCount) / float64(checked)
+	}
+
+	return statistics
 }
 
 func (m MonitorHistorical) Validate() (bool, error) {
@@ -29,7 +89,7 @@ func (m MonitorHistorical) Validate() (bool, error) {
 		validationError.AddIssue("timestamp", "timestamp is required")
 	}
 
-	if m.Status != MonitorStatusSuccess && m.Status != MonitorStatusFailure {
+	if !m.Status.IsValid() {
 		validationError.AddIssue("status", "invalid status")
 	}
 
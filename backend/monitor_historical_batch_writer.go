@@ -0,0 +1,356 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/getsentry/sentry-go"
+	"github.com/marcboeker/go-duckdb/v2"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	defaultBatchMaxSize       = 1000
+	defaultBatchFlushInterval = time.Second
+)
+
+// RawHistoricalWriter writes a single check result into the raw historical table.
+// It is implemented by both MonitorHistoricalWriter and MonitorHistoricalBatchWriter.
+type RawHistoricalWriter interface {
+	Write(ctx context.Context, historical MonitorHistorical) error
+}
+
+type MonitorHistoricalBatchWriterConfig struct {
+	// DB is the database the batches are written into. For DuckDB, it should be opened from the DuckDB
+	// connector directly (not through a wrapping connector), so the Appender API can be used.
+	DB *sql.DB
+	// MaxBatchSize specifies the maximum number of rows in a single batch. Defaults to 1000.
+	MaxBatchSize int
+	// FlushInterval specifies how long a row can wait before the batch is written. Defaults to 1 second.
+	FlushInterval time.Duration
+}
+
+type batchWriteRequest struct {
+	ctx        context.Context
+	historical MonitorHistorical
+	result     chan error
+}
+
+// MonitorHistoricalBatchWriter groups check results and writes them in batches, using the Appender API
+// on DuckDB and a prepared batch insert on other databases (which ClickHouse turns into a native batch).
+// Every batch is written by a single goroutine, so writes to DuckDB are serialized.
+type MonitorHistoricalBatchWriter struct {
+	db            *sql.DB
+	fallback      *MonitorHistoricalWriter
+	maxBatchSize  int
+	flushInterval time.Duration
+	requests      chan batchWriteRequest
+
+	metricsMutex sync.Mutex
+	batches      uint64
+	rows         uint64
+	failedRows   uint64
+}
+
+func NewMonitorHistoricalBatchWriter(config MonitorHistoricalBatchWriterConfig) *MonitorHistoricalBatchWriter {
+	if config.MaxBatchSize <= 0 {
+		config.MaxBatchSize = defaultBatchMaxSize
+	}
+
+	if config.FlushInterval <= 0 {
+		config.FlushInterval = defaultBatchFlushInterval
+	}
+
+	return &MonitorHistoricalBatchWriter{
+		db:            config.DB,
+		fallback:      NewMonitorHistoricalWriter(config.DB),
+		maxBatchSize:  config.MaxBatchSize,
+		flushInterval: config.FlushInterval,
+		requests:      make(chan batchWriteRequest, config.MaxBatchSize),
+	}
+}
+
+// Write queues the check result into the current batch, and waits until the batch is written.
+// Run must be running, otherwise Write blocks until the context is cancelled.
+func (w *MonitorHistoricalBatchWriter) Write(ctx context.Context, historical MonitorHistorical) error {
+	valid, err := historical.Validate()
+	if err != nil {
+		return err
+	}
+	if !valid {
+		return nil
+	}
+
+	historical.Timestamp = EnsureUTC(historical.Timestamp)
+
+	request := batchWriteRequest{
+		ctx:        ctx,
+		historical: historical,
+		result:     make(chan error, 1),
+	}
+
+	select {
+	case w.requests <- request:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	select {
+	case err := <-request.result:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Run collects queued check results and writes them in batches until the context is cancelled.
+// Results that are still queued when the context is cancelled are written before Run returns.
+func (w *MonitorHistoricalBatchWriter) Run(ctx context.Context) {
+	ticker := time.NewTicker(w.flushInterval)
+	defer ticker.Stop()
+
+	batch := make([]batchWriteRequest, 0, w.maxBatchSize)
+	for {
+		select {
+		case <-ctx.Done():
+			for {
+				select {
+				case request := <-w.requests:
+					batch = append(batch, request)
+				default:
+					w.flush(context.WithoutCancel(ctx), batch)
+					return
+				}
+			}
+		case request := <-w.requests:
+			batch = append(batch, request)
+			if len(batch) >= w.maxBatchSize {
+				w.flush(ctx, batch)
+				batch = batch[:0]
+			}
+		case <-ticker.C:
+			if len(batch) > 0 {
+				w.flush(ctx, batch)
+				batch = batch[:0]
+			}
+		}
+	}
+}
+
+func (w *MonitorHistoricalBatchWriter) flush(ctx context.Context, batch []batchWriteRequest) {
+	if len(batch) == 0 {
+		return
+	}
+
+	ctx = sentry.SetHubOnContext(ctx, sentry.CurrentHub().Clone())
+	span := sentry.StartSpan(ctx, "function", sentry.WithDescription("MonitorHistoricalBatchWriter.flush"))
+	span.SetData("semyi.batch.size", len(batch))
+	ctx = span.Context()
+	defer span.Finish()
+
+	historical := make([]MonitorHistorical, len(batch))
+	for i, request := range batch {
+		historical[i] = request.historical
+	}
+
+	err := w.writeBatch(ctx, historical)
+	if err == nil {
+		w.recordBatch(len(batch), 0)
+		for _, request := range batch {
+			request.result <- nil
+		}
+		return
+	}
+
+	// A single bad row (e.g. a duplicate primary key) fails the whole batch. Retry the rows one by one,
+	// so only the rows that actually fail are reported as failed.
+	log.Warn().Err(err).Int("size", len(batch)).Msg("failed to write historical batch, retrying row by row")
+
+	var failed int
+	for _, request := range batch {
+		err := w.fallback.Write(request.ctx, request.historical)
+		if err != nil {
+			failed++
+		}
+		request.result <- err
+	}
+	w.recordBatch(len(batch)-failed, failed)
+}
+
+func (w *MonitorHistoricalBatchWriter) writeBatch(ctx context.Context, historical []MonitorHistorical) error {
+	conn, err := w.db.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get connection: %w", err)
+	}
+	defer func() {
+		err := conn.Close()
+		if err != nil {
+			log.Warn().Err(err).Msg("failed to close connection")
+		}
+	}()
+
+	errNotDuckDB := errors.New("not a duckdb connection")
+	err = conn.Raw(func(driverConn any) error {
+		duckdbConn, ok := driverConn.(*duckdb.Conn)
+		if !ok {
+			return errNotDuckDB
+		}
+
+		return appendHistorical(duckdbConn, historical)
+	})
+	if !errors.Is(err, errNotDuckDB) {
+		return err
+	}
+
+	return insertHistorical(ctx, conn, historical)
+}
+
+// appendHistorical writes the rows with the DuckDB Appender API. The values must be in the same order
+// as the columns of the monitor_historical table.
+func appendHistorical(conn driver.Conn, historical []MonitorHistorical) error {
+	appender, err := duckdb.NewAppenderFromConn(conn, "", "monitor_historical")
+	if err != nil {
+		return fmt.Errorf("failed to create appender: %w", err)
+	}
+
+	for _, h := range historical {
+		err = appender.AppendRow(
+			h.MonitorID,
+			int16(h.Status),
+			int32(h.Latency),
+			h.Timestamp,
+			nullableString(h.AdditionalMessage),
+			nullableString(h.HttpProtocol),
+			nullableString(h.TLSVersion),
+			nullableString(h.TLSCipherName),
+			nullableTime(h.TLSExpiryDate),
+		)
+		if err != nil {
+			_ = appender.Close()
+			return fmt.Errorf("failed to append historical data: %w", err)
+		}
+	}
+
+	err = appender.Close()
+	if err != nil {
+		return fmt.Errorf("failed to flush appender: %w", err)
+	}
+
+	return nil
+}
+
+// insertHistorical writes the rows with a prepared statement inside a transaction.
+// ClickHouse sends the rows as a single native batch on commit.
+func insertHistorical(ctx context.Context, conn *sql.Conn, historical []MonitorHistorical) error {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+
+	statement, err := tx.PrepareContext(
+		ctx,
+		`INSERT INTO
+			monitor_historical
+			(
+				monitor_id,
+				status,
+				latency,
+				timestamp,
+				additional_message,
+				http_protocol,
+				tls_version,
+				tls_cipher,
+				tls_expiry
+			)
+		VALUES
+			(?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+	)
+	if err != nil {
+		if rollbackErr := tx.Rollback(); rollbackErr != nil {
+			log.Error().Err(rollbackErr).Msg("failed to rollback transaction")
+		}
+		return fmt.Errorf("failed to prepare statement: %w", err)
+	}
+
+	for _, h := range historical {
+		_, err = statement.ExecContext(
+			ctx,
+			h.MonitorID,
+			uint8(h.Status),
+			h.Latency,
+			h.Timestamp,
+			sql.NullString{String: h.AdditionalMessage, Valid: h.AdditionalMessage != ""},
+			sql.NullString{String: h.HttpProtocol, Valid: h.HttpProtocol != ""},
+			sql.NullString{String: h.TLSVersion, Valid: h.TLSVersion != ""},
+			sql.NullString{String: h.TLSCipherName, Valid: h.TLSCipherName != ""},
+			sql.NullTime{Time: h.TLSExpiryDate, Valid: !h.TLSExpiryDate.IsZero()},
+		)
+		if err != nil {
+			_ = statement.Close()
+			if rollbackErr := tx.Rollback(); rollbackErr != nil {
+				log.Error().Err(rollbackErr).Msg("failed to rollback transaction")
+			}
+			return fmt.Errorf("failed to insert historical data: %w", err)
+		}
+	}
+
+	err = statement.Close()
+	if err != nil {
+		if rollbackErr := tx.Rollback(); rollbackErr != nil {
+			log.Error().Err(rollbackErr).Msg("failed to rollback transaction")
+		}
+		return fmt.Errorf("failed to close statement: %w", err)
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return nil
+}
+
+func nullableString(value string) driver.Value {
+	if value == "" {
+		return nil
+	}
+
+	return value
+}
+
+func nullableTime(value time.Time) driver.Value {
+	if value.IsZero() {
+		return nil
+	}
+
+	return value
+}
+
+func (w *MonitorHistoricalBatchWriter) recordBatch(rows int, failedRows int) {
+	w.metricsMutex.Lock()
+	defer w.metricsMutex.Unlock()
+
+	w.batches++
+	w.rows += uint64(rows)
+	w.failedRows += uint64(failedRows)
+}
+
+// CollectMetrics writes the batch writer metrics in the Prometheus text exposition format.
+func (w *MonitorHistoricalBatchWriter) CollectMetrics(writer io.Writer) error {
+	w.metricsMutex.Lock()
+	batches, rows, failedRows := w.batches, w.rows, w.failedRows
+	w.metricsMutex.Unlock()
+
+	return WriteMetrics(writer,
+		Metric{Name: "semyi_historical_batch_queue_length", Help: "Number of check results waiting for the next batch.", Type: MetricTypeGauge, Value: float64(len(w.requests))},
+		Metric{Name: "semyi_historical_batches_total", Help: "Number of batches written to the database.", Type: MetricTypeCounter, Value: float64(batches)},
+		Metric{Name: "semyi_historical_batch_rows_total", Help: "Number of check results written to the database in batches.", Type: MetricTypeCounter, Value: float64(rows)},
+		Metric{Name: "semyi_historical_batch_failed_rows_total", Help: "Number of check results that failed to be written.", Type: MetricTypeCounter, Value: float64(failedRows)},
+	)
+}
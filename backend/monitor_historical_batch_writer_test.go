@@ -0,0 +1,75 @@
+package main_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	main "semyi"
+	"semyi/testutils"
+
+	"github.com/getsentry/sentry-go"
+)
+
+func TestMonitorHistoricalBatchWriter_Write(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	ctx = sentry.SetHubOnContext(ctx, sentry.CurrentHub())
+
+	runCtx, stop := context.WithCancel(ctx)
+	defer stop()
+
+	writer := main.NewMonitorHistoricalBatchWriter(main.MonitorHistoricalBatchWriterConfig{
+		DB:            database,
+		MaxBatchSize:  10,
+		FlushInterval: 50 * time.Millisecond,
+	})
+	go writer.Run(runCtx)
+
+	now := time.Now().UTC().Truncate(time.Second)
+	var wg sync.WaitGroup
+	errs := make([]error, 25)
+	for i := 0; i < 25; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = writer.Write(ctx, main.MonitorHistorical{
+				MonitorID:         "batch-monitor",
+				Status:            main.MonitorStatusSuccess,
+				Latency:           int64(i),
+				Timestamp:         now.Add(-time.Duration(i) * time.Second),
+				AdditionalMessage: "ok",
+			})
+		}(i)
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		testutils.AssertNoError(t, err, "Failed to write historical data")
+	}
+
+	historical, err := main.NewMonitorHistoricalReader(database).ReadRawHistorical(ctx, "batch-monitor", false)
+	testutils.AssertNoError(t, err, "Failed to read historical data")
+	testutils.AssertEqual(t, 25, len(historical), "Expected every row to be written")
+
+	// A duplicate row fails the batch, but should not fail the other rows in it
+	var duplicateErr, freshErr error
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		duplicateErr = writer.Write(ctx, main.MonitorHistorical{MonitorID: "batch-monitor", Status: main.MonitorStatusSuccess, Timestamp: now})
+	}()
+	go func() {
+		defer wg.Done()
+		freshErr = writer.Write(ctx, main.MonitorHistorical{MonitorID: "batch-monitor", Status: main.MonitorStatusSuccess, Timestamp: now.Add(time.Minute)})
+	}()
+	wg.Wait()
+
+	testutils.AssertError(t, duplicateErr, "Expected the duplicate row to fail")
+	testutils.AssertNoError(t, freshErr, "Expected the fresh row to be written")
+
+	// Invalid rows are rejected before they are queued
+	err = writer.Write(ctx, main.MonitorHistorical{Status: main.MonitorStatusSuccess})
+	testutils.AssertError(t, err, "Expected a validation error")
+}
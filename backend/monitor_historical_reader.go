@@ -4,6 +4,8 @@ import (
 	"context"
 	"database/sql"
 	"fmt"
+	"math"
+	"sync"
 	"time"
 
 	"github.com/getsentry/sentry-go"
@@ -12,6 +14,9 @@ import (
 
 type MonitorHistoricalReader struct {
 	db *sql.DB
+
+	dialectMutex sync.Mutex
+	dialect      Dialect
 }
 
 func NewMonitorHistoricalReader(db *sql.DB) *MonitorHistoricalReader {
@@ -30,6 +35,40 @@ type monitorHistoricalTableSchema struct {
 	TLSExpiryDate     sql.NullTime   `json:"tls_expiry_date,omitempty"`
 }
 
+// aggregateTableSchema holds the statistics columns of the aggregate tables.
+type aggregateTableSchema struct {
+	CheckCount     sql.NullInt64
+	FailureCount   sql.NullInt64
+	UptimeRatio    sql.NullFloat64
+	LatencyMin     sql.NullInt64
+	LatencyMax     sql.NullInt64
+	LatencyP50     sql.NullInt64
+	LatencyP95     sql.NullInt64
+	LatencyP99     sql.NullInt64
+	WorstStatus    sql.NullInt16
+	DominantStatus sql.NullInt16
+}
+
+// ToAggregateStatistics returns nil for aggregates that were written before the statistics were introduced.
+func (a aggregateTableSchema) ToAggregateStatistics() *AggregateStatistics {
+	if a.CheckCount.Int64 == 0 {
+		return nil
+	}
+
+	return &AggregateStatistics{
+		CheckCount:     a.CheckCount.Int64,
+		FailureCount:   a.FailureCount.Int64,
+		UptimeRatio:    a.UptimeRatio.Float64,
+		LatencyMin:     a.LatencyMin.Int64,
+		LatencyMax:     a.LatencyMax.Int64,
+		LatencyP50:     a.LatencyP50.Int64,
+		LatencyP95:     a.LatencyP95.Int64,
+		LatencyP99:     a.LatencyP99.Int64,
+		WorstStatus:    MonitorStatus(a.WorstStatus.Int16),
+		DominantStatus: MonitorStatus(a.DominantStatus.Int16),
+	}
+}
+
 func (m monitorHistoricalTableSchema) ToMonitorHistorical() MonitorHistorical {
 	return MonitorHistorical{
 		MonitorID:         m.MonitorID,
@@ -107,7 +146,7 @@ func (r *MonitorHistoricalReader) ReadHourlyHistorical(ctx context.Context, moni
 		}
 	}()
 
-	query := "SELECT timestamp, monitor_id, status, latency, additional_message, http_protocol, tls_version, tls_cipher, tls_expiry FROM monitor_historical_hourly_aggregate WHERE monitor_id = ? ORDER BY timestamp DESC"
+	query := "SELECT timestamp, monitor_id, status, latency, additional_message, http_protocol, tls_version, tls_cipher, tls_expiry, " + aggregateStatisticsColumns + " FROM monitor_historical_hourly_aggregate WHERE monitor_id = ? ORDER BY timestamp DESC"
 	if limitResults {
 		query += " LIMIT 100"
 	}
@@ -125,12 +164,19 @@ func (r *MonitorHistoricalReader) ReadHourlyHistorical(ctx context.Context, moni
 	var monitorsHistorical []MonitorHistorical
 	for rows.Next() {
 		var row monitorHistoricalTableSchema
-		err := rows.Scan(&row.Timestamp, &row.MonitorID, &row.Status, &row.Latency, &row.AdditionalMessage, &row.HttpProtocol, &row.TLSVersion, &row.TLSCipherName, &row.TLSExpiryDate)
+		var aggregate aggregateTableSchema
+		err := rows.Scan(
+			&row.Timestamp, &row.MonitorID, &row.Status, &row.Latency, &row.AdditionalMessage, &row.HttpProtocol, &row.TLSVersion, &row.TLSCipherName, &row.TLSExpiryDate,
+			&aggregate.CheckCount, &aggregate.FailureCount, &aggregate.UptimeRatio, &aggregate.LatencyMin, &aggregate.LatencyMax,
+			&aggregate.LatencyP50, &aggregate.LatencyP95, &aggregate.LatencyP99, &aggregate.WorstStatus, &aggregate.DominantStatus,
+		)
 		if err != nil {
 			return []MonitorHistorical{}, fmt.Errorf("failed to scan row")
 		}
 
-		monitorsHistorical = append(monitorsHistorical, row.ToMonitorHistorical())
+		historical := row.ToMonitorHistorical()
+		historical.Aggregate = aggregate.ToAggregateStatistics()
+		monitorsHistorical = append(monitorsHistorical, historical)
 	}
 
 	return monitorsHistorical, nil
@@ -153,7 +199,7 @@ func (r *MonitorHistoricalReader) ReadDailyHistorical(ctx context.Context, monit
 		}
 	}()
 
-	query := "SELECT timestamp, monitor_id, status, latency, additional_message, http_protocol, tls_version, tls_cipher, tls_expiry FROM monitor_historical_daily_aggregate WHERE monitor_id = ? ORDER BY timestamp DESC"
+	query := "SELECT timestamp, monitor_id, status, latency, additional_message, http_protocol, tls_version, tls_cipher, tls_expiry, " + aggregateStatisticsColumns + " FROM monitor_historical_daily_aggregate WHERE monitor_id = ? ORDER BY timestamp DESC"
 	if limitResults {
 		query += " LIMIT 100"
 	}
@@ -171,12 +217,19 @@ func (r *MonitorHistoricalReader) ReadDailyHistorical(ctx context.Context, monit
 	var monitorsHistorical []MonitorHistorical
 	for rows.Next() {
 		var row monitorHistoricalTableSchema
-		err := rows.Scan(&row.Timestamp, &row.MonitorID, &row.Status, &row.Latency, &row.AdditionalMessage, &row.HttpProtocol, &row.TLSVersion, &row.TLSCipherName, &row.TLSExpiryDate)
+		var aggregate aggregateTableSchema
+		err := rows.Scan(
+			&row.Timestamp, &row.MonitorID, &row.Status, &row.Latency, &row.AdditionalMessage, &row.HttpProtocol, &row.TLSVersion, &row.TLSCipherName, &row.TLSExpiryDate,
+			&aggregate.CheckCount, &aggregate.FailureCount, &aggregate.UptimeRatio, &aggregate.LatencyMin, &aggregate.LatencyMax,
+			&aggregate.LatencyP50, &aggregate.LatencyP95, &aggregate.LatencyP99, &aggregate.WorstStatus, &aggregate.DominantStatus,
+		)
 		if err != nil {
 			return []MonitorHistorical{}, fmt.Errorf("failed to scan row")
 		}
 
-		monitorsHistorical = append(monitorsHistorical, row.ToMonitorHistorical())
+		historical := row.ToMonitorHistorical()
+		historical.Aggregate = aggregate.ToAggregateStatistics()
+		monitorsHistorical = append(monitorsHistorical, historical)
 	}
 
 	return monitorsHistorical, nil
@@ -218,3 +271,305 @@ func (r *MonitorHistoricalReader) ReadRawLatest(ctx context.Context, monitorId s
 
 	return monitorsHistorical.ToMonitorHistorical(), nil
 }
+
+const aggregateStatisticsColumns = "check_count, failure_count, uptime_ratio, latency_min, latency_max, latency_p50, latency_p95, latency_p99, worst_status, dominant_status"
+
+// AggregateInterval is the size of an aggregate bucket, as understood by date_trunc.
+type AggregateInterval string
+
+const (
+	AggregateIntervalHour  AggregateInterval = "hour"
+	AggregateIntervalDay   AggregateInterval = "day"
+	AggregateIntervalMonth AggregateInterval = "month"
+)
+
+// Truncate returns the start of the bucket that contains t, in UTC.
+func (i AggregateInterval) Truncate(t time.Time) time.Time {
+	t = t.UTC()
+	switch i {
+	case AggregateIntervalDay:
+		return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	case AggregateIntervalMonth:
+		return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+	default:
+		return t.Truncate(time.Hour)
+	}
+}
+
+// Next returns the start of the bucket after the bucket that starts at t.
+func (i AggregateInterval) Next(t time.Time) time.Time {
+	switch i {
+	case AggregateIntervalDay:
+		return t.AddDate(0, 0, 1)
+	case AggregateIntervalMonth:
+		return t.AddDate(0, 1, 0)
+	default:
+		return t.Add(time.Hour)
+	}
+}
+
+func (r *MonitorHistoricalReader) getDialect(ctx context.Context, conn *sql.Conn) (Dialect, error) {
+	r.dialectMutex.Lock()
+	defer r.dialectMutex.Unlock()
+
+	if r.dialect != "" {
+		return r.dialect, nil
+	}
+
+	dialect, err := DetectDialect(ctx, conn)
+	if err != nil {
+		return "", err
+	}
+
+	r.dialect = dialect
+	return dialect, nil
+}
+
+// ReadAggregate aggregates the raw historical data of a monitor within [from, to) into buckets of the given
+// interval, in UTC. The aggregation is done by the database, so the raw rows are never loaded into memory.
+// Buckets without any check are omitted.
+func (r *MonitorHistoricalReader) ReadAggregate(ctx context.Context, monitorId string, interval AggregateInterval, from time.Time, to time.Time) ([]MonitorHistorical, error) {
+	span := sentry.StartSpan(ctx, "function", sentry.WithDescription("MonitorHistoricalReader.ReadAggregate"))
+	span.SetData("semyi.monitor.id", monitorId)
+	span.SetData("semyi.aggregate.interval", string(interval))
+	ctx = span.Context()
+	defer span.Finish()
+
+	buckets, err := r.readBuckets(ctx, monitorId, from, to, func(dialect Dialect) (string, []any) {
+		return dialect.EpochSeconds(fmt.Sprintf("date_trunc('%s', timestamp)", interval)), nil
+	})
+	if err != nil {
+		return []MonitorHistorical{}, err
+	}
+
+	aggregates := make([]MonitorHistorical, len(buckets))
+	for i, bucket := range buckets {
+		aggregates[i] = bucket.historical
+	}
+
+	return aggregates, nil
+}
+
+// aggregateBucket is a single bucket of aggregated raw historical data.
+type aggregateBucket struct {
+	historical   MonitorHistorical
+	statusCounts map[MonitorStatus]int64
+}
+
+// readBuckets aggregates the raw historical data within [from, to), grouped by the bucket expression.
+// The bucket expression must evaluate to the start of the bucket, in seconds since the Unix epoch.
+func (r *MonitorHistoricalReader) readBuckets(ctx context.Context, monitorId string, from time.Time, to time.Time, bucketExpression func(dialect Dialect) (string, []any)) ([]aggregateBucket, error) {
+	conn, err := r.db.Conn(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get connection: %w", err)
+	}
+	defer func() {
+		err := conn.Close()
+		if err != nil {
+			log.Warn().Stack().Err(err).Msg("failed to close connection")
+		}
+	}()
+
+	dialect, err := r.getDialect(ctx, conn)
+	if err != nil {
+		return nil, err
+	}
+
+	bucket, args := bucketExpression(dialect)
+	query := fmt.Sprintf(
+		`SELECT
+			%s AS bucket,
+			SUM(CASE WHEN status = %d THEN 1 ELSE 0 END),
+			SUM(CASE WHEN status = %d THEN 1 ELSE 0 END),
+			SUM(CASE WHEN status = %d THEN 1 ELSE 0 END),
+			SUM(CASE WHEN status = %d THEN 1 ELSE 0 END),
+			SUM(CASE WHEN status = %d THEN 1 ELSE 0 END),
+			AVG(latency),
+			MIN(latency),
+			MAX(latency),
+			%s,
+			%s,
+			%s,
+			%s,
+			%s,
+			%s,
+			%s,
+			%s
+		FROM
+			monitor_historical
+		WHERE
+			monitor_id = ?
+			AND timestamp >= ?
+			AND timestamp < ?
+		GROUP BY
+			bucket
+		ORDER BY
+			bucket ASC`,
+		bucket,
+		MonitorStatusSuccess,
+		MonitorStatusFailure,
+		MonitorStatusDegradedPerformance,
+		MonitorStatusUnderMaintenance,
+		MonitorStatusLimitedAvailability,
+		dialect.Quantile("latency", 0.5),
+		dialect.Quantile("latency", 0.95),
+		dialect.Quantile("latency", 0.99),
+		// Additional message is only relevant when the check was not successful
+		dialect.LatestWhere("additional_message", fmt.Sprintf("status <> %d", MonitorStatusSuccess)),
+		dialect.LatestWhere("http_protocol", ""),
+		dialect.LatestWhere("tls_version", ""),
+		dialect.LatestWhere("tls_cipher", ""),
+		dialect.LatestWhere("tls_expiry", ""),
+	)
+
+	args = append(args, monitorId, EnsureUTC(from), EnsureUTC(to))
+	rows, err := conn.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to aggregate historical data: %w", err)
+	}
+	defer func() {
+		if err := rows.Close(); err != nil {
+			log.Warn().Stack().Err(err).Msg("failed to close rows")
+		}
+	}()
+
+	var buckets []aggregateBucket
+	for rows.Next() {
+		var bucketStart float64
+		var success, failure, degraded, maintenance, limited int64
+		var averageLatency, p50, p95, p99 float64
+		var minLatency, maxLatency int64
+		var row monitorHistoricalTableSchema
+		err := rows.Scan(
+			&bucketStart, &success, &failure, &degraded, &maintenance, &limited,
+			&averageLatency, &minLatency, &maxLatency, &p50, &p95, &p99,
+			&row.AdditionalMessage, &row.HttpProtocol, &row.TLSVersion, &row.TLSCipherName, &row.TLSExpiryDate,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+
+		statusCounts := map[MonitorStatus]int64{
+			MonitorStatusSuccess:             success,
+			MonitorStatusFailure:             failure,
+			MonitorStatusDegradedPerformance: degraded,
+			MonitorStatusUnderMaintenance:    maintenance,
+			MonitorStatusLimitedAvailability: limited,
+		}
+		statistics := NewAggregateStatistics(statusCounts)
+		statistics.LatencyMin = minLatency
+		statistics.LatencyMax = maxLatency
+		statistics.LatencyP50 = int64(math.Round(p50))
+		statistics.LatencyP95 = int64(math.Round(p95))
+		statistics.LatencyP99 = int64(math.Round(p99))
+
+		row.MonitorID = monitorId
+		row.Timestamp = time.Unix(int64(bucketStart), 0).UTC()
+		row.Status = statistics.DominantStatus
+		row.Latency = int64(math.Round(averageLatency))
+		historical := row.ToMonitorHistorical()
+		if historical.Status == MonitorStatusSuccess {
+			historical.AdditionalMessage = ""
+		}
+		historical.Aggregate = &statistics
+
+		buckets = append(buckets, aggregateBucket{
+			historical:   historical,
+			statusCounts: statusCounts,
+		})
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate rows: %w", err)
+	}
+
+	return buckets, nil
+}
+
+// ReadRawOldestTimestamp returns the timestamp of the oldest raw historical data of a monitor.
+// It returns false if the monitor has no historical data.
+func (r *MonitorHistoricalReader) ReadRawOldestTimestamp(ctx context.Context, monitorId string) (time.Time, bool, error) {
+	span := sentry.StartSpan(ctx, "function", sentry.WithDescription("MonitorHistoricalReader.ReadRawOldestTimestamp"))
+	span.SetData("semyi.monitor.id", monitorId)
+	ctx = span.Context()
+	defer span.Finish()
+
+	conn, err := r.db.Conn(ctx)
+	if err != nil {
+		return time.Time{}, false, fmt.Errorf("failed to get connection: %w", err)
+	}
+	defer func() {
+		err := conn.Close()
+		if err != nil {
+			log.Warn().Stack().Err(err).Msg("failed to close connection")
+		}
+	}()
+
+	var oldest sql.NullTime
+	err = conn.QueryRowContext(ctx, "SELECT MIN(timestamp) FROM monitor_historical WHERE monitor_id = ?", monitorId).Scan(&oldest)
+	if err != nil {
+		return time.Time{}, false, fmt.Errorf("failed to read oldest raw historical data: %w", err)
+	}
+
+	// ClickHouse returns the zero value of the column instead of NULL for an empty set
+	if !oldest.Valid || oldest.Time.Unix() <= 0 {
+		return time.Time{}, false, nil
+	}
+
+	return oldest.Time, true, nil
+}
+
+// ReadRawStatuses calls fn with the timestamp and status of every raw historical data of a monitor within
+// [from, to), from the oldest to the newest. The rows are streamed, so a long range does not need to fit in memory.
+func (r *MonitorHistoricalReader) ReadRawStatuses(ctx context.Context, monitorId string, from time.Time, to time.Time, fn func(timestamp time.Time, status MonitorStatus) error) error {
+	span := sentry.StartSpan(ctx, "function", sentry.WithDescription("MonitorHistoricalReader.ReadRawStatuses"))
+	span.SetData("semyi.monitor.id", monitorId)
+	ctx = span.Context()
+	defer span.Finish()
+
+	conn, err := r.db.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get connection: %w", err)
+	}
+	defer func() {
+		err := conn.Close()
+		if err != nil {
+			log.Warn().Stack().Err(err).Msg("failed to close connection")
+		}
+	}()
+
+	rows, err := conn.QueryContext(
+		ctx,
+		"SELECT timestamp, status FROM monitor_historical WHERE monitor_id = ? AND timestamp >= ? AND timestamp < ? ORDER BY timestamp ASC",
+		monitorId,
+		EnsureUTC(from),
+		EnsureUTC(to),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to read raw historical data: %w", err)
+	}
+	defer func() {
+		if err := rows.Close(); err != nil {
+			log.Warn().Stack().Err(err).Msg("failed to close rows")
+		}
+	}()
+
+	for rows.Next() {
+		var timestamp time.Time
+		var status MonitorStatus
+		err := rows.Scan(&timestamp, &status)
+		if err != nil {
+			return fmt.Errorf("failed to scan row: %w", err)
+		}
+
+		if err := fn(timestamp, status); err != nil {
+			return err
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to iterate rows: %w", err)
+	}
+
+	return nil
+}
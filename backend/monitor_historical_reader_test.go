@@ -195,3 +195,64 @@ func TestMonitorHistoricalReader_ErrorCases(t *testing.T) {
 	_, err = reader.ReadRawHistorical(ctx, longID, false)
 	testutils.AssertNoError(t, err, "Expected error for too long monitor ID")
 }
+
+func TestMonitorHistoricalReader_ReadAggregate(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	ctx = sentry.SetHubOnContext(ctx, sentry.CurrentHub())
+
+	writer := main.NewMonitorHistoricalWriter(database)
+	reader := main.NewMonitorHistoricalReader(database)
+
+	// 51 successful checks and 49 failures within the same hour, and a single maintenance check
+	bucket := time.Date(2025, 3, 10, 8, 0, 0, 0, time.UTC)
+	for i := 0; i < 101; i++ {
+		status := main.MonitorStatusSuccess
+		if i >= 51 {
+			status = main.MonitorStatusFailure
+		}
+		if i == 100 {
+			status = main.MonitorStatusUnderMaintenance
+		}
+
+		err := writer.Write(ctx, main.MonitorHistorical{
+			MonitorID:         "aggregate-monitor",
+			Status:            status,
+			Latency:           int64(i + 1),
+			Timestamp:         bucket.Add(time.Duration(i) * 30 * time.Second),
+			AdditionalMessage: "connection refused",
+		})
+		testutils.AssertNoError(t, err, "Failed to write test data")
+	}
+
+	aggregates, err := reader.ReadAggregate(ctx, "aggregate-monitor", main.AggregateIntervalHour, bucket, bucket.Add(2*time.Hour))
+	testutils.AssertNoError(t, err, "Failed to aggregate historical data")
+	testutils.AssertEqual(t, 1, len(aggregates), "Expected a single hourly bucket")
+
+	aggregate := aggregates[0]
+	testutils.AssertTrue(t, aggregate.Timestamp.Equal(bucket), "Bucket should start at the hour")
+	testutils.AssertNotNil(t, aggregate.Aggregate, "Expected aggregate statistics")
+	testutils.AssertEqual(t, int64(101), aggregate.Aggregate.CheckCount, "Unexpected check count")
+	testutils.AssertEqual(t, int64(49), aggregate.Aggregate.FailureCount, "Unexpected failure count")
+	testutils.AssertEqual(t, 0.51, aggregate.Aggregate.UptimeRatio, "Maintenance should be excluded from the uptime ratio")
+	testutils.AssertEqual(t, int64(1), aggregate.Aggregate.LatencyMin, "Unexpected minimum latency")
+	testutils.AssertEqual(t, int64(101), aggregate.Aggregate.LatencyMax, "Unexpected maximum latency")
+	testutils.AssertEqual(t, int64(51), aggregate.Aggregate.LatencyP50, "Unexpected median latency")
+	testutils.AssertEqual(t, main.MonitorStatusFailure, aggregate.Aggregate.WorstStatus, "Unexpected worst status")
+	testutils.AssertEqual(t, main.MonitorStatusSuccess, aggregate.Aggregate.DominantStatus, "Unexpected dominant status")
+	testutils.AssertEqual(t, "", aggregate.AdditionalMessage, "Additional message should be empty for a successful bucket")
+
+	if materializedAggregates(t) {
+		return
+	}
+
+	// The statistics should survive a round trip through the hourly aggregate table
+	err = writer.WriteHourly(ctx, aggregate)
+	testutils.AssertNoError(t, err, "Failed to write hourly aggregate")
+
+	hourly, err := reader.ReadHourlyHistorical(ctx, "aggregate-monitor", false)
+	testutils.AssertNoError(t, err, "Failed to read hourly historical data")
+	testutils.AssertEqual(t, 1, len(hourly), "Expected a single hourly aggregate")
+	testutils.AssertNotNil(t, hourly[0].Aggregate, "Expected aggregate statistics")
+	testutils.AssertEqual(t, *aggregate.Aggregate, *hourly[0].Aggregate, "Statistics should be stored as is")
+}
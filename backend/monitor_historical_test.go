@@ -6,6 +6,7 @@ import (
 	"time"
 
 	main "semyi"
+	"semyi/testutils"
 )
 
 func TestMonitorHistorical_Validate(t *testing.T) {
@@ -61,3 +62,23 @@ func TestMonitorHistorical_Validate(t *testing.T) {
 		}
 	})
 }
+
+func TestNewAggregateStatistics(t *testing.T) {
+	statistics := main.NewAggregateStatistics(map[main.MonitorStatus]int64{
+		main.MonitorStatusSuccess:             3,
+		main.MonitorStatusDegradedPerformance: 3,
+		main.MonitorStatusFailure:             2,
+		main.MonitorStatusUnderMaintenance:    10,
+	})
+	testutils.AssertEqual(t, int64(18), statistics.CheckCount, "Unexpected check count")
+	testutils.AssertEqual(t, int64(2), statistics.FailureCount, "Unexpected failure count")
+	testutils.AssertEqual(t, 0.75, statistics.UptimeRatio, "Unexpected uptime ratio")
+	testutils.AssertEqual(t, main.MonitorStatusFailure, statistics.WorstStatus, "Unexpected worst status")
+	testutils.AssertEqual(t, main.MonitorStatusDegradedPerformance, statistics.DominantStatus, "Ties should resolve to the more severe status")
+
+	statistics = main.NewAggregateStatistics(map[main.MonitorStatus]int64{
+		main.MonitorStatusUnderMaintenance: 5,
+	})
+	testutils.AssertEqual(t, main.MonitorStatusUnderMaintenance, statistics.DominantStatus, "Expected maintenance when every check was under maintenance")
+	testutils.AssertEqual(t, 1.0, statistics.UptimeRatio, "Maintenance should not count against the uptime")
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"database/sql"
 	"fmt"
+	"sync"
 	"time"
 
 	"github.com/getsentry/sentry-go"
@@ -12,12 +13,142 @@ import (
 
 type MonitorHistoricalWriter struct {
 	db *sql.DB
+
+	materializedMutex    sync.Mutex
+	materializedDetected bool
+	materialized         bool
+	dialect              Dialect
 }
 
 func NewMonitorHistoricalWriter(db *sql.DB) *MonitorHistoricalWriter {
 	return &MonitorHistoricalWriter{db: db}
 }
 
+// materializedAggregateSelect folds the raw historical data within [from, to) of a monitor into aggregate
+// states. It is the query of the materialized views in migrations/clickhouse, with a filter, and has to be
+// kept in sync with them.
+const materializedAggregateSelect = `SELECT
+    monitor_id,
+    bucket AS timestamp,
+    countIf(status = 0) AS success_count,
+    countIf(status = 1) AS failure_count,
+    countIf(status = 2) AS degraded_count,
+    countIf(status = 3) AS maintenance_count,
+    countIf(status = 4) AS limited_count,
+    sum(toInt64(latency)) AS latency_sum,
+    min(latency) AS latency_min,
+    max(latency) AS latency_max,
+    quantilesState(0.5, 0.95, 0.99)(latency) AS latency_quantiles,
+    argMaxIfState(assumeNotNull(additional_message), checked_at, isNotNull(additional_message) AND status != 0) AS additional_message,
+    argMaxIfState(assumeNotNull(http_protocol), checked_at, isNotNull(http_protocol)) AS http_protocol,
+    argMaxIfState(assumeNotNull(tls_version), checked_at, isNotNull(tls_version)) AS tls_version,
+    argMaxIfState(assumeNotNull(tls_cipher), checked_at, isNotNull(tls_cipher)) AS tls_cipher,
+    argMaxIfState(assumeNotNull(tls_expiry), checked_at, isNotNull(tls_expiry)) AS tls_expiry,
+    max(now()) AS created_at
+FROM (
+    SELECT
+        monitor_id,
+        status,
+        latency,
+        additional_message,
+        http_protocol,
+        tls_version,
+        tls_cipher,
+        tls_expiry,
+        timestamp AS checked_at,
+        toDateTime(%s(timestamp), 'UTC') AS bucket
+    FROM monitor_historical
+    WHERE monitor_id = ? AND timestamp >= ? AND timestamp < ?
+)
+GROUP BY monitor_id, bucket`
+
+// MaterializedAggregates reports whether the aggregates are maintained by the database, with ClickHouse
+// materialized views or TimescaleDB continuous aggregates. The result is cached, since the schema does not
+// change while running.
+func (w *MonitorHistoricalWriter) MaterializedAggregates(ctx context.Context) (bool, error) {
+	w.materializedMutex.Lock()
+	defer w.materializedMutex.Unlock()
+
+	if w.materializedDetected {
+		return w.materialized, nil
+	}
+
+	conn, err := w.db.Conn(ctx)
+	if err != nil {
+		return false, fmt.Errorf("failed to get connection: %w", err)
+	}
+	defer func() {
+		err := conn.Close()
+		if err != nil {
+			log.Warn().Err(err).Msg("failed to close connection")
+		}
+	}()
+
+	dialect, err := DetectDialect(ctx, conn)
+	if err != nil {
+		return false, err
+	}
+
+	materialized, err := MaterializedAggregates(ctx, conn, dialect)
+	if err != nil {
+		return false, err
+	}
+
+	w.materialized = materialized
+	w.dialect = dialect
+	w.materializedDetected = true
+	return materialized, nil
+}
+
+// RebuildMaterializedAggregates recomputes the aggregates within [from, to) that the database maintains, from
+// the raw historical data. The ClickHouse materialized views only see new inserts, and the TimescaleDB refresh
+// policy only revisits recent buckets, so this is how the aggregates catch up after raw data has been deleted
+// or imported. TimescaleDB refreshes every monitor within the range.
+func (w *MonitorHistoricalWriter) RebuildMaterializedAggregates(ctx context.Context, monitorId string, interval AggregateInterval, from time.Time, to time.Time) error {
+	span := sentry.StartSpan(ctx, "function", sentry.WithDescription("MonitorHistoricalWriter.RebuildMaterializedAggregates"))
+	span.SetData("semyi.monitor.id", monitorId)
+	span.SetData("semyi.aggregate.interval", string(interval))
+	ctx = span.Context()
+	defer span.Finish()
+
+	if w.dialect == DialectPostgres {
+		return w.refreshContinuousAggregate(ctx, interval, from, to)
+	}
+
+	table := "monitor_historical_hourly_aggregate_state"
+	bucket := "toStartOfHour"
+	if interval == AggregateIntervalDay {
+		table = "monitor_historical_daily_aggregate_state"
+		bucket = "toStartOfDay"
+	}
+
+	conn, err := w.db.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get connection: %w", err)
+	}
+	defer func() {
+		err := conn.Close()
+		if err != nil {
+			log.Warn().Err(err).Msg("failed to close connection")
+		}
+	}()
+
+	from = EnsureUTC(from)
+	to = EnsureUTC(to)
+
+	_, err = conn.ExecContext(ctx, "DELETE FROM "+table+" WHERE monitor_id = ? AND timestamp >= ? AND timestamp < ?", monitorId, from, to)
+	if err != nil {
+		return fmt.Errorf("failed to delete aggregate states: %w", err)
+	}
+
+	_, err = conn.ExecContext(ctx, "INSERT INTO "+table+" "+fmt.Sprintf(materializedAggregateSelect, bucket), monitorId, from, to)
+	if err != nil {
+		return fmt.Errorf("failed to insert aggregate states: %w", err)
+	}
+
+	return nil
+}
+
 func (w *MonitorHistoricalWriter) Write(ctx context.Context, historical MonitorHistorical) error {
 	span := sentry.StartSpan(ctx, "function", sentry.WithDescription("MonitorHistoricalWriter.Write"))
 	span.SetData("semyi.monitor.id", historical.MonitorID)
@@ -109,6 +240,12 @@ func (w *MonitorHistoricalWriter) WriteHourly(ctx context.Context, historical Mo
 		return nil
 	}
 
+	// Aggregates written without statistics are stored with zero values, which are read back as nil.
+	var statistics AggregateStatistics
+	if historical.Aggregate != nil {
+		statistics = *historical.Aggregate
+	}
+
 	// Insert the historical data into the database
 	conn, err := w.db.Conn(ctx)
 	if err != nil {
@@ -149,10 +286,30 @@ func (w *MonitorHistoricalWriter) WriteHourly(ctx context.Context, historical Mo
 				http_protocol,
 				tls_version,
 				tls_cipher,
-				tls_expiry
+				tls_expiry,
+				check_count,
+				failure_count,
+				uptime_ratio,
+				latency_min,
+				latency_max,
+				latency_p50,
+				latency_p95,
+				latency_p99,
+				worst_status,
+				dominant_status
 			)
 		VALUES
 			(
+				?,
+				?,
+				?,
+				?,
+				?,
+				?,
+				?,
+				?,
+				?,
+				?,
 				?,
 				?,
 				?,
@@ -174,6 +331,16 @@ func (w *MonitorHistoricalWriter) WriteHourly(ctx context.Context, historical Mo
 		sql.NullString{String: historical.TLSVersion, Valid: historical.TLSVersion != ""},
 		sql.NullString{String: historical.TLSCipherName, Valid: historical.TLSCipherName != ""},
 		sql.NullTime{Time: historical.TLSExpiryDate, Valid: !historical.TLSExpiryDate.IsZero()},
+		statistics.CheckCount,
+		statistics.FailureCount,
+		statistics.UptimeRatio,
+		statistics.LatencyMin,
+		statistics.LatencyMax,
+		statistics.LatencyP50,
+		statistics.LatencyP95,
+		statistics.LatencyP99,
+		uint8(statistics.WorstStatus),
+		uint8(statistics.DominantStatus),
 	)
 	if err != nil {
 		if rollbackErr := tx.Rollback(); rollbackErr != nil {
@@ -207,6 +374,12 @@ func (w *MonitorHistoricalWriter) WriteDaily(ctx context.Context, historical Mon
 		return nil
 	}
 
+	// Aggregates written without statistics are stored with zero values, which are read back as nil.
+	var statistics AggregateStatistics
+	if historical.Aggregate != nil {
+		statistics = *historical.Aggregate
+	}
+
 	// Insert the historical data into the database
 	conn, err := w.db.Conn(ctx)
 	if err != nil {
@@ -247,10 +420,30 @@ func (w *MonitorHistoricalWriter) WriteDaily(ctx context.Context, historical Mon
 				http_protocol,
 				tls_version,
 				tls_cipher,
-				tls_expiry
+				tls_expiry,
+				check_count,
+				failure_count,
+				uptime_ratio,
+				latency_min,
+				latency_max,
+				latency_p50,
+				latency_p95,
+				latency_p99,
+				worst_status,
+				dominant_status
 			)
 		VALUES
 			(
+				?,
+				?,
+				?,
+				?,
+				?,
+				?,
+				?,
+				?,
+				?,
+				?,
 				?,
 				?,
 				?,
@@ -272,6 +465,16 @@ func (w *MonitorHistoricalWriter) WriteDaily(ctx context.Context, historical Mon
 		sql.NullString{String: historical.TLSVersion, Valid: historical.TLSVersion != ""},
 		sql.NullString{String: historical.TLSCipherName, Valid: historical.TLSCipherName != ""},
 		sql.NullTime{Time: historical.TLSExpiryDate, Valid: !historical.TLSExpiryDate.IsZero()},
+		statistics.CheckCount,
+		statistics.FailureCount,
+		statistics.UptimeRatio,
+		statistics.LatencyMin,
+		statistics.LatencyMax,
+		statistics.LatencyP50,
+		statistics.LatencyP95,
+		statistics.LatencyP99,
+		uint8(statistics.WorstStatus),
+		uint8(statistics.DominantStatus),
 	)
 	if err != nil {
 		if rollbackErr := tx.Rollback(); rollbackErr != nil {
@@ -288,3 +491,58 @@ func (w *MonitorHistoricalWriter) WriteDaily(ctx context.Context, historical Mon
 
 	return nil
 }
+
+// refreshContinuousAggregate refreshes the TimescaleDB continuous aggregate of the interval within [from, to).
+func (w *MonitorHistoricalWriter) refreshContinuousAggregate(ctx context.Context, interval AggregateInterval, from time.Time, to time.Time) error {
+	for _, aggregate := range continuousAggregates {
+		if aggregate.interval != interval {
+			continue
+		}
+
+		// refresh_continuous_aggregate can not run within a transaction, and its window can not be bound, as
+		// the type of the parameters can not be inferred.
+		_, err := w.db.ExecContext(ctx, fmt.Sprintf(
+			"CALL refresh_continuous_aggregate('%s', TIMESTAMP '%s', TIMESTAMP '%s')",
+			aggregate.continuousView,
+			EnsureUTC(from).Format(time.DateTime),
+			EnsureUTC(to).Format(time.DateTime),
+		))
+		if err != nil {
+			return fmt.Errorf("failed to refresh continuous aggregate: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// DeleteAggregates removes the aggregates of a monitor within [from, to) for the given interval.
+func (w *MonitorHistoricalWriter) DeleteAggregates(ctx context.Context, monitorId string, interval AggregateInterval, from time.Time, to time.Time) error {
+	span := sentry.StartSpan(ctx, "function", sentry.WithDescription("MonitorHistoricalWriter.DeleteAggregates"))
+	span.SetData("semyi.monitor.id", monitorId)
+	span.SetData("semyi.aggregate.interval", string(interval))
+	ctx = span.Context()
+	defer span.Finish()
+
+	table := "monitor_historical_hourly_aggregate"
+	if interval == AggregateIntervalDay {
+		table = "monitor_historical_daily_aggregate"
+	}
+
+	conn, err := w.db.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get connection: %w", err)
+	}
+	defer func() {
+		err := conn.Close()
+		if err != nil {
+			log.Warn().Err(err).Msg("failed to close connection")
+		}
+	}()
+
+	_, err = conn.ExecContext(ctx, "DELETE FROM "+table+" WHERE monitor_id = ? AND timestamp >= ? AND timestamp < ?", monitorId, EnsureUTC(from), EnsureUTC(to))
+	if err != nil {
+		return fmt.Errorf("failed to delete aggregate data: %w", err)
+	}
+
+	return nil
+}
@@ -66,6 +66,8 @@ func TestMonitorHistoricalWriter_WriteHourly(t *testing.T) {
 		return
 	}
 
+	skipIfMaterializedAggregates(t)
+
 	writer := main.NewMonitorHistoricalWriter(database)
 	if writer == nil {
 		t.Error("expected MonitorHistoricalWriter, got nil")
@@ -137,6 +139,8 @@ func TestMonitorHistoricalWriter_WriteDaily(t *testing.T) {
 		return
 	}
 
+	skipIfMaterializedAggregates(t)
+
 	writer := main.NewMonitorHistoricalWriter(database)
 	if writer == nil {
 		t.Error("expected MonitorHistoricalWriter, got nil")
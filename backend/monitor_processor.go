@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"math"
 	"time"
@@ -11,13 +12,19 @@ import (
 )
 
 type Processor struct {
-	HistoricalWriter      *MonitorHistoricalWriter
-	HistoricalReader      *MonitorHistoricalReader
-	CentralBroker         *Broker[MonitorHistorical]
-	TelegramAlertProvider Alerter
-	DiscordAlertProvider  Alerter
-	HTTPAlertProvider     Alerter
-	SlackAlertProvider    Alerter
+	HistoricalWriter RawHistoricalWriter
+	HistoricalReader HistoricalReader
+	CentralBroker    *Broker[MonitorHistorical]
+	States           *MonitorStateStore
+	Spool            *HistoricalSpool
+	Maintenance      *MaintenanceSchedule
+	Outages          *OutageTracker
+	// AlertRouter sends the alerts of each monitor to its alert providers. Alerting is disabled if nil.
+	AlertRouter *AlertRouter
+	// Escalations escalates the down alerts of the monitors with an escalation policy. This is optional.
+	Escalations *Escalator
+	// AlertRules filters, holds and groups the alerts before they are routed. This is optional.
+	AlertRules *AlertRules
 }
 
 func (m *Processor) ProcessResponse(ctx context.Context, response Response) {
@@ -37,6 +44,12 @@ func (m *Processor) ProcessResponse(ctx context.Context, response Response) {
 		uniqueId = uniqueId[:255]
 	}
 
+	// Checks are still executed during a maintenance window, so the status page can show whether
+	// the service is back, but the result is recorded as "Under Maintenance" instead.
+	if m.Maintenance.IsUnderMaintenance(response.Monitor.UniqueID, response.Timestamp) {
+		status = MonitorStatusUnderMaintenance
+	}
+
 	// Add breadcrumb for monitor processing
 	sentry.AddBreadcrumb(&sentry.Breadcrumb{
 		Category: "monitor",
@@ -50,14 +63,6 @@ func (m *Processor) ProcessResponse(ctx context.Context, response Response) {
 		},
 	})
 
-	lastHistoricalAvailable := true
-	lastHistorical, err := m.HistoricalReader.ReadRawLatest(ctx, uniqueId)
-	if err != nil {
-		lastHistoricalAvailable = false
-		log.Error().Err(err).Msg("failed to read historical data")
-		sentry.GetHubFromContext(ctx).CaptureException(err)
-	}
-
 	monitorHistorical := MonitorHistorical{
 		MonitorID:         uniqueId,
 		Status:            status,
@@ -70,88 +75,83 @@ func (m *Processor) ProcessResponse(ctx context.Context, response Response) {
 		TLSExpiryDate:     response.TLSExpiryDate,
 	}
 
-	attemptRemaining := 3
-	attemptedEntries := 0
-	for attemptRemaining > 0 {
-		err := m.HistoricalWriter.Write(ctx, monitorHistorical)
-		if err != nil {
-			attemptedEntries++
-			if attemptRemaining == 0 {
-				log.Error().Err(err).Msgf("failed to write historical data. Attempt %d failed\n", attemptedEntries)
-				sentry.GetHubFromContext(ctx).CaptureException(err)
-				return
-			}
-
-			delay := time.Second * time.Duration(math.Pow(2, math.Abs(float64(attemptedEntries))))
-			log.Error().Err(err).Msgf("failed to write historical data. Attempt %d failed. Retrying in %v...\n", attemptedEntries, delay)
-			sentry.GetHubFromContext(ctx).CaptureException(err)
+	transition := m.States.Observe(response.Monitor, monitorHistorical)
+	if transition.Flapping {
+		log.Debug().Str("monitor_id", uniqueId).Msg("monitor is flapping, holding alerts")
+	}
 
-			time.Sleep(delay)
+	m.writeHistorical(ctx, monitorHistorical)
 
-			attemptRemaining -= 1
-			continue
+	var outage *Outage
+	if m.Outages != nil {
+		var err error
+		outage, err = m.Outages.Observe(ctx, monitorHistorical, transition)
+		if err != nil {
+			log.Error().Err(err).Str("monitor_id", uniqueId).Msg("failed to track outage")
+			sentry.GetHubFromContext(ctx).CaptureException(err)
 		}
-
-		break
 	}
 
 	go func() {
 		ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), time.Minute*5)
 		defer cancel()
 
-		if !lastHistoricalAvailable {
+		// We only send an alert once the state change is confirmed, see MonitorTransition for details.
+		if !transition.Alert {
 			return
 		}
 
-		// If the lastHistorical has difference with the current response, we should send an alert
-		if lastHistorical.Status == status {
-			return
+		alertMessage := AlertMessage{
+			Success:           response.Success,
+			MonitorID:         uniqueId,
+			MonitorName:       response.Monitor.Name,
+			StatusCode:        response.StatusCode,
+			Timestamp:         response.Timestamp,
+			Latency:           response.RequestDuration,
+			Monitor:           response.Monitor,
+			Status:            transition.Current,
+			PreviousStatus:    transition.Previous,
+			AdditionalMessage: response.AdditionalMessage,
+			HttpProtocol:      response.HttpProtocol,
+			TLSVersion:        response.TLSVersion,
+			TLSCipherName:     response.TLSCipherName,
+			TLSExpiryDate:     response.TLSExpiryDate,
+			PublicURL:         response.Monitor.PublicUrl,
+			Description:       response.Monitor.Description,
 		}
 
-		if m.TelegramAlertProvider == nil && m.DiscordAlertProvider == nil && m.HTTPAlertProvider == nil && m.SlackAlertProvider == nil {
-			log.Warn().Msg("no alert providers are set, skipping alert")
-			return
+		if outage != nil && outage.EndedAt != nil {
+			alertMessage.OutageDuration = time.Duration(outage.DurationSeconds) * time.Second
 		}
 
-		alertMessage := AlertMessage{
-			Success:     response.Success,
-			MonitorID:   uniqueId,
-			MonitorName: response.Monitor.Name,
-			StatusCode:  response.StatusCode,
-			Timestamp:   response.Timestamp,
-			Latency:     response.RequestDuration,
+		startedAt := response.Timestamp
+		if outage != nil && outage.EndedAt == nil {
+			startedAt = outage.StartedAt
 		}
 
-		if m.TelegramAlertProvider != nil {
-			err := m.TelegramAlertProvider.Send(ctx, alertMessage)
+		// The alert rules start the escalation themselves, once the alert passes them
+		if m.AlertRules != nil {
+			err := m.AlertRules.Apply(ctx, alertMessage, startedAt)
 			if err != nil {
-				log.Error().Err(err).Msg("failed to send telegram alert")
+				log.Error().Err(err).Msg("failed to send alert")
 				sentry.GetHubFromContext(ctx).CaptureException(err)
 			}
+			return
 		}
 
-		if m.DiscordAlertProvider != nil {
-			err := m.DiscordAlertProvider.Send(ctx, alertMessage)
-			if err != nil {
-				log.Error().Err(err).Msg("failed to send discord alert")
-				sentry.GetHubFromContext(ctx).CaptureException(err)
-			}
+		if m.Escalations != nil {
+			m.Escalations.Observe(ctx, alertMessage, startedAt)
 		}
 
-		if m.HTTPAlertProvider != nil {
-			err := m.HTTPAlertProvider.Send(ctx, alertMessage)
-			if err != nil {
-				log.Error().Err(err).Msg("failed to send http alert")
-				sentry.GetHubFromContext(ctx).CaptureException(err)
-			}
+		if m.AlertRouter == nil || len(m.AlertRouter.Route(uniqueId)) == 0 {
+			log.Warn().Str("monitor_id", uniqueId).Msg("no alert providers are set, skipping alert")
+			return
 		}
 
-		if m.SlackAlertProvider != nil {
-			err := m.SlackAlertProvider.Send(ctx, alertMessage)
-			if err != nil {
-				log.Error().Err(err).Msg("failed to send slack alert")
-				sentry.GetHubFromContext(ctx).CaptureException(err)
-			}
+		err := m.Send(ctx, alertMessage)
+		if err != nil {
+			log.Error().Err(err).Msg("failed to send alert")
+			sentry.GetHubFromContext(ctx).CaptureException(err)
 		}
 	}()
 
@@ -163,3 +163,68 @@ func (m *Processor) ProcessResponse(ctx context.Context, response Response) {
 		Body: monitorHistorical,
 	})
 }
+
+// Ensure Processor implements Alerter interface
+var _ Alerter = (*Processor)(nil)
+
+// Send sends the alert message through the alert providers of its monitor, see AlertRouter. The alert rules
+// apply first if they are configured, see AlertRules.
+func (m *Processor) Send(ctx context.Context, msg AlertMessage) error {
+	if m.AlertRouter == nil {
+		return nil
+	}
+
+	if m.AlertRules != nil {
+		return m.AlertRules.Send(ctx, msg)
+	}
+
+	return m.AlertRouter.Send(ctx, msg)
+}
+
+// writeHistorical writes the check result to the database. If the database is unavailable, the result is
+// written to the spool instead, to be replayed once the database recovers.
+func (m *Processor) writeHistorical(ctx context.Context, monitorHistorical MonitorHistorical) {
+	// While the spool has pending entries, new results have to go behind them to keep the order.
+	if m.Spool != nil && m.Spool.Pending() > 0 {
+		m.spoolHistorical(ctx, monitorHistorical)
+		return
+	}
+
+	var err error
+	for attempt := 1; attempt <= 3; attempt++ {
+		err = m.HistoricalWriter.Write(ctx, monitorHistorical)
+		if err == nil {
+			return
+		}
+
+		var validationError *ValidationError
+		if errors.As(err, &validationError) {
+			log.Error().Err(err).Msg("invalid historical data")
+			sentry.GetHubFromContext(ctx).CaptureException(err)
+			return
+		}
+
+		if attempt == 3 {
+			break
+		}
+
+		delay := time.Second * time.Duration(math.Pow(2, float64(attempt)))
+		log.Error().Err(err).Msgf("failed to write historical data. Attempt %d failed. Retrying in %v...", attempt, delay)
+		time.Sleep(delay)
+	}
+
+	log.Error().Err(err).Msg("failed to write historical data after 3 attempts")
+	sentry.GetHubFromContext(ctx).CaptureException(err)
+
+	if m.Spool != nil {
+		m.spoolHistorical(ctx, monitorHistorical)
+	}
+}
+
+func (m *Processor) spoolHistorical(ctx context.Context, monitorHistorical MonitorHistorical) {
+	err := m.Spool.Append(monitorHistorical)
+	if err != nil {
+		log.Error().Err(err).Str("monitor_id", monitorHistorical.MonitorID).Msg("failed to write historical data to the spool")
+		sentry.GetHubFromContext(ctx).CaptureException(err)
+	}
+}
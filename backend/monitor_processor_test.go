@@ -19,6 +19,25 @@ func (m *MockAlerter) Send(ctx context.Context, alert main.AlertMessage) error {
 	return nil
 }
 
+// newMockAlertRouter creates an alert router with the given alerters as providers, named after their key, on
+// top of the providers of the configuration.
+func newMockAlertRouter[A main.Alerter](t *testing.T, config main.AlertRouterConfig, alerters map[string]A) *main.AlertRouter {
+	t.Helper()
+
+	providers := make(map[string]main.Alerter)
+	for name, alerter := range config.Providers {
+		providers[name] = alerter
+	}
+	for name, alerter := range alerters {
+		providers[name] = alerter
+	}
+	config.Providers = providers
+
+	router, err := main.NewAlertRouter(config)
+	testutils.AssertNoError(t, err, "Failed to create alert router")
+	return router
+}
+
 func TestProcessor_ProcessResponse(t *testing.T) {
 	t.Skip()
 	// Create mock dependencies
@@ -29,13 +48,11 @@ func TestProcessor_ProcessResponse(t *testing.T) {
 
 	// Create processor with mock dependencies
 	processor := &main.Processor{
-		HistoricalWriter:      mockWriter,
-		HistoricalReader:      mockReader,
-		CentralBroker:         mockBroker,
-		TelegramAlertProvider: mockAlerter,
-		DiscordAlertProvider:  mockAlerter,
-		HTTPAlertProvider:     mockAlerter,
-		SlackAlertProvider:    mockAlerter,
+		HistoricalWriter: mockWriter,
+		HistoricalReader: mockReader,
+		CentralBroker:    mockBroker,
+		States:           main.NewMonitorStateStore(0),
+		AlertRouter:      newMockAlertRouter(t, main.AlertRouterConfig{}, map[string]*MockAlerter{"mock": mockAlerter}),
 	}
 
 	// Test cases
@@ -98,13 +115,11 @@ func TestProcessor_ProcessResponse_WithLongID(t *testing.T) {
 
 	// Create processor with mock dependencies
 	processor := &main.Processor{
-		HistoricalWriter:      mockWriter,
-		HistoricalReader:      mockReader,
-		CentralBroker:         mockBroker,
-		TelegramAlertProvider: mockAlerter,
-		DiscordAlertProvider:  mockAlerter,
-		HTTPAlertProvider:     mockAlerter,
-		SlackAlertProvider:    mockAlerter,
+		HistoricalWriter: mockWriter,
+		HistoricalReader: mockReader,
+		CentralBroker:    mockBroker,
+		States:           main.NewMonitorStateStore(0),
+		AlertRouter:      newMockAlertRouter(t, main.AlertRouterConfig{}, map[string]*MockAlerter{"mock": mockAlerter}),
 	}
 
 	// Create a response with a very long ID
@@ -136,13 +151,11 @@ func TestProcessor_ProcessResponse_WithError(t *testing.T) {
 
 	// Create processor with mock dependencies
 	processor := &main.Processor{
-		HistoricalWriter:      mockWriter,
-		HistoricalReader:      mockReader,
-		CentralBroker:         mockBroker,
-		TelegramAlertProvider: mockAlerter,
-		DiscordAlertProvider:  mockAlerter,
-		HTTPAlertProvider:     mockAlerter,
-		SlackAlertProvider:    mockAlerter,
+		HistoricalWriter: mockWriter,
+		HistoricalReader: mockReader,
+		CentralBroker:    mockBroker,
+		States:           main.NewMonitorStateStore(0),
+		AlertRouter:      newMockAlertRouter(t, main.AlertRouterConfig{}, map[string]*MockAlerter{"mock": mockAlerter}),
 	}
 
 	// Create a response with an error
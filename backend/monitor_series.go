@@ -0,0 +1,196 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/getsentry/sentry-go"
+)
+
+const (
+	minSeriesStep = time.Minute
+	// maxSeriesStep is the longest fixed step. Longer steps should use the calendar month step.
+	maxSeriesStep    = 31 * 24 * time.Hour
+	maxSeriesBuckets = 10000
+)
+
+// SeriesStep is the bucket size of a time series. It is either a fixed duration,
+// or a calendar month, since months do not have a fixed duration.
+type SeriesStep struct {
+	Duration time.Duration
+	Month    bool
+}
+
+// ParseSeriesStep parses a step in Go's duration format (e.g. "5m", "1h"), with the additional "d" (day)
+// and "w" (week) units, or "1mo" for a calendar month. The step must be between 1 minute and 1 month, in whole
+// seconds, since the buckets are aligned to the epoch in seconds.
+func ParseSeriesStep(value string) (SeriesStep, error) {
+	if value == "1mo" {
+		return SeriesStep{Month: true}, nil
+	}
+
+	duration, err := parseDuration(value)
+	if err != nil {
+		return SeriesStep{}, fmt.Errorf("invalid step %q: %w", value, err)
+	}
+
+	if duration < minSeriesStep || duration > maxSeriesStep {
+		return SeriesStep{}, fmt.Errorf("step must be between 1m and 1mo")
+	}
+
+	if duration%time.Second != 0 {
+		return SeriesStep{}, fmt.Errorf("step must be a whole number of seconds")
+	}
+
+	return SeriesStep{Duration: duration}, nil
+}
+
+// parseDuration parses a duration in Go's duration format, with the additional "d" (day) and "w" (week) units.
+func parseDuration(value string) (time.Duration, error) {
+	if !strings.HasSuffix(value, "d") && !strings.HasSuffix(value, "w") {
+		return time.ParseDuration(value)
+	}
+
+	unit := 24 * time.Hour
+	if strings.HasSuffix(value, "w") {
+		unit = 7 * 24 * time.Hour
+	}
+
+	count, err := strconv.Atoi(value[:len(value)-1])
+	if err != nil {
+		return 0, err
+	}
+
+	return time.Duration(count) * unit, nil
+}
+
+func (s SeriesStep) String() string {
+	if s.Month {
+		return "1mo"
+	}
+
+	return s.Duration.String()
+}
+
+// Truncate returns the start of the bucket that contains t. Fixed steps are aligned to the Unix epoch,
+// so the buckets stay the same regardless of the requested range.
+func (s SeriesStep) Truncate(t time.Time) time.Time {
+	if s.Month {
+		return AggregateIntervalMonth.Truncate(t)
+	}
+
+	seconds := int64(s.Duration / time.Second)
+	unix := t.Unix()
+	return time.Unix(unix-((unix%seconds)+seconds)%seconds, 0).UTC()
+}
+
+// Next returns the start of the bucket after the bucket that starts at t.
+func (s SeriesStep) Next(t time.Time) time.Time {
+	if s.Month {
+		return AggregateIntervalMonth.Next(t)
+	}
+
+	return t.Add(s.Duration)
+}
+
+// BucketCount returns the number of buckets that overlap with [from, to).
+func (s SeriesStep) BucketCount(from time.Time, to time.Time) int {
+	var count int
+	for start := s.Truncate(from); start.Before(to); start = s.Next(start) {
+		count++
+		if count > maxSeriesBuckets {
+			break
+		}
+	}
+
+	return count
+}
+
+// StatusRatios holds the ratio (0-1) of checks within a bucket for each status.
+type StatusRatios struct {
+	Success             float64 `json:"success"`
+	Failure             float64 `json:"failure"`
+	DegradedPerformance float64 `json:"degraded_performance"`
+	UnderMaintenance    float64 `json:"under_maintenance"`
+	LimitedAvailability float64 `json:"limited_availability"`
+}
+
+// MonitorSeriesBucket is a single bucket of a time series.
+type MonitorSeriesBucket struct {
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+	// Latency is the average latency of the checks within the bucket.
+	Latency      int64        `json:"latency"`
+	StatusRatios StatusRatios `json:"status_ratios"`
+	// Statistics is null if there is no check within the bucket.
+	Statistics *AggregateStatistics `json:"statistics"`
+}
+
+// ReadSeries aggregates the raw historical data of a monitor within [from, to) into buckets of the given step.
+// Every bucket within the range is returned, including the ones without any check.
+func (r *MonitorHistoricalReader) ReadSeries(ctx context.Context, monitorId string, from time.Time, to time.Time, step SeriesStep) ([]MonitorSeriesBucket, error) {
+	span := sentry.StartSpan(ctx, "function", sentry.WithDescription("MonitorHistoricalReader.ReadSeries"))
+	span.SetData("semyi.monitor.id", monitorId)
+	span.SetData("semyi.series.step", step.String())
+	ctx = span.Context()
+	defer span.Finish()
+
+	if count := step.BucketCount(from, to); count > maxSeriesBuckets {
+		return nil, fmt.Errorf("too many buckets, the range must contain at most %d steps", maxSeriesBuckets)
+	}
+
+	origin := step.Truncate(from)
+	buckets, err := r.readBuckets(ctx, monitorId, origin, to, func(dialect Dialect) (string, []any) {
+		if step.Month {
+			return dialect.EpochSeconds("date_trunc('month', timestamp)"), nil
+		}
+
+		seconds := int64(step.Duration / time.Second)
+		epoch := dialect.EpochSeconds("timestamp")
+		return fmt.Sprintf("CAST(? + FLOOR((%s - ?) / ?) * ? AS BIGINT)", epoch), []any{origin.Unix(), origin.Unix(), seconds, seconds}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return newSeries(buckets, origin, to, step), nil
+}
+
+// newSeries returns every bucket of the given step within [origin, to), filled with the aggregated buckets.
+func newSeries(buckets []aggregateBucket, origin time.Time, to time.Time, step SeriesStep) []MonitorSeriesBucket {
+	bucketsByStart := make(map[int64]aggregateBucket, len(buckets))
+	for _, bucket := range buckets {
+		bucketsByStart[bucket.historical.Timestamp.Unix()] = bucket
+	}
+
+	var series []MonitorSeriesBucket
+	for start := origin; start.Before(to); start = step.Next(start) {
+		seriesBucket := MonitorSeriesBucket{
+			Start: start,
+			End:   step.Next(start),
+		}
+
+		if bucket, ok := bucketsByStart[start.Unix()]; ok && bucket.historical.Aggregate != nil {
+			statistics := bucket.historical.Aggregate
+			seriesBucket.Latency = bucket.historical.Latency
+			seriesBucket.Statistics = statistics
+			if statistics.CheckCount > 0 {
+				total := float64(statistics.CheckCount)
+				seriesBucket.StatusRatios = StatusRatios{
+					Success:             float64(bucket.statusCounts[MonitorStatusSuccess]) / total,
+					Failure:             float64(bucket.statusCounts[MonitorStatusFailure]) / total,
+					DegradedPerformance: float64(bucket.statusCounts[MonitorStatusDegradedPerformance]) / total,
+					UnderMaintenance:    float64(bucket.statusCounts[MonitorStatusUnderMaintenance]) / total,
+					LimitedAvailability: float64(bucket.statusCounts[MonitorStatusLimitedAvailability]) / total,
+				}
+			}
+		}
+
+		series = append(series, seriesBucket)
+	}
+
+	return series
+}
@@ -0,0 +1,144 @@
+package main_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	main "semyi"
+	"semyi/testutils"
+
+	"github.com/getsentry/sentry-go"
+)
+
+func TestParseSeriesStep(t *testing.T) {
+	tests := []struct {
+		value    string
+		expected main.SeriesStep
+		wantErr  bool
+	}{
+		{value: "1m", expected: main.SeriesStep{Duration: time.Minute}},
+		{value: "5m", expected: main.SeriesStep{Duration: 5 * time.Minute}},
+		{value: "1d", expected: main.SeriesStep{Duration: 24 * time.Hour}},
+		{value: "2w", expected: main.SeriesStep{Duration: 14 * 24 * time.Hour}},
+		{value: "1mo", expected: main.SeriesStep{Month: true}},
+		{value: "30s", wantErr: true},
+		{value: "32d", wantErr: true},
+		{value: "90500ms", wantErr: true},
+		{value: "1m30.5s", wantErr: true},
+		{value: "abc", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			step, err := main.ParseSeriesStep(tt.value)
+			if tt.wantErr {
+				testutils.AssertError(t, err, "Expected an invalid step")
+				return
+			}
+
+			testutils.AssertNoError(t, err, "Expected a valid step")
+			testutils.AssertEqual(t, tt.expected, step, "Unexpected step")
+		})
+	}
+}
+
+func TestMonitorHistoricalReader_ReadSeries(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	ctx = sentry.SetHubOnContext(ctx, sentry.CurrentHub())
+
+	writer := main.NewMonitorHistoricalWriter(database)
+	reader := main.NewMonitorHistoricalReader(database)
+
+	start := time.Date(2025, 4, 1, 12, 0, 0, 0, time.UTC)
+	statuses := []main.MonitorStatus{
+		main.MonitorStatusSuccess,
+		main.MonitorStatusFailure,
+		main.MonitorStatusSuccess,
+		main.MonitorStatusSuccess,
+	}
+	for i, status := range statuses {
+		err := writer.Write(ctx, main.MonitorHistorical{
+			MonitorID: "series-monitor",
+			Status:    status,
+			Latency:   int64(100 * (i + 1)),
+			Timestamp: start.Add(time.Duration(i) * time.Minute),
+		})
+		testutils.AssertNoError(t, err, "Failed to write test data")
+	}
+
+	// The last check is in its own bucket, the one in between has no check
+	err := writer.Write(ctx, main.MonitorHistorical{
+		MonitorID: "series-monitor",
+		Status:    main.MonitorStatusSuccess,
+		Latency:   100,
+		Timestamp: start.Add(11 * time.Minute),
+	})
+	testutils.AssertNoError(t, err, "Failed to write test data")
+
+	series, err := reader.ReadSeries(ctx, "series-monitor", start, start.Add(15*time.Minute), main.SeriesStep{Duration: 5 * time.Minute})
+	testutils.AssertNoError(t, err, "Failed to read series")
+	testutils.AssertEqual(t, 3, len(series), "Expected every bucket within the range")
+
+	testutils.AssertTrue(t, series[0].Start.Equal(start), "Unexpected first bucket start")
+	testutils.AssertNotNil(t, series[0].Statistics, "Expected statistics for the first bucket")
+	testutils.AssertEqual(t, int64(4), series[0].Statistics.CheckCount, "Unexpected check count")
+	testutils.AssertEqual(t, 0.75, series[0].StatusRatios.Success, "Unexpected success ratio")
+	testutils.AssertEqual(t, 0.25, series[0].StatusRatios.Failure, "Unexpected failure ratio")
+	testutils.AssertEqual(t, int64(250), series[0].Latency, "Unexpected average latency")
+
+	testutils.AssertTrue(t, series[1].Statistics == nil, "Expected no statistics for an empty bucket")
+	testutils.AssertNotNil(t, series[2].Statistics, "Expected statistics for the last bucket")
+	testutils.AssertEqual(t, int64(1), series[2].Statistics.CheckCount, "Unexpected check count")
+
+	monthly, err := reader.ReadSeries(ctx, "series-monitor", start.AddDate(0, -1, 0), time.Date(2025, 5, 1, 0, 0, 0, 0, time.UTC), main.SeriesStep{Month: true})
+	testutils.AssertNoError(t, err, "Failed to read monthly series")
+	testutils.AssertEqual(t, 2, len(monthly), "Expected two calendar months")
+	testutils.AssertTrue(t, monthly[1].Start.Equal(time.Date(2025, 4, 1, 0, 0, 0, 0, time.UTC)), "Unexpected month start")
+	testutils.AssertNotNil(t, monthly[1].Statistics, "Expected statistics for April")
+	testutils.AssertEqual(t, int64(5), monthly[1].Statistics.CheckCount, "Unexpected check count")
+}
+
+func TestServer_MonitorSeries(t *testing.T) {
+	server := main.NewServer(main.ServerConfig{
+		Environment:             "test",
+		Hostname:                "localhost",
+		Port:                    "8080",
+		MonitorHistoricalReader: main.NewMonitorHistoricalReader(database),
+		MonitorList:             []main.Monitor{{UniqueID: "series-monitor", Name: "Series Monitor"}},
+	})
+
+	t.Run("valid request", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/monitors/series-monitor/series?from=2025-04-01T12:00:00Z&to=2025-04-01T13:00:00Z&step=10m", nil)
+		w := httptest.NewRecorder()
+		server.Handler.ServeHTTP(w, req)
+
+		testutils.AssertEqual(t, http.StatusOK, w.Code, "HTTP status code should be OK")
+
+		var response main.MonitorSeriesResponse
+		err := json.NewDecoder(w.Body).Decode(&response)
+		testutils.AssertNoError(t, err, "Failed to decode response")
+		testutils.AssertEqual(t, "Series Monitor", response.Metadata.Name, "Unexpected monitor")
+		testutils.AssertEqual(t, 6, len(response.Buckets), "Unexpected number of buckets")
+	})
+
+	t.Run("unknown monitor", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/monitors/unknown/series", nil)
+		w := httptest.NewRecorder()
+		server.Handler.ServeHTTP(w, req)
+
+		testutils.AssertEqual(t, http.StatusNotFound, w.Code, "HTTP status code should be Not Found")
+	})
+
+	t.Run("too many buckets", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/monitors/series-monitor/series?from=2020-01-01T00:00:00Z&to=2025-01-01T00:00:00Z&step=1m", nil)
+		w := httptest.NewRecorder()
+		server.Handler.ServeHTTP(w, req)
+
+		testutils.AssertEqual(t, http.StatusBadRequest, w.Code, "HTTP status code should be Bad Request")
+	})
+}
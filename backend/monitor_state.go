@@ -0,0 +1,178 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/getsentry/sentry-go"
+	"github.com/rs/zerolog/log"
+)
+
+// defaultMonitorStateRecentCapacity specifies how many of the latest check results are kept in memory per monitor.
+const defaultMonitorStateRecentCapacity = 20
+
+// MonitorState is the authoritative, in-memory state of a single monitor.
+type MonitorState struct {
+	MonitorID string `json:"monitor_id"`
+	// Status is the confirmed status of the monitor, after the failure and success thresholds are applied.
+	Status MonitorStatus `json:"status"`
+	// Since is the time when the monitor entered the confirmed status.
+	Since                time.Time `json:"since"`
+	ConsecutiveFailures  int       `json:"consecutive_failures"`
+	ConsecutiveSuccesses int       `json:"consecutive_successes"`
+	Flapping             bool      `json:"flapping"`
+	// Recent holds the latest check results, ordered from the oldest to the newest.
+	Recent []MonitorHistorical `json:"recent"`
+}
+
+// Latest returns the latest check result of the monitor.
+func (s MonitorState) Latest() (MonitorHistorical, bool) {
+	if len(s.Recent) == 0 {
+		return MonitorHistorical{}, false
+	}
+
+	return s.Recent[len(s.Recent)-1], true
+}
+
+type monitorStateEntry struct {
+	transition MonitorTransition
+	since      time.Time
+	recent     []MonitorHistorical
+}
+
+func (e *monitorStateEntry) snapshot(monitorId string) MonitorState {
+	return MonitorState{
+		MonitorID:            monitorId,
+		Status:               e.transition.confirmed,
+		Since:                e.since,
+		ConsecutiveFailures:  e.transition.consecutiveFailures,
+		ConsecutiveSuccesses: e.transition.consecutiveSuccesses,
+		Flapping:             e.transition.flapping,
+		Recent:               slices.Clone(e.recent),
+	}
+}
+
+// MonitorStateStore keeps the state of every monitor in memory, so deciding on a state transition does not
+// need to read the latest entry from the database on every check, which is racy against concurrent writes
+// and stops working when the database is slow. The store is hydrated from the database on startup.
+type MonitorStateStore struct {
+	mutex          sync.RWMutex
+	states         map[string]*monitorStateEntry
+	recentCapacity int
+}
+
+func NewMonitorStateStore(recentCapacity int) *MonitorStateStore {
+	if recentCapacity <= 0 {
+		recentCapacity = defaultMonitorStateRecentCapacity
+	}
+
+	return &MonitorStateStore{
+		states:         make(map[string]*monitorStateEntry),
+		recentCapacity: recentCapacity,
+	}
+}
+
+// Hydrate rebuilds the state of the given monitors by replaying their latest stored check results.
+// Replayed transitions never produce an alert. A monitor whose check results can not be read starts without
+// state, and the errors of every such monitor are returned once the other monitors are hydrated.
+func (s *MonitorStateStore) Hydrate(ctx context.Context, reader HistoricalReader, monitors []Monitor) error {
+	span := sentry.StartSpan(ctx, "function", sentry.WithDescription("MonitorStateStore.Hydrate"))
+	ctx = span.Context()
+	defer span.Finish()
+
+	var errs []error
+	for _, monitor := range monitors {
+		// ReadRawHistorical returns the latest 100 entries, ordered from the newest to the oldest.
+		historical, err := reader.ReadRawHistorical(ctx, monitor.UniqueID, true)
+		if err != nil {
+			log.Warn().Err(err).Str("monitor_id", monitor.UniqueID).Msg("failed to hydrate monitor state")
+			errs = append(errs, fmt.Errorf("failed to read historical data for monitor %s: %w", monitor.UniqueID, err))
+			continue
+		}
+
+		if len(historical) == 0 {
+			continue
+		}
+
+		slices.Reverse(historical)
+
+		entry := &monitorStateEntry{}
+		for _, data := range historical {
+			s.observe(entry, monitor, data)
+		}
+
+		// Whatever happened before the restart has either been alerted, or is too late to be alerted.
+		entry.transition.notified = entry.transition.confirmed
+
+		s.mutex.Lock()
+		s.states[monitor.UniqueID] = entry
+		s.mutex.Unlock()
+	}
+
+	return errors.Join(errs...)
+}
+
+// Observe feeds a check result into the monitor's state and returns the resulting transition.
+func (s *MonitorStateStore) Observe(monitor Monitor, historical MonitorHistorical) TransitionResult {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	entry, ok := s.states[historical.MonitorID]
+	if !ok {
+		entry = &monitorStateEntry{}
+		s.states[historical.MonitorID] = entry
+	}
+
+	return s.observe(entry, monitor, historical)
+}
+
+func (s *MonitorStateStore) observe(entry *monitorStateEntry, monitor Monitor, historical MonitorHistorical) TransitionResult {
+	initialized := entry.transition.initialized
+	result := entry.transition.Observe(monitor, historical.Status)
+	if !initialized || result.Previous != result.Current {
+		entry.since = historical.Timestamp
+	}
+
+	entry.recent = append(entry.recent, historical)
+	if len(entry.recent) > s.recentCapacity {
+		entry.recent = entry.recent[len(entry.recent)-s.recentCapacity:]
+	}
+
+	return result
+}
+
+// Suspect returns true if the check result at the given time differs from the confirmed status of the monitor,
+// that is, while a state change is waiting to be confirmed or dismissed. If the store has not observed the check
+// result yet, the given status is compared instead.
+func (s *MonitorStateStore) Suspect(monitorId string, status MonitorStatus, at time.Time) bool {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	entry, ok := s.states[monitorId]
+	if !ok || !entry.transition.initialized {
+		return false
+	}
+
+	if latest := len(entry.recent) - 1; latest >= 0 && entry.recent[latest].Timestamp.Equal(at) {
+		status = entry.recent[latest].Status
+	}
+
+	return status != entry.transition.confirmed
+}
+
+// Get returns the state of a single monitor.
+func (s *MonitorStateStore) Get(monitorId string) (MonitorState, bool) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	entry, ok := s.states[monitorId]
+	if !ok {
+		return MonitorState{}, false
+	}
+
+	return entry.snapshot(monitorId), true
+}
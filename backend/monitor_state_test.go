@@ -0,0 +1,146 @@
+package main_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	main "semyi"
+	"semyi/testutils"
+
+	"github.com/getsentry/sentry-go"
+)
+
+func TestMonitorStateStore_Observe(t *testing.T) {
+	store := main.NewMonitorStateStore(3)
+	monitor := main.Monitor{UniqueID: "state-monitor", FailureThreshold: 2}
+	start := time.Date(2025, 3, 10, 10, 0, 0, 0, time.UTC)
+
+	_, ok := store.Get(monitor.UniqueID)
+	testutils.AssertFalse(t, ok, "Expected no state before the first observation")
+
+	statuses := []main.MonitorStatus{
+		main.MonitorStatusSuccess,
+		main.MonitorStatusFailure,
+		main.MonitorStatusFailure,
+		main.MonitorStatusFailure,
+	}
+
+	var alerts int
+	for i, status := range statuses {
+		result := store.Observe(monitor, main.MonitorHistorical{
+			MonitorID: monitor.UniqueID,
+			Status:    status,
+			Timestamp: start.Add(time.Duration(i) * time.Minute),
+		})
+		if result.Alert {
+			alerts++
+		}
+	}
+
+	testutils.AssertEqual(t, 1, alerts, "Expected a single alert once the failure is confirmed")
+
+	state, ok := store.Get(monitor.UniqueID)
+	testutils.AssertTrue(t, ok, "Expected state after observations")
+	testutils.AssertEqual(t, main.MonitorStatusFailure, state.Status, "Unexpected confirmed status")
+	testutils.AssertEqual(t, start.Add(2*time.Minute), state.Since, "Since should be the time the failure was confirmed")
+	testutils.AssertEqual(t, 3, state.ConsecutiveFailures, "Unexpected consecutive failures")
+	testutils.AssertEqual(t, 3, len(state.Recent), "Recent results should be capped to the capacity")
+
+	latest, ok := state.Latest()
+	testutils.AssertTrue(t, ok, "Expected a latest result")
+	testutils.AssertEqual(t, start.Add(3*time.Minute), latest.Timestamp, "Unexpected latest result")
+}
+
+func TestMonitorStateStore_Hydrate(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	ctx = sentry.SetHubOnContext(ctx, sentry.CurrentHub())
+
+	writer := main.NewMonitorHistoricalWriter(database)
+	monitor := main.Monitor{UniqueID: "state-hydrate-monitor"}
+	now := time.Now().UTC().Truncate(time.Second)
+
+	for i, status := range []main.MonitorStatus{main.MonitorStatusSuccess, main.MonitorStatusFailure} {
+		err := writer.Write(ctx, main.MonitorHistorical{
+			MonitorID: monitor.UniqueID,
+			Status:    status,
+			Latency:   100,
+			Timestamp: now.Add(time.Duration(i-2) * time.Minute),
+		})
+		testutils.AssertNoError(t, err, "Failed to write test data")
+	}
+
+	store := main.NewMonitorStateStore(0)
+	err := store.Hydrate(ctx, main.NewMonitorHistoricalReader(database), []main.Monitor{monitor})
+	testutils.AssertNoError(t, err, "Failed to hydrate monitor states")
+
+	state, ok := store.Get(monitor.UniqueID)
+	testutils.AssertTrue(t, ok, "Expected state after hydration")
+	testutils.AssertEqual(t, main.MonitorStatusFailure, state.Status, "Unexpected hydrated status")
+	testutils.AssertEqual(t, 2, len(state.Recent), "Unexpected hydrated recent results")
+
+	// The hydrated status has already been alerted before the restart.
+	result := store.Observe(monitor, main.MonitorHistorical{
+		MonitorID: monitor.UniqueID,
+		Status:    main.MonitorStatusFailure,
+		Timestamp: now,
+	})
+	testutils.AssertFalse(t, result.Alert, "Expected no alert for the hydrated status")
+}
+
+func TestMonitorStateStore_Suspect(t *testing.T) {
+	store := main.NewMonitorStateStore(0)
+	monitor := main.Monitor{UniqueID: "state-suspect-monitor", FailureThreshold: 2}
+	start := time.Date(2025, 3, 10, 10, 0, 0, 0, time.UTC)
+
+	testutils.AssertFalse(t, store.Suspect(monitor.UniqueID, main.MonitorStatusFailure, start), "A monitor without state is not suspect")
+
+	store.Observe(monitor, main.MonitorHistorical{MonitorID: monitor.UniqueID, Status: main.MonitorStatusSuccess, Timestamp: start})
+	testutils.AssertTrue(t, store.Suspect(monitor.UniqueID, main.MonitorStatusFailure, start.Add(time.Minute)), "A failure that has not been observed yet should be suspect")
+
+	store.Observe(monitor, main.MonitorHistorical{MonitorID: monitor.UniqueID, Status: main.MonitorStatusFailure, Timestamp: start.Add(time.Minute)})
+	testutils.AssertTrue(t, store.Suspect(monitor.UniqueID, main.MonitorStatusFailure, start.Add(time.Minute)), "An unconfirmed failure should be suspect")
+
+	store.Observe(monitor, main.MonitorHistorical{MonitorID: monitor.UniqueID, Status: main.MonitorStatusFailure, Timestamp: start.Add(2 * time.Minute)})
+	testutils.AssertFalse(t, store.Suspect(monitor.UniqueID, main.MonitorStatusFailure, start.Add(2*time.Minute)), "A confirmed failure is not suspect")
+}
+
+// failingHistoricalReader fails to read the raw historical data of a single monitor.
+type failingHistoricalReader struct {
+	*main.MemoryStorage
+	monitorId string
+}
+
+func (r failingHistoricalReader) ReadRawHistorical(ctx context.Context, monitorId string, limitResults bool) ([]main.MonitorHistorical, error) {
+	if monitorId == r.monitorId {
+		return nil, errors.New("connection reset")
+	}
+
+	return r.MemoryStorage.ReadRawHistorical(ctx, monitorId, limitResults)
+}
+
+func (r failingHistoricalReader) ReadRawOldestTimestamp(ctx context.Context, monitorId string) (time.Time, bool, error) {
+	if monitorId == r.monitorId {
+		return time.Time{}, false, errors.New("connection reset")
+	}
+
+	return r.MemoryStorage.ReadRawOldestTimestamp(ctx, monitorId)
+}
+
+func TestMonitorStateStore_HydrateContinuesOnError(t *testing.T) {
+	ctx := sentry.SetHubOnContext(context.Background(), sentry.CurrentHub())
+
+	storage := main.NewMemoryStorage()
+	err := storage.Write(ctx, main.MonitorHistorical{MonitorID: "healthy", Status: main.MonitorStatusFailure, Timestamp: time.Now().UTC()})
+	testutils.AssertNoError(t, err, "Failed to write test data")
+
+	store := main.NewMonitorStateStore(0)
+	err = store.Hydrate(ctx, failingHistoricalReader{MemoryStorage: storage, monitorId: "broken"}, []main.Monitor{{UniqueID: "broken"}, {UniqueID: "healthy"}})
+	testutils.AssertError(t, err, "Expected the error of the broken monitor")
+
+	state, ok := store.Get("healthy")
+	testutils.AssertTrue(t, ok, "Expected the monitors after the broken one to be hydrated")
+	testutils.AssertEqual(t, main.MonitorStatusFailure, state.Status, "Unexpected hydrated status")
+}
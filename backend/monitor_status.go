@@ -10,6 +10,14 @@ const (
 	MonitorStatusLimitedAvailability
 )
 
+func (s MonitorStatus) IsValid() bool {
+	switch s {
+	case MonitorStatusSuccess, MonitorStatusFailure, MonitorStatusDegradedPerformance, MonitorStatusUnderMaintenance, MonitorStatusLimitedAvailability:
+		return true
+	}
+	return false
+}
+
 func (s MonitorStatus) String() string {
 	switch s {
 	case MonitorStatusSuccess:
@@ -26,3 +34,22 @@ func (s MonitorStatus) String() string {
 		return "Unknown"
 	}
 }
+
+// Severity ranks the status by how bad it is for the availability of the monitor. Under maintenance
+// ranks the lowest, since it is planned and does not count against the availability.
+func (s MonitorStatus) Severity() int {
+	switch s {
+	case MonitorStatusUnderMaintenance:
+		return 0
+	case MonitorStatusSuccess:
+		return 1
+	case MonitorStatusDegradedPerformance:
+		return 2
+	case MonitorStatusLimitedAvailability:
+		return 3
+	case MonitorStatusFailure:
+		return 4
+	default:
+		return 0
+	}
+}
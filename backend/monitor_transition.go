@@ -0,0 +1,162 @@
+package main
+
+const (
+	defaultFlapDetectionWindow        = 20
+	defaultFlapDetectionHighThreshold = 50
+	defaultFlapDetectionLowThreshold  = 25
+)
+
+// FlapDetection configures the flap detection of a monitor. A monitor is considered flapping when
+// the percentage of state changes within the latest Window checks goes above HighThreshold, and it
+// stops flapping when the percentage goes below LowThreshold.
+type FlapDetection struct {
+	// Enabled specifies whether flap detection is enabled for the monitor.
+	Enabled bool `json:"enabled" yaml:"enabled" toml:"enabled"`
+	// Window specifies how many of the latest checks are considered. Defaults to 20.
+	Window int `json:"window" yaml:"window" toml:"window"`
+	// HighThreshold specifies the percentage (0-100) of state changes in the window
+	// for the monitor to start flapping. Defaults to 50.
+	HighThreshold float64 `json:"high_threshold" yaml:"high_threshold" toml:"high_threshold"`
+	// LowThreshold specifies the percentage (0-100) of state changes in the window
+	// for the monitor to stop flapping. Defaults to 25.
+	LowThreshold float64 `json:"low_threshold" yaml:"low_threshold" toml:"low_threshold"`
+}
+
+// MonitorTransition keeps track of consecutive check results of a single monitor to decide whether
+// the monitor has confirmed a state change, and whether an alert should be sent for it.
+// It is not safe for concurrent use.
+type MonitorTransition struct {
+	initialized          bool
+	confirmed            MonitorStatus
+	notified             MonitorStatus
+	consecutiveFailures  int
+	consecutiveSuccesses int
+	recent               []MonitorStatus
+	flapping             bool
+}
+
+type TransitionResult struct {
+	// Previous is the confirmed status before the observation.
+	Previous MonitorStatus
+	// Current is the confirmed status after the observation.
+	Current MonitorStatus
+	// Suspect is true when the observed status differs from the confirmed status,
+	// but the threshold has not been reached yet.
+	Suspect bool
+	// Flapping is true when the monitor is oscillating between states.
+	Flapping bool
+	// Alert is true when the confirmed status differs from the latest notified status
+	// and an alert should be sent.
+	Alert bool
+}
+
+// Seed sets the confirmed status without going through the thresholds. It is used to initialize
+// the transition from the latest known status, so a restart does not cause an alert.
+func (t *MonitorTransition) Seed(status MonitorStatus) {
+	t.initialized = true
+	t.confirmed = status
+	t.notified = status
+}
+
+// Observe feeds the status of a single check into the transition, and returns the resulting confirmed status.
+func (t *MonitorTransition) Observe(monitor Monitor, status MonitorStatus) TransitionResult {
+	if !t.initialized {
+		t.Seed(status)
+	}
+
+	previous := t.confirmed
+
+	switch status {
+	case MonitorStatusSuccess:
+		t.consecutiveSuccesses++
+		t.consecutiveFailures = 0
+		if t.confirmed != MonitorStatusSuccess && t.consecutiveSuccesses >= max(monitor.SuccessThreshold, 1) {
+			t.confirmed = MonitorStatusSuccess
+		}
+	case MonitorStatusFailure:
+		t.consecutiveFailures++
+		t.consecutiveSuccesses = 0
+		if t.confirmed != MonitorStatusFailure && t.consecutiveFailures >= max(monitor.FailureThreshold, 1) {
+			t.confirmed = MonitorStatusFailure
+		}
+	default:
+		// Statuses that are not the result of a check (e.g. under maintenance) are confirmed immediately.
+		t.consecutiveSuccesses = 0
+		t.consecutiveFailures = 0
+		t.confirmed = status
+	}
+
+	t.observeFlapping(monitor.FlapDetection, status)
+
+	result := TransitionResult{
+		Previous: previous,
+		Current:  t.confirmed,
+		Suspect:  status != t.confirmed,
+		Flapping: t.flapping,
+	}
+
+	// While flapping, alerts are held. Once the monitor settles, we only alert if the settled
+	// status differs from what we have notified before the monitor started flapping.
+	if t.flapping || t.confirmed == t.notified {
+		return result
+	}
+
+	// Alerts are suppressed during a maintenance window. Once the maintenance window is over,
+	// we only alert if the monitor is still failing, since coming back up is the expected outcome.
+	if t.confirmed == MonitorStatusUnderMaintenance || (t.notified == MonitorStatusUnderMaintenance && t.confirmed == MonitorStatusSuccess) {
+		t.notified = t.confirmed
+		return result
+	}
+
+	t.notified = t.confirmed
+	result.Alert = true
+	return result
+}
+
+func (t *MonitorTransition) observeFlapping(config FlapDetection, status MonitorStatus) {
+	if !config.Enabled {
+		t.flapping = false
+		t.recent = nil
+		return
+	}
+
+	window := config.Window
+	if window <= 1 {
+		window = defaultFlapDetectionWindow
+	}
+
+	highThreshold := config.HighThreshold
+	if highThreshold <= 0 {
+		highThreshold = defaultFlapDetectionHighThreshold
+	}
+
+	lowThreshold := config.LowThreshold
+	if lowThreshold <= 0 {
+		lowThreshold = defaultFlapDetectionLowThreshold
+	}
+
+	t.recent = append(t.recent, status)
+	if len(t.recent) > window {
+		t.recent = t.recent[len(t.recent)-window:]
+	}
+
+	// We need a full window before deciding, otherwise a single state change right
+	// after startup would already be considered as flapping.
+	if len(t.recent) < window {
+		return
+	}
+
+	var changes int
+	for i := 1; i < len(t.recent); i++ {
+		if t.recent[i] != t.recent[i-1] {
+			changes++
+		}
+	}
+
+	percentage := float64(changes) / float64(len(t.recent)-1) * 100
+	if !t.flapping && percentage >= highThreshold {
+		t.flapping = true
+	} else if t.flapping && percentage < lowThreshold {
+		t.flapping = false
+	}
+}
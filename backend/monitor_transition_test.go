@@ -0,0 +1,129 @@
+package main_test
+
+import (
+	"testing"
+
+	main "semyi"
+	"semyi/testutils"
+)
+
+func TestMonitorTransition_Thresholds(t *testing.T) {
+	monitor := main.Monitor{
+		UniqueID:         "transition-thresholds",
+		FailureThreshold: 3,
+		SuccessThreshold: 2,
+	}
+
+	var transition main.MonitorTransition
+	transition.Seed(main.MonitorStatusSuccess)
+
+	// A single dropped check should not be alerted
+	result := transition.Observe(monitor, main.MonitorStatusFailure)
+	testutils.AssertTrue(t, result.Suspect, "First failure should be suspect")
+	testutils.AssertFalse(t, result.Alert, "First failure should not alert")
+	testutils.AssertEqual(t, main.MonitorStatusSuccess, result.Current, "Status should still be success")
+
+	result = transition.Observe(monitor, main.MonitorStatusSuccess)
+	testutils.AssertFalse(t, result.Suspect, "Success should reset the suspicion")
+	testutils.AssertFalse(t, result.Alert, "Success should not alert")
+
+	for i := 0; i < 2; i++ {
+		result = transition.Observe(monitor, main.MonitorStatusFailure)
+		testutils.AssertFalse(t, result.Alert, "Failures below the threshold should not alert")
+	}
+
+	result = transition.Observe(monitor, main.MonitorStatusFailure)
+	testutils.AssertTrue(t, result.Alert, "Third consecutive failure should alert")
+	testutils.AssertEqual(t, main.MonitorStatusSuccess, result.Previous, "Previous status should be success")
+	testutils.AssertEqual(t, main.MonitorStatusFailure, result.Current, "Current status should be failure")
+
+	result = transition.Observe(monitor, main.MonitorStatusFailure)
+	testutils.AssertFalse(t, result.Alert, "Staying down should not alert again")
+
+	result = transition.Observe(monitor, main.MonitorStatusSuccess)
+	testutils.AssertTrue(t, result.Suspect, "First success should be suspect")
+	testutils.AssertFalse(t, result.Alert, "First success should not alert")
+
+	result = transition.Observe(monitor, main.MonitorStatusSuccess)
+	testutils.AssertTrue(t, result.Alert, "Second consecutive success should alert")
+	testutils.AssertEqual(t, main.MonitorStatusSuccess, result.Current, "Current status should be success")
+}
+
+func TestMonitorTransition_DefaultThresholds(t *testing.T) {
+	monitor := main.Monitor{UniqueID: "transition-defaults"}
+
+	var transition main.MonitorTransition
+	result := transition.Observe(monitor, main.MonitorStatusSuccess)
+	testutils.AssertFalse(t, result.Alert, "First observation should only seed the transition")
+
+	result = transition.Observe(monitor, main.MonitorStatusFailure)
+	testutils.AssertTrue(t, result.Alert, "Without thresholds, the first failure should alert")
+}
+
+func TestMonitorTransition_Maintenance(t *testing.T) {
+	monitor := main.Monitor{UniqueID: "transition-maintenance"}
+
+	var transition main.MonitorTransition
+	transition.Seed(main.MonitorStatusSuccess)
+
+	result := transition.Observe(monitor, main.MonitorStatusUnderMaintenance)
+	testutils.AssertFalse(t, result.Alert, "Entering maintenance should not alert")
+
+	result = transition.Observe(monitor, main.MonitorStatusSuccess)
+	testutils.AssertFalse(t, result.Alert, "Coming back up after maintenance should not alert")
+
+	transition.Observe(monitor, main.MonitorStatusUnderMaintenance)
+	result = transition.Observe(monitor, main.MonitorStatusFailure)
+	testutils.AssertTrue(t, result.Alert, "Still failing after maintenance should alert")
+}
+
+func TestMonitorTransition_FlapDetection(t *testing.T) {
+	monitor := main.Monitor{
+		UniqueID: "transition-flapping",
+		FlapDetection: main.FlapDetection{
+			Enabled:       true,
+			Window:        6,
+			HighThreshold: 50,
+			LowThreshold:  25,
+		},
+	}
+
+	var transition main.MonitorTransition
+	transition.Seed(main.MonitorStatusSuccess)
+
+	var alerts int
+	statuses := []main.MonitorStatus{
+		main.MonitorStatusSuccess,
+		main.MonitorStatusFailure,
+		main.MonitorStatusSuccess,
+		main.MonitorStatusFailure,
+		main.MonitorStatusSuccess,
+		main.MonitorStatusFailure,
+	}
+	var result main.TransitionResult
+	for _, status := range statuses {
+		result = transition.Observe(monitor, status)
+		if result.Alert {
+			alerts++
+		}
+	}
+
+	testutils.AssertTrue(t, result.Flapping, "Monitor should be flapping")
+	// Alerts are sent until the window is full, then they are held
+	testutils.AssertEqual(t, 4, alerts, "Unexpected number of alerts before flapping was detected")
+
+	alerts = 0
+	for i := 0; i < 3; i++ {
+		result = transition.Observe(monitor, main.MonitorStatusFailure)
+		if result.Alert {
+			alerts++
+		}
+	}
+	testutils.AssertTrue(t, result.Flapping, "Monitor should still be flapping")
+	testutils.AssertEqual(t, 0, alerts, "Alerts should be held while flapping")
+
+	// The last notified status was success, so settling down as failure should be alerted
+	result = transition.Observe(monitor, main.MonitorStatusFailure)
+	testutils.AssertFalse(t, result.Flapping, "Monitor should have settled")
+	testutils.AssertTrue(t, result.Alert, "Settled status should be alerted")
+}
@@ -0,0 +1,359 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/getsentry/sentry-go"
+	"github.com/rs/zerolog/log"
+)
+
+// Outage is a period where the confirmed status of a monitor was Failure. It starts at the first failed check
+// that led to the confirmation, and ends at the check that confirmed another status.
+type Outage struct {
+	MonitorID string    `json:"monitor_id"`
+	StartedAt time.Time `json:"started_at"`
+	// EndedAt is null while the outage is ongoing.
+	EndedAt *time.Time `json:"ended_at"`
+	// DurationSeconds is the duration of the outage. For an ongoing outage, it is the duration so far.
+	DurationSeconds     int64  `json:"duration_seconds"`
+	FirstFailureMessage string `json:"first_failure_message"`
+	FailedChecks        int64  `json:"failed_checks"`
+	// RecoveryCheck is the check that ended the outage. It is null while the outage is ongoing.
+	RecoveryCheck *OutageRecoveryCheck `json:"recovery_check"`
+}
+
+// OutageRecoveryCheck is the check that ended an outage.
+type OutageRecoveryCheck struct {
+	Timestamp time.Time     `json:"timestamp"`
+	Status    MonitorStatus `json:"status"`
+	Latency   int64         `json:"latency"`
+}
+
+// Ongoing returns true if the outage has not ended yet.
+func (o Outage) Ongoing() bool {
+	return o.EndedAt == nil
+}
+
+// OutageFilter narrows down the outages returned by OutageStore.Read.
+type OutageFilter struct {
+	// MonitorID returns the outages of every monitor if empty.
+	MonitorID string
+	// From and To return the outages that overlap with [From, To). Both are optional.
+	From time.Time
+	To   time.Time
+	// MinDuration returns the outages that lasted at least as long. Ongoing outages are compared
+	// by their duration so far.
+	MinDuration time.Duration
+	// Ongoing only returns the outages that have not ended yet.
+	Ongoing bool
+	// Limit defaults to 100.
+	Limit int
+}
+
+// OutageStore persists the outages.
+type OutageStore struct {
+	db *sql.DB
+}
+
+func NewOutageStore(db *sql.DB) *OutageStore {
+	return &OutageStore{db: db}
+}
+
+// Save writes the outage, replacing the stored outage of the same monitor that started at the same time.
+func (s *OutageStore) Save(ctx context.Context, outage Outage) error {
+	span := sentry.StartSpan(ctx, "function", sentry.WithDescription("OutageStore.Save"))
+	span.SetData("semyi.monitor.id", outage.MonitorID)
+	ctx = span.Context()
+	defer span.Finish()
+
+	conn, err := s.db.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get connection: %w", err)
+	}
+	defer func() {
+		err := conn.Close()
+		if err != nil {
+			log.Warn().Err(err).Msg("failed to close connection")
+		}
+	}()
+
+	var endedAt sql.NullTime
+	var durationSeconds, recoveryLatency sql.NullInt64
+	var recoveryStatus sql.NullInt16
+	if outage.EndedAt != nil {
+		endedAt = sql.NullTime{Time: EnsureUTC(*outage.EndedAt), Valid: true}
+		durationSeconds = sql.NullInt64{Int64: outage.DurationSeconds, Valid: true}
+	}
+	if outage.RecoveryCheck != nil {
+		recoveryStatus = sql.NullInt16{Int16: int16(outage.RecoveryCheck.Status), Valid: true}
+		recoveryLatency = sql.NullInt64{Int64: outage.RecoveryCheck.Latency, Valid: true}
+	}
+
+	// ClickHouse does not support UPDATE statements, the outage is replaced instead.
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+
+	_, err = tx.ExecContext(ctx, "DELETE FROM outages WHERE monitor_id = ? AND started_at = ?", outage.MonitorID, EnsureUTC(outage.StartedAt))
+	if err != nil {
+		if rollbackErr := tx.Rollback(); rollbackErr != nil {
+			log.Warn().Err(rollbackErr).Msg("failed to rollback transaction")
+		}
+
+		return fmt.Errorf("failed to delete outage: %w", err)
+	}
+
+	_, err = tx.ExecContext(
+		ctx,
+		`INSERT INTO outages
+			(monitor_id, started_at, ended_at, duration_seconds, first_failure_message, failed_checks, recovery_status, recovery_latency, created_at)
+		VALUES
+			(?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		outage.MonitorID,
+		EnsureUTC(outage.StartedAt),
+		endedAt,
+		durationSeconds,
+		outage.FirstFailureMessage,
+		outage.FailedChecks,
+		recoveryStatus,
+		recoveryLatency,
+		time.Now().UTC(),
+	)
+	if err != nil {
+		if rollbackErr := tx.Rollback(); rollbackErr != nil {
+			log.Warn().Err(rollbackErr).Msg("failed to rollback transaction")
+		}
+
+		return fmt.Errorf("failed to insert outage: %w", err)
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return nil
+}
+
+// Read returns the outages that match the filter, ordered from the newest to the oldest.
+func (s *OutageStore) Read(ctx context.Context, filter OutageFilter) ([]Outage, error) {
+	span := sentry.StartSpan(ctx, "function", sentry.WithDescription("OutageStore.Read"))
+	span.SetData("semyi.monitor.id", filter.MonitorID)
+	ctx = span.Context()
+	defer span.Finish()
+
+	conn, err := s.db.Conn(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get connection: %w", err)
+	}
+	defer func() {
+		err := conn.Close()
+		if err != nil {
+			log.Warn().Err(err).Msg("failed to close connection")
+		}
+	}()
+
+	now := time.Now().UTC()
+	var conditions []string
+	var args []any
+	if filter.MonitorID != "" {
+		conditions = append(conditions, "monitor_id = ?")
+		args = append(args, filter.MonitorID)
+	}
+	if !filter.To.IsZero() {
+		conditions = append(conditions, "started_at < ?")
+		args = append(args, EnsureUTC(filter.To))
+	}
+	if !filter.From.IsZero() {
+		conditions = append(conditions, "(ended_at IS NULL OR ended_at >= ?)")
+		args = append(args, EnsureUTC(filter.From))
+	}
+	if filter.MinDuration > 0 {
+		conditions = append(conditions, "(duration_seconds >= ? OR (ended_at IS NULL AND started_at <= ?))")
+		args = append(args, int64(filter.MinDuration/time.Second), now.Add(-filter.MinDuration))
+	}
+	if filter.Ongoing {
+		conditions = append(conditions, "ended_at IS NULL")
+	}
+
+	limit := filter.Limit
+	if limit <= 0 {
+		limit = 100
+	}
+
+	query := "SELECT monitor_id, started_at, ended_at, duration_seconds, first_failure_message, failed_checks, recovery_status, recovery_latency FROM outages"
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	query += fmt.Sprintf(" ORDER BY started_at DESC LIMIT %d", limit)
+
+	rows, err := conn.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read outages: %w", err)
+	}
+	defer func() {
+		if err := rows.Close(); err != nil {
+			log.Warn().Err(err).Msg("failed to close rows")
+		}
+	}()
+
+	var outages []Outage
+	for rows.Next() {
+		var outage Outage
+		var endedAt sql.NullTime
+		var durationSeconds, recoveryLatency sql.NullInt64
+		var firstFailureMessage sql.NullString
+		var recoveryStatus sql.NullInt16
+		err := rows.Scan(&outage.MonitorID, &outage.StartedAt, &endedAt, &durationSeconds, &firstFailureMessage, &outage.FailedChecks, &recoveryStatus, &recoveryLatency)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+
+		outage.StartedAt = outage.StartedAt.UTC()
+		outage.FirstFailureMessage = firstFailureMessage.String
+		if endedAt.Valid {
+			ended := endedAt.Time.UTC()
+			outage.EndedAt = &ended
+			outage.DurationSeconds = durationSeconds.Int64
+		} else {
+			outage.DurationSeconds = int64(now.Sub(outage.StartedAt) / time.Second)
+		}
+
+		if recoveryStatus.Valid && outage.EndedAt != nil {
+			outage.RecoveryCheck = &OutageRecoveryCheck{
+				Timestamp: *outage.EndedAt,
+				Status:    MonitorStatus(recoveryStatus.Int16),
+				Latency:   recoveryLatency.Int64,
+			}
+		}
+
+		outages = append(outages, outage)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate rows: %w", err)
+	}
+
+	return outages, nil
+}
+
+type outageTrackerEntry struct {
+	// runStart, runMessage and runChecks describe the latest run of consecutive failed checks,
+	// which becomes an outage once the failure is confirmed.
+	runStart   time.Time
+	runMessage string
+	runChecks  int64
+	open       *Outage
+}
+
+// OutageTracker derives outages from the state transitions of every monitor.
+type OutageTracker struct {
+	store   *OutageStore
+	mutex   sync.Mutex
+	entries map[string]*outageTrackerEntry
+}
+
+func NewOutageTracker(store *OutageStore) *OutageTracker {
+	return &OutageTracker{
+		store:   store,
+		entries: make(map[string]*outageTrackerEntry),
+	}
+}
+
+// Hydrate loads the ongoing outages, so an outage that started before a restart can still be ended.
+func (t *OutageTracker) Hydrate(ctx context.Context) error {
+	span := sentry.StartSpan(ctx, "function", sentry.WithDescription("OutageTracker.Hydrate"))
+	ctx = span.Context()
+	defer span.Finish()
+
+	outages, err := t.store.Read(ctx, OutageFilter{Ongoing: true, Limit: 10000})
+	if err != nil {
+		return fmt.Errorf("failed to read ongoing outages: %w", err)
+	}
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	for _, outage := range outages {
+		entry := t.entry(outage.MonitorID)
+		if entry.open == nil || outage.StartedAt.After(entry.open.StartedAt) {
+			entry.open = &outage
+		}
+	}
+
+	return nil
+}
+
+func (t *OutageTracker) entry(monitorId string) *outageTrackerEntry {
+	entry, ok := t.entries[monitorId]
+	if !ok {
+		entry = &outageTrackerEntry{}
+		t.entries[monitorId] = entry
+	}
+
+	return entry
+}
+
+// Observe feeds a check result and the transition it caused into the tracker. An outage is stored when the
+// failure is confirmed, and stored again when it ends. The outage that started or ended with the check is
+// returned, nil if there is none.
+func (t *OutageTracker) Observe(ctx context.Context, historical MonitorHistorical, transition TransitionResult) (*Outage, error) {
+	t.mutex.Lock()
+	entry := t.entry(historical.MonitorID)
+
+	if historical.Status == MonitorStatusFailure {
+		if entry.runChecks == 0 {
+			entry.runStart = historical.Timestamp
+			entry.runMessage = historical.AdditionalMessage
+		}
+		entry.runChecks++
+		if entry.open != nil {
+			entry.open.FailedChecks++
+		}
+	} else {
+		entry.runChecks = 0
+	}
+
+	var changed *Outage
+	switch {
+	case entry.open == nil && transition.Current == MonitorStatusFailure && transition.Previous != MonitorStatusFailure:
+		entry.open = &Outage{
+			MonitorID:           historical.MonitorID,
+			StartedAt:           entry.runStart,
+			FirstFailureMessage: entry.runMessage,
+			FailedChecks:        entry.runChecks,
+		}
+		outage := *entry.open
+		changed = &outage
+	case entry.open != nil && transition.Current != MonitorStatusFailure:
+		endedAt := historical.Timestamp
+		outage := *entry.open
+		outage.EndedAt = &endedAt
+		outage.DurationSeconds = int64(endedAt.Sub(outage.StartedAt) / time.Second)
+		outage.RecoveryCheck = &OutageRecoveryCheck{
+			Timestamp: endedAt,
+			Status:    historical.Status,
+			Latency:   historical.Latency,
+		}
+		entry.open = nil
+		changed = &outage
+	}
+	t.mutex.Unlock()
+
+	if changed == nil {
+		return nil, nil
+	}
+
+	err := t.store.Save(ctx, *changed)
+	if err != nil {
+		return changed, fmt.Errorf("failed to save outage: %w", err)
+	}
+
+	return changed, nil
+}
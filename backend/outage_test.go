@@ -0,0 +1,77 @@
+package main_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	main "semyi"
+	"semyi/testutils"
+
+	"github.com/getsentry/sentry-go"
+)
+
+func TestOutageTracker_Observe(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	ctx = sentry.SetHubOnContext(ctx, sentry.CurrentHub())
+
+	store := main.NewOutageStore(database)
+	tracker := main.NewOutageTracker(store)
+	states := main.NewMonitorStateStore(0)
+	monitor := main.Monitor{UniqueID: "outage-monitor", Name: "Outage Monitor", FailureThreshold: 2}
+
+	start := time.Date(2025, 7, 1, 8, 0, 0, 0, time.UTC)
+	observe := func(offset time.Duration, status main.MonitorStatus, message string) {
+		historical := main.MonitorHistorical{
+			MonitorID:         monitor.UniqueID,
+			Status:            status,
+			Latency:           100,
+			Timestamp:         start.Add(offset),
+			AdditionalMessage: message,
+		}
+		_, err := tracker.Observe(ctx, historical, states.Observe(monitor, historical))
+		testutils.AssertNoError(t, err, "Failed to observe check")
+	}
+
+	observe(0, main.MonitorStatusSuccess, "")
+	// A single failure is not confirmed, so it is not an outage
+	observe(time.Minute, main.MonitorStatusFailure, "blip")
+	observe(2*time.Minute, main.MonitorStatusSuccess, "")
+	observe(3*time.Minute, main.MonitorStatusFailure, "connection refused")
+	observe(4*time.Minute, main.MonitorStatusFailure, "timeout")
+
+	ongoing, err := store.Read(ctx, main.OutageFilter{MonitorID: monitor.UniqueID, Ongoing: true})
+	testutils.AssertNoError(t, err, "Failed to read outages")
+	testutils.AssertEqual(t, 1, len(ongoing), "Expected an ongoing outage once the failure is confirmed")
+	testutils.AssertTrue(t, ongoing[0].StartedAt.Equal(start.Add(3*time.Minute)), "The outage should start at the first failed check")
+	testutils.AssertEqual(t, "connection refused", ongoing[0].FirstFailureMessage, "Unexpected first failure message")
+
+	// The ongoing outage survives a restart
+	tracker = main.NewOutageTracker(store)
+	err = tracker.Hydrate(ctx)
+	testutils.AssertNoError(t, err, "Failed to hydrate outages")
+
+	observe(5*time.Minute, main.MonitorStatusFailure, "timeout")
+	observe(9*time.Minute, main.MonitorStatusSuccess, "")
+
+	outages, err := store.Read(ctx, main.OutageFilter{MonitorID: monitor.UniqueID})
+	testutils.AssertNoError(t, err, "Failed to read outages")
+	testutils.AssertEqual(t, 1, len(outages), "Expected a single outage")
+
+	outage := outages[0]
+	testutils.AssertFalse(t, outage.Ongoing(), "The outage should have ended")
+	testutils.AssertTrue(t, outage.EndedAt.Equal(start.Add(9*time.Minute)), "The outage should end at the recovery check")
+	testutils.AssertEqual(t, int64(6*60), outage.DurationSeconds, "Unexpected duration")
+	testutils.AssertEqual(t, int64(3), outage.FailedChecks, "Unexpected number of failed checks")
+	testutils.AssertNotNil(t, outage.RecoveryCheck, "Expected a recovery check")
+	testutils.AssertEqual(t, main.MonitorStatusSuccess, outage.RecoveryCheck.Status, "Unexpected recovery status")
+
+	filtered, err := store.Read(ctx, main.OutageFilter{MonitorID: monitor.UniqueID, MinDuration: 10 * time.Minute})
+	testutils.AssertNoError(t, err, "Failed to read outages")
+	testutils.AssertEqual(t, 0, len(filtered), "Shorter outages should be filtered out")
+
+	filtered, err = store.Read(ctx, main.OutageFilter{MonitorID: monitor.UniqueID, From: start.Add(10 * time.Minute)})
+	testutils.AssertNoError(t, err, "Failed to read outages")
+	testutils.AssertEqual(t, 0, len(filtered), "Outages that ended before the range should be filtered out")
+}
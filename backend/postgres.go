@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"database/sql/driver"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/stdlib"
+)
+
+// NewPostgresConnector creates a `database/sql` compatible connector for the PostgreSQL DSN. The queries of
+// Semyi use `?` placeholders, which PostgreSQL does not understand, so they are rewritten into `$1`, `$2`, ...
+// before they reach the driver. The session runs in UTC, like the timestamps that Semyi stores.
+func NewPostgresConnector(dsn string) (driver.Connector, error) {
+	config, err := pgx.ParseConfig(dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse postgres DSN: %w", err)
+	}
+
+	config.RuntimeParams["timezone"] = "UTC"
+
+	return postgresConnector{Connector: stdlib.GetConnector(*config)}, nil
+}
+
+type postgresConnector struct {
+	driver.Connector
+}
+
+func (c postgresConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	conn, err := c.Connector.Connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return postgresConn{Conn: conn.(*stdlib.Conn)}, nil
+}
+
+type postgresConn struct {
+	*stdlib.Conn
+}
+
+func (c postgresConn) Prepare(query string) (driver.Stmt, error) {
+	return c.Conn.Prepare(RebindPostgres(query))
+}
+
+func (c postgresConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	return c.Conn.PrepareContext(ctx, RebindPostgres(query))
+}
+
+func (c postgresConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	return c.Conn.ExecContext(ctx, RebindPostgres(query), args)
+}
+
+func (c postgresConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	return c.Conn.QueryContext(ctx, RebindPostgres(query), args)
+}
+
+// RebindPostgres replaces the `?` placeholders of the query with the numbered placeholders of PostgreSQL.
+// Question marks within string literals, quoted identifiers, and comments are left alone.
+func RebindPostgres(query string) string {
+	if !strings.Contains(query, "?") {
+		return query
+	}
+
+	var builder strings.Builder
+	builder.Grow(len(query) + 16)
+
+	placeholder := 0
+	// quote is the quote character of the literal or identifier that we are in, or 0 outside of them.
+	// An escaped quote ('') closes and reopens the literal, which leaves us inside of it as well.
+	var quote byte
+	for i := 0; i < len(query); i++ {
+		character := query[i]
+		switch {
+		case quote != 0:
+			if character == quote {
+				quote = 0
+			}
+		case character == '\'' || character == '"':
+			quote = character
+		case character == '-' && i+1 < len(query) && query[i+1] == '-':
+			end := strings.IndexByte(query[i:], '\n')
+			if end < 0 {
+				end = len(query) - i
+			}
+
+			builder.WriteString(query[i : i+end])
+			i += end - 1
+			continue
+		case character == '?':
+			placeholder++
+			builder.WriteByte('$')
+			builder.WriteString(strconv.Itoa(placeholder))
+			continue
+		}
+
+		builder.WriteByte(character)
+	}
+
+	return builder.String()
+}
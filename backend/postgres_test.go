@@ -0,0 +1,48 @@
+package main_test
+
+import (
+	"testing"
+
+	main "semyi"
+	"semyi/testutils"
+)
+
+func TestRebindPostgres(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+		want  string
+	}{
+		{
+			name:  "no placeholders",
+			query: "SELECT version()",
+			want:  "SELECT version()",
+		},
+		{
+			name:  "placeholders",
+			query: "SELECT * FROM monitor_historical WHERE monitor_id = ? AND timestamp >= ? AND timestamp < ?",
+			want:  "SELECT * FROM monitor_historical WHERE monitor_id = $1 AND timestamp >= $2 AND timestamp < $3",
+		},
+		{
+			name:  "string literal",
+			query: "SELECT 'why?', 'it''s ?' FROM t WHERE a = ?",
+			want:  "SELECT 'why?', 'it''s ?' FROM t WHERE a = $1",
+		},
+		{
+			name:  "quoted identifier",
+			query: `SELECT "odd?name" FROM t WHERE a = ? AND b = ?`,
+			want:  `SELECT "odd?name" FROM t WHERE a = $1 AND b = $2`,
+		},
+		{
+			name:  "comment",
+			query: "SELECT a -- is it?\nFROM t WHERE a = ?",
+			want:  "SELECT a -- is it?\nFROM t WHERE a = $1",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			testutils.AssertEqual(t, tt.want, main.RebindPostgres(tt.query), "Unexpected query")
+		})
+	}
+}
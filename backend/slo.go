@@ -0,0 +1,595 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/getsentry/sentry-go"
+	"github.com/rs/zerolog/log"
+)
+
+// ServiceLevelObjective declares the availability and latency targets of one or more monitors over a
+// rolling window. The objective is tracked for each monitor individually.
+type ServiceLevelObjective struct {
+	// ID specifies the unique identifier of the SLO.
+	ID string `json:"id" yaml:"id" toml:"id"`
+	// Name specifies the display name of the SLO (e.g., "Checkout API availability").
+	Name string `json:"name" yaml:"name" toml:"name"`
+	// MonitorIDs specifies the list of monitor's UniqueID that the SLO applies to.
+	MonitorIDs []string `json:"monitor_ids" yaml:"monitor_ids" toml:"monitor_ids"`
+	// Groups specifies the list of monitor groups that the SLO applies to.
+	// Every monitor that has the same Group value will be tracked.
+	Groups []string `json:"groups" yaml:"groups" toml:"groups"`
+	// Window specifies the rolling window of the SLO, in Go's duration format with the additional
+	// "d" (day) and "w" (week) units. Defaults to "30d".
+	Window string `json:"window" yaml:"window" toml:"window"`
+	// AvailabilityTarget specifies the percentage of checks that must succeed within the window (e.g., 99.9).
+	// Checks under maintenance are excluded. Set to 0 to not track availability.
+	AvailabilityTarget float64 `json:"availability_target" yaml:"availability_target" toml:"availability_target"`
+	// LatencyThreshold specifies the latency in milliseconds that a successful check must not exceed.
+	LatencyThreshold int64 `json:"latency_threshold" yaml:"latency_threshold" toml:"latency_threshold"`
+	// LatencyTarget specifies the percentage of successful checks that must not exceed the LatencyThreshold
+	// within the window (e.g., 99 for "p99 is below the threshold"). Set to 0 to not track latency.
+	LatencyTarget float64 `json:"latency_target" yaml:"latency_target" toml:"latency_target"`
+	// BurnRateAlerts specifies when to alert on the error budget burning too fast. Defaults to 14.4x over
+	// 1 hour and 6x over 6 hours, both confirmed over a short window of 1/12 of the long window.
+	BurnRateAlerts []BurnRateAlert `json:"burn_rate_alerts" yaml:"burn_rate_alerts" toml:"burn_rate_alerts"`
+}
+
+// BurnRateAlert fires when the error budget burns at least BurnRate times faster than what the SLO can
+// sustain over its window, over both the long and the short window. The short window makes the alert
+// resolve soon after the problem is gone.
+type BurnRateAlert struct {
+	// BurnRate specifies the burn rate threshold (e.g., 14.4 burns 2% of a 30 days error budget in 1 hour).
+	BurnRate float64 `json:"burn_rate" yaml:"burn_rate" toml:"burn_rate"`
+	// LongWindow specifies the long window (e.g., "1h").
+	LongWindow string `json:"long_window" yaml:"long_window" toml:"long_window"`
+	// ShortWindow specifies the short window (e.g., "5m"). Defaults to 1/12 of the LongWindow.
+	ShortWindow string `json:"short_window" yaml:"short_window" toml:"short_window"`
+}
+
+var defaultBurnRateAlerts = []BurnRateAlert{
+	{BurnRate: 14.4, LongWindow: "1h"},
+	{BurnRate: 6, LongWindow: "6h"},
+}
+
+func (o ServiceLevelObjective) Validate() error {
+	validationError := NewValidationError()
+
+	if o.ID == "" {
+		validationError.AddIssue("id", "id is required")
+	}
+
+	if len(o.MonitorIDs) == 0 && len(o.Groups) == 0 {
+		validationError.AddIssue("monitor_ids", "either monitor_ids or groups must be set")
+	}
+
+	if o.Window != "" {
+		window, err := parseDuration(o.Window)
+		if err != nil || window <= 0 {
+			validationError.AddIssue("window", "window must be a valid positive duration")
+		}
+	}
+
+	if o.AvailabilityTarget == 0 && o.LatencyTarget == 0 {
+		validationError.AddIssue("availability_target", "either availability_target or latency_target must be set")
+	}
+
+	if o.AvailabilityTarget < 0 || o.AvailabilityTarget >= 100 {
+		validationError.AddIssue("availability_target", "availability_target must be between 0 and 100 (exclusive)")
+	}
+
+	if o.LatencyTarget < 0 || o.LatencyTarget >= 100 {
+		validationError.AddIssue("latency_target", "latency_target must be between 0 and 100 (exclusive)")
+	}
+
+	if o.LatencyTarget > 0 && o.LatencyThreshold <= 0 {
+		validationError.AddIssue("latency_threshold", "latency_threshold must be set when latency_target is set")
+	}
+
+	for i, alert := range o.BurnRateAlerts {
+		if alert.BurnRate <= 0 {
+			validationError.AddIssue(fmt.Sprintf("burn_rate_alerts[%d].burn_rate", i), "burn_rate must be greater than 0")
+		}
+
+		long, err := parseDuration(alert.LongWindow)
+		if err != nil || long <= 0 {
+			validationError.AddIssue(fmt.Sprintf("burn_rate_alerts[%d].long_window", i), "long_window must be a valid positive duration")
+		}
+
+		if alert.ShortWindow != "" {
+			short, err := parseDuration(alert.ShortWindow)
+			if err != nil || short <= 0 || short > long {
+				validationError.AddIssue(fmt.Sprintf("burn_rate_alerts[%d].short_window", i), "short_window must be a valid positive duration, not longer than long_window")
+			}
+		}
+	}
+
+	if validationError.HasIssues() {
+		return validationError
+	}
+
+	return nil
+}
+
+// SLOObjectiveType is the kind of target an SLO status is tracking.
+type SLOObjectiveType string
+
+const (
+	SLOObjectiveAvailability SLOObjectiveType = "availability"
+	SLOObjectiveLatency      SLOObjectiveType = "latency"
+)
+
+// SLOStatus is the latest evaluation of a single objective of an SLO, for a single monitor.
+type SLOStatus struct {
+	SLOID     string           `json:"slo_id"`
+	Name      string           `json:"name"`
+	MonitorID string           `json:"monitor_id"`
+	Objective SLOObjectiveType `json:"objective"`
+	// Target is the percentage of good checks that the objective requires.
+	Target float64 `json:"target"`
+	Window string  `json:"window"`
+	// SLI is the percentage of good checks within the window. It is null if there is no check.
+	SLI         *float64 `json:"sli"`
+	TotalChecks int64    `json:"total_checks"`
+	BadChecks   int64    `json:"bad_checks"`
+	// ErrorBudgetRemaining is the ratio of the error budget that is left within the window.
+	// It goes below 0 once the objective is missed.
+	ErrorBudgetRemaining float64          `json:"error_budget_remaining"`
+	BurnRates            []BurnRateStatus `json:"burn_rates"`
+	EvaluatedAt          time.Time        `json:"evaluated_at"`
+}
+
+// BurnRateStatus is the latest evaluation of a single burn rate alert.
+type BurnRateStatus struct {
+	Threshold     float64 `json:"threshold"`
+	LongWindow    string  `json:"long_window"`
+	ShortWindow   string  `json:"short_window"`
+	LongBurnRate  float64 `json:"long_burn_rate"`
+	ShortBurnRate float64 `json:"short_burn_rate"`
+	Firing        bool    `json:"firing"`
+}
+
+// SLOCheckCounts holds the number of checks of a monitor that count towards its SLOs.
+type SLOCheckCounts struct {
+	// Checked is the number of checks, excluding the ones under maintenance.
+	Checked int64
+	Failed  int64
+	// Succeeded is the number of checks that were neither failed nor under maintenance.
+	Succeeded int64
+	// Slow is the number of succeeded checks whose latency exceeded the threshold.
+	Slow int64
+}
+
+func (c SLOCheckCounts) add(other SLOCheckCounts) SLOCheckCounts {
+	return SLOCheckCounts{
+		Checked:   c.Checked + other.Checked,
+		Failed:    c.Failed + other.Failed,
+		Succeeded: c.Succeeded + other.Succeeded,
+		Slow:      c.Slow + other.Slow,
+	}
+}
+
+// sloCheckCountsFromAggregate estimates the check counts of an aggregate bucket. The number of checks under
+// maintenance follows from the uptime ratio if any check failed, and the number of slow checks is estimated
+// from the latency percentiles.
+func sloCheckCountsFromAggregate(aggregate MonitorHistorical, latencyThreshold int64) SLOCheckCounts {
+	statistics := aggregate.Aggregate
+	if statistics == nil {
+		// Aggregates without statistics only have the status of the bucket
+		switch aggregate.Status {
+		case MonitorStatusUnderMaintenance:
+			return SLOCheckCounts{}
+		case MonitorStatusFailure:
+			return SLOCheckCounts{Checked: 1, Failed: 1}
+		default:
+			counts := SLOCheckCounts{Checked: 1, Succeeded: 1}
+			if aggregate.Latency > latencyThreshold {
+				counts.Slow = 1
+			}
+			return counts
+		}
+	}
+
+	if statistics.DominantStatus == MonitorStatusUnderMaintenance {
+		return SLOCheckCounts{}
+	}
+
+	counts := SLOCheckCounts{Checked: statistics.CheckCount, Failed: statistics.FailureCount}
+	if statistics.FailureCount > 0 && statistics.UptimeRatio < 1 {
+		counts.Checked = int64(math.Round(float64(statistics.FailureCount) / (1 - statistics.UptimeRatio)))
+	}
+	counts.Succeeded = counts.Checked - counts.Failed
+
+	var slowRatio float64
+	switch {
+	case latencyThreshold < statistics.LatencyMin:
+		slowRatio = 1
+	case latencyThreshold < statistics.LatencyP50:
+		slowRatio = 0.5
+	case latencyThreshold < statistics.LatencyP95:
+		slowRatio = 0.05
+	case latencyThreshold < statistics.LatencyP99:
+		slowRatio = 0.01
+	}
+	counts.Slow = int64(math.Round(float64(counts.Succeeded) * slowRatio))
+
+	return counts
+}
+
+// ReadSLOCheckCounts counts the raw historical data of a monitor within [from, to) for SLO tracking.
+func (r *MonitorHistoricalReader) ReadSLOCheckCounts(ctx context.Context, monitorId string, from time.Time, to time.Time, latencyThreshold int64) (SLOCheckCounts, error) {
+	span := sentry.StartSpan(ctx, "function", sentry.WithDescription("MonitorHistoricalReader.ReadSLOCheckCounts"))
+	span.SetData("semyi.monitor.id", monitorId)
+	ctx = span.Context()
+	defer span.Finish()
+
+	conn, err := r.db.Conn(ctx)
+	if err != nil {
+		return SLOCheckCounts{}, fmt.Errorf("failed to get connection: %w", err)
+	}
+	defer func() {
+		err := conn.Close()
+		if err != nil {
+			log.Warn().Stack().Err(err).Msg("failed to close connection")
+		}
+	}()
+
+	query := fmt.Sprintf(
+		`SELECT
+			COALESCE(SUM(CASE WHEN status <> %[1]d THEN 1 ELSE 0 END), 0),
+			COALESCE(SUM(CASE WHEN status = %[2]d THEN 1 ELSE 0 END), 0),
+			COALESCE(SUM(CASE WHEN status NOT IN (%[1]d, %[2]d) THEN 1 ELSE 0 END), 0),
+			COALESCE(SUM(CASE WHEN status NOT IN (%[1]d, %[2]d) AND latency > ? THEN 1 ELSE 0 END), 0)
+		FROM
+			monitor_historical
+		WHERE
+			monitor_id = ?
+			AND timestamp >= ?
+			AND timestamp < ?`,
+		MonitorStatusUnderMaintenance,
+		MonitorStatusFailure,
+	)
+
+	var counts SLOCheckCounts
+	err = conn.QueryRowContext(ctx, query, latencyThreshold, monitorId, EnsureUTC(from), EnsureUTC(to)).
+		Scan(&counts.Checked, &counts.Failed, &counts.Succeeded, &counts.Slow)
+	if err != nil {
+		return SLOCheckCounts{}, fmt.Errorf("failed to count historical data: %w", err)
+	}
+
+	return counts, nil
+}
+
+type burnRateRule struct {
+	alert BurnRateAlert
+	long  time.Duration
+	short time.Duration
+}
+
+type sloEntry struct {
+	objective  ServiceLevelObjective
+	monitorIDs []string
+	window     time.Duration
+	rules      []burnRateRule
+}
+
+// SLOTracker evaluates the configured SLOs periodically, and alerts when an error budget burns too fast.
+type SLOTracker struct {
+	entries      []sloEntry
+	monitorNames map[string]string
+	reader       HistoricalReader
+	alerter      Alerter
+
+	mutex    sync.RWMutex
+	statuses map[string]SLOStatus
+}
+
+type SLOTrackerConfig struct {
+	Objectives []ServiceLevelObjective
+	Monitors   []Monitor
+	Reader     HistoricalReader
+	// Alerter receives the burn rate alerts. It is optional.
+	Alerter Alerter
+}
+
+// NewSLOTracker validates and parses the SLOs. Groups are resolved against the given monitors.
+func NewSLOTracker(config SLOTrackerConfig) (*SLOTracker, error) {
+	tracker := &SLOTracker{
+		monitorNames: make(map[string]string),
+		reader:       config.Reader,
+		alerter:      config.Alerter,
+		statuses:     make(map[string]SLOStatus),
+	}
+
+	for _, monitor := range config.Monitors {
+		tracker.monitorNames[monitor.UniqueID] = monitor.Name
+	}
+
+	for _, objective := range config.Objectives {
+		if err := objective.Validate(); err != nil {
+			return nil, fmt.Errorf("invalid slo %q: %w", objective.ID, err)
+		}
+
+		if objective.Window == "" {
+			objective.Window = "30d"
+		}
+
+		if len(objective.BurnRateAlerts) == 0 {
+			objective.BurnRateAlerts = defaultBurnRateAlerts
+		}
+
+		entry := sloEntry{objective: objective}
+		// Validate has made sure that the durations are parseable
+		entry.window, _ = parseDuration(objective.Window)
+		entry.monitorIDs = append(entry.monitorIDs, objective.MonitorIDs...)
+		for _, monitor := range config.Monitors {
+			if monitor.Group != "" && slices.Contains(objective.Groups, monitor.Group) && !slices.Contains(entry.monitorIDs, monitor.UniqueID) {
+				entry.monitorIDs = append(entry.monitorIDs, monitor.UniqueID)
+			}
+		}
+
+		for _, alert := range objective.BurnRateAlerts {
+			rule := burnRateRule{alert: alert}
+			rule.long, _ = parseDuration(alert.LongWindow)
+			rule.short = rule.long / 12
+			if alert.ShortWindow != "" {
+				rule.short, _ = parseDuration(alert.ShortWindow)
+			}
+			entry.rules = append(entry.rules, rule)
+		}
+
+		tracker.entries = append(tracker.entries, entry)
+	}
+
+	return tracker, nil
+}
+
+// Run evaluates the SLOs every minute until the context is cancelled.
+func (t *SLOTracker) Run(ctx context.Context) {
+	if len(t.entries) == 0 {
+		return
+	}
+
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+
+	for {
+		ctx := sentry.SetHubOnContext(ctx, sentry.CurrentHub().Clone())
+		if err := t.Evaluate(ctx, time.Now()); err != nil {
+			log.Error().Err(err).Msg("failed to evaluate slos")
+			sentry.GetHubFromContext(ctx).CaptureException(err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Evaluate computes the status of every SLO at the given time, and sends an alert for every burn rate
+// alert that starts or stops firing.
+func (t *SLOTracker) Evaluate(ctx context.Context, now time.Time) error {
+	span := sentry.StartSpan(ctx, "function", sentry.WithDescription("SLOTracker.Evaluate"))
+	ctx = span.Context()
+	defer span.Finish()
+
+	var errs []error
+	for _, entry := range t.entries {
+		for _, monitorId := range entry.monitorIDs {
+			// Windows are shared between the objectives, so every window is only counted once.
+			windows := []time.Duration{entry.window}
+			for _, rule := range entry.rules {
+				windows = append(windows, rule.long, rule.short)
+			}
+
+			counts, err := t.readCheckCounts(ctx, monitorId, windows, entry.objective.LatencyThreshold, now)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("failed to evaluate slo %q for monitor %s: %w", entry.objective.ID, monitorId, err))
+				continue
+			}
+
+			if entry.objective.AvailabilityTarget > 0 {
+				t.update(ctx, entry, monitorId, SLOObjectiveAvailability, entry.objective.AvailabilityTarget, counts, now)
+			}
+
+			if entry.objective.LatencyTarget > 0 {
+				t.update(ctx, entry, monitorId, SLOObjectiveLatency, entry.objective.LatencyTarget, counts, now)
+			}
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// readCheckCounts counts the checks of a monitor within every window that ends at the given time. The part of
+// a window that is past the raw retention is counted from the aggregates instead.
+func (t *SLOTracker) readCheckCounts(ctx context.Context, monitorId string, windows []time.Duration, latencyThreshold int64, now time.Time) (map[time.Duration]SLOCheckCounts, error) {
+	oldest, found, err := t.reader.ReadRawOldestTimestamp(ctx, monitorId)
+	if err != nil {
+		return nil, err
+	}
+
+	// The aggregates only cover whole buckets, so the raw historical data is counted from its first whole hour
+	rawFrom := now
+	if found {
+		rawFrom = AggregateIntervalHour.Truncate(oldest.UTC())
+	}
+
+	var aggregates []retainedAggregate
+	if longest := slices.Max(windows); now.Add(-longest).Before(rawFrom) {
+		aggregates, err = readRetainedAggregates(ctx, t.reader, monitorId, now.Add(-longest), rawFrom)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	counts := make(map[time.Duration]SLOCheckCounts)
+	for _, window := range windows {
+		if _, ok := counts[window]; ok {
+			continue
+		}
+
+		from := now.Add(-window)
+		count, err := t.reader.ReadSLOCheckCounts(ctx, monitorId, from, now, latencyThreshold)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, aggregate := range aggregates {
+			if !aggregate.from.Before(from) {
+				count = count.add(sloCheckCountsFromAggregate(aggregate.historical, latencyThreshold))
+			}
+		}
+
+		counts[window] = count
+	}
+
+	return counts, nil
+}
+
+// update stores the status of a single objective, and alerts on the burn rate alerts whose state changed.
+func (t *SLOTracker) update(ctx context.Context, entry sloEntry, monitorId string, objective SLOObjectiveType, target float64, counts map[time.Duration]SLOCheckCounts, now time.Time) {
+	budget := 1 - target/100
+	events := func(count SLOCheckCounts) (total int64, bad int64) {
+		if objective == SLOObjectiveLatency {
+			return count.Succeeded, count.Slow
+		}
+
+		return count.Checked, count.Failed
+	}
+	burnRate := func(count SLOCheckCounts) float64 {
+		total, bad := events(count)
+		if total == 0 {
+			return 0
+		}
+
+		return float64(bad) / float64(total) / budget
+	}
+
+	total, bad := events(counts[entry.window])
+	status := SLOStatus{
+		SLOID:                entry.objective.ID,
+		Name:                 entry.objective.Name,
+		MonitorID:            monitorId,
+		Objective:            objective,
+		Target:               target,
+		Window:               entry.objective.Window,
+		TotalChecks:          total,
+		BadChecks:            bad,
+		ErrorBudgetRemaining: 1,
+		EvaluatedAt:          now,
+	}
+	if total > 0 {
+		sli := float64(total-bad) / float64(total) * 100
+		status.SLI = &sli
+		status.ErrorBudgetRemaining = 1 - float64(bad)/(float64(total)*budget)
+	}
+
+	key := entry.objective.ID + "/" + monitorId + "/" + string(objective)
+	t.mutex.RLock()
+	previous, hasPrevious := t.statuses[key]
+	t.mutex.RUnlock()
+
+	for i, rule := range entry.rules {
+		burnRateStatus := BurnRateStatus{
+			Threshold:     rule.alert.BurnRate,
+			LongWindow:    rule.long.String(),
+			ShortWindow:   rule.short.String(),
+			LongBurnRate:  burnRate(counts[rule.long]),
+			ShortBurnRate: burnRate(counts[rule.short]),
+		}
+		burnRateStatus.Firing = burnRateStatus.LongBurnRate >= rule.alert.BurnRate && burnRateStatus.ShortBurnRate >= rule.alert.BurnRate
+		status.BurnRates = append(status.BurnRates, burnRateStatus)
+
+		wasFiring := hasPrevious && i < len(previous.BurnRates) && previous.BurnRates[i].Firing
+		if burnRateStatus.Firing != wasFiring {
+			t.alert(ctx, status, burnRateStatus)
+		}
+	}
+
+	t.mutex.Lock()
+	t.statuses[key] = status
+	t.mutex.Unlock()
+}
+
+func (t *SLOTracker) alert(ctx context.Context, status SLOStatus, burnRate BurnRateStatus) {
+	log.Info().
+		Str("slo_id", status.SLOID).
+		Str("monitor_id", status.MonitorID).
+		Str("objective", string(status.Objective)).
+		Float64("burn_rate", burnRate.LongBurnRate).
+		Bool("firing", burnRate.Firing).
+		Msg("slo burn rate alert changed")
+
+	if t.alerter == nil {
+		return
+	}
+
+	name := status.Name
+	if name == "" {
+		name = status.SLOID
+	}
+
+	title := "🔥 SLO Burn Rate"
+	message := fmt.Sprintf(
+		"%s (%s, %g%% target): the error budget is burning %.1fx over the last %s and %.1fx over the last %s, above the %gx threshold. %.1f%% of the error budget remains.",
+		name, status.Objective, status.Target, burnRate.LongBurnRate, burnRate.LongWindow, burnRate.ShortBurnRate, burnRate.ShortWindow, burnRate.Threshold, status.ErrorBudgetRemaining*100,
+	)
+	if !burnRate.Firing {
+		title = "✅ SLO Burn Rate Resolved"
+		message = fmt.Sprintf(
+			"%s (%s, %g%% target): the error budget is burning %.1fx over the last %s, below the %gx threshold. %.1f%% of the error budget remains.",
+			name, status.Objective, status.Target, burnRate.ShortBurnRate, burnRate.ShortWindow, burnRate.Threshold, status.ErrorBudgetRemaining*100,
+		)
+	}
+
+	err := t.alerter.Send(ctx, AlertMessage{
+		Success:     !burnRate.Firing,
+		Timestamp:   status.EvaluatedAt,
+		MonitorID:   status.MonitorID,
+		MonitorName: t.monitorNames[status.MonitorID],
+		Title:       title,
+		Message:     message,
+	})
+	if err != nil {
+		log.Error().Err(err).Str("slo_id", status.SLOID).Msg("failed to send slo alert")
+		sentry.GetHubFromContext(ctx).CaptureException(err)
+	}
+}
+
+// Statuses returns the latest status of every objective, sorted by the SLO ID, the monitor ID, and the objective.
+// If monitorId is not empty, only the statuses of that monitor are returned.
+func (t *SLOTracker) Statuses(monitorId string) []SLOStatus {
+	t.mutex.RLock()
+	defer t.mutex.RUnlock()
+
+	statuses := make([]SLOStatus, 0, len(t.statuses))
+	for _, status := range t.statuses {
+		if monitorId != "" && status.MonitorID != monitorId {
+			continue
+		}
+
+		statuses = append(statuses, status)
+	}
+
+	sort.Slice(statuses, func(i, j int) bool {
+		if statuses[i].SLOID != statuses[j].SLOID {
+			return statuses[i].SLOID < statuses[j].SLOID
+		}
+		if statuses[i].MonitorID != statuses[j].MonitorID {
+			return statuses[i].MonitorID < statuses[j].MonitorID
+		}
+		return statuses[i].Objective < statuses[j].Objective
+	})
+
+	return statuses
+}
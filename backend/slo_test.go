@@ -0,0 +1,203 @@
+package main_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	main "semyi"
+	"semyi/testutils"
+
+	"github.com/getsentry/sentry-go"
+)
+
+func TestServiceLevelObjective_Validate(t *testing.T) {
+	tests := []struct {
+		name      string
+		objective main.ServiceLevelObjective
+		wantErr   bool
+	}{
+		{
+			name: "availability",
+			objective: main.ServiceLevelObjective{
+				ID:                 "availability",
+				MonitorIDs:         []string{"monitor-1"},
+				AvailabilityTarget: 99.9,
+			},
+		},
+		{
+			name: "latency",
+			objective: main.ServiceLevelObjective{
+				ID:               "latency",
+				Groups:           []string{"web"},
+				Window:           "4w",
+				LatencyThreshold: 500,
+				LatencyTarget:    99,
+			},
+		},
+		{
+			name: "no target",
+			objective: main.ServiceLevelObjective{
+				ID:         "no-target",
+				MonitorIDs: []string{"monitor-1"},
+			},
+			wantErr: true,
+		},
+		{
+			name: "latency target without threshold",
+			objective: main.ServiceLevelObjective{
+				ID:            "latency",
+				MonitorIDs:    []string{"monitor-1"},
+				LatencyTarget: 99,
+			},
+			wantErr: true,
+		},
+		{
+			name: "short window longer than long window",
+			objective: main.ServiceLevelObjective{
+				ID:                 "burn-rate",
+				MonitorIDs:         []string{"monitor-1"},
+				AvailabilityTarget: 99,
+				BurnRateAlerts: []main.BurnRateAlert{
+					{BurnRate: 14.4, LongWindow: "1h", ShortWindow: "2h"},
+				},
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.objective.Validate()
+			if tt.wantErr {
+				testutils.AssertError(t, err, "Expected an invalid SLO")
+			} else {
+				testutils.AssertNoError(t, err, "Expected a valid SLO")
+			}
+		})
+	}
+}
+
+func TestSLOTracker_Evaluate(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	ctx = sentry.SetHubOnContext(ctx, sentry.CurrentHub())
+
+	writer := main.NewMonitorHistoricalWriter(database)
+	alerter := &MockAlerter{}
+	tracker, err := main.NewSLOTracker(main.SLOTrackerConfig{
+		Objectives: []main.ServiceLevelObjective{
+			{
+				ID:                 "checkout",
+				Name:               "Checkout",
+				MonitorIDs:         []string{"slo-monitor"},
+				AvailabilityTarget: 99,
+				LatencyThreshold:   500,
+				LatencyTarget:      90,
+				BurnRateAlerts: []main.BurnRateAlert{
+					{BurnRate: 14.4, LongWindow: "1h", ShortWindow: "5m"},
+				},
+			},
+		},
+		Monitors: []main.Monitor{{UniqueID: "slo-monitor", Name: "SLO Monitor"}},
+		Reader:   main.NewMonitorHistoricalReader(database),
+		Alerter:  alerter,
+	})
+	testutils.AssertNoError(t, err, "Failed to create SLO tracker")
+
+	// Half of the checks within the last 4 minutes failed, the successful ones are fast
+	now := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	for i := 0; i < 8; i++ {
+		status := main.MonitorStatusSuccess
+		if i%2 == 0 {
+			status = main.MonitorStatusFailure
+		}
+
+		err := writer.Write(ctx, main.MonitorHistorical{
+			MonitorID: "slo-monitor",
+			Status:    status,
+			Latency:   100,
+			Timestamp: now.Add(-time.Duration(i+1) * 30 * time.Second),
+		})
+		testutils.AssertNoError(t, err, "Failed to write test data")
+	}
+
+	err = tracker.Evaluate(ctx, now)
+	testutils.AssertNoError(t, err, "Failed to evaluate SLOs")
+
+	statuses := tracker.Statuses("slo-monitor")
+	testutils.AssertEqual(t, 2, len(statuses), "Expected a status for each objective")
+
+	availability := statuses[0]
+	testutils.AssertEqual(t, main.SLOObjectiveAvailability, availability.Objective, "Unexpected objective")
+	testutils.AssertEqual(t, int64(8), availability.TotalChecks, "Unexpected total checks")
+	testutils.AssertEqual(t, int64(4), availability.BadChecks, "Unexpected bad checks")
+	testutils.AssertEqual(t, 50.0, *availability.SLI, "Unexpected SLI")
+	testutils.AssertTrue(t, availability.ErrorBudgetRemaining < 0, "The error budget should be exhausted")
+	testutils.AssertTrue(t, availability.BurnRates[0].Firing, "The burn rate alert should fire")
+
+	latency := statuses[1]
+	testutils.AssertEqual(t, main.SLOObjectiveLatency, latency.Objective, "Unexpected objective")
+	testutils.AssertEqual(t, int64(0), latency.BadChecks, "Unexpected slow checks")
+	testutils.AssertEqual(t, 1.0, latency.ErrorBudgetRemaining, "The latency error budget should be untouched")
+	testutils.AssertFalse(t, latency.BurnRates[0].Firing, "The latency burn rate alert should not fire")
+
+	testutils.AssertEqual(t, 1, len(alerter.alertsSent), "Expected a single alert")
+	testutils.AssertFalse(t, alerter.alertsSent[0].Success, "Expected a firing alert")
+	testutils.AssertEqual(t, "SLO Monitor", alerter.alertsSent[0].MonitorName, "Unexpected monitor name")
+
+	// Evaluating again without any change should not alert again
+	err = tracker.Evaluate(ctx, now)
+	testutils.AssertNoError(t, err, "Failed to evaluate SLOs")
+	testutils.AssertEqual(t, 1, len(alerter.alertsSent), "Expected no additional alert")
+
+	// The failures are out of the short window 10 minutes later
+	err = tracker.Evaluate(ctx, now.Add(10*time.Minute))
+	testutils.AssertNoError(t, err, "Failed to evaluate SLOs")
+	testutils.AssertEqual(t, 2, len(alerter.alertsSent), "Expected a resolved alert")
+	testutils.AssertTrue(t, alerter.alertsSent[1].Success, "Expected a resolved alert")
+}
+
+func TestSLOTracker_EvaluatePastRawRetention(t *testing.T) {
+	ctx := sentry.SetHubOnContext(context.Background(), sentry.CurrentHub())
+	storage := main.NewMemoryStorage()
+
+	tracker, err := main.NewSLOTracker(main.SLOTrackerConfig{
+		Objectives: []main.ServiceLevelObjective{
+			{ID: "monthly", MonitorIDs: []string{"broken", "retained"}, Window: "30d", AvailabilityTarget: 99},
+		},
+		Reader: failingHistoricalReader{MemoryStorage: storage, monitorId: "broken"},
+	})
+	testutils.AssertNoError(t, err, "Failed to create SLO tracker")
+
+	// The raw data only covers the last hour, older checks are only left in the aggregates
+	now := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	for i := 0; i < 10; i++ {
+		err := storage.Write(ctx, main.MonitorHistorical{MonitorID: "retained", Status: main.MonitorStatusSuccess, Timestamp: now.Add(-time.Duration(i+1) * time.Minute)})
+		testutils.AssertNoError(t, err, "Failed to write test data")
+	}
+
+	err = storage.WriteHourly(ctx, main.MonitorHistorical{
+		MonitorID: "retained",
+		Status:    main.MonitorStatusSuccess,
+		Timestamp: now.Add(-3 * time.Hour),
+		Aggregate: &main.AggregateStatistics{CheckCount: 60, FailureCount: 15, UptimeRatio: 0.75, DominantStatus: main.MonitorStatusSuccess},
+	})
+	testutils.AssertNoError(t, err, "Failed to write test data")
+
+	err = storage.WriteDaily(ctx, main.MonitorHistorical{
+		MonitorID: "retained",
+		Status:    main.MonitorStatusSuccess,
+		Timestamp: time.Date(2025, 5, 20, 0, 0, 0, 0, time.UTC),
+		Aggregate: &main.AggregateStatistics{CheckCount: 1440, FailureCount: 144, UptimeRatio: 0.9, DominantStatus: main.MonitorStatusSuccess},
+	})
+	testutils.AssertNoError(t, err, "Failed to write test data")
+
+	err = tracker.Evaluate(ctx, now)
+	testutils.AssertError(t, err, "Expected the error of the broken monitor")
+
+	statuses := tracker.Statuses("retained")
+	testutils.AssertEqual(t, 1, len(statuses), "Expected the monitors after the broken one to be evaluated")
+	testutils.AssertEqual(t, int64(10+60+1440), statuses[0].TotalChecks, "Expected the aggregates past the raw retention to be counted")
+	testutils.AssertEqual(t, int64(15+144), statuses[0].BadChecks, "Unexpected bad checks")
+}
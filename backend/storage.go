@@ -0,0 +1,149 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// HistoricalReader reads the historical data of monitors.
+type HistoricalReader interface {
+	// ReadRawHistorical returns the raw historical data of a monitor, from the newest to the oldest.
+	// If limitResults is true, only the latest 100 entries are returned.
+	ReadRawHistorical(ctx context.Context, monitorId string, limitResults bool) ([]MonitorHistorical, error)
+	// ReadHourlyHistorical returns the hourly aggregates of a monitor, from the newest to the oldest.
+	ReadHourlyHistorical(ctx context.Context, monitorId string, limitResults bool) ([]MonitorHistorical, error)
+	// ReadDailyHistorical returns the daily aggregates of a monitor, from the newest to the oldest.
+	ReadDailyHistorical(ctx context.Context, monitorId string, limitResults bool) ([]MonitorHistorical, error)
+	// ReadRawLatest returns the latest raw historical data of a monitor. It returns an error wrapping
+	// sql.ErrNoRows if the monitor has no historical data.
+	ReadRawLatest(ctx context.Context, monitorId string) (MonitorHistorical, error)
+	ReadRawOldestTimestamp(ctx context.Context, monitorId string) (time.Time, bool, error)
+	ReadRawStatuses(ctx context.Context, monitorId string, from time.Time, to time.Time, fn func(timestamp time.Time, status MonitorStatus) error) error
+	// ReadAggregate aggregates the raw historical data of a monitor within [from, to) into buckets of the given interval.
+	ReadAggregate(ctx context.Context, monitorId string, interval AggregateInterval, from time.Time, to time.Time) ([]MonitorHistorical, error)
+	ReadSeries(ctx context.Context, monitorId string, from time.Time, to time.Time, step SeriesStep) ([]MonitorSeriesBucket, error)
+	ReadSLOCheckCounts(ctx context.Context, monitorId string, from time.Time, to time.Time, latencyThreshold int64) (SLOCheckCounts, error)
+}
+
+// retainedAggregate is a stored aggregate, along with the bucket it covers.
+type retainedAggregate struct {
+	from       time.Time
+	to         time.Time
+	historical MonitorHistorical
+}
+
+// readRetainedAggregates returns the stored aggregates of a monitor whose bucket is within [from, to), in
+// chronological order. These are the hourly aggregates, and the daily aggregates before the oldest of them.
+// It is meant for the time ranges whose raw historical data has expired.
+func readRetainedAggregates(ctx context.Context, reader HistoricalReader, monitorId string, from time.Time, to time.Time) ([]retainedAggregate, error) {
+	hourly, err := reader.ReadHourlyHistorical(ctx, monitorId, false)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read hourly aggregates: %w", err)
+	}
+
+	var aggregates []retainedAggregate
+	covered := to
+	for _, historical := range hourly {
+		start := historical.Timestamp.UTC()
+		end := AggregateIntervalHour.Next(start)
+		if start.Before(from) || end.After(to) {
+			continue
+		}
+
+		aggregates = append(aggregates, retainedAggregate{from: start, to: end, historical: historical})
+		if start.Before(covered) {
+			covered = start
+		}
+	}
+
+	if from.Before(covered) {
+		daily, err := reader.ReadDailyHistorical(ctx, monitorId, false)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read daily aggregates: %w", err)
+		}
+
+		for _, historical := range daily {
+			start := historical.Timestamp.UTC()
+			end := AggregateIntervalDay.Next(start)
+			if start.Before(from) || end.After(covered) {
+				continue
+			}
+
+			aggregates = append(aggregates, retainedAggregate{from: start, to: end, historical: historical})
+		}
+	}
+
+	sort.Slice(aggregates, func(i, j int) bool {
+		return aggregates[i].from.Before(aggregates[j].from)
+	})
+
+	return aggregates, nil
+}
+
+// HistoricalWriter writes the raw historical data and the aggregates of monitors.
+type HistoricalWriter interface {
+	RawHistoricalWriter
+	// WriteHourly writes an hourly aggregate, replacing the aggregate of the same monitor and timestamp.
+	WriteHourly(ctx context.Context, historical MonitorHistorical) error
+	// WriteDaily writes a daily aggregate, replacing the aggregate of the same monitor and timestamp.
+	WriteDaily(ctx context.Context, historical MonitorHistorical) error
+	DeleteAggregates(ctx context.Context, monitorId string, interval AggregateInterval, from time.Time, to time.Time) error
+}
+
+// IncidentStorage writes and reads incidents.
+type IncidentStorage interface {
+	// WriteIncident writes an incident. Incidents in the future are written as scheduled.
+	WriteIncident(ctx context.Context, incident Incident) error
+	// ReadRelatedIncidents returns the incidents of a monitor with the given title, from the newest to the oldest.
+	ReadRelatedIncidents(ctx context.Context, incidentTitle string, monitorID string) ([]Incident, error)
+	// ReadIncidentByTimestamp returns a single incident. It returns sql.ErrNoRows if there is no such incident.
+	ReadIncidentByTimestamp(ctx context.Context, incidentTitle string, monitorID string, timestamp time.Time) (Incident, error)
+}
+
+// RetentionStorage deletes the historical data that expired.
+type RetentionStorage interface {
+	// DeleteExpired deletes the historical data older than the retention period of its tier. Monitors in
+	// overrides use their own retention policy instead.
+	DeleteExpired(ctx context.Context, retention RetentionPolicy, overrides map[string]RetentionPolicy, now time.Time) error
+}
+
+// Storage holds everything Semyi persists. SQLStorage stores it in DuckDB, ClickHouse or PostgreSQL,
+// and MemoryStorage keeps it in memory, which is useful for tests.
+type Storage interface {
+	HistoricalReader
+	HistoricalWriter
+	IncidentStorage
+	RetentionStorage
+}
+
+// SQLStorage is the Storage of every SQL dialect, see Dialect. The dialect specific parts, such as the
+// materialized aggregates, are available through the embedded MonitorHistoricalWriter.
+type SQLStorage struct {
+	*MonitorHistoricalReader
+	*MonitorHistoricalWriter
+	*IncidentDataReader
+	*MonitorHistoricalCleaner
+
+	incidentWriter *IncidentWriter
+}
+
+var _ Storage = (*SQLStorage)(nil)
+
+// NewSQLStorage creates a new SQLStorage. If archive is not nil, the expiring raw data is archived before
+// it is deleted.
+func NewSQLStorage(db *sql.DB, archive *Archive) *SQLStorage {
+	return &SQLStorage{
+		MonitorHistoricalReader:  NewMonitorHistoricalReader(db),
+		MonitorHistoricalWriter:  NewMonitorHistoricalWriter(db),
+		IncidentDataReader:       NewIncidentDataReader(db),
+		MonitorHistoricalCleaner: NewMonitorHistoricalCleaner(db, archive),
+		incidentWriter:           NewIncidentWriter(db),
+	}
+}
+
+func (s *SQLStorage) WriteIncident(ctx context.Context, incident Incident) error {
+	return s.incidentWriter.Write(ctx, incident)
+}
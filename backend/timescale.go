@@ -0,0 +1,347 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/getsentry/sentry-go"
+	"github.com/rs/zerolog/log"
+)
+
+// continuousAggregates describes the TimescaleDB continuous aggregate behind each aggregate table. The refresh
+// policy only revisits recent buckets, so removing expired raw data does not empty the older aggregates.
+var continuousAggregates = []struct {
+	table          string
+	interval       AggregateInterval
+	bucket         string
+	startOffset    string
+	endOffset      string
+	scheduleEvery  string
+	continuousView string
+}{
+	{
+		table:          "monitor_historical_hourly_aggregate",
+		interval:       AggregateIntervalHour,
+		bucket:         "1 hour",
+		startOffset:    "6 hours",
+		endOffset:      "1 hour",
+		scheduleEvery:  "30 minutes",
+		continuousView: "monitor_historical_hourly_cagg",
+	},
+	{
+		table:          "monitor_historical_daily_aggregate",
+		interval:       AggregateIntervalDay,
+		bucket:         "1 day",
+		startOffset:    "2 days",
+		endOffset:      "1 day",
+		scheduleEvery:  "1 hour",
+		continuousView: "monitor_historical_daily_cagg",
+	},
+}
+
+// EnableTimescale turns the raw historical data into a TimescaleDB hypertable, if the extension is available
+// on the PostgreSQL server. On a database without any aggregate yet, the aggregate tables are replaced by views
+// over continuous aggregates, which TimescaleDB keeps up to date instead of the AggregateWorker. Existing
+// aggregates are left alone, since the continuous aggregates could only be rebuilt from the retained raw data.
+// It reports whether TimescaleDB is enabled, and does nothing on the other databases.
+func EnableTimescale(ctx context.Context, db *sql.DB) (bool, error) {
+	span := sentry.StartSpan(ctx, "function", sentry.WithDescription("EnableTimescale"))
+	ctx = span.Context()
+	defer span.Finish()
+
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return false, fmt.Errorf("failed to get connection: %w", err)
+	}
+	defer func() {
+		err := conn.Close()
+		if err != nil {
+			log.Warn().Err(err).Msg("failed to close connection")
+		}
+	}()
+
+	dialect, err := DetectDialect(ctx, conn)
+	if err != nil {
+		return false, err
+	}
+
+	if dialect != DialectPostgres {
+		return false, nil
+	}
+
+	var available bool
+	err = conn.QueryRowContext(ctx, "SELECT EXISTS (SELECT 1 FROM pg_available_extensions WHERE name = 'timescaledb')").Scan(&available)
+	if err != nil {
+		return false, fmt.Errorf("failed to read available extensions: %w", err)
+	}
+
+	if !available {
+		return false, nil
+	}
+
+	_, err = conn.ExecContext(ctx, "CREATE EXTENSION IF NOT EXISTS timescaledb")
+	if err != nil {
+		return false, fmt.Errorf("failed to create timescaledb extension: %w", err)
+	}
+
+	_, err = conn.ExecContext(ctx, "SELECT create_hypertable('monitor_historical', 'timestamp', chunk_time_interval => INTERVAL '7 days', if_not_exists => TRUE, migrate_data => TRUE)")
+	if err != nil {
+		return false, fmt.Errorf("failed to create hypertable: %w", err)
+	}
+
+	materialized, err := MaterializedAggregates(ctx, conn, dialect)
+	if err != nil {
+		return false, err
+	}
+
+	if materialized {
+		return true, nil
+	}
+
+	var hasAggregates bool
+	err = conn.QueryRowContext(ctx, "SELECT EXISTS (SELECT 1 FROM monitor_historical_hourly_aggregate) OR EXISTS (SELECT 1 FROM monitor_historical_daily_aggregate)").Scan(&hasAggregates)
+	if err != nil {
+		return false, fmt.Errorf("failed to check for existing aggregates: %w", err)
+	}
+
+	if hasAggregates {
+		log.Info().Msg("keeping the existing aggregate tables, continuous aggregates are only created on a database without aggregates")
+		return true, nil
+	}
+
+	for _, aggregate := range continuousAggregates {
+		// Continuous aggregates can not be created within a transaction
+		_, err = conn.ExecContext(ctx, continuousAggregateQuery(aggregate.continuousView, aggregate.bucket))
+		if err != nil {
+			return false, fmt.Errorf("failed to create continuous aggregate %s: %w", aggregate.continuousView, err)
+		}
+
+		err = replaceAggregateTable(ctx, conn, aggregate.table, aggregate.continuousView)
+		if err != nil {
+			return false, err
+		}
+
+		_, err = conn.ExecContext(ctx, fmt.Sprintf(
+			"SELECT add_continuous_aggregate_policy('%s', start_offset => INTERVAL '%s', end_offset => INTERVAL '%s', schedule_interval => INTERVAL '%s', if_not_exists => TRUE)",
+			aggregate.continuousView,
+			aggregate.startOffset,
+			aggregate.endOffset,
+			aggregate.scheduleEvery,
+		))
+		if err != nil {
+			return false, fmt.Errorf("failed to add refresh policy of %s: %w", aggregate.continuousView, err)
+		}
+
+		// Fold the raw data that was written before the continuous aggregate existed
+		_, err = conn.ExecContext(ctx, fmt.Sprintf("CALL refresh_continuous_aggregate('%s', NULL, NULL)", aggregate.continuousView))
+		if err != nil {
+			return false, fmt.Errorf("failed to refresh continuous aggregate %s: %w", aggregate.continuousView, err)
+		}
+
+		log.Info().Str("table", aggregate.table).Str("continuous_aggregate", aggregate.continuousView).Msg("replaced aggregate table with a continuous aggregate")
+	}
+
+	return true, nil
+}
+
+// replaceAggregateTable drops the empty aggregate table, and creates a view of the same name and columns over
+// the continuous aggregate, so the readers do not need to know about TimescaleDB.
+func replaceAggregateTable(ctx context.Context, conn *sql.Conn, table string, continuousView string) error {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+
+	for _, statement := range []string{
+		"DROP TABLE " + table,
+		fmt.Sprintf("CREATE VIEW %s AS %s", table, continuousAggregateViewQuery(continuousView)),
+	} {
+		_, err = tx.ExecContext(ctx, statement)
+		if err != nil {
+			if rollbackErr := tx.Rollback(); rollbackErr != nil {
+				log.Error().Err(rollbackErr).Msg("failed to rollback transaction")
+			}
+			return fmt.Errorf("failed to replace %s: %w", table, err)
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return nil
+}
+
+// disableContinuousAggregates turns the views over the continuous aggregates back into plain aggregate tables,
+// with the aggregates they hold, and drops the continuous aggregates. The generic migrations can only be
+// reverted on plain tables.
+func disableContinuousAggregates(ctx context.Context, conn *sql.Conn) error {
+	materialized, err := MaterializedAggregates(ctx, conn, DialectPostgres)
+	if err != nil {
+		return err
+	}
+
+	if !materialized {
+		return nil
+	}
+
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+
+	for _, aggregate := range continuousAggregates {
+		for _, statement := range []string{
+			fmt.Sprintf("ALTER VIEW %s RENAME TO %s_materialized", aggregate.table, aggregate.table),
+			fmt.Sprintf("CREATE TABLE %s AS SELECT * FROM %s_materialized", aggregate.table, aggregate.table),
+			fmt.Sprintf("ALTER TABLE %s ADD PRIMARY KEY (monitor_id, timestamp)", aggregate.table),
+			fmt.Sprintf("DROP VIEW %s_materialized", aggregate.table),
+			fmt.Sprintf("DROP MATERIALIZED VIEW %s", aggregate.continuousView),
+		} {
+			_, err = tx.ExecContext(ctx, statement)
+			if err != nil {
+				if rollbackErr := tx.Rollback(); rollbackErr != nil {
+					log.Error().Err(rollbackErr).Msg("failed to rollback transaction")
+				}
+				return fmt.Errorf("failed to restore %s: %w", aggregate.table, err)
+			}
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	log.Info().Msg("replaced continuous aggregates with aggregate tables")
+	return nil
+}
+
+// continuousAggregateQuery returns the DDL of a continuous aggregate that folds the raw historical data into
+// buckets of the given size. It computes the same statistics as MonitorHistoricalReader.ReadAggregate.
+func continuousAggregateQuery(name string, bucket string) string {
+	latest := func(column string, condition string) string {
+		filter := column + " IS NOT NULL"
+		if condition != "" {
+			filter += " AND " + condition
+		}
+
+		return fmt.Sprintf("last(%s, timestamp) FILTER (WHERE %s) AS %s", column, filter, column)
+	}
+
+	return fmt.Sprintf(
+		`CREATE MATERIALIZED VIEW IF NOT EXISTS %s
+		WITH (timescaledb.continuous, timescaledb.materialized_only = false) AS
+		SELECT
+			monitor_id,
+			time_bucket(INTERVAL '%s', timestamp) AS bucket,
+			COUNT(*) FILTER (WHERE status = %d) AS success_count,
+			COUNT(*) FILTER (WHERE status = %d) AS failure_count,
+			COUNT(*) FILTER (WHERE status = %d) AS degraded_count,
+			COUNT(*) FILTER (WHERE status = %d) AS maintenance_count,
+			COUNT(*) FILTER (WHERE status = %d) AS limited_count,
+			AVG(latency) AS latency_avg,
+			MIN(latency) AS latency_min,
+			MAX(latency) AS latency_max,
+			percentile_cont(0.5) WITHIN GROUP (ORDER BY latency) AS latency_p50,
+			percentile_cont(0.95) WITHIN GROUP (ORDER BY latency) AS latency_p95,
+			percentile_cont(0.99) WITHIN GROUP (ORDER BY latency) AS latency_p99,
+			%s,
+			MAX(timestamp) AS last_checked_at
+		FROM
+			monitor_historical
+		GROUP BY
+			monitor_id,
+			time_bucket(INTERVAL '%s', timestamp)
+		WITH NO DATA`,
+		name,
+		bucket,
+		MonitorStatusSuccess,
+		MonitorStatusFailure,
+		MonitorStatusDegradedPerformance,
+		MonitorStatusUnderMaintenance,
+		MonitorStatusLimitedAvailability,
+		strings.Join([]string{
+			// Additional message is only relevant when the check was not successful
+			latest("additional_message", fmt.Sprintf("status <> %d", MonitorStatusSuccess)),
+			latest("http_protocol", ""),
+			latest("tls_version", ""),
+			latest("tls_cipher", ""),
+			latest("tls_expiry", ""),
+		}, ",\n\t\t\t"),
+		bucket,
+	)
+}
+
+// continuousAggregateViewQuery returns the query of the view that exposes a continuous aggregate with the
+// columns of the aggregate tables, in the same order. The worst and dominant status follow
+// NewAggregateStatistics: the dominant status is the most frequent status besides maintenance, and ties go
+// to the more severe status.
+func continuousAggregateViewQuery(continuousView string) string {
+	return fmt.Sprintf(
+		`SELECT
+			bucket AS timestamp,
+			monitor_id,
+			CAST(%[2]s AS SMALLINT) AS status,
+			CAST(ROUND(latency_avg) AS INTEGER) AS latency,
+			last_checked_at AS created_at,
+			additional_message,
+			http_protocol,
+			tls_version,
+			tls_cipher,
+			tls_expiry,
+			CAST(check_count AS INTEGER) AS check_count,
+			CAST(failure_count AS INTEGER) AS failure_count,
+			CASE
+				WHEN check_count > maintenance_count
+				THEN CAST(check_count - maintenance_count - failure_count AS DOUBLE PRECISION) / (check_count - maintenance_count)
+				ELSE 1
+			END AS uptime_ratio,
+			latency_min,
+			latency_max,
+			CAST(ROUND(latency_p50) AS INTEGER) AS latency_p50,
+			CAST(ROUND(latency_p95) AS INTEGER) AS latency_p95,
+			CAST(ROUND(latency_p99) AS INTEGER) AS latency_p99,
+			CAST(%[3]s AS SMALLINT) AS worst_status,
+			CAST(%[2]s AS SMALLINT) AS dominant_status
+		FROM (
+			SELECT
+				*,
+				success_count + failure_count + degraded_count + maintenance_count + limited_count AS check_count
+			FROM
+				%[1]s
+		) AS aggregate`,
+		continuousView,
+		fmt.Sprintf(
+			`CASE
+				WHEN failure_count > 0 AND failure_count >= limited_count AND failure_count >= degraded_count AND failure_count >= success_count THEN %d
+				WHEN limited_count > 0 AND limited_count > failure_count AND limited_count >= degraded_count AND limited_count >= success_count THEN %d
+				WHEN degraded_count > 0 AND degraded_count > failure_count AND degraded_count > limited_count AND degraded_count >= success_count THEN %d
+				WHEN success_count > 0 THEN %d
+				ELSE %d
+			END`,
+			MonitorStatusFailure,
+			MonitorStatusLimitedAvailability,
+			MonitorStatusDegradedPerformance,
+			MonitorStatusSuccess,
+			MonitorStatusUnderMaintenance,
+		),
+		fmt.Sprintf(
+			`CASE
+				WHEN failure_count > 0 THEN %d
+				WHEN limited_count > 0 THEN %d
+				WHEN degraded_count > 0 THEN %d
+				WHEN success_count > 0 THEN %d
+				ELSE %d
+			END`,
+			MonitorStatusFailure,
+			MonitorStatusLimitedAvailability,
+			MonitorStatusDegradedPerformance,
+			MonitorStatusSuccess,
+			MonitorStatusUnderMaintenance,
+		),
+	)
+}
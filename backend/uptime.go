@@ -0,0 +1,370 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/getsentry/sentry-go"
+)
+
+// uptimeWindows are the rolling windows of an uptime summary, ending at the time of the calculation.
+var uptimeWindows = []struct {
+	label    string
+	duration time.Duration
+}{
+	{label: "24h", duration: 24 * time.Hour},
+	{label: "7d", duration: 7 * 24 * time.Hour},
+	{label: "30d", duration: 30 * 24 * time.Hour},
+	{label: "90d", duration: 90 * 24 * time.Hour},
+}
+
+const (
+	// uptimeCalendarMonths is the number of calendar months in an uptime summary, including the current month.
+	uptimeCalendarMonths = 12
+	// uptimeCalendarDays is the number of days in the uptime calendar, including today.
+	uptimeCalendarDays = 365
+)
+
+// UptimeReport summarizes the availability of a monitor within [From, To). Every check is assumed to hold
+// until the next check. Maintenance, either recorded as such or within a configured maintenance window,
+// is excluded.
+type UptimeReport struct {
+	// Label is the window (e.g. "24h", "30d") or the calendar month (e.g. "2025-04").
+	Label string    `json:"label"`
+	From  time.Time `json:"from"`
+	To    time.Time `json:"to"`
+	// UptimePercentage is null if no check covers the range.
+	UptimePercentage *float64 `json:"uptime_percentage"`
+	// TrackedSeconds is the time covered by checks, excluding maintenance.
+	TrackedSeconds  int64 `json:"tracked_seconds"`
+	DowntimeSeconds int64 `json:"downtime_seconds"`
+	// Outages is the number of consecutive failure periods that overlap with the range.
+	Outages int `json:"outages"`
+	// MTTRSeconds is the mean time to recovery. It is null if there is no outage.
+	MTTRSeconds *int64 `json:"mttr_seconds"`
+	// MTBFSeconds is the mean time between failures. It is null if there is no outage.
+	MTBFSeconds *int64 `json:"mtbf_seconds"`
+}
+
+// UptimeCalendarDay is the availability of a monitor for a single day, in UTC.
+type UptimeCalendarDay struct {
+	// Date is formatted as YYYY-MM-DD.
+	Date string `json:"date"`
+	// UptimePercentage is null if no check covers the day.
+	UptimePercentage *float64 `json:"uptime_percentage"`
+	DowntimeSeconds  int64    `json:"downtime_seconds"`
+	Outages          int      `json:"outages"`
+}
+
+// UptimeSummary holds the uptime reports of a monitor.
+type UptimeSummary struct {
+	Windows  []UptimeReport      `json:"windows"`
+	Months   []UptimeReport      `json:"months"`
+	Calendar []UptimeCalendarDay `json:"calendar"`
+}
+
+// UptimeCalculator computes uptime reports from the raw historical data. The part of a report that is past
+// the raw retention is computed from the hourly aggregates, and from the daily aggregates past those.
+type UptimeCalculator struct {
+	reader      HistoricalReader
+	maintenance *MaintenanceSchedule
+}
+
+func NewUptimeCalculator(reader HistoricalReader, maintenance *MaintenanceSchedule) *UptimeCalculator {
+	return &UptimeCalculator{
+		reader:      reader,
+		maintenance: maintenance,
+	}
+}
+
+// Calculate computes the rolling windows, the calendar months, and the daily calendar of a monitor up to now.
+// Every report is computed from a single pass over the aggregates before the oldest raw historical data,
+// followed by the raw historical data.
+func (c *UptimeCalculator) Calculate(ctx context.Context, monitorId string, now time.Time) (UptimeSummary, error) {
+	span := sentry.StartSpan(ctx, "function", sentry.WithDescription("UptimeCalculator.Calculate"))
+	span.SetData("semyi.monitor.id", monitorId)
+	ctx = span.Context()
+	defer span.Finish()
+
+	now = now.UTC()
+
+	windows := make([]*uptimeAccumulator, len(uptimeWindows))
+	from := now
+	for i, window := range uptimeWindows {
+		windows[i] = &uptimeAccumulator{from: now.Add(-window.duration), to: now}
+		if windows[i].from.Before(from) {
+			from = windows[i].from
+		}
+	}
+
+	months := make(uptimeSeries, uptimeCalendarMonths)
+	start := AggregateIntervalMonth.Truncate(now).AddDate(0, -(uptimeCalendarMonths - 1), 0)
+	for i := range months {
+		months[i] = &uptimeAccumulator{from: start, to: AggregateIntervalMonth.Next(start)}
+		start = months[i].to
+	}
+	if months[0].from.Before(from) {
+		from = months[0].from
+	}
+
+	days := make(uptimeSeries, uptimeCalendarDays)
+	start = AggregateIntervalDay.Truncate(now).AddDate(0, 0, -(uptimeCalendarDays - 1))
+	for i := range days {
+		days[i] = &uptimeAccumulator{from: start, to: AggregateIntervalDay.Next(start)}
+		start = days[i].to
+	}
+	if days[0].from.Before(from) {
+		from = days[0].from
+	}
+
+	excluded := c.maintenanceRanges(monitorId, from, now)
+
+	var pieces []timeRange
+	record := func(start time.Time, end time.Time, status MonitorStatus) {
+		pieces = pieces[:0]
+		if status != MonitorStatusUnderMaintenance {
+			pieces = excluded.subtract(start, end, pieces)
+		}
+
+		for _, window := range windows {
+			window.add(pieces, status)
+		}
+		months.add(start, end, pieces, status)
+		days.add(start, end, pieces, status)
+	}
+
+	oldest, found, err := c.reader.ReadRawOldestTimestamp(ctx, monitorId)
+	if err != nil {
+		return UptimeSummary{}, fmt.Errorf("failed to read oldest raw timestamp: %w", err)
+	}
+
+	if !found {
+		oldest = now
+	}
+
+	if from.Before(oldest) {
+		segments, err := c.aggregateSegments(ctx, monitorId, from, AggregateIntervalHour.Truncate(oldest.UTC()))
+		if err != nil {
+			return UptimeSummary{}, err
+		}
+
+		for _, segment := range segments {
+			record(segment.start, segment.end, segment.status)
+		}
+	}
+
+	var previousTimestamp time.Time
+	var previousStatus MonitorStatus
+	err = c.reader.ReadRawStatuses(ctx, monitorId, from, now, func(timestamp time.Time, status MonitorStatus) error {
+		timestamp = timestamp.UTC()
+		if !previousTimestamp.IsZero() {
+			record(previousTimestamp, timestamp, previousStatus)
+		}
+
+		previousTimestamp = timestamp
+		previousStatus = status
+		return nil
+	})
+	if err != nil {
+		return UptimeSummary{}, fmt.Errorf("failed to read raw statuses: %w", err)
+	}
+
+	// The latest check holds until now
+	if !previousTimestamp.IsZero() {
+		record(previousTimestamp, now, previousStatus)
+	}
+
+	var summary UptimeSummary
+	for i, window := range windows {
+		summary.Windows = append(summary.Windows, window.report(uptimeWindows[i].label))
+	}
+
+	for _, month := range months {
+		summary.Months = append(summary.Months, month.report(month.from.Format("2006-01")))
+	}
+
+	for _, day := range days {
+		report := day.report(day.from.Format(time.DateOnly))
+		summary.Calendar = append(summary.Calendar, UptimeCalendarDay{
+			Date:             report.Label,
+			UptimePercentage: report.UptimePercentage,
+			DowntimeSeconds:  report.DowntimeSeconds,
+			Outages:          report.Outages,
+		})
+	}
+
+	return summary, nil
+}
+
+// uptimeSegment is a period with a single status, made up from an aggregate.
+type uptimeSegment struct {
+	start  time.Time
+	end    time.Time
+	status MonitorStatus
+}
+
+// aggregateSegments turns the aggregates within [from, to) into segments, in chronological order. The checks
+// of a bucket are not stored, so its failing share is assumed to be a single failure at the start of the bucket.
+// Consecutive buckets only count as a single outage if they failed entirely.
+func (c *UptimeCalculator) aggregateSegments(ctx context.Context, monitorId string, from time.Time, to time.Time) ([]uptimeSegment, error) {
+	aggregates, err := readRetainedAggregates(ctx, c.reader, monitorId, from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	var segments []uptimeSegment
+	for _, aggregate := range aggregates {
+		segments = appendAggregateSegments(segments, aggregate.from, aggregate.to, aggregate.historical)
+	}
+
+	return segments, nil
+}
+
+// appendAggregateSegments appends the segments of a single aggregate that covers [start, end).
+func appendAggregateSegments(segments []uptimeSegment, start time.Time, end time.Time, aggregate MonitorHistorical) []uptimeSegment {
+	// Aggregates without statistics only have the status of the bucket
+	if aggregate.Aggregate == nil || aggregate.Aggregate.DominantStatus == MonitorStatusUnderMaintenance {
+		return append(segments, uptimeSegment{start: start, end: end, status: aggregate.Status})
+	}
+
+	if aggregate.Aggregate.CheckCount == 0 {
+		return segments
+	}
+
+	failing := time.Duration((1 - aggregate.Aggregate.UptimeRatio) * float64(end.Sub(start))).Truncate(time.Second)
+	if failing > 0 {
+		segments = append(segments, uptimeSegment{start: start, end: start.Add(failing), status: MonitorStatusFailure})
+	}
+
+	if start.Add(failing).Before(end) {
+		segments = append(segments, uptimeSegment{start: start.Add(failing), end: end, status: MonitorStatusSuccess})
+	}
+
+	return segments
+}
+
+// maintenanceRanges returns the configured maintenance occurrences of a monitor within [from, to),
+// sorted and merged, so they never overlap.
+func (c *UptimeCalculator) maintenanceRanges(monitorId string, from time.Time, to time.Time) timeRanges {
+	var ranges timeRanges
+	for _, occurrence := range c.maintenance.Occurrences(monitorId, from, to) {
+		if last := len(ranges) - 1; last >= 0 && !occurrence.Start.After(ranges[last].end) {
+			if occurrence.End.After(ranges[last].end) {
+				ranges[last].end = occurrence.End
+			}
+			continue
+		}
+
+		ranges = append(ranges, timeRange{start: occurrence.Start, end: occurrence.End})
+	}
+
+	return ranges
+}
+
+type timeRange struct {
+	start time.Time
+	end   time.Time
+}
+
+// timeRanges is a sorted list of time ranges that do not overlap.
+type timeRanges []timeRange
+
+// subtract appends the parts of [start, end) that are not covered by any of the time ranges to pieces.
+func (r timeRanges) subtract(start time.Time, end time.Time, pieces []timeRange) []timeRange {
+	i := sort.Search(len(r), func(i int) bool {
+		return r[i].end.After(start)
+	})
+
+	for ; i < len(r) && r[i].start.Before(end); i++ {
+		if r[i].start.After(start) {
+			pieces = append(pieces, timeRange{start: start, end: r[i].start})
+		}
+		start = r[i].end
+	}
+
+	if start.Before(end) {
+		pieces = append(pieces, timeRange{start: start, end: end})
+	}
+
+	return pieces
+}
+
+// uptimeAccumulator accumulates the checks that fall within [from, to).
+type uptimeAccumulator struct {
+	from     time.Time
+	to       time.Time
+	tracked  time.Duration
+	downtime time.Duration
+	outages  int
+	inOutage bool
+}
+
+// add accumulates the pieces of a single check that are not under maintenance, in chronological order.
+func (a *uptimeAccumulator) add(pieces []timeRange, status MonitorStatus) {
+	for _, piece := range pieces {
+		start, end := piece.start, piece.end
+		if start.Before(a.from) {
+			start = a.from
+		}
+		if end.After(a.to) {
+			end = a.to
+		}
+		if !start.Before(end) {
+			continue
+		}
+
+		duration := end.Sub(start)
+		a.tracked += duration
+		if status != MonitorStatusFailure {
+			a.inOutage = false
+			continue
+		}
+
+		a.downtime += duration
+		if !a.inOutage {
+			a.outages++
+			a.inOutage = true
+		}
+	}
+}
+
+func (a *uptimeAccumulator) report(label string) UptimeReport {
+	report := UptimeReport{
+		Label:           label,
+		From:            a.from,
+		To:              a.to,
+		TrackedSeconds:  int64(a.tracked / time.Second),
+		DowntimeSeconds: int64(a.downtime / time.Second),
+		Outages:         a.outages,
+	}
+
+	if a.tracked > 0 {
+		uptimePercentage := float64(a.tracked-a.downtime) / float64(a.tracked) * 100
+		report.UptimePercentage = &uptimePercentage
+	}
+
+	if a.outages > 0 {
+		mttr := int64(a.downtime / time.Duration(a.outages) / time.Second)
+		mtbf := int64((a.tracked - a.downtime) / time.Duration(a.outages) / time.Second)
+		report.MTTRSeconds = &mttr
+		report.MTBFSeconds = &mtbf
+	}
+
+	return report
+}
+
+// uptimeSeries is a list of adjacent accumulators, sorted by their start.
+type uptimeSeries []*uptimeAccumulator
+
+// add accumulates a single check that covers [start, end) into every accumulator it overlaps with.
+func (s uptimeSeries) add(start time.Time, end time.Time, pieces []timeRange, status MonitorStatus) {
+	i := sort.Search(len(s), func(i int) bool {
+		return s[i].to.After(start)
+	})
+
+	for ; i < len(s) && s[i].from.Before(end); i++ {
+		s[i].add(pieces, status)
+	}
+}
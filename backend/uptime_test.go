@@ -0,0 +1,140 @@
+package main_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	main "semyi"
+	"semyi/testutils"
+
+	"github.com/getsentry/sentry-go"
+)
+
+func TestUptimeCalculator_Calculate(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	ctx = sentry.SetHubOnContext(ctx, sentry.CurrentHub())
+
+	writer := main.NewMonitorHistoricalWriter(database)
+	reader := main.NewMonitorHistoricalReader(database)
+
+	now := time.Date(2025, 5, 10, 12, 0, 0, 0, time.UTC)
+	checks := []struct {
+		offset time.Duration
+		status main.MonitorStatus
+	}{
+		{offset: -120 * time.Minute, status: main.MonitorStatusSuccess},
+		{offset: -90 * time.Minute, status: main.MonitorStatusFailure},
+		{offset: -80 * time.Minute, status: main.MonitorStatusFailure},
+		{offset: -60 * time.Minute, status: main.MonitorStatusSuccess},
+		{offset: -40 * time.Minute, status: main.MonitorStatusUnderMaintenance},
+		{offset: -20 * time.Minute, status: main.MonitorStatusSuccess},
+	}
+	for _, check := range checks {
+		err := writer.Write(ctx, main.MonitorHistorical{
+			MonitorID: "uptime-monitor",
+			Status:    check.status,
+			Latency:   100,
+			Timestamp: now.Add(check.offset),
+		})
+		testutils.AssertNoError(t, err, "Failed to write test data")
+	}
+
+	t.Run("recorded maintenance", func(t *testing.T) {
+		summary, err := main.NewUptimeCalculator(reader, nil).Calculate(ctx, "uptime-monitor", now)
+		testutils.AssertNoError(t, err, "Failed to calculate uptime")
+		testutils.AssertEqual(t, 4, len(summary.Windows), "Expected every rolling window")
+		testutils.AssertEqual(t, 12, len(summary.Months), "Expected twelve calendar months")
+		testutils.AssertEqual(t, 365, len(summary.Calendar), "Expected a year of days")
+
+		day := summary.Windows[0]
+		testutils.AssertEqual(t, "24h", day.Label, "Unexpected window")
+		testutils.AssertEqual(t, int64(100*60), day.TrackedSeconds, "Recorded maintenance should be excluded")
+		testutils.AssertEqual(t, int64(30*60), day.DowntimeSeconds, "Unexpected downtime")
+		testutils.AssertEqual(t, 1, day.Outages, "Consecutive failures should be a single outage")
+		testutils.AssertNotNil(t, day.UptimePercentage, "Expected an uptime percentage")
+		testutils.AssertEqual(t, 70.0, *day.UptimePercentage, "Unexpected uptime percentage")
+		testutils.AssertEqual(t, int64(30*60), *day.MTTRSeconds, "Unexpected MTTR")
+		testutils.AssertEqual(t, int64(70*60), *day.MTBFSeconds, "Unexpected MTBF")
+
+		month := summary.Months[len(summary.Months)-1]
+		testutils.AssertEqual(t, "2025-05", month.Label, "Unexpected month")
+		testutils.AssertEqual(t, int64(30*60), month.DowntimeSeconds, "Unexpected downtime")
+
+		calendarDay := summary.Calendar[len(summary.Calendar)-1]
+		testutils.AssertEqual(t, "2025-05-10", calendarDay.Date, "Unexpected date")
+		testutils.AssertEqual(t, 70.0, *calendarDay.UptimePercentage, "Unexpected uptime percentage")
+		testutils.AssertTrue(t, summary.Calendar[0].UptimePercentage == nil, "Days without checks should have no uptime")
+	})
+
+	t.Run("configured maintenance", func(t *testing.T) {
+		schedule, err := main.NewMaintenanceSchedule([]main.MaintenanceWindow{
+			{
+				ID:         "database-upgrade",
+				MonitorIDs: []string{"uptime-monitor"},
+				Start:      now.Add(-90 * time.Minute),
+				End:        now.Add(-85 * time.Minute),
+			},
+		}, nil)
+		testutils.AssertNoError(t, err, "Failed to create maintenance schedule")
+
+		summary, err := main.NewUptimeCalculator(reader, schedule).Calculate(ctx, "uptime-monitor", now)
+		testutils.AssertNoError(t, err, "Failed to calculate uptime")
+
+		day := summary.Windows[0]
+		testutils.AssertEqual(t, int64(95*60), day.TrackedSeconds, "Configured maintenance should be excluded")
+		testutils.AssertEqual(t, int64(25*60), day.DowntimeSeconds, "Configured maintenance should not count as downtime")
+		testutils.AssertEqual(t, 1, day.Outages, "Unexpected number of outages")
+	})
+}
+
+func TestUptimeCalculator_CalculatePastRawRetention(t *testing.T) {
+	ctx := sentry.SetHubOnContext(context.Background(), sentry.CurrentHub())
+	storage := main.NewMemoryStorage()
+
+	now := time.Date(2025, 5, 10, 12, 0, 0, 0, time.UTC)
+
+	// The raw data only covers the last hour, older checks are only left in the aggregates
+	err := storage.Write(ctx, main.MonitorHistorical{MonitorID: "retained-monitor", Status: main.MonitorStatusSuccess, Timestamp: now.Add(-time.Hour)})
+	testutils.AssertNoError(t, err, "Failed to write test data")
+
+	hours := []struct {
+		offset time.Duration
+		ratio  float64
+	}{
+		{offset: -4 * time.Hour, ratio: 1},
+		{offset: -3 * time.Hour, ratio: 0.5},
+		{offset: -2 * time.Hour, ratio: 1},
+	}
+	for _, hour := range hours {
+		err := storage.WriteHourly(ctx, main.MonitorHistorical{
+			MonitorID: "retained-monitor",
+			Status:    main.MonitorStatusSuccess,
+			Timestamp: now.Add(hour.offset),
+			Aggregate: &main.AggregateStatistics{CheckCount: 60, UptimeRatio: hour.ratio, DominantStatus: main.MonitorStatusSuccess},
+		})
+		testutils.AssertNoError(t, err, "Failed to write test data")
+	}
+
+	// The hourly aggregates of older days have expired as well
+	err = storage.WriteDaily(ctx, main.MonitorHistorical{
+		MonitorID: "retained-monitor",
+		Status:    main.MonitorStatusFailure,
+		Timestamp: time.Date(2025, 5, 1, 0, 0, 0, 0, time.UTC),
+		Aggregate: &main.AggregateStatistics{CheckCount: 1440, UptimeRatio: 0.75, DominantStatus: main.MonitorStatusSuccess},
+	})
+	testutils.AssertNoError(t, err, "Failed to write test data")
+
+	summary, err := main.NewUptimeCalculator(storage, nil).Calculate(ctx, "retained-monitor", now)
+	testutils.AssertNoError(t, err, "Failed to calculate uptime")
+
+	day := summary.Windows[0]
+	testutils.AssertEqual(t, int64(4*60*60), day.TrackedSeconds, "Expected the hourly aggregates and the raw data to be tracked")
+	testutils.AssertEqual(t, int64(30*60), day.DowntimeSeconds, "Expected the failing share of the hourly aggregate")
+	testutils.AssertEqual(t, 1, day.Outages, "Unexpected number of outages")
+
+	month := summary.Months[len(summary.Months)-1]
+	testutils.AssertEqual(t, int64(28*60*60), month.TrackedSeconds, "Expected the daily aggregate to be tracked")
+	testutils.AssertEqual(t, int64(6*60*60+30*60), month.DowntimeSeconds, "Expected the failing share of the daily aggregate")
+}
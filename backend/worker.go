@@ -4,6 +4,7 @@ import (
 	"context"
 	"crypto/tls"
 	"crypto/x509"
+	"database/sql"
 	"errors"
 	"fmt"
 	"net"
@@ -37,7 +38,7 @@ type Response struct {
 type Worker struct {
 	monitor                   Monitor
 	processor                 *Processor
-	historicalReader          *MonitorHistoricalReader
+	historicalReader          HistoricalReader
 	enableDumpFailureResponse bool
 }
 
@@ -69,11 +70,18 @@ func NewWorker(monitor Monitor, processor *Processor, enableDumpFailureResponse
 		monitor.IcmpPacketSize = 56
 	}
 
-	return &Worker{
+	worker := &Worker{
 		monitor:                   monitor,
 		processor:                 processor,
 		enableDumpFailureResponse: enableDumpFailureResponse,
-	}, nil
+	}
+
+	// Pull monitors read the latest data that was pushed to find out whether the monitor is stale
+	if processor != nil {
+		worker.historicalReader = processor.HistoricalReader
+	}
+
+	return worker, nil
 }
 
 func (w *Worker) Run() {
@@ -144,10 +152,36 @@ func (w *Worker) Run() {
 		}
 
 		// Sleep for the interval
-		log.Debug().Str("monitor_id", w.monitor.UniqueID).Msgf("sleeping for %d seconds", w.monitor.Interval)
+		interval := w.nextInterval(response)
+		log.Debug().Str("monitor_id", w.monitor.UniqueID).Msgf("sleeping for %d seconds", interval)
 		span.Finish()
-		time.Sleep(time.Duration(w.monitor.Interval) * time.Second)
+		time.Sleep(time.Duration(interval) * time.Second)
+	}
+}
+
+// nextInterval returns the retry interval (in seconds) while the latest check result differs from the
+// confirmed state, so a suspected state change is confirmed or dismissed sooner. Otherwise, it returns
+// the regular interval.
+func (w *Worker) nextInterval(response Response) int {
+	if w.monitor.Type == MonitorTypePull || w.monitor.RetryInterval <= 0 || w.processor == nil || w.processor.States == nil {
+		return w.monitor.Interval
+	}
+
+	status := MonitorStatusFailure
+	if response.Success {
+		status = MonitorStatusSuccess
+	}
+
+	if w.processor.Maintenance.IsUnderMaintenance(w.monitor.UniqueID, response.Timestamp) {
+		status = MonitorStatusUnderMaintenance
+	}
+
+	// The response is processed concurrently, so the state store may not have observed it yet
+	if w.processor.States.Suspect(w.monitor.UniqueID, status, response.Timestamp) {
+		return w.monitor.RetryInterval
 	}
+
+	return w.monitor.Interval
 }
 
 func (w *Worker) parseExpectedStatusCode(got int) bool {
@@ -401,8 +435,13 @@ func (w *Worker) backfillPullHealthcheck(ctx context.Context) (Response, error)
 	ctx = span.Context()
 	defer span.Finish()
 
+	if w.historicalReader == nil {
+		return Response{}, fmt.Errorf("pull monitors require a historical reader")
+	}
+
+	// A monitor that never received any data is as stale as one that stopped receiving data
 	historical, err := w.historicalReader.ReadRawLatest(ctx, w.monitor.UniqueID)
-	if err != nil {
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
 		return Response{}, fmt.Errorf("failed to read historical data: %w", err)
 	}
 